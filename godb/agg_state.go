@@ -1,5 +1,7 @@
 package godb
 
+import "math"
+
 // interface for an aggregation state
 type AggState interface {
 	// Initializes an aggregation state. Is supplied with an alias, an expr to
@@ -20,7 +22,8 @@ type AggState interface {
 	GetTupleDesc() *TupleDesc
 }
 
-// Implements the aggregation state for COUNT
+// Implements the aggregation state for COUNT, which counts the tuples for
+// which expr is not NULL
 type CountAggState struct {
 	alias string
 	expr  Expr
@@ -39,6 +42,9 @@ func (a *CountAggState) Init(alias string, expr Expr) error {
 }
 
 func (a *CountAggState) AddTuple(t *Tuple) {
+	if v, err := a.expr.EvalExpr(t); err == nil && isNull(v) {
+		return
+	}
 	a.count++
 }
 
@@ -59,14 +65,18 @@ func (a *CountAggState) GetTupleDesc() *TupleDesc {
 }
 
 // Implements the aggregation state for SUM
+// The sum of an int expression is an int, and the sum of a float expression is
+// a float
 type SumAggState struct {
 	alias string
 	expr  Expr
 	sum   int64
+	fsum  floatSum
+	null  bool // whether all of the values added so far were NULL
 }
 
 func (a *SumAggState) Copy() AggState {
-	return &SumAggState{a.alias, a.expr, a.sum}
+	return &SumAggState{a.alias, a.expr, a.sum, a.fsum, a.null}
 }
 
 func intAggGetter(v DBValue) any {
@@ -81,6 +91,8 @@ func stringAggGetter(v DBValue) any {
 
 func (a *SumAggState) Init(alias string, expr Expr) error {
 	a.sum = 0
+	a.fsum = floatSum{}
+	a.null = true
 	a.expr = expr
 	a.alias = alias
 	return nil
@@ -91,36 +103,54 @@ func (a *SumAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	switch v.(type) {
+	switch v := v.(type) {
 	case IntField:
-		a.sum += v.(IntField).Value
+		a.sum += v.Value
+		a.null = false
+	case FloatField:
+		a.fsum.add(v.Value)
+		a.null = false
 	}
 }
 
 func (a *SumAggState) GetTupleDesc() *TupleDesc {
+	if a.expr.GetExprType().Ftype == FloatType {
+		return &TupleDesc{[]FieldType{{a.alias, "", FloatType}}}
+	}
 	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
 }
 
 func (a *SumAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{a.sum}}, nil}
+	td := a.GetTupleDesc()
+	if a.null {
+		return &Tuple{*td, []DBValue{NullField{}}, nil}
+	}
+	if td.Fields[0].Ftype == FloatType {
+		sum := a.fsum
+		sum.add(float64(a.sum))
+		return &Tuple{*td, []DBValue{FloatField{sum.value()}}, nil}
+	}
+	return &Tuple{*td, []DBValue{IntField{a.sum}}, nil}
 }
 
 // Implements the aggregation state for AVG
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for divide-by-zero
+// The average is always a float. NULLs are not counted, so the average of a
+// group where every value is NULL is NULL
 type AvgAggState struct {
 	alias string
 	expr  Expr
 	sum   int64
+	fsum  floatSum
 	count int64
 }
 
 func (a *AvgAggState) Copy() AggState {
-	return &AvgAggState{a.alias, a.expr, a.sum, a.count}
+	return &AvgAggState{a.alias, a.expr, a.sum, a.fsum, a.count}
 }
 
 func (a *AvgAggState) Init(alias string, expr Expr) error {
 	a.sum = 0
+	a.fsum = floatSum{}
 	a.count = 0
 	a.expr = expr
 	a.alias = alias
@@ -132,29 +162,57 @@ func (a *AvgAggState) AddTuple(t *Tuple) {
 	if err != nil {
 		return
 	}
-	switch v.(type) {
+	switch v := v.(type) {
 	case IntField:
-		a.sum += v.(IntField).Value
+		a.sum += v.Value
+		a.count++
+	case FloatField:
+		a.fsum.add(v.Value)
+		a.count++
 	}
-	a.count++
 }
 
 func (a *AvgAggState) GetTupleDesc() *TupleDesc {
-	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
+	return &TupleDesc{[]FieldType{{a.alias, "", FloatType}}}
 }
 
 func (a *AvgAggState) Finalize() *Tuple {
-	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{a.sum / a.count}}, nil}
+	if a.count == 0 {
+		return &Tuple{*a.GetTupleDesc(), []DBValue{NullField{}}, nil}
+	}
+	sum := a.fsum
+	sum.add(float64(a.sum))
+	return &Tuple{*a.GetTupleDesc(), []DBValue{FloatField{sum.value() / float64(a.count)}}, nil}
+}
+
+// A running sum of floats that uses Neumaier's compensated summation, so that
+// adding many small values to a large one does not lose them to rounding.
+type floatSum struct {
+	sum          float64
+	compensation float64
+}
+
+func (s *floatSum) add(v float64) {
+	t := s.sum + v
+	if math.Abs(s.sum) >= math.Abs(v) {
+		s.compensation += (s.sum - t) + v
+	} else {
+		s.compensation += (v - t) + s.sum
+	}
+	s.sum = t
+}
+
+func (s *floatSum) value() float64 {
+	return s.sum + s.compensation
 }
 
 // Implements the aggregation state for MAX
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN max
+// NULLs are ignored, so the max of a group where every value is NULL is NULL
 type MaxAggState struct {
 	alias string
 	expr  Expr
 	val   DBValue
-	null  bool // whether the agg state have not seen any tuple inputted yet
+	null  bool // whether the agg state have not seen any non-NULL value yet
 }
 
 func (a *MaxAggState) Copy() AggState {
@@ -172,7 +230,7 @@ func (a *MaxAggState) Init(alias string, expr Expr) error {
 
 func (a *MaxAggState) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 
@@ -189,12 +247,14 @@ func (a *MaxAggState) GetTupleDesc() *TupleDesc {
 }
 
 func (a *MaxAggState) Finalize() *Tuple {
+	if a.null {
+		return &Tuple{*a.GetTupleDesc(), []DBValue{NullField{}}, nil}
+	}
 	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}
 }
 
 // Implements the aggregation state for MIN
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN min
+// NULLs are ignored, so the min of a group where every value is NULL is NULL
 type MinAggState struct {
 	MaxAggState
 }
@@ -214,7 +274,7 @@ func (a *MinAggState) Init(alias string, expr Expr) error {
 
 func (a *MinAggState) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 	if a.null {
@@ -230,5 +290,8 @@ func (a *MinAggState) GetTupleDesc() *TupleDesc {
 }
 
 func (a *MinAggState) Finalize() *Tuple {
+	if a.null {
+		return &Tuple{*a.GetTupleDesc(), []DBValue{NullField{}}, nil}
+	}
 	return &Tuple{*a.GetTupleDesc(), []DBValue{a.val}, nil}
 }
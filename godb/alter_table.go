@@ -0,0 +1,238 @@
+package godb
+
+/*
+alter_table.go implements ALTER TABLE ADD COLUMN, DROP COLUMN and RENAME
+COLUMN.
+
+The tuples of a table are stored in the format of its TupleDesc, and the log
+reads the pages of a file in the format of the table the file belongs to, so a
+table whose columns change is rewritten: a new version of the table is
+created with a new file number and files of its own (see [versionedFile]),
+the tuples of the old version are copied into it, and its indexes are rebuilt.
+The change is logged like a DROP TABLE of the old version followed by a
+CREATE TABLE of the new one (see ddl.go), in the transaction that runs the
+ALTER TABLE, so that an abort restores the old version, and the files of the
+old version are deleted when the transaction commits.
+
+An index on a dropped column is dropped with it, and so is a key (see
+constraints.go) or a foreign key (see foreign_keys.go) that has the column. A
+column that a foreign key of another table references cannot be dropped or
+renamed.
+*/
+
+import (
+	"fmt"
+)
+
+// Add a column to a table on behalf of tid. The column of the existing tuples
+// is set to value, which may be NULL unless the column is NOT NULL.
+func (c *Catalog) addColumnInTransaction(tid TransactionID, tableName string, field FieldType, column columnInfo, value DBValue) error {
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	if _, err := findFieldInTd(FieldType{field.Fname, "", UnknownType}, &t.desc); err == nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column named '%s'", tableName, field.Fname)}
+	}
+	if column.notNull && isNull(value) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("column '%s' is not null, and must have a default value", field.Fname)}
+	}
+	desc := t.desc.copy()
+	desc.Fields = append(desc.Fields, field)
+	columns := append(append([]columnInfo{}, t.columns...), column)
+	sources := make([]int, len(desc.Fields))
+	for i := range sources {
+		sources[i] = i
+	}
+	sources[len(sources)-1] = -1
+	return c.rewriteTable(tid, t, desc, columns, t.keys, t.foreignKeys, sources, value)
+}
+
+// Drop a column of a table, and the indexes, keys and foreign keys on the
+// column, on behalf of tid.
+func (c *Catalog) dropColumnInTransaction(tid TransactionID, tableName string, column string) error {
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	field, err := findFieldInTd(FieldType{column, "", UnknownType}, &t.desc)
+	if err != nil {
+		return err
+	}
+	if len(t.desc.Fields) == 1 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop '%s', the only column of table '%s'", column, tableName)}
+	}
+	if err := c.checkColumnUnreferenced(tableName, column, "drop"); err != nil {
+		return err
+	}
+	desc := &TupleDesc{}
+	var columns []columnInfo
+	var sources []int
+	for i, f := range t.desc.Fields {
+		if i != field {
+			desc.Fields = append(desc.Fields, f)
+			columns = append(columns, t.columns[i])
+			sources = append(sources, i)
+		}
+	}
+	var keys []tableKey
+	for _, k := range t.keys {
+		if fieldPosition(k.fields, field) == -1 {
+			keys = append(keys, k)
+		}
+	}
+	var fks []foreignKey
+	for _, fk := range t.foreignKeys {
+		// a foreign key of the table may reference the column
+		references := false
+		for _, col := range fk.parentColumns {
+			references = references || (fk.parent == tableName && col == column)
+		}
+		if fieldPosition(fk.fields, field) == -1 && !references {
+			fks = append(fks, fk)
+		}
+	}
+	return c.rewriteTable(tid, t, desc, columns, keys, fks, sources, nil)
+}
+
+// Rename a column of a table, and the column of its indexes, keys and foreign
+// keys, on behalf of tid.
+func (c *Catalog) renameColumnInTransaction(tid TransactionID, tableName string, column string, newName string) error {
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	field, err := findFieldInTd(FieldType{column, "", UnknownType}, &t.desc)
+	if err != nil {
+		return err
+	}
+	if _, err := findFieldInTd(FieldType{newName, "", UnknownType}, &t.desc); err == nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column named '%s'", tableName, newName)}
+	}
+	if err := c.checkColumnUnreferenced(tableName, column, "rename"); err != nil {
+		return err
+	}
+	desc := t.desc.copy()
+	desc.Fields[field].Fname = newName
+	sources := make([]int, len(desc.Fields))
+	for i := range sources {
+		sources[i] = i
+	}
+	keys := make([]tableKey, len(t.keys))
+	for i, k := range t.keys {
+		keys[i] = tableKey{k.primary, append([]string{}, k.columns...), nil}
+		for j, f := range k.fields {
+			if f == field {
+				keys[i].columns[j] = newName
+			}
+		}
+	}
+	rename := func(columns []string) []string {
+		renamed := append([]string{}, columns...)
+		for i, col := range renamed {
+			if col == column {
+				renamed[i] = newName
+			}
+		}
+		return renamed
+	}
+	fks := make([]foreignKey, len(t.foreignKeys))
+	for i, fk := range t.foreignKeys {
+		fks[i] = foreignKey{rename(fk.columns), fk.parent, fk.parentColumns, fk.onDelete, nil}
+		if fk.parent == tableName {
+			fks[i].parentColumns = rename(fk.parentColumns)
+		}
+	}
+	return c.rewriteTable(tid, t, desc, t.columns, keys, fks, sources, nil)
+}
+
+// Replace table t with a new version with the specified fields, columns, keys
+// and foreign keys, on behalf of tid. Field i of the tuples of the new version is field sources[i]
+// of the old version, or value if sources[i] is -1. The indexes of t are
+// rebuilt on the same columns of the new version, unless their column is not
+// in the new version.
+func (c *Catalog) rewriteTable(tid TransactionID, t *Table, desc *TupleDesc, columns []columnInfo, keys []tableKey, fks []foreignKey, sources []int, value DBValue) error {
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if tid == noTransaction {
+			return GoDBError{IllegalOperationError, "ALTER TABLE requires a log file"}
+		}
+		if err := c.checkNotMaterialized(t.name); err != nil {
+			return err
+		}
+		if t.temporary() {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("temporary table '%s' cannot be altered", t.name)}
+		}
+		oldIndexes := c.tableIndexes(t.name)
+		oldDef := c.tableDef(t, oldIndexes)
+		id := c.nextFileId
+		storage := t.storage()
+		newDef := tableDef{id, t.name, versionedFile(defaultTableFile(t.name, storage), id), storage, *desc, columns, keys, fks, nil}
+		for _, idx := range oldIndexes {
+			for i, source := range sources {
+				if source == idx.field {
+					id++
+					newDef.indexes = append(newDef.indexes, indexDef{id, idx.name, versionedFile(defaultIndexFile(idx.name), id), desc.Fields[i].Fname, idx.method})
+				}
+			}
+		}
+
+		logFile := c.bufferPool.logFile
+		if err := logFile.logTable(DropTableRecord, tid, &oldDef); err != nil {
+			return err
+		}
+		if err := logFile.logTable(CreateTableRecord, tid, &newDef); err != nil {
+			return err
+		}
+		indexes := c.unregisterTable(t)
+		c.dropped[tid] = append(c.dropped[tid], &droppedTable{t, indexes})
+		err := c.openTableDef(&newDef)
+		newT, ok := c.tableMap[t.name]
+		if ok {
+			// removed by an abort, even if one of its indexes failed to open
+			c.created[tid] = append(c.created[tid], newT)
+		}
+		if err != nil {
+			return err
+		}
+
+		// the copied tuples have the values of the foreign keys they had, and
+		// may reference tuples that are not copied yet
+		newFks := newT.foreignKeys
+		newT.foreignKeys = nil
+		defer func() { newT.foreignKeys = newFks }()
+
+		// the inserts also add the tuples to the rebuilt indexes
+		iter, err := t.file.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				return err
+			}
+			if tup == nil {
+				break
+			}
+			fields := make([]DBValue, len(sources))
+			for i, source := range sources {
+				if source == -1 {
+					fields[i] = value
+				} else {
+					fields[i] = tup.Fields[source]
+				}
+			}
+			newTup := Tuple{*newT.file.Descriptor(), fields, nil}
+			if err := newT.file.insertTuple(&newTup, tid); err != nil {
+				return err
+			}
+		}
+		stats, err := computeTableStats(tid, newT.file)
+		if err != nil {
+			return err
+		}
+		stats.unique = newT.uniqueColumns()
+		newT.stats = stats
+		return nil
+	})
+}
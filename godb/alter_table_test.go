@@ -0,0 +1,154 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Statements that create a table people(name, age) with n tuples and an index
+// on age.
+func alterTestTable(n int) []string {
+	return []string{
+		"create table people (name text, age int)",
+		"create index people_age on people(age)",
+		insertRowsForTest("people", n, func(i int) string { return fmt.Sprintf("'sam', %d", i) }),
+	}
+}
+
+func TestAlterTable(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, alterTestTable(2000)...)
+
+	runSQLForTest(t, bp, c, "alter table people add column city varchar(10) not null default 'paris'", noTransaction)
+	if got := c.String(); got != "people(name text, age int, city varchar(10) not null default 'paris')\nindex people_age on people(age) using btree\n" {
+		t.Errorf("unexpected catalog after adding a column:\n%s", got)
+	}
+	for _, name := range []string{"people.dat", "people_age.idx"} {
+		if _, ok := disk.files[root+"/"+name]; ok {
+			t.Errorf("expected %s to be deleted when the alter commits", name)
+		}
+	}
+	tups := runSQLForTest(t, bp, c, "select name, age, city from people where age = 42", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[1] != (IntField{42}) || tups[0].Fields[2] != (StringField{"paris"}) {
+		t.Errorf("expected the added column to have its default value, got %v", tups)
+	}
+	_, op, err := Parse(c, "select name from people where age = 42")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if findIndexScan(op) == nil {
+		t.Errorf("expected the index to be rebuilt")
+	}
+	if stats := c.GetTableStats("people"); stats == nil || stats.EstimateCardinality(1) != 2000 {
+		t.Errorf("expected the rewritten table to have statistics of its 2000 tuples, got %v", stats)
+	}
+
+	runSQLForTest(t, bp, c, "alter table people rename column age to years", noTransaction)
+	runSQLForTest(t, bp, c, "alter table people drop column name", noTransaction)
+	if got := c.String(); got != "people(years int, city varchar(10) not null default 'paris')\nindex people_age on people(years) using btree\n" {
+		t.Errorf("unexpected catalog after renaming and dropping columns:\n%s", got)
+	}
+	if tups := runSQLForTest(t, bp, c, "select city from people where years >= 1990", noTransaction); len(tups) != 10 {
+		t.Errorf("expected 10 tuples, got %d", len(tups))
+	}
+	if _, _, err := Parse(c, "select age from people"); err == nil {
+		t.Errorf("expected an error selecting a renamed column by its old name")
+	}
+
+	// dropping the indexed column drops the index
+	runSQLForTest(t, bp, c, "alter table people add column n int", noTransaction)
+	runSQLForTest(t, bp, c, "alter table people drop years", noTransaction)
+	if got := c.String(); got != "people(city varchar(10) not null default 'paris', n int)\n" {
+		t.Errorf("unexpected catalog after dropping the indexed column:\n%s", got)
+	}
+	people, _ := c.GetTable("people")
+	tups = runQueryForTest(t, bp, people, noTransaction)
+	if len(tups) != 2000 || tups[0].Fields[0] != (StringField{"paris"}) || tups[0].Fields[1] != (NullField{}) {
+		t.Errorf("expected 2000 tuples with a NULL n, got %d: %v", len(tups), tups[0])
+	}
+
+	for _, sql := range []string{
+		"alter table people add column city int",
+		"alter table people add column x int not null",
+		"alter table people add column x int default 'abc'",
+		"alter table people add column x varchar(2) default 'abc'",
+		"alter table people drop column missing",
+		"alter table people rename column n to city",
+		"alter table missing add column x int",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	runSQLForTest(t, bp, c, "alter table people drop column n", noTransaction)
+	if _, _, err := Parse(c, "alter table people drop column city"); err == nil {
+		t.Errorf("expected an error dropping the only column of a table")
+	}
+
+	// the catalog file records the file of the rewritten table
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	people2, err := c2.GetTable("people")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(runQueryForTest(t, bp2, people2, noTransaction)); n != 2000 {
+		t.Errorf("expected 2000 tuples after a restart, got %d", n)
+	}
+}
+
+func TestAlterTableRollback(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, alterTestTable(10)...)
+	people, _ := c.GetTable("people")
+	before := c.String()
+
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "alter table people add column city text default 'paris'", tid)
+	runSQLForTest(t, bp, c, "alter table people drop column name", tid)
+	runSQLForTest(t, bp, c, "insert into people values (10, 'rome')", tid)
+	bp.AbortTransaction(tid)
+
+	if got := c.String(); got != before {
+		t.Errorf("expected the abort to restore the table, got:\n%s", got)
+	}
+	if f, _ := c.GetTable("people"); f != people {
+		t.Errorf("expected the abort to restore the old version of the table")
+	}
+	if n := len(runQueryForTest(t, bp, people, noTransaction)); n != 10 {
+		t.Errorf("expected 10 tuples after the abort, got %d", n)
+	}
+	for name := range disk.files {
+		switch name {
+		case root + "/people.dat", root + "/people.dat.fsm", root + "/people.dat.ovf", root + "/people_age.idx":
+		default:
+			if strings.HasPrefix(name, root+"/people") {
+				t.Errorf("expected %s to be deleted by the abort", name)
+			}
+		}
+	}
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select name from people where age = 3", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the index to be restored, got %v", tups)
+	}
+
+	// after a crash, a committed alter is kept and one that did not commit
+	// is undone, although the catalog file was saved before the crash
+	runSQLForTest(t, bp, c, "alter table people rename column name to who", noTransaction)
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "alter table people add column city text", tid)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got := c2.String(); got != "people(who text, age int)\nindex people_age on people(age) using btree\n" {
+		t.Errorf("unexpected catalog after recovery:\n%s", got)
+	}
+	people2, _ := c2.GetTable("people")
+	if n := len(runQueryForTest(t, bp2, people2, noTransaction)); n != 10 {
+		t.Errorf("expected 10 tuples after recovery, got %d", n)
+	}
+}
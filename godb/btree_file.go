@@ -0,0 +1,646 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+BTreeFile implements a B+ tree over one column of a table. It is used as a
+secondary index (see [Index]): each entry maps a key, the value of the indexed
+column, to the heapFileRid of a tuple in the table's heap file. Entries are
+ordered by key and then by rid, so the tree may contain duplicate keys and
+every entry is still unique.
+
+Like a HeapFile, a BTreeFile is a sequence of PageSize pages that are read and
+written through the BufferPool, so page locks and log records cover the index
+just as they cover the table. Page 0 is a meta page that stores the page number
+of the root. Every page begins with a header:
+
++--------------------------------------------------------+
+| Page kind: meta, leaf or internal (1 byte)             |
++--------------------------------------------------------+
+| Number of entries (4 bytes)                            |
++--------------------------------------------------------+
+| Root (meta), right sibling (leaf) or first child (4 b) |
++--------------------------------------------------------+
+
+A leaf entry is a key, written with [Tuple.writeTo], followed by the page and
+slot of the rid (4 bytes each). An internal entry is a separator key and rid
+followed by the page number of the child that holds entries greater than or
+equal to the separator. Entries smaller than the first separator are in the
+first child stored in the header. Leaves are linked left to right so that
+range scans can walk them.
+
+A node is full when its serialized size would exceed PageSize, at which point
+it is split in half and the separator is pushed into its parent. Deleting an
+entry removes it from its leaf, but nodes are never merged.
+*/
+
+type btreePageKind int8
+
+const (
+	btreeMetaPage     btreePageKind = iota
+	btreeLeafPage     btreePageKind = iota
+	btreeInternalPage btreePageKind = iota
+)
+
+const btreeHeaderSize = 9
+
+type BTreeFile struct {
+	keyType     FieldType
+	td          *TupleDesc
+	numPages    int
+	backingFile string
+	bufPool     *BufferPool
+	sync.Mutex
+}
+
+type btreePage struct {
+	kind     btreePageKind
+	pageNo   int
+	next     int // root (meta page), right sibling (leaf) or first child (internal)
+	entries  []indexEntry
+	children []int // internal pages: child holding entries >= entries[i]
+	file     *BTreeFile
+
+	dirty       bool
+	dirtier     TransactionID
+	beforeImage *btreePage
+	sync.Mutex
+}
+
+// Create a BTreeFile.
+// Parameters
+// - fromFile: backing file for the BTreeFile. May be empty or a previously created index file.
+// - keyType: the type of the indexed column.
+// - bp: the BufferPool that is used to store pages read from the BTreeFile
+// May return an error if the file cannot be opened or created.
+func NewBTreeFile(fromFile string, keyType FieldType, bp *BufferPool) (*BTreeFile, error) {
+	disk := bp.DiskManager()
+	if err := disk.Open(fromFile); err != nil {
+		return nil, err
+	}
+	size, err := disk.Size(fromFile)
+	if err != nil {
+		return nil, err
+	}
+	bf := &BTreeFile{keyType, indexTupleDesc(keyType), int(size / int64(PageSize)), fromFile, bp, sync.Mutex{}}
+
+	if bf.numPages == 0 {
+		// a new file has a meta page that points to an empty root leaf
+		meta := newBTreePage(btreeMetaPage, 0, bf)
+		meta.next = 1
+		if err := bf.flushPage(meta); err != nil {
+			return nil, err
+		}
+		if err := bf.flushPage(newBTreePage(btreeLeafPage, 1, bf)); err != nil {
+			return nil, err
+		}
+		bf.numPages = 2
+	}
+	return bf, nil
+}
+
+func newBTreePage(kind btreePageKind, pageNo int, f *BTreeFile) *btreePage {
+	pg := &btreePage{kind: kind, pageNo: pageNo, next: -1, file: f, dirtier: -1}
+	pg.SetBeforeImage()
+	return pg
+}
+
+// Return the name of the backing file
+func (f *BTreeFile) BackingFile() string {
+	return f.backingFile
+}
+
+// Return the number of pages in the file
+func (f *BTreeFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+// [Operator] descriptor method -- the tuples of a BTreeFile consist of the
+// key and the page and slot number of the record id.
+func (f *BTreeFile) Descriptor() *TupleDesc {
+	return f.td
+}
+
+func (f *BTreeFile) pageKey(pgNo int) any {
+	return heapHash{f.backingFile, pgNo}
+}
+
+func (f *BTreeFile) readPage(pageNo int) (Page, error) {
+	b := make([]byte, PageSize)
+	n, err := f.bufPool.DiskManager().ReadAt(f.backingFile, b, int64(pageNo*PageSize))
+	if err != nil {
+		return nil, err
+	}
+	if n != PageSize {
+		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	}
+	return f.pageFromBuffer(pageNo, b)
+}
+
+// Construct the page with the specified page number from its serialized form.
+func (f *BTreeFile) pageFromBuffer(pageNo int, b []byte) (Page, error) {
+	pg := newBTreePage(btreeLeafPage, pageNo, f)
+	if err := pg.initFromBuffer(bytes.NewBuffer(b)); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+func (f *BTreeFile) flushPage(p Page) error {
+	bp := p.(*btreePage)
+	buf, err := bp.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = f.bufPool.DiskManager().WriteAt(f.backingFile, buf.Bytes(), int64(bp.pageNo*PageSize))
+	return err
+}
+
+// Insert an index tuple (key, page, slot) into the tree.
+func (f *BTreeFile) insertTuple(t *Tuple, tid TransactionID) error {
+	e, err := tupleToIndexEntry(t)
+	if err != nil {
+		return err
+	}
+	return f.insertEntry(e.key, e.rid, tid)
+}
+
+// Delete an index tuple (key, page, slot) from the tree.
+func (f *BTreeFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	e, err := tupleToIndexEntry(t)
+	if err != nil {
+		return err
+	}
+	return f.deleteEntry(e.key, e.rid, tid)
+}
+
+// Compare two keys, returning -1, 0 or 1 if k1 is less than, equal to or
+// greater than k2.
+func compareKeys(k1 DBValue, k2 DBValue) int {
+	if k1.EvalPred(k2, OpLt) {
+		return -1
+	}
+	if k1.EvalPred(k2, OpEq) {
+		return 0
+	}
+	return 1
+}
+
+func (f *BTreeFile) getBTreePage(pageNo int, tid TransactionID, perm RWPerm) (*btreePage, error) {
+	pg, err := f.bufPool.GetPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, err
+	}
+	return pg.(*btreePage), nil
+}
+
+// Descend from the root to the leaf that holds (or would hold) e, taking read
+// locks on the way down. Returns the page numbers on the path from the root to
+// the leaf.
+func (f *BTreeFile) findLeaf(e indexEntry, tid TransactionID) ([]int, error) {
+	meta, err := f.getBTreePage(0, tid, ReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	path := []int{meta.next}
+	for {
+		pg, err := f.getBTreePage(path[len(path)-1], tid, ReadPerm)
+		if err != nil {
+			return nil, err
+		}
+		if pg.kind != btreeInternalPage {
+			return path, nil
+		}
+		path = append(path, pg.childFor(e))
+	}
+}
+
+// Return the page number of the leftmost leaf.
+func (f *BTreeFile) firstLeaf(tid TransactionID) (int, error) {
+	meta, err := f.getBTreePage(0, tid, ReadPerm)
+	if err != nil {
+		return 0, err
+	}
+	pageNo := meta.next
+	for {
+		pg, err := f.getBTreePage(pageNo, tid, ReadPerm)
+		if err != nil {
+			return 0, err
+		}
+		if pg.kind != btreeInternalPage {
+			return pageNo, nil
+		}
+		pageNo = pg.next
+	}
+}
+
+// Add an entry for key and rid to the tree, splitting nodes as needed.
+func (f *BTreeFile) insertEntry(key DBValue, rid recordID, tid TransactionID) error {
+	heapRid, err := toHeapFileRid(rid)
+	if err != nil {
+		return err
+	}
+	e := indexEntry{key, heapRid}
+	if err := e.checkSize(); err != nil {
+		return err
+	}
+	path, err := f.findLeaf(e, tid)
+	if err != nil {
+		return err
+	}
+	leaf, err := f.getBTreePage(path[len(path)-1], tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	leaf.insertEntry(e, -1)
+	leaf.setDirty(tid, true)
+
+	// split full nodes bottom up; pages are looked up again by number because
+	// clean pages on the path may have been evicted in the meantime
+	for level := len(path) - 1; level >= 0; level-- {
+		node, err := f.getBTreePage(path[level], tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		if node.fits() {
+			return nil
+		}
+		sep, right, err := f.splitPage(node, tid)
+		if err != nil {
+			return err
+		}
+		if level == 0 {
+			return f.newRoot(node.pageNo, sep, right.pageNo, tid)
+		}
+		parent, err := f.getBTreePage(path[level-1], tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		parent.insertEntry(sep, right.pageNo)
+		parent.setDirty(tid, true)
+	}
+	return nil
+}
+
+// Allocate a new, empty page at the end of the file and return it write
+// locked.
+func (f *BTreeFile) allocatePage(kind btreePageKind, tid TransactionID) (*btreePage, error) {
+	f.Lock()
+	pageNo := f.numPages
+	err := f.flushPage(newBTreePage(kind, pageNo, f))
+	if err != nil {
+		f.Unlock()
+		return nil, err
+	}
+	f.numPages++
+	f.Unlock()
+	return f.getBTreePage(pageNo, tid, WritePerm)
+}
+
+// Move the upper half of the entries of a full page to a new page. Returns the
+// separator to insert into the parent, and the new page.
+func (f *BTreeFile) splitPage(pg *btreePage, tid TransactionID) (indexEntry, *btreePage, error) {
+	right, err := f.allocatePage(pg.kind, tid)
+	if err != nil {
+		return indexEntry{}, nil, err
+	}
+	mid := len(pg.entries) / 2
+	var sep indexEntry
+	if pg.kind == btreeLeafPage {
+		sep = pg.entries[mid]
+		right.entries = append([]indexEntry{}, pg.entries[mid:]...)
+		right.next = pg.next
+		pg.next = right.pageNo
+	} else {
+		// the middle separator moves up; its child becomes the first child
+		// of the new page
+		sep = pg.entries[mid]
+		right.next = pg.children[mid]
+		right.entries = append([]indexEntry{}, pg.entries[mid+1:]...)
+		right.children = append([]int{}, pg.children[mid+1:]...)
+		pg.children = append([]int{}, pg.children[:mid]...)
+	}
+	pg.entries = append([]indexEntry{}, pg.entries[:mid]...)
+	pg.setDirty(tid, true)
+	right.setDirty(tid, true)
+	return sep, right, nil
+}
+
+// Replace the root with a new internal page whose children are left and right.
+func (f *BTreeFile) newRoot(left int, sep indexEntry, right int, tid TransactionID) error {
+	meta, err := f.getBTreePage(0, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	root, err := f.allocatePage(btreeInternalPage, tid)
+	if err != nil {
+		return err
+	}
+	root.next = left
+	root.insertEntry(sep, right)
+	root.setDirty(tid, true)
+	meta.next = root.pageNo
+	meta.setDirty(tid, true)
+	return nil
+}
+
+// Remove the entry for key and rid from its leaf.
+func (f *BTreeFile) deleteEntry(key DBValue, rid recordID, tid TransactionID) error {
+	heapRid, err := toHeapFileRid(rid)
+	if err != nil {
+		return err
+	}
+	e := indexEntry{key, heapRid}
+	path, err := f.findLeaf(e, tid)
+	if err != nil {
+		return err
+	}
+	leaf, err := f.getBTreePage(path[len(path)-1], tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	i := leaf.search(e)
+	if i == len(leaf.entries) || leaf.entries[i].compare(e) != 0 {
+		return GoDBError{TupleNotFoundError, fmt.Sprintf("no index entry for key %v", key)}
+	}
+	leaf.entries = append(leaf.entries[:i], leaf.entries[i+1:]...)
+	leaf.setDirty(tid, true)
+	return nil
+}
+
+func (f *BTreeFile) supportsOp(op BoolOp) bool {
+	switch op {
+	case OpEq, OpLt, OpLe, OpGt, OpGe:
+		return true
+	}
+	return false
+}
+
+// Return an iterator over the rids of the entries whose key satisfies
+// "key op value", in key order. Equality and lower bounded scans start at the
+// leaf that holds the first key >= value; upper bounded scans start at the
+// leftmost leaf.
+func (f *BTreeFile) lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error) {
+	if !f.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("b+ tree does not support %s lookups", op)}
+	}
+	var pageNo int
+	if op == OpLt || op == OpLe {
+		first, err := f.firstLeaf(tid)
+		if err != nil {
+			return nil, err
+		}
+		pageNo = first
+	} else {
+		// the smallest possible entry with key value
+		path, err := f.findLeaf(indexEntry{value, heapFileRid{-1, -1}}, tid)
+		if err != nil {
+			return nil, err
+		}
+		pageNo = path[len(path)-1]
+	}
+
+	var pg *btreePage
+	i := 0
+	return func() (recordID, error) {
+		for pageNo != -1 {
+			if pg == nil {
+				var err error
+				if pg, err = f.getBTreePage(pageNo, tid, ReadPerm); err != nil {
+					return nil, err
+				}
+				i = 0
+			}
+			if i >= len(pg.entries) {
+				pageNo = pg.next
+				pg = nil
+				continue
+			}
+			e := pg.entries[i]
+			i++
+			c := compareKeys(e.key, value)
+			switch op {
+			case OpEq:
+				if c < 0 {
+					continue
+				}
+				if c > 0 {
+					pageNo = -1
+					return nil, nil
+				}
+			case OpGt:
+				if c <= 0 {
+					continue
+				}
+			case OpGe:
+				if c < 0 {
+					continue
+				}
+			case OpLt:
+				if c >= 0 {
+					pageNo = -1
+					return nil, nil
+				}
+			case OpLe:
+				if c > 0 {
+					pageNo = -1
+					return nil, nil
+				}
+			}
+			return e.rid, nil
+		}
+		return nil, nil
+	}, nil
+}
+
+// [Operator] iterator method -- return the entries of the tree in key order,
+// as tuples of the form (key, page, slot).
+func (f *BTreeFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	pageNo, err := f.firstLeaf(tid)
+	if err != nil {
+		return nil, err
+	}
+	var pg *btreePage
+	i := 0
+	return func() (*Tuple, error) {
+		for pageNo != -1 {
+			if pg == nil {
+				var err error
+				if pg, err = f.getBTreePage(pageNo, tid, ReadPerm); err != nil {
+					return nil, err
+				}
+				i = 0
+			}
+			if i >= len(pg.entries) {
+				pageNo = pg.next
+				pg = nil
+				continue
+			}
+			e := pg.entries[i]
+			i++
+			return e.tuple(f.td), nil
+		}
+		return nil, nil
+	}, nil
+}
+
+// Return the position of the first entry >= e.
+func (p *btreePage) search(e indexEntry) int {
+	return sort.Search(len(p.entries), func(i int) bool {
+		return p.entries[i].compare(e) >= 0
+	})
+}
+
+// Return the child of an internal page that holds (or would hold) e.
+func (p *btreePage) childFor(e indexEntry) int {
+	i := sort.Search(len(p.entries), func(i int) bool {
+		return p.entries[i].compare(e) > 0
+	})
+	if i == 0 {
+		return p.next
+	}
+	return p.children[i-1]
+}
+
+// Insert e in order. For internal pages, child is the page holding entries >=
+// e; it is ignored for leaves.
+func (p *btreePage) insertEntry(e indexEntry, child int) {
+	i := p.search(e)
+	p.entries = append(p.entries, indexEntry{})
+	copy(p.entries[i+1:], p.entries[i:])
+	p.entries[i] = e
+	if p.kind == btreeInternalPage {
+		p.children = append(p.children, 0)
+		copy(p.children[i+1:], p.children[i:])
+		p.children[i] = child
+	}
+}
+
+// Return true if the page can be written in PageSize bytes.
+func (p *btreePage) fits() bool {
+	size := btreeHeaderSize
+	for _, e := range p.entries {
+		size += e.size()
+		if p.kind == btreeInternalPage {
+			size += 4
+		}
+		if size > PageSize {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *btreePage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+func (p *btreePage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.dirty = dirty
+	if dirty {
+		p.dirtier = tid
+	}
+}
+
+func (p *btreePage) getDirtier() TransactionID {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirtier
+}
+
+func (p *btreePage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *btreePage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the before-image of the page, used for logging and recovery.
+func (p *btreePage) BeforeImage() Page {
+	return p.beforeImage
+}
+
+// Sets the before-image of the page to a copy of the current state of the
+// page.
+func (p *btreePage) SetBeforeImage() {
+	p.beforeImage = &btreePage{
+		kind:     p.kind,
+		pageNo:   p.pageNo,
+		next:     p.next,
+		entries:  append([]indexEntry{}, p.entries...),
+		children: append([]int{}, p.children...),
+		file:     p.file,
+		dirtier:  -1,
+	}
+}
+
+// Write the page to a new PageSize buffer.
+func (p *btreePage) toBuffer() (*bytes.Buffer, error) {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, int8(p.kind))
+	binary.Write(b, binary.LittleEndian, int32(len(p.entries)))
+	binary.Write(b, binary.LittleEndian, int32(p.next))
+	for i, e := range p.entries {
+		if err := e.writeTo(b); err != nil {
+			return nil, err
+		}
+		if p.kind == btreeInternalPage {
+			binary.Write(b, binary.LittleEndian, int32(p.children[i]))
+		}
+	}
+	if b.Len() > PageSize {
+		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+	}
+	b.Write(make([]byte, PageSize-b.Len()))
+	return b, nil
+}
+
+// Read the contents of the page from the supplied buffer.
+func (p *btreePage) initFromBuffer(buf *bytes.Buffer) error {
+	var kind int8
+	var n, next int32
+	if err := binary.Read(buf, binary.LittleEndian, &kind); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &next); err != nil {
+		return err
+	}
+	p.kind = btreePageKind(kind)
+	p.next = int(next)
+	p.entries = make([]indexEntry, n)
+	p.children = nil
+	for i := range p.entries {
+		e, err := readIndexEntry(buf, p.file.keyType)
+		if err != nil {
+			return err
+		}
+		p.entries[i] = e
+		if p.kind == btreeInternalPage {
+			var child int32
+			if err := binary.Read(buf, binary.LittleEndian, &child); err != nil {
+				return err
+			}
+			p.children = append(p.children, int(child))
+		}
+	}
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
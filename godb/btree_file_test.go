@@ -0,0 +1,304 @@
+package godb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Create a B+ tree file with keys of type keyType in an empty database.
+func makeBTreeTestFile(t *testing.T, keyType DBType) (*BufferPool, *BTreeFile, *MemDiskManager, string) {
+	t.Helper()
+	bp, c, disk, root := newTestDatabase(t)
+	bf, err := NewBTreeFile("btree_test.idx", FieldType{"key", "", keyType}, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// register the file so that its pages can be logged
+	c.indexMap["btree_test"] = &Index{c.nextFileId, "btree_test", "btree_test.idx", "", "key", 0, "btree", bf}
+	c.nextFileId++
+	return bp, bf, disk, root
+}
+
+func countLookup(t *testing.T, bf *BTreeFile, op BoolOp, v DBValue, tid TransactionID) int {
+	iter, err := bf.lookup(op, v, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for {
+		rid, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if rid == nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestBTreeFileInsertAndLookup(t *testing.T) {
+	bp, bf, _, _ := makeBTreeTestFile(t, IntType)
+	tid := BeginTransactionForTest(t, bp)
+
+	// 3000 entries over 1000 distinct keys, inserted in random order
+	const nKeys = 1000
+	for i, k := range rand.Perm(3 * nKeys) {
+		err := bf.insertEntry(IntField{int64(k % nKeys)}, heapFileRid{i, 0}, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if bf.NumPages() <= 3 {
+		t.Fatalf("expected the tree to have split, got %d pages", bf.NumPages())
+	}
+
+	// the iterator returns every entry in key order
+	iter, err := bf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	var last int64 = -1
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		k := tup.Fields[0].(IntField).Value
+		if k < last {
+			t.Fatalf("iterator out of order: %d after %d", k, last)
+		}
+		last = k
+		n++
+	}
+	if n != 3*nKeys {
+		t.Fatalf("expected %d entries, got %d", 3*nKeys, n)
+	}
+
+	cases := []struct {
+		op   BoolOp
+		v    int64
+		want int
+	}{
+		{OpEq, 500, 3},
+		{OpEq, 0, 3},
+		{OpEq, nKeys, 0},
+		{OpLt, 10, 30},
+		{OpLe, 10, 33},
+		{OpGt, nKeys - 11, 30},
+		{OpGe, nKeys - 11, 33},
+		{OpGe, -5, 3 * nKeys},
+	}
+	for _, c := range cases {
+		if got := countLookup(t, bf, c.op, IntField{c.v}, tid); got != c.want {
+			t.Errorf("lookup %s %d: expected %d entries, got %d", c.op, c.v, c.want, got)
+		}
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeFileDelete(t *testing.T) {
+	bp, bf, _, _ := makeBTreeTestFile(t, StringType)
+	tid := BeginTransactionForTest(t, bp)
+
+	names := []string{"sam", "joe", "mary", "fred", "alice"}
+	for i := 0; i < 1000; i++ {
+		err := bf.insertEntry(StringField{names[i%len(names)]}, heapFileRid{i, i % 7}, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for i := 0; i < 1000; i += 5 {
+		err := bf.deleteEntry(StringField{"sam"}, heapFileRid{i, i % 7}, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if got := countLookup(t, bf, OpEq, StringField{"sam"}, tid); got != 0 {
+		t.Errorf("expected all entries for sam to be deleted, got %d", got)
+	}
+	if got := countLookup(t, bf, OpEq, StringField{"mary"}, tid); got != 200 {
+		t.Errorf("expected 200 entries for mary, got %d", got)
+	}
+	err := bf.deleteEntry(StringField{"sam"}, heapFileRid{0, 0}, tid)
+	if err == nil {
+		t.Errorf("expected error deleting a missing entry")
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeFilePersistence(t *testing.T) {
+	bp, bf, disk, root := makeBTreeTestFile(t, IntType)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 2000; i++ {
+		err := bf.insertEntry(IntField{int64(i)}, heapFileRid{i, 1}, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	bp2, _ := openTestDatabase(t, disk, root)
+	bf2, err := NewBTreeFile("btree_test.idx", FieldType{"key", "", IntType}, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bf2.NumPages() != bf.NumPages() {
+		t.Fatalf("expected %d pages after reopening, got %d", bf.NumPages(), bf2.NumPages())
+	}
+	tid = BeginTransactionForTest(t, bp2)
+	if got := countLookup(t, bf2, OpEq, IntField{1234}, tid); got != 1 {
+		t.Errorf("expected one entry for 1234 after reopening, got %d", got)
+	}
+	if got := countLookup(t, bf2, OpLt, IntField{1000}, tid); got != 1000 {
+		t.Errorf("expected 1000 entries < 1000 after reopening, got %d", got)
+	}
+	bp2.CommitTransaction(tid)
+}
+
+// Statements that create the idx_test table, with 2000 rows whose ages are 0
+// to 1999.
+var indexTestTable = []string{
+	"create table idx_test (name varchar, age int)",
+	insertRowsForTest("idx_test", 2000, func(i int) string { return fmt.Sprintf("'sam', %d", i) }),
+}
+
+func findIndexScan(op Operator) *IndexScan {
+	switch op := op.(type) {
+	case *IndexScan:
+		return op
+	case *OperatorCard:
+		return findIndexScan(op.Op)
+	case *Project:
+		return findIndexScan(op.child)
+	case *Filter:
+		return findIndexScan(op.child)
+	}
+	return nil
+}
+
+func TestIndexCreateAndScan(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, indexTestTable...)
+	qtype, _, err := Parse(c, "create index idx_test_age on idx_test(age)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if qtype != CreateIndexQueryType {
+		t.Fatalf("expected CreateIndexQueryType, got %d", qtype)
+	}
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	_, plan, err := Parse(c, "select name, age from idx_test where age = 1500")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if findIndexScan(plan) == nil {
+		t.Fatalf("expected an equality query to use the index")
+	}
+	tups := runQueryForTest(t, bp, plan, noTransaction)
+	if len(tups) != 1 || tups[0].Fields[1].(IntField).Value != 1500 {
+		t.Fatalf("expected one tuple with age 1500, got %v", tups)
+	}
+
+	_, plan, err = Parse(c, "select age from idx_test where age >= 1995")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if findIndexScan(plan) == nil {
+		t.Fatalf("expected a selective range query to use the index")
+	}
+	if tups := runQueryForTest(t, bp, plan, noTransaction); len(tups) != 5 {
+		t.Fatalf("expected 5 tuples with age >= 1995, got %d", len(tups))
+	}
+
+	// a filter that matches every tuple is cheaper as a scan
+	_, plan, err = Parse(c, "select age from idx_test where age >= 0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if findIndexScan(plan) != nil {
+		t.Fatalf("expected an unselective query to scan the table")
+	}
+}
+
+func TestIndexMaintainedByInsertAndDelete(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, indexTestTable...)
+	runSQLForTest(t, bp, c, "create index idx_test_age on idx_test(age)", noTransaction)
+	runSQLForTest(t, bp, c, "insert into idx_test values ('joe', 5000)", noTransaction)
+	runSQLForTest(t, bp, c, "delete from idx_test where age < 100", noTransaction)
+
+	idx := c.findIndex("idx_test", "age", OpEq)
+	hf, _ := c.GetTable("idx_test")
+	for _, tc := range []struct {
+		op   BoolOp
+		v    int64
+		want int
+	}{{OpEq, 5000, 1}, {OpLt, 100, 0}, {OpGe, 0, 1901}} {
+		scan, err := NewIndexScan(hf.(*HeapFile), idx, tc.op, IntField{tc.v})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if got := len(runQueryForTest(t, bp, scan, noTransaction)); got != tc.want {
+			t.Errorf("index scan age %s %d: expected %d tuples, got %d", tc.op, tc.v, tc.want, got)
+		}
+	}
+}
+
+func TestCreateIndexInTransaction(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, indexTestTable...)
+	hf, _ := c.GetTable("idx_test")
+	tid := BeginTransactionForTest(t, bp)
+	tup := Tuple{*hf.Descriptor(), []DBValue{StringField{"joe"}, IntField{5000}}, nil}
+	insertTupleForTest(t, hf, &tup, tid)
+
+	// the index is built by the transaction that wrote the table, which holds
+	// the locks of its pages
+	done := make(chan error)
+	go func() {
+		_, _, err := ParseInTransaction(c, "create index idx_test_age on idx_test(age)", tid)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the index to be built in the transaction that wrote the table")
+	}
+	bp.CommitTransaction(tid)
+
+	idx := c.findIndex("idx_test", "age", OpEq)
+	scan, err := NewIndexScan(hf.(*HeapFile), idx, OpEq, IntField{5000})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runQueryForTest(t, bp, scan, noTransaction); len(tups) != 1 {
+		t.Errorf("expected the index to have the inserted tuple, got %v", tups)
+	}
+}
+
+func TestIndexCatalogEntry(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "t (name string, age int)\nindex t_age on t(age) using btree\n")
+	c := NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	if c.findIndex("t", "age", OpEq) == nil {
+		t.Fatalf("expected index on t.age")
+	}
+	s := c.String()
+	if s != "t(name string, age int)\nindex t_age on t(age) using btree\n" {
+		t.Errorf("unexpected catalog: %#v", s)
+	}
+}
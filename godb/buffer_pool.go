@@ -41,10 +41,17 @@ type BufferPool struct {
 	//</silentstrip>
 
 	logFile *LogFile
+	disk    DiskManager // performs the I/O of the files whose pages are cached
 }
 
 // Create a new BufferPool with the specified number of pages
 func NewBufferPool(numPages int) (*BufferPool, error) {
+	return NewBufferPoolWithDiskManager(numPages, defaultDiskManager)
+}
+
+// Create a new BufferPool with the specified number of pages whose files do
+// their I/O through disk, e.g., a [MemDiskManager] in tests.
+func NewBufferPoolWithDiskManager(numPages int, disk DiskManager) (*BufferPool, error) {
 	//<silentstrip lab1|lab2|lab3|lab4>
 	if numPages <= 0 {
 		return nil, fmt.Errorf("numPages must be positive")
@@ -56,12 +63,22 @@ func NewBufferPool(numPages int) (*BufferPool, error) {
 		make(map[TransactionID]any),
 		sync.Mutex{},
 		nil,
+		disk,
 	}
 
 	return bp, nil
 	//</silentstrip>
 }
 
+// Return the DiskManager that the files of the buffer pool use for I/O. Files
+// without a buffer pool use the default [FileDiskManager].
+func (bp *BufferPool) DiskManager() DiskManager {
+	if bp == nil || bp.disk == nil {
+		return defaultDiskManager
+	}
+	return bp.disk
+}
+
 // Testing method -- iterate through all pages in the buffer pool
 // and flush them using [DBFile.flushPage]. Does not need to be thread/transaction safe.
 // Mark pages as not dirty after flushing them.
@@ -74,6 +91,45 @@ func (bp *BufferPool) FlushAllPages() {
 	//</strip>
 }
 
+// Remove all cached pages of the specified file from the buffer pool without
+// flushing them. Used when a file is dropped.
+func (bp *BufferPool) discardPages(file DBFile) {
+	bp.Lock()
+	defer bp.Unlock()
+	bp.removeFiles([]DBFile{file}, nil)
+}
+
+// Remove all cached pages of the specified files from the buffer pool without
+// flushing them, and delete the named files. Used when the drop of a table
+// commits or its creation is rolled back.
+//
+// Caller must hold the bufferpool lock.
+func (bp *BufferPool) removeFiles(files []DBFile, names []string) {
+	for key, page := range bp.pages {
+		for _, file := range files {
+			if page.getFile() == file {
+				delete(bp.pages, key)
+			}
+		}
+	}
+	for _, name := range names {
+		bp.DiskManager().Remove(name)
+	}
+}
+
+// Remove the cached pages of the specified file with page numbers of at least
+// pageNo from the buffer pool without flushing them. Used when the end of a
+// file is truncated.
+func (bp *BufferPool) discardPagesFrom(file DBFile, pageNo int) {
+	bp.Lock()
+	defer bp.Unlock()
+	for key, page := range bp.pages {
+		if pg, ok := page.(loggedPage); ok && page.getFile() == file && pg.PageNo() >= pageNo {
+			delete(bp.pages, key)
+		}
+	}
+}
+
 // <silentstrip lab1|lab2|lab3|lab4>
 // Returns true if the transaction is runing.
 //
@@ -99,9 +155,15 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 	if bp.logFile == nil {
 		log.Printf("log file not initialized")
 	}
+	// the tables dropped by tid are restored first, so that the log records of
+	// their pages can be read, and the files of those it created are deleted
+	// last
+	files, names := bp.logFile.catalog.abortDDL(tid)
+	bp.logFile.catalog.abortTemporaryTables(tid)
 	if err := bp.Rollback(tid); err != nil {
 		log.Printf("Error rolling back transaction: %v\n", err)
 	}
+	bp.removeFiles(files, names)
 	bp.logFile.LogAbort(tid)
 	if err := bp.logFile.Force(); err != nil {
 		log.Printf("Error aborting transaction: %s\n", err)
@@ -110,8 +172,20 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 	delete(bp.runningTids, tid)
 
 	for _, pg := range bp.lockTable.WriteLockedPages(tid) {
+		// pages are not written when their transaction commits, so the page
+		// may hold changes of committed transactions that are only in the
+		// log; its before-image is the page as of the last commit
+		if page, ok := bp.pages[pg].(loggedPage); ok && page.isDirty() && page.BeforeImage() != nil {
+			before := page.BeforeImage()
+			if err := before.getFile().flushPage(before); err != nil {
+				log.Printf("Error aborting transaction: %s\n", err)
+			}
+		}
 		delete(bp.pages, pg)
 	}
+	// the pages that tid appended by bulk loads are emptied last, since the
+	// before-images of their cached pages are the loaded pages
+	bp.logFile.catalog.abortBulkLoads(tid)
 	bp.lockTable.ReleaseLocks(tid)
 	// </strip>
 }
@@ -139,7 +213,10 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) {
 			continue
 		}
 
-		pg := page.(*heapPage)
+		pg, ok := page.(loggedPage)
+		if !ok {
+			continue
+		}
 		if err := bp.logFile.LogUpdate(tid, pg.BeforeImage(), pg); err != nil {
 			log.Printf("Error logging update: %v\n", err)
 		}
@@ -151,6 +228,11 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) {
 		log.Printf("Error committing transaction: %s\n", err)
 	}
 
+	// the tables dropped by tid can only be deleted once the commit is durable
+	bp.removeFiles(bp.logFile.catalog.commitDDL(tid))
+	bp.logFile.catalog.commitTemporaryTables(tid)
+	bp.logFile.catalog.commitBulkLoads(tid)
+
 	delete(bp.runningTids, tid)
 
 	bp.lockTable.ReleaseLocks(tid)
@@ -200,10 +282,13 @@ func (bp *BufferPool) evictPage() error {
 	//<silentstrip lab1|lab2|lab3|lab4>
 	// evict an arbitrary dirty page after writing an update record
 	for key, page := range bp.pages {
-		pg := page.(*heapPage)
+		pg, ok := page.(loggedPage)
+		if !ok {
+			continue
+		}
 
-		if bp.tidIsRunning(pg.dirtier) {
-			if err := bp.logFile.LogUpdate(pg.dirtier, pg.BeforeImage(), pg); err != nil {
+		if bp.tidIsRunning(pg.getDirtier()) {
+			if err := bp.logFile.LogUpdate(pg.getDirtier(), pg.BeforeImage(), pg); err != nil {
 				return err
 			}
 			if err := bp.logFile.Force(); err != nil {
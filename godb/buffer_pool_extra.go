@@ -1,25 +1,96 @@
 package godb
 
 import (
-	"fmt"
+	"io"
 )
 
 // Rolls back a transaction by reading the log and undoing the changes made by
 // the transaction.
 func (bp *BufferPool) Rollback(tid TransactionID) error {
-	// TODO: some code goes here
-	return fmt.Errorf("not implemented") // replace it
+	iter, err := bp.logFile.ReverseIterator()
+	if err != nil {
+		return err
+	}
+	for {
+		r, err := iter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		if r.Tid() != tid {
+			continue
+		}
+		if r.Type() == BeginRecord {
+			break
+		}
+		if r.Type() == UpdateRecord {
+			u := r.(*UpdateLogRecord)
+			u.Before.getFile().flushPage(u.Before)
+			delete(bp.pages, u.Before.getFile().pageKey(u.Before.(loggedPage).PageNo()))
+		}
+	}
+	return bp.logFile.seek(0, io.SeekEnd)
 }
 
 // Returns the log file associated with the buffer pool.
 func (bp *BufferPool) LogFile() *LogFile {
-	// TODO: some code goes here
-	return nil // replace it
+	return bp.logFile
 }
 
 // Recover the buffer pool from a log file. This should be called when the
 // database is started, even if the log file is empty.
 func (bp *BufferPool) Recover(logFile *LogFile) error {
-	// TODO: some code goes here
-	return fmt.Errorf("not implemented") // replace it
+	bp.logFile = logFile
+	if err := logFile.seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	active := map[TransactionID]bool{}
+	iter := logFile.ForwardIterator()
+	for {
+		r, err := iter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		switch r.Type() {
+		case BeginRecord:
+			active[r.Tid()] = true
+		case CommitRecord, AbortRecord:
+			delete(active, r.Tid())
+		case UpdateRecord:
+			u := r.(*UpdateLogRecord)
+			u.After.getFile().flushPage(u.After)
+		}
+	}
+	riter, err := logFile.ReverseIterator()
+	if err != nil {
+		return err
+	}
+	for len(active) > 0 {
+		r, err := riter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		if !active[r.Tid()] {
+			continue
+		}
+		if r.Type() == BeginRecord {
+			delete(active, r.Tid())
+		}
+		if r.Type() == UpdateRecord {
+			u := r.(*UpdateLogRecord)
+			u.Before.getFile().flushPage(u.Before)
+		}
+	}
+	if err := logFile.seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	return nil
 }
@@ -8,7 +8,7 @@ import (
 func TestBufferPoolGetPage(t *testing.T) {
 	_, t1, t2, hf, bp, _ := makeTestVars(t)
 	tid := NewTID()
-	for i := 0; i < 300; i++ {
+	for i := 0; i < 400; i++ {
 		bp.BeginTransaction(tid)
 		err := hf.insertTuple(&t1, tid)
 		if err != nil {
@@ -0,0 +1,567 @@
+package godb
+
+/*
+bulk_load.go implements the bulk loading of CSV files into tables, by the \l
+command of the shell and the COPY statement:
+
+	copy people from 'people.csv' with (delimiter '|', header)
+
+The file is parsed as described by RFC 4180: fields may be enclosed in double
+quotes, in which case they may contain the separator, line breaks, and double
+quotes written twice. An empty field that is not quoted is NULL, and the
+AUTO_INCREMENT column of a table is given the next value of its sequence if
+its field is NULL. A row that cannot be parsed, has the wrong number of fields,
+has a value that is not valid for its column, or violates a constraint of the
+table is rejected, and reported with the number of the line of the file that
+it starts on, but does not stop the load.
+
+All the rows are loaded in one transaction, the one that runs the statement or,
+outside of a transaction, one of its own. The tuples of a heap file whose table
+has no indexes, keys or foreign keys are not inserted one by one through the
+buffer pool. Instead, full heap pages are built in memory and appended to the
+end of the file in batches, under write locks that other transactions wait on
+until the load ends. The pages are not logged: a BulkLoad record with their
+page numbers is written before each batch, and the pages are made durable
+before the transaction commits. If the transaction aborts, or the database
+crashes before it commits, the pages are overwritten with empty pages (see
+[Catalog.abortBulkLoads] and [Catalog.recoverBulkLoads]). Rows are inserted
+into other tables with [DBFile.insertTuple], which maintains their indexes and
+checks their constraints.
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Number of pages that a bulk load builds in memory before appending them to
+// the heap file.
+const bulkLoadBatchPages = 32
+
+// A row of a CSV file that a bulk load rejected.
+type RejectedRow struct {
+	Line   int           // line of the file that the row starts on
+	Code   GoDBErrorCode // kind of error that rejected the row
+	Reason string        // why the row was rejected
+}
+
+func (r RejectedRow) String() string {
+	return fmt.Sprintf("line %d: %s", r.Line, r.Reason)
+}
+
+// The result of a bulk load: the number of rows that were loaded, and the rows
+// that were rejected. It is also the [Operator] that the COPY statement
+// returns, whose tuples are the rejected rows.
+type BulkLoadResult struct {
+	Loaded   int
+	Rejected []RejectedRow
+}
+
+// The descriptor of the rejected rows, which have the line of the file that the
+// row starts on, the kind of error that rejected it, and the reason.
+func (r *BulkLoadResult) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{{"line", "", IntType}, {"code", "", StringType}, {"error", "", StringType}}}
+}
+
+// Return an iterator over the rejected rows of the load. The load has already
+// run, so tid is not used.
+func (r *BulkLoadResult) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	desc := r.Descriptor()
+	i := 0
+	return func() (*Tuple, error) {
+		if i >= len(r.Rejected) {
+			return nil, nil
+		}
+		row := r.Rejected[i]
+		i++
+		return &Tuple{*desc, []DBValue{IntField{int64(row.Line)}, StringField{row.Code.String()}, StringField{row.Reason}}, nil}, nil
+	}, nil
+}
+
+// Load the rows of a CSV file whose fields are separated by sep, and whose first
+// line is a header if hasHeader is true, into the named table, in a
+// transaction of its own.
+//
+// Returns an error, and loads no rows, if the table does not exist, is the
+// table of a materialized view, the separator is not a single character other
+// than a double quote or line break, or the file cannot be read. Rows that
+// cannot be loaded are reported in the result rather than as an error.
+func (c *Catalog) LoadCSV(named string, r io.Reader, sep string, hasHeader bool) (*BulkLoadResult, error) {
+	return c.loadCSV(noTransaction, named, r, sep, hasHeader)
+}
+
+// Load the rows of a CSV file into the named table on behalf of tid, like
+// [Catalog.LoadCSV], or in a transaction of its own if tid is noTransaction.
+func (c *Catalog) loadCSV(tid TransactionID, named string, r io.Reader, sep string, hasHeader bool) (*BulkLoadResult, error) {
+	sepRune, size := utf8.DecodeRuneInString(sep)
+	if size == 0 || size != len(sep) || sepRune == '"' || sepRune == '\r' || sepRune == '\n' {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid CSV separator %q", sep)}
+	}
+	reader := newCSVReader(r, sepRune)
+	first := true
+	return c.loadRows(tid, named, func(t *Table, tid TransactionID) (*Tuple, int, error) {
+		fields, line, err := reader.read()
+		if err == nil && first && hasHeader {
+			fields, line, err = reader.read()
+		}
+		first = false
+		if err != nil {
+			return nil, line, err
+		}
+		tup, err := t.csvTuple(fields, tid)
+		return tup, line, err
+	})
+}
+
+// Load the rows of a file into the named table on behalf of tid, or in a
+// transaction of its own if tid is noTransaction. next returns the tuple of the
+// next row of the file and the line the row starts on, or io.EOF at the end of
+// the file. The rows for which next or the insert of their tuple return an
+// error that [rejectsRow] are rejected, and other errors stop the load.
+func (c *Catalog) loadRows(tid TransactionID, named string, next func(t *Table, tid TransactionID) (*Tuple, int, error)) (*BulkLoadResult, error) {
+	t, err := c.GetTableInfo(named)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkNotMaterialized(named); err != nil {
+		return nil, err
+	}
+	result := &BulkLoadResult{}
+	err = c.runDDL(tid, func(tid TransactionID) error {
+		if tid == noTransaction {
+			return GoDBError{IllegalOperationError, "bulk loads require a log file"}
+		}
+		loader := newTableLoader(t, tid)
+		for {
+			tup, line, err := next(t, tid)
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				err = loader.insert(tup)
+			}
+			if rejectsRow(err) {
+				dbErr := err.(GoDBError)
+				result.Rejected = append(result.Rejected, RejectedRow{line, dbErr.code, dbErr.errString})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			result.Loaded++
+		}
+		return loader.finish()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Load the named CSV or JSON Lines file into the named table on behalf of tid,
+// for the COPY FROM statement, whose options are the format, the separator of a
+// CSV file and whether it has a header (see [parseCopyOptions]).
+func (c *Catalog) copyFrom(tid TransactionID, named string, path string, options string) (*BulkLoadResult, error) {
+	opts, err := parseCopyOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.format {
+	case "csv":
+		if opts.sep == "" {
+			opts.sep = ","
+		}
+	case "jsonl":
+		if opts.sep != "" || opts.hasHeader {
+			return nil, GoDBError{ParseError, "jsonl files do not have a delimiter or a header"}
+		}
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("COPY FROM cannot read %s files", opts.format)}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if opts.format == "jsonl" {
+		return c.loadJSONL(tid, named, file)
+	}
+	return c.loadCSV(tid, named, file, opts.sep, opts.hasHeader)
+}
+
+// Return true if err is the reason a row of a bulk load is rejected, rather
+// than a failure of the load.
+func rejectsRow(err error) bool {
+	dbErr, ok := err.(GoDBError)
+	return ok && (dbErr.code == MalformedDataError || dbErr.code == TypeMismatchError || dbErr.code == ConstraintViolationError)
+}
+
+// A field of a CSV record.
+type csvField struct {
+	value  string
+	quoted bool // the field was enclosed in double quotes
+}
+
+// A reader of the records of a CSV file, as described by RFC 4180, whose
+// fields are separated by sep. Records end with "\n" or "\r\n", and empty
+// lines are skipped.
+type csvReader struct {
+	r    *bufio.Reader
+	sep  rune
+	line int // line of the next character
+}
+
+func newCSVReader(r io.Reader, sep rune) *csvReader {
+	return &csvReader{bufio.NewReader(r), sep, 1}
+}
+
+// Return the fields of the next record, and the line the record starts on, or
+// io.EOF at the end of the file. Returns a MalformedDataError if the record is
+// malformed, in which case the reader skips to the end of the line with the
+// error, so that the next record can be read.
+func (r *csvReader) read() ([]csvField, int, error) {
+	start := r.line
+	var fields []csvField
+	var field strings.Builder
+	quoted := false
+	for {
+		ch, _, err := r.r.ReadRune()
+		if err == io.EOF {
+			if fields == nil && field.Len() == 0 && !quoted {
+				return nil, start, io.EOF
+			}
+			return append(fields, csvField{field.String(), quoted}), start, nil
+		}
+		if err != nil {
+			return nil, start, err
+		}
+		if ch == '\r' {
+			if next, _, err := r.r.ReadRune(); err == nil && next == '\n' {
+				ch = '\n'
+			} else if err == nil {
+				r.r.UnreadRune()
+			}
+		}
+		switch {
+		case ch == '\n':
+			r.line++
+			if fields == nil && field.Len() == 0 && !quoted {
+				start = r.line
+				continue
+			}
+			return append(fields, csvField{field.String(), quoted}), start, nil
+		case ch == r.sep:
+			fields = append(fields, csvField{field.String(), quoted})
+			field.Reset()
+			quoted = false
+		case quoted:
+			return nil, start, r.malformed(fmt.Sprintf("unexpected %q after quoted field", ch))
+		case ch == '"' && field.Len() == 0:
+			quoted = true
+			if err := r.readQuoted(&field); err != nil {
+				return nil, start, err
+			}
+		case ch == '"':
+			return nil, start, r.malformed(`bare " in unquoted field`)
+		default:
+			field.WriteRune(ch)
+		}
+	}
+}
+
+// Read the rest of a quoted field, up to and including its closing quote, into
+// field.
+func (r *csvReader) readQuoted(field *strings.Builder) error {
+	for {
+		ch, _, err := r.r.ReadRune()
+		if err == io.EOF {
+			return GoDBError{MalformedDataError, "quoted field is not terminated"}
+		}
+		if err != nil {
+			return err
+		}
+		if ch == '\n' {
+			r.line++
+		}
+		if ch != '"' {
+			field.WriteRune(ch)
+			continue
+		}
+		if next, _, err := r.r.ReadRune(); err == nil && next == '"' {
+			field.WriteRune('"')
+			continue
+		} else if err == nil {
+			r.r.UnreadRune()
+		}
+		return nil
+	}
+}
+
+// Skip to the end of the current line, and return a MalformedDataError with
+// the specified message.
+func (r *csvReader) malformed(msg string) error {
+	for {
+		ch, _, err := r.r.ReadRune()
+		if err != nil {
+			break
+		}
+		if ch == '\n' {
+			r.line++
+			break
+		}
+	}
+	return GoDBError{MalformedDataError, msg}
+}
+
+// Return the value of type ftype of a CSV field: NULL if the field is empty and
+// not quoted, and otherwise the text of the field, or the value it is the
+// literal of, without the white space around it.
+func csvValue(f csvField, ftype DBType) (DBValue, error) {
+	if f.value == "" && !f.quoted {
+		return NullField{}, nil
+	}
+	if ftype == StringType {
+		return StringField{f.value}, nil
+	}
+	return parseValue(strings.TrimSpace(f.value), ftype)
+}
+
+// Return the tuple of the table for the fields of a CSV record, whose
+// AUTO_INCREMENT column is given the next value of its sequence on behalf of
+// tid if its field is NULL.
+func (t *Table) csvTuple(fields []csvField, tid TransactionID) (*Tuple, error) {
+	desc := t.file.Descriptor()
+	if len(fields) != len(desc.Fields) {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("expected %d fields, got %d", len(desc.Fields), len(fields))}
+	}
+	values := make([]DBValue, len(fields))
+	for i, f := range fields {
+		v, err := csvValue(f, desc.Fields[i].Ftype)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	t.fillSequences(values, tid)
+	return &Tuple{*desc, values, nil}, nil
+}
+
+// Give the AUTO_INCREMENT column of the table the next value of its sequence on
+// behalf of tid if its value is NULL, or move the sequence past its value.
+func (t *Table) fillSequences(values []DBValue, tid TransactionID) {
+	for i, col := range t.columns {
+		if col.seq == nil {
+			continue
+		}
+		if isNull(values[i]) {
+			values[i] = IntField{col.seq.next(tid)}
+		} else if v, ok := values[i].(IntField); ok {
+			col.seq.advance(tid, v.Value)
+		}
+	}
+}
+
+// Inserts the tuples of a bulk load into a table on behalf of a transaction.
+type tableLoader struct {
+	file DBFile
+	heap *HeapFile // the file, if pages are built and appended to it directly
+	tid  TransactionID
+
+	page *heapPage   // the page being filled, or nil
+	full []*heapPage // the full pages that are not yet appended
+}
+
+// Return a loader of tuples into table t on behalf of tid, which builds the
+// pages of the table directly if it is a heap file without indexes, keys or
+// foreign keys, so that inserts need not be checked against other tuples.
+func newTableLoader(t *Table, tid TransactionID) *tableLoader {
+	l := &tableLoader{file: t.file, tid: tid}
+	if hf, ok := t.file.(*HeapFile); ok && len(hf.indexes) == 0 && len(t.keys) == 0 && len(t.foreignKeys) == 0 {
+		l.heap = hf
+	}
+	return l
+}
+
+// Insert a tuple into the table, or add it to the page being filled.
+func (l *tableLoader) insert(t *Tuple) error {
+	if l.heap == nil {
+		return l.file.insertTuple(t, l.tid)
+	}
+	f := l.heap
+	if err := checkColumnValues(f.td, f.columns, t); err != nil {
+		return err
+	}
+	stored, err := f.storeOverflowValues(t, l.tid)
+	if err != nil {
+		return err
+	}
+	if l.page != nil {
+		if _, err := l.page.insertTuple(stored); err != ErrPageFull {
+			return err
+		}
+		l.full = append(l.full, l.page)
+		if len(l.full) == bulkLoadBatchPages {
+			if err := f.appendPages(l.full, l.tid); err != nil {
+				return err
+			}
+			l.full = nil
+		}
+	}
+	// the page number of the page is set when it is appended
+	if l.page, err = newHeapPage(f.td, -1, nil); err != nil {
+		return err
+	}
+	_, err = l.page.insertTuple(stored)
+	return err
+}
+
+// Append the pages that are not yet appended to the file, and make them
+// durable, so that the load can commit.
+func (l *tableLoader) finish() error {
+	if l.heap == nil {
+		return nil
+	}
+	if l.page != nil && l.page.numUsed > 0 {
+		l.full = append(l.full, l.page)
+	}
+	l.page = nil
+	if len(l.full) > 0 {
+		if err := l.heap.appendPages(l.full, l.tid); err != nil {
+			return err
+		}
+		l.full = nil
+	}
+	return l.heap.bufPool.DiskManager().Sync(l.heap.backingFile)
+}
+
+// Pages that a transaction appended to a heap file by a bulk load.
+type bulkLoad struct {
+	file      *HeapFile
+	firstPage int
+	numPages  int
+}
+
+// Append pages that are not in the buffer pool to the end of the HeapFile on
+// behalf of tid, which takes write locks on them. A BulkLoad record with the
+// page numbers is forced to the log first, but the pages themselves are not
+// logged.
+func (f *HeapFile) appendPages(pages []*heapPage, tid TransactionID) error {
+	bp := f.bufPool
+	f.Lock()
+	defer f.Unlock()
+	bp.Lock()
+	first := f.numPages
+	for i := range pages {
+		// no other transaction knows the pages yet
+		if bp.lockTable.TryLock(f, first+i, tid, WritePerm) != Grant {
+			bp.Unlock()
+			return GoDBError{IllegalOperationError, fmt.Sprintf("page %d of '%s' is locked", first+i, f.backingFile)}
+		}
+	}
+	c := bp.logFile.catalog
+	id, err := c.getFileId(f)
+	if err == nil {
+		err = bp.logFile.logBulkLoad(tid, id, first, len(pages))
+	}
+	if err != nil {
+		bp.Unlock()
+		return err
+	}
+	c.loaded[tid] = append(c.loaded[tid], bulkLoad{f, first, len(pages)})
+	bp.Unlock()
+
+	for i, p := range pages {
+		p.pageNo = first + i
+		p.file = f
+		if err := f.flushPage(p); err != nil {
+			return err
+		}
+	}
+	f.numPages += len(pages)
+	return nil
+}
+
+// Overwrite the specified pages of the HeapFile with empty pages, e.g., the
+// pages of a bulk load that did not commit.
+func (f *HeapFile) emptyPages(firstPage int, numPages int) error {
+	for pageNo := firstPage; pageNo < firstPage+numPages; pageNo++ {
+		p, err := newHeapPage(f.td, pageNo, f)
+		if err != nil {
+			return err
+		}
+		if err := f.flushPage(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forget the pages that tid appended by bulk loads, which has committed.
+func (c *Catalog) commitBulkLoads(tid TransactionID) {
+	delete(c.loaded, tid)
+}
+
+// Empty the pages that tid appended by bulk loads, which is aborting, unless
+// their table was created by tid too and is deleted.
+//
+// Caller must hold the bufferpool lock.
+func (c *Catalog) abortBulkLoads(tid TransactionID) {
+	for _, load := range c.loaded[tid] {
+		if _, err := c.getFileId(load.file); err != nil {
+			continue
+		}
+		if err := load.file.emptyPages(load.firstPage, load.numPages); err != nil {
+			log.Printf("Error undoing bulk load: %s\n", err)
+		}
+	}
+	delete(c.loaded, tid)
+}
+
+// Empty the pages of the bulk loads in the log whose transactions did not
+// commit before the database was closed or crashed. Must be called after the
+// updates of the log are recovered, since the pages of those transactions may
+// have been updated too.
+func (c *Catalog) recoverBulkLoads(logFile *LogFile) error {
+	if err := logFile.seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	committed := make(map[TransactionID]bool)
+	var loads []*BulkLoadLogRecord
+	iter := logFile.ForwardIterator()
+	for {
+		r, err := iter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		if load, ok := r.(*BulkLoadLogRecord); ok {
+			loads = append(loads, load)
+		} else if r.Type() == CommitRecord {
+			committed[r.Tid()] = true
+		}
+	}
+	for _, load := range loads {
+		if committed[load.Tid()] {
+			continue
+		}
+		f, err := c.getFileById(load.table)
+		hf, ok := f.(*HeapFile)
+		if err != nil || !ok {
+			// the table was dropped, or its creation rolled back
+			continue
+		}
+		// pages that were never written are not in the file
+		numPages := min(load.numPages, hf.NumPages()-load.firstPage)
+		if err := hf.emptyPages(load.firstPage, numPages); err != nil {
+			return err
+		}
+	}
+	return logFile.seek(0, io.SeekEnd)
+}
@@ -0,0 +1,165 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCSVReader(t *testing.T) {
+	input := "a,\"b,c\",\"say \"\"hi\"\"\"\r\n" +
+		"\n" +
+		"1,,\"\"\n" +
+		"\"two\nlines\",x,y\n" +
+		"bad\"quote,x,y\n" +
+		"\"closed\"junk,x\n" +
+		"last,row,here"
+	r := newCSVReader(strings.NewReader(input), ',')
+	for _, want := range []struct {
+		line   int
+		fields []csvField
+		err    bool
+	}{
+		{1, []csvField{{"a", false}, {"b,c", true}, {`say "hi"`, true}}, false},
+		{3, []csvField{{"1", false}, {"", false}, {"", true}}, false},
+		{4, []csvField{{"two\nlines", true}, {"x", false}, {"y", false}}, false},
+		{6, nil, true},
+		{7, nil, true},
+		{8, []csvField{{"last", false}, {"row", false}, {"here", false}}, false},
+	} {
+		fields, line, err := r.read()
+		if line != want.line || (err != nil) != want.err || fmt.Sprint(fields) != fmt.Sprint(want.fields) {
+			t.Errorf("expected %v at line %d (error %v), got %v at line %d (%v)", want.fields, want.line, want.err, fields, line, err)
+		}
+	}
+	if _, _, err := r.read(); err == nil || err.Error() != "EOF" {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	r = newCSVReader(strings.NewReader("a|\"unterminated|b\nc|d\n"), '|')
+	if _, _, err := r.read(); err == nil {
+		t.Errorf("expected an unterminated quoted field to be an error")
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (id int auto_increment, name text not null, age int)", noTransaction)
+	var csv strings.Builder
+	csv.WriteString("id,name,age\n")
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&csv, "%d,\"person %d, the %dth\",%d\n", i, i, i, i%90)
+	}
+	csv.WriteString(",\"no id\",\n")
+	csv.WriteString("5002,,5\n")
+	csv.WriteString("5003,x,old\n")
+	csv.WriteString("5004,x\n")
+	result, err := c.LoadCSV("people", strings.NewReader(csv.String()), ",", true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result.Loaded != 5001 || len(result.Rejected) != 3 ||
+		result.Rejected[0].Line != 5003 || result.Rejected[1].Line != 5004 || result.Rejected[2].Line != 5005 {
+		t.Errorf("expected 5001 loaded rows and rejected lines 5003-5005, got %d and %v", result.Loaded, result.Rejected)
+	}
+	people, _ := c.GetTable("people")
+	if n := people.(*HeapFile).NumPages(); n <= bulkLoadBatchPages {
+		t.Errorf("expected the rows to fill more than a batch of pages, got %d", n)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id, age from people where name = 'no id'", noTransaction); len(tups) != 1 ||
+		tups[0].Fields[0] != (IntField{5001}) || !isNull(tups[0].Fields[1]) {
+		t.Errorf("expected the next id of the sequence and a NULL age, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select count(*) from people where name = 'person 1234, the 1234th'", noTransaction); tups[0].Fields[0] != (IntField{1}) {
+		t.Errorf("expected a quoted name with a comma, got %v", tups)
+	}
+
+	// an abort empties the loaded pages
+	tid := BeginTransactionForTest(t, bp)
+	if _, err := c.loadCSV(tid, "people", strings.NewReader("9000,gone,1\n"), ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.AbortTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select count(*) from people", noTransaction); tups[0].Fields[0] != (IntField{5001}) {
+		t.Errorf("expected the aborted load to be undone, got %v", tups)
+	}
+
+	// the loads of transactions that did not commit are undone by recovery
+	tid = BeginTransactionForTest(t, bp)
+	if _, err := c.loadCSV(tid, "people", strings.NewReader("9001|crashed|1\n"), "|", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if tups := runSQLForTest(t, bp2, c2, "select count(*) from people", noTransaction); tups[0].Fields[0] != (IntField{5001}) {
+		t.Errorf("expected recovery to undo the load, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select max(id) from people", noTransaction); tups[0].Fields[0] != (IntField{5001}) {
+		t.Errorf("expected the committed rows to survive recovery, got %v", tups)
+	}
+
+	for _, bad := range []string{"", ",,", "\""} {
+		if _, err := c2.LoadCSV("people", strings.NewReader("1,a,1\n"), bad, false); err == nil {
+			t.Errorf("expected separator %q to be an error", bad)
+		}
+	}
+	if _, err := c2.LoadCSV("missing", strings.NewReader("1\n"), ",", false); err == nil {
+		t.Errorf("expected a load into a missing table to be an error")
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	bp, c, _, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table cities (id int primary key, name text)", noTransaction)
+	path := root + "/cities.csv"
+	if err := os.WriteFile(path, []byte("id|name\n1|paris\n2|'s-hertogenbosch\n1|again\nx|bad\n3|\"new\nyork\"\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	_, op, err := ParseInTransaction(c, fmt.Sprintf("copy cities from '%s' with (delimiter '|', header)", path), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	result := op.(*BulkLoadResult)
+	if result.Loaded != 3 {
+		t.Errorf("expected 3 loaded rows, got %d", result.Loaded)
+	}
+	tups := runQueryForTest(t, bp, op, noTransaction)
+	if len(tups) != 2 || tups[0].Fields[0] != (IntField{4}) || tups[1].Fields[0] != (IntField{5}) ||
+		tups[0].Fields[1] != (StringField{"ConstraintViolationError"}) || tups[1].Fields[1] != (StringField{"TypeMismatchError"}) {
+		t.Errorf("expected the duplicate key and the bad id to be rejected, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id, name from cities order by id", noTransaction); len(tups) != 3 ||
+		tups[1].Fields[1] != (StringField{"'s-hertogenbosch"}) || tups[2].Fields[1] != (StringField{"new\nyork"}) {
+		t.Errorf("unexpected cities %v", tups)
+	}
+
+	// a value too large for the index of its column rejects the row, and
+	// leaves no tuple without an index entry behind
+	runSQLForTest(t, bp, c, "create index cities_name on cities(name)", noTransaction)
+	result, err = c.LoadCSV("cities", strings.NewReader("6,"+strings.Repeat("x", 2000)+"\n7,rome\n"), ",", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result.Loaded != 1 || len(result.Rejected) != 1 || result.Rejected[0].Line != 1 {
+		t.Errorf("expected the row with the large value to be rejected, got %d and %v", result.Loaded, result.Rejected)
+	}
+	if tups := runSQLForTest(t, bp, c, "select count(*) from cities", noTransaction); tups[0].Fields[0] != (IntField{4}) {
+		t.Errorf("expected 4 cities, got %v", tups)
+	}
+	if _, err := execSQLForTest(t, bp, c, "delete from cities where id > 0", noTransaction); err != nil {
+		t.Errorf("expected the cities to be deleted, got %s", err.Error())
+	}
+	runSQLForTest(t, bp, c, "alter table cities add column country text", noTransaction)
+
+	for _, sql := range []string{
+		fmt.Sprintf("copy cities from '%s' with (delimiter '||')", path),
+		fmt.Sprintf("copy cities from '%s' with (quote '\"')", path),
+		fmt.Sprintf("copy nowhere from '%s'", path),
+		fmt.Sprintf("copy cities from '%s.missing'", path),
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
@@ -5,14 +5,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 type Table struct {
-	id   int
-	name string
-	desc TupleDesc
+	id       int
+	name     string
+	fileName string // name of the file of the table in the root directory
+	desc     TupleDesc
+	columns  []columnInfo
+	keys     []tableKey // PRIMARY KEY and UNIQUE constraints (see constraints.go)
+
+	foreignKeys []foreignKey // FOREIGN KEY constraints (see foreign_keys.go)
 
 	// statistics
 	stats *TableStats
@@ -20,40 +29,116 @@ type Table struct {
 	file DBFile
 }
 
+// Declared properties of a column that are not captured by its FieldType.
+type columnInfo struct {
+	typeName string // declared type, e.g., "varchar" or "text"
+	length   int    // maximum length of a varchar(n) column, or 0 if unbounded
+	notNull  bool   // whether the column was declared NOT NULL
+
+	// DEFAULT of the column as written in the catalog file, e.g., "'paris'" or
+	// "current_timestamp", or "" if it has none (see column_defaults.go)
+	defaultValue string
+	seq          *sequence // counter of an AUTO_INCREMENT column, or nil
+}
+
+// Return the declared type and constraints of the column, as written in the
+// catalog file.
+func (col columnInfo) String() string {
+	typ := col.typeName
+	if col.length > 0 {
+		typ = fmt.Sprintf("%s(%d)", col.typeName, col.length)
+	}
+	if col.notNull {
+		typ += " not null"
+	}
+	if col.defaultValue != "" {
+		typ += " default " + col.defaultValue
+	}
+	if col.seq != nil {
+		typ += " auto_increment"
+	}
+	return typ
+}
+
+// Return the default column information for fields of the supplied types.
+func defaultColumns(desc *TupleDesc) []columnInfo {
+	cols := make([]columnInfo, len(desc.Fields))
+	for i, f := range desc.Fields {
+		cols[i] = columnInfo{columnTypeName(f.Ftype), 0, false, "", nil}
+	}
+	return cols
+}
+
+// Return the name of the column type that [parseColumnType] parses to ftype,
+// e.g., "text" for StringType.
+func columnTypeName(ftype DBType) string {
+	if ftype == StringType {
+		return "text"
+	}
+	return ftype.String()
+}
+
 type Catalog struct {
 	tableMap   map[string]*Table
 	columnMap  map[string][]*Table
+	indexMap   map[string]*Index
 	bufferPool *BufferPool
 	rootPath   string
 	filePath   string
+
+	// next file number to hand out to a table or index. File numbers identify
+	// files in log records, so they are never reused, even after a drop.
+	nextFileId int
+
+	// tables created and dropped by transactions that have not committed
+	created map[TransactionID][]*Table
+	dropped map[TransactionID][]*droppedTable
+
+	// indexes created and dropped by those transactions, in the order they
+	// were created and dropped
+	indexChanges map[TransactionID][]indexChange
+
+	// views created and dropped by those transactions, in the same order
+	viewChanges map[TransactionID][]viewChange
+
+	// read-only tables that describe the catalog (see system_tables.go)
+	systemTables map[string]*Table
+
+	// named queries, which are kept in a file of their own (see views.go)
+	viewMap map[string]*view
+
+	// pages appended by the bulk loads of transactions that have not committed
+	// (see bulk_load.go)
+	loaded map[TransactionID][]bulkLoad
 }
 
+// Write the catalog to the catalog file, and its views to the views file next
+// to it (see views.go). Unlike [Catalog.String], the entries record the file
+// numbers of the tables and indexes, and the next file number, so that they
+// survive a restart.
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
 	f, err := os.OpenFile(rootPath+"/"+catalogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
-	f.WriteString(c.String())
+	f.WriteString(c.format(true))
 	f.Close()
-	return nil
+	return c.saveViews(catalogFile, rootPath)
 }
 
+// Remove a table and its indexes from the catalog, and delete their files and
+// cached pages. The drop is not logged, see [Catalog.dropTableInTransaction].
 func (c *Catalog) dropTable(tableName string) error {
-	_, ok := c.tableMap[tableName]
+	t, ok := c.tableMap[tableName]
 	if !ok {
 		return GoDBError{NoSuchTableError, "couldn't find table to drop"}
 	}
 
-	delete(c.tableMap, tableName)
-	for cn, ts := range c.columnMap {
-		tsFiltered := make([]*Table, 0)
-		for _, t := range ts {
-			if t.name != tableName {
-				tsFiltered = append(tsFiltered, t)
-			}
-		}
-		c.columnMap[cn] = tsFiltered
-	}
+	indexes := c.unregisterTable(t)
+	def := c.tableDef(t, indexes)
+	c.bufferPool.Lock()
+	c.bufferPool.removeFiles(tableFiles(t, indexes), c.tableFileNames(&def))
+	c.bufferPool.Unlock()
 	return nil
 }
 
@@ -70,10 +155,11 @@ func ImportCatalogFromCSVs(
 	for _, t := range c.tableMap {
 		fileName := rootPath + "/" + t.name + "." + tableSuffix
 		log.Printf("Loading %s from %s...\n", t.name, fileName)
-		hf, err := NewHeapFile(c.tableNameToFile(t.name), t.desc.copy(), c.bufferPool)
+		hf, err := NewHeapFile(c.rootFile(t.fileName), t.desc.copy(), c.bufferPool)
 		if err != nil {
 			return err
 		}
+		hf.columns = t.columns
 		f, err := os.Open(fileName)
 		if err != nil {
 			return err
@@ -95,43 +181,67 @@ func (c *Catalog) parseCatalogFile() error {
 
 	for scanner.Scan() {
 		// code to read each line
-		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+		line := lowerUnquoted(scanner.Text())
+		if m := nextFileIdRe.FindStringSubmatch(line); m != nil {
+			next, _ := strconv.Atoi(m[1])
+			c.nextFileId = max(c.nextFileId, next)
+			continue
+		}
+		// entries of catalog files written by older versions have no file
+		// number, and are numbered in order
+		id := c.nextFileId
+		fileName := ""
+		var last int64
+		if m := fileIdRe.FindStringSubmatch(line); m != nil {
+			line = m[1]
+			id, _ = strconv.Atoi(m[2])
+			fileName = m[3]
+			last, _ = strconv.ParseInt(m[4], 10, 64)
+		}
+		if strings.HasPrefix(line, "index ") {
+			if err := c.parseIndexEntry(line, id, fileName); err != nil {
+				return err
+			}
+			continue
+		}
+		storage := "heap"
+		if m := tableStorageRe.FindStringSubmatch(line); m != nil {
+			line, storage = m[1], m[2]
 		}
-		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
+		line, keys, fks := parseTableConstraints(line)
+		open := strings.Index(line, "(")
+		if open == -1 || !strings.HasSuffix(strings.TrimSpace(line), ")") {
+			return GoDBError{ParseError, fmt.Sprintf("expected parenthesized field list in catalog entry (%s)", line)}
+		}
+		tableName := strings.TrimSpace(line[:open])
+		rest := strings.TrimSpace(line[open+1:])
+		rest = rest[:len(rest)-1]
+		fields := splitUnquoted(rest)
 
 		var fieldArray []FieldType
+		var columns []columnInfo
 		for _, f := range fields {
-			f := strings.TrimSpace(f)
-			nameType := strings.Split(f, " ")
-			if len(nameType) < 2 || len(nameType) > 4 {
-				return GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
+			m := columnDefRe.FindStringSubmatch(strings.TrimSpace(f))
+			if m == nil {
+				return GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", f, line)}
 			}
-
-			name := nameType[0]
-			fieldType := FieldType{name, "", IntType}
-			switch nameType[1] {
-			case "int":
-				fallthrough
-			case "integer":
-				fieldType.Ftype = IntType
-			case "string":
-				fallthrough
-			case "varchar":
-				fallthrough
-			case "text":
-				fieldType.Ftype = StringType
-			default:
-				return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+			col, ftype, err := parseColumnType(m[2])
+			if err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("%s (line %s)", err.Error(), line)}
+			}
+			col.notNull = m[3] != ""
+			col.defaultValue = m[4]
+			if m[5] != "" {
+				col.seq = newSequence(last, id, len(fieldArray), c.bufferPool)
 			}
-			fieldArray = append(fieldArray, fieldType)
+			fieldArray = append(fieldArray, FieldType{m[1], "", ftype})
+			columns = append(columns, col)
 		}
 
-		_, err := c.addTable(tableName, TupleDesc{fieldArray})
+		if fileName == "" {
+			fileName = defaultTableFile(tableName, storage)
+		}
+		_, err := c.openTable(id, tableName, fileName, TupleDesc{fieldArray}, columns, keys, fks, storage)
 		if err != nil {
 			return err
 		}
@@ -139,8 +249,123 @@ func (c *Catalog) parseCatalogFile() error {
 	return nil
 }
 
+// A column of a table line of the catalog file, e.g., "a int", "b varchar(10)
+// not null default 'x'" or "c int not null auto_increment".
+var columnDefRe = regexp.MustCompile(`^(\w+)\s+(\w+(?:\(\s*\d+\s*\))?)(\s+not\s+null)?(?:\s+default\s+('(?:[^']|'')*'|[-+.:\w]+))?(\s+auto_increment)?$`)
+
+// Return s in lower case, except for the quoted strings in it, e.g., the
+// default values of columns.
+func lowerUnquoted(s string) string {
+	var buf strings.Builder
+	quoted := false
+	for _, r := range s {
+		if r == '\'' {
+			quoted = !quoted
+		}
+		if !quoted {
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// Split s at the commas that are not in quoted strings.
+func splitUnquoted(s string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// The catalog file starts with the next file number, e.g., "next id 7", and
+// each entry ends with the file number of its table or index, e.g.,
+// "t (a int, b int) id 3", followed by the name of its file if it is not the
+// default one (see [versionedFile]), e.g., "t (a int) id 7 file t.7.dat", and
+// by the counter of the sequence of a table with an AUTO_INCREMENT column, e.g.,
+// "t (a int auto_increment) id 3 sequence 17".
+var (
+	nextFileIdRe = regexp.MustCompile(`^next\s+id\s+(\d+)\s*$`)
+	fileIdRe     = regexp.MustCompile(`^(.*)\s+id\s+(\d+)(?:\s+file\s+(\S+))?(?:\s+sequence\s+(\d+))?\s*$`)
+)
+
+// A table line of the catalog file may end with the keys and foreign keys of
+// the table (see [parseTableConstraints]) and the storage method of the table, e.g.,
+// "t (a int, b int) using column".
+var tableStorageRe = regexp.MustCompile(`^(.*\))\s*using\s+(\w+)\s*$`)
+
+var columnTypeRe = regexp.MustCompile(`^(\w+)(?:\(\s*(\d+)\s*\))?$`)
+
+// Parse a declared column type, e.g., "int", "text", "varchar(255)", "float",
+// "bool", "date", "timestamp" or "blob".
+func parseColumnType(typ string) (columnInfo, DBType, error) {
+	m := columnTypeRe.FindStringSubmatch(strings.ToLower(typ))
+	if m == nil {
+		return columnInfo{}, UnknownType, fmt.Errorf("malformed type %s", typ)
+	}
+	length := 0
+	if m[2] != "" {
+		length, _ = strconv.Atoi(m[2])
+	}
+	if length != 0 && m[1] != "varchar" {
+		return columnInfo{}, UnknownType, fmt.Errorf("type %s does not take a length", m[1])
+	}
+	switch m[1] {
+	case "int", "integer":
+		return columnInfo{"int", 0, false, "", nil}, IntType, nil
+	case "string", "text":
+		return columnInfo{m[1], 0, false, "", nil}, StringType, nil
+	case "varchar":
+		return columnInfo{"varchar", length, false, "", nil}, StringType, nil
+	case "float", "double", "real":
+		return columnInfo{"float", 0, false, "", nil}, FloatType, nil
+	case "bool", "boolean", "bit":
+		return columnInfo{"bool", 0, false, "", nil}, BoolType, nil
+	case "date":
+		return columnInfo{"date", 0, false, "", nil}, DateType, nil
+	case "timestamp", "datetime":
+		return columnInfo{"timestamp", 0, false, "", nil}, TimestampType, nil
+	case "blob", "bytea":
+		return columnInfo{"blob", 0, false, "", nil}, BlobType, nil
+	}
+	return columnInfo{}, UnknownType, fmt.Errorf("unknown type %s", m[1])
+}
+
+var indexEntryRe = regexp.MustCompile(`^index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)\s+using\s+(\w+)\s*$`)
+
+// Parse an index line of the catalog file, which has the form
+//
+//	index name on table(column) using method
+//
+// and add the index with the specified file number and file, or the default
+// file of the index if fileName is empty.
+func (c *Catalog) parseIndexEntry(line string, id int, fileName string) error {
+	m := indexEntryRe.FindStringSubmatch(line)
+	if m == nil {
+		return GoDBError{ParseError, fmt.Sprintf("malformed index entry (line %s)", line)}
+	}
+	if fileName == "" {
+		fileName = defaultIndexFile(m[1])
+	}
+	_, err := c.openIndex(id, m[1], fileName, m[2], m[3], m[4])
+	return err
+}
+
 func NewCatalog(catalogFile string, bp *BufferPool, rootPath string) *Catalog {
-	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile}
+	c := &Catalog{make(map[string]*Table), make(map[string][]*Table), make(map[string]*Index), bp, rootPath, catalogFile, 0, make(map[TransactionID][]*Table), make(map[TransactionID][]*droppedTable), make(map[TransactionID][]indexChange), make(map[TransactionID][]viewChange), make(map[string]*Table), make(map[string]*view), make(map[TransactionID][]bulkLoad)}
+	for name, st := range newSystemTables(c) {
+		c.systemTables[name] = &Table{-1, name, "", st.desc, defaultColumns(&st.desc), nil, nil, nil, st}
+	}
+	return c
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
@@ -148,6 +373,9 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 	if err := c.parseCatalogFile(); err != nil {
 		return nil, err
 	}
+	if err := c.loadViews(); err != nil {
+		return nil, err
+	}
 	catFile := fmt.Sprintf("%s.log", catalogFile)
 	//os.Remove(catFile)
 	lf, err := NewLogFile(catFile, bp, c)
@@ -155,14 +383,28 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 		return nil, err
 	}
 
+	if err := c.recoverTables(lf); err != nil {
+		return nil, err
+	}
+	if err := c.recoverSequences(lf); err != nil {
+		return nil, err
+	}
 	if err := bp.Recover(lf); err != nil {
 		return nil, err
 	}
+	if err := c.recoverBulkLoads(lf); err != nil {
+		return nil, err
+	}
 
 	if err := c.ComputeTableStats(); err != nil {
 		return nil, err
 	}
 
+	// recovery may have created or dropped tables
+	if err := c.SaveToFile(catalogFile, rootPath); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -170,27 +412,257 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 //
 // Returns an error if the table already exists.
 func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
-	f, err := c.GetTable(named)
-	if err == nil {
-		return f, GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+	return c.createTable(named, desc, defaultColumns(&desc), nil, nil, "heap")
+}
+
+// Add a new table whose columns have the specified declared types, keys and
+// foreign keys to the catalog. The table is stored in a [HeapFile] if storage
+// is "heap", or in a [ColumnFile] if it is "column". The keys are not given
+// indexes (see [Catalog.createTableInTransaction]), and the tables that the
+// foreign keys reference are not checked (see [Catalog.checkNewForeignKeys]).
+//
+// Returns an error if the table already exists, the storage method is
+// unknown, or a key is invalid or on a column table.
+func (c *Catalog) createTable(named string, desc TupleDesc, columns []columnInfo, keys []tableKey, fks []foreignKey, storage string) (DBFile, error) {
+	t, err := c.openTable(c.nextFileId, named, defaultTableFile(named, storage), desc, columns, keys, fks, storage)
+	if t == nil {
+		return nil, err
 	}
+	return t.file, err
+}
 
-	hf, err := NewHeapFile(c.tableNameToFile(named), &desc, c.bufferPool)
+// Add a table with the specified file number to the catalog, opening its file,
+// which is named fileName in the root directory, e.g., when the catalog file is
+// read. See [Catalog.createTable].
+func (c *Catalog) openTable(id int, named string, fileName string, desc TupleDesc, columns []columnInfo, keys []tableKey, fks []foreignKey, storage string) (*Table, error) {
+	if t, ok := c.tableMap[named]; ok {
+		return t, GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+	}
+	if _, ok := c.systemTables[named]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("'%s' is the name of a system table", named)}
+	}
+	if _, ok := c.viewMap[named]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("a view named '%s' already exists", named)}
+	}
+	if _, err := c.getFileById(id); err == nil {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("file number %d of table '%s' is already in use", id, named)}
+	}
+	keys, err := resolveKeys(&desc, keys)
+	if err != nil {
+		return nil, err
+	}
+	fks, err = resolveForeignKeys(&desc, fks)
+	if err != nil {
+		return nil, err
+	}
+	columns, err = c.openSequences(id, named, &desc, columns)
 	if err != nil {
 		return nil, err
 	}
+	if (len(keys) > 0 || len(fks) > 0) && storage != "heap" {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("keys are not supported on %s table '%s'", storage, named)}
+	}
 
-	t := &Table{len(c.tableMap), named, desc, nil, hf}
-	c.tableMap[named] = t
-	for _, f := range desc.Fields {
+	var file DBFile
+	switch storage {
+	case "heap":
+		hf, err := NewHeapFile(c.rootFile(fileName), &desc, c.bufferPool)
+		if err != nil {
+			return nil, err
+		}
+		hf.columns = columns
+		hf.keys = keys
+		hf.catalog = c
+		file = hf
+	case "column":
+		cf, err := NewColumnFile(c.rootFile(fileName), &desc, c.bufferPool)
+		if err != nil {
+			return nil, err
+		}
+		cf.columns = columns
+		file = cf
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown storage method %s for table %s", storage, named)}
+	}
+
+	t := &Table{id, named, fileName, desc, columns, keys, fks, nil, file}
+	c.nextFileId = max(c.nextFileId, id+1)
+	c.registerTable(t)
+	return t, nil
+}
+
+// Add an open table to the maps of the catalog.
+func (c *Catalog) registerTable(t *Table) {
+	c.tableMap[t.name] = t
+	for _, f := range t.desc.Fields {
 		mapList := c.columnMap[f.Fname]
 		if mapList == nil {
 			mapList = make([]*Table, 0)
 		}
 		c.columnMap[f.Fname] = append(mapList, t)
 	}
+}
 
-	return hf, nil
+// Remove a table and its indexes from the maps of the catalog, without closing
+// or deleting their files. The indexes stay attached to the table's heap file,
+// so that registering the table and its indexes again restores the table as it
+// was. Returns the indexes of the table, ordered by name.
+func (c *Catalog) unregisterTable(t *Table) []*Index {
+	indexes := c.tableIndexes(t.name)
+	for _, idx := range indexes {
+		delete(c.indexMap, idx.name)
+	}
+	delete(c.tableMap, t.name)
+	for cn, ts := range c.columnMap {
+		tsFiltered := make([]*Table, 0)
+		for _, other := range ts {
+			if other != t {
+				tsFiltered = append(tsFiltered, other)
+			}
+		}
+		c.columnMap[cn] = tsFiltered
+	}
+	return indexes
+}
+
+// Return the indexes of the specified table, ordered by name.
+func (c *Catalog) tableIndexes(tableName string) []*Index {
+	var indexes []*Index
+	for _, idx := range c.indexMap {
+		if idx.table == tableName {
+			indexes = append(indexes, idx)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].name < indexes[j].name })
+	return indexes
+}
+
+// Add a new index on column of the specified table to the catalog and attach
+// it to the table's heap file, so that subsequent inserts and deletes maintain
+// it. The index file is opened if it exists, but existing tuples of the table
+// are not added to it (see [Catalog.CreateIndex]).
+//
+// Returns an error if an index or table with the same name already exists.
+func (c *Catalog) addIndex(name string, tableName string, column string, method string) (*Index, error) {
+	return c.openIndex(c.nextFileId, name, defaultIndexFile(name), tableName, column, method)
+}
+
+// Add an index with the specified file number, whose file is named fileName in
+// the root directory, to the catalog. See [Catalog.addIndex].
+func (c *Catalog) openIndex(id int, name string, fileName string, tableName string, column string, method string) (*Index, error) {
+	if _, ok := c.indexMap[name]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("an index named '%s' already exists", name)}
+	}
+	if _, ok := c.tableMap[name]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", name)}
+	}
+	if _, ok := c.viewMap[name]; ok {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("a view named '%s' already exists", name)}
+	}
+	t, err := c.GetTableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	hf, ok := t.file.(*HeapFile)
+	if !ok {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("cannot index table '%s'", tableName)}
+	}
+	field, err := findFieldInTd(FieldType{column, "", UnknownType}, &t.desc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.getFileById(id); err == nil {
+		return nil, GoDBError{DuplicateTableError, fmt.Sprintf("file number %d of index '%s' is already in use", id, name)}
+	}
+	f, err := newIndexFile(method, c.rootFile(fileName), t.desc.Fields[field], c.bufferPool)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{id, name, fileName, tableName, column, field, method, f}
+	c.nextFileId = max(c.nextFileId, id+1)
+	c.indexMap[name] = idx
+	hf.addIndex(idx)
+	return idx, nil
+}
+
+// Remove an index from the catalog, detach it from its table and delete its
+// file.
+func (c *Catalog) dropIndex(name string) error {
+	idx, ok := c.indexMap[name]
+	if !ok {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no index '%s' found", name)}
+	}
+	delete(c.indexMap, name)
+	if t, ok := c.tableMap[idx.table]; ok {
+		if hf, ok := t.file.(*HeapFile); ok {
+			hf.removeIndex(idx)
+		}
+	}
+	if c.bufferPool != nil {
+		c.bufferPool.discardPages(idx.file)
+	}
+	c.bufferPool.DiskManager().Remove(c.rootFile(idx.fileName))
+	return nil
+}
+
+// Return an index on the specified column of a table that supports lookups
+// with op, or nil if there is no such index. If there are several, the first
+// by name is returned.
+func (c *Catalog) findIndex(tableName string, column string, op BoolOp) *Index {
+	var found *Index
+	for _, idx := range c.indexMap {
+		if idx.table == tableName && idx.column == column && idx.file.supportsOp(op) && (found == nil || idx.name < found.name) {
+			found = idx
+		}
+	}
+	return found
+}
+
+func (c *Catalog) indexNameToFile(indexName string) string {
+	return c.rootFile(defaultIndexFile(indexName))
+}
+
+// The file number of the overflow file of a heap file is the number of the
+// heap file with this bit set.
+const overflowFileIdFlag = 1 << 30
+
+// Return the file (table, index or overflow file) with the specified file
+// number. File numbers identify files in log records.
+func (c *Catalog) getFileById(id int) (DBFile, error) {
+	if id&overflowFileIdFlag != 0 {
+		if t, err := c.GetTableInfoId(id &^ overflowFileIdFlag); err == nil {
+			if hf, ok := t.file.(*HeapFile); ok {
+				return hf.overflow, nil
+			}
+		}
+	}
+	if t, err := c.GetTableInfoId(id); err == nil {
+		return t.file, nil
+	}
+	for _, idx := range c.indexMap {
+		if idx.id == id {
+			return idx.file, nil
+		}
+	}
+	return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no file '%d' found", id)}
+}
+
+// Return the file number of the specified table, index or overflow file.
+func (c *Catalog) getFileId(f DBFile) (int, error) {
+	if of, ok := f.(*overflowFile); ok {
+		id, err := c.getFileId(of.heapFile)
+		return id | overflowFileIdFlag, err
+	}
+	if t, err := c.GetTableInfoDBFile(f); err == nil {
+		return t.id, nil
+	}
+	for _, idx := range c.indexMap {
+		if idx.file == f {
+			return idx.id, nil
+		}
+	}
+	return 0, GoDBError{NoSuchTableError, "file not found"}
 }
 
 func (c *Catalog) ComputeTableStats() error {
@@ -199,13 +671,50 @@ func (c *Catalog) ComputeTableStats() error {
 		if err != nil {
 			return err
 		}
+		stats.unique = t.uniqueColumns()
 		t.stats = stats
 	}
 	return nil
 }
 
 func (c *Catalog) tableNameToFile(tableName string) string {
-	return c.rootPath + "/" + tableName + ".dat"
+	return c.rootFile(defaultTableFile(tableName, "heap"))
+}
+
+// Return the name of the file that stores a table created with USING column.
+func (c *Catalog) columnTableToFile(tableName string) string {
+	return c.rootFile(defaultTableFile(tableName, "column"))
+}
+
+// Return the path of the file with the specified name in the root directory.
+func (c *Catalog) rootFile(fileName string) string {
+	return c.rootPath + "/" + fileName
+}
+
+// Return the name of the file in the root directory that stores a table with
+// the specified storage method, unless the table replaced another table with
+// the same name (see [versionedFile]).
+func defaultTableFile(tableName string, storage string) string {
+	if storage == "column" {
+		return tableName + ".col"
+	}
+	return tableName + ".dat"
+}
+
+// Return the name of the file in the root directory that stores an index,
+// unless the index replaced another index with the same name.
+func defaultIndexFile(indexName string) string {
+	return indexName + ".idx"
+}
+
+// Return the name of the file of a table or index with the specified file
+// number that replaces one with the same name, whose default file is fileName,
+// e.g., "t.7.dat" for file 7 of table t. The files of a table that ALTER TABLE
+// rewrites are only deleted when the transaction commits, so the new version
+// of the table needs files of its own.
+func versionedFile(fileName string, id int) string {
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(fileName, ext), id, ext)
 }
 
 func (c *Catalog) GetTableInfo(named string) (*Table, error) {
@@ -216,7 +725,13 @@ func (c *Catalog) GetTableInfo(named string) (*Table, error) {
 	return t, nil
 }
 
+// Return the file of the named table, which may be a system table.
+// [Catalog.GetTableInfo] only returns the tables whose definitions can be
+// changed, and not the system tables.
 func (c *Catalog) GetTable(named string) (DBFile, error) {
+	if t, ok := c.systemTables[named]; ok {
+		return t.file, nil
+	}
 	t, err := c.GetTableInfo(named)
 	if err != nil {
 		return nil, err
@@ -253,8 +768,18 @@ func (c *Catalog) GetTableStats(named string) *TableStats {
 	return t.stats
 }
 
+// Return the tables, including the system tables, that have a column with the
+// specified name.
 func (c *Catalog) findTablesWithColumn(named string) []*Table {
-	return c.columnMap[named]
+	tables := c.columnMap[named]
+	for _, t := range c.systemTables {
+		for _, f := range t.desc.Fields {
+			if f.Fname == named {
+				tables = append(tables[:len(tables):len(tables)], t)
+			}
+		}
+	}
+	return tables
 }
 
 func (c *Catalog) NumTables() int {
@@ -271,21 +796,104 @@ func (t *Table) String() string {
 		}
 		buf.WriteString(f.Fname)
 		buf.WriteByte(' ')
-		buf.WriteString(f.Ftype.String())
+		buf.WriteString(t.columns[i].String())
+	}
+	buf.WriteString(")")
+	for _, k := range t.keys {
+		buf.WriteByte(' ')
+		buf.WriteString(k.String())
+	}
+	for _, fk := range t.foreignKeys {
+		buf.WriteByte(' ')
+		buf.WriteString(fk.String())
+	}
+	if _, ok := t.file.(*ColumnFile); ok {
+		buf.WriteString(" using column")
 	}
-	buf.WriteString(")\n")
+	if t.temporary() {
+		buf.WriteString(" temporary")
+	}
+	buf.WriteString("\n")
 	return buf.String()
 }
 
+// Check the checksums of the pages of every table on disk, and return the pages
+// that are damaged, ordered by table name and page number.
+func (c *Catalog) VerifyTables() ([]CorruptPage, error) {
+	keys := make([]string, 0, len(c.tableMap))
+	for k := range c.tableMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var bad []CorruptPage
+	for _, name := range keys {
+		hf, ok := c.tableMap[name].file.(*HeapFile)
+		if !ok {
+			continue
+		}
+		pages, err := hf.verifyPages()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pages {
+			p.Table = name
+			bad = append(bad, p)
+		}
+	}
+	return bad, nil
+}
+
+// Return the tables, indexes and views of the catalog, one per line.
 func (c *Catalog) String() string {
+	s := c.format(false)
+	for _, v := range c.views() {
+		s += v.String() + "\n"
+	}
+	return s
+}
+
+// Return the tables and then the indexes of the catalog, one per line and
+// ordered by name. If withIds is set, the file numbers are included, as in the
+// catalog file.
+func (c *Catalog) format(withIds bool) string {
 	var buf strings.Builder
+	entry := func(s string, id int, fileName string, defaultFile string, seq *sequence) {
+		if withIds {
+			s = fmt.Sprintf("%s id %d", strings.TrimSuffix(s, "\n"), id)
+			if fileName != defaultFile {
+				s += " file " + fileName
+			}
+			if seq != nil {
+				s += fmt.Sprintf(" sequence %d", seq.lastValue())
+			}
+			s += "\n"
+		}
+		buf.WriteString(s)
+	}
+	if withIds {
+		fmt.Fprintf(&buf, "next id %d\n", c.nextFileId)
+	}
 	keys := make([]string, 0, len(c.tableMap))
 	for k := range c.tableMap {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	for _, t := range keys {
-		buf.WriteString(c.tableMap[t].String())
+	for _, name := range keys {
+		t := c.tableMap[name]
+		if withIds && t.temporary() {
+			// temporary tables are not kept in the catalog file
+			continue
+		}
+		entry(t.String(), t.id, t.fileName, defaultTableFile(t.name, t.storage()), t.sequence())
+	}
+	keys = keys[:0]
+	for k := range c.indexMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		idx := c.indexMap[name]
+		entry(idx.String(), idx.id, idx.fileName, defaultIndexFile(idx.name), nil)
 	}
 	return buf.String()
 }
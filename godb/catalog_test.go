@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -15,3 +16,84 @@ func TestNewCatalogFromFile(t *testing.T) {
 		t.Errorf("unexpected catalog: %#v", s)
 	}
 }
+
+func TestCatalogColumnTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "p (name varchar(10), descr text, price integer)\n")
+	c := NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	s := c.String()
+	if s != "p(name varchar(10), descr text, price int)\n" {
+		t.Errorf("unexpected catalog: %#v", s)
+	}
+
+	writeFile(t, dir+"/catalog.txt", "p (name varchar(x), price int)\n")
+	c = NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err == nil {
+		t.Errorf("expected error parsing a malformed type")
+	}
+}
+
+func TestCatalogVarcharLength(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, "create table varchar_test (code varchar(5), descr text)")
+	ti, _ := c.GetTableInfo("varchar_test")
+	if ti.String() != "varchar_test(code varchar(5), descr text)\n" {
+		t.Errorf("unexpected table: %#v", ti.String())
+	}
+
+	long := strings.Repeat("a much longer description than thirty two bytes ", 10)
+	tid := BeginTransactionForTest(t, bp)
+	err := ti.file.insertTuple(&Tuple{ti.desc, []DBValue{StringField{"abcde"}, StringField{long}}, nil}, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = ti.file.insertTuple(&Tuple{ti.desc, []DBValue{StringField{"abcdef"}, StringField{""}}, nil}, tid)
+	if err == nil {
+		t.Errorf("expected error inserting a value longer than varchar(5)")
+	}
+	iter, _ := ti.file.Iterator(tid)
+	tup, err := iter()
+	if err != nil || tup == nil {
+		t.Fatalf("expected a tuple, got %v", err)
+	}
+	if tup.Fields[1].(StringField).Value != long {
+		t.Errorf("text value was not stored intact")
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestCatalogNotNull(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, "create table not_null_test (id int not null, name varchar(5))")
+	ti, _ := c.GetTableInfo("not_null_test")
+	if ti.String() != "not_null_test(id int not null, name varchar(5))\n" {
+		t.Errorf("unexpected table: %#v", ti.String())
+	}
+
+	for _, tc := range []struct {
+		sql string
+		ok  bool
+	}{
+		{"insert into not_null_test values (1, null)", true},
+		{"insert into not_null_test values (null, 'sam')", false},
+	} {
+		_, op, err := Parse(c, tc.sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := execQueryForTest(t, bp, op, noTransaction); (err == nil) != tc.ok {
+			t.Errorf("%s: expected success %v, got error %v", tc.sql, tc.ok, err)
+		}
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir+"/catalog.txt", "p (id int not null, name text)\n")
+	c = NewCatalog("catalog.txt", nil, dir)
+	if err := c.parseCatalogFile(); err != nil {
+		t.Fatalf("failed to parse catalog file, %s", err.Error())
+	}
+	if c.String() != "p(id int not null, name text)\n" {
+		t.Errorf("unexpected catalog: %#v", c.String())
+	}
+}
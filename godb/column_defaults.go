@@ -0,0 +1,230 @@
+package godb
+
+/*
+column_defaults.go implements the DEFAULT values and AUTO_INCREMENT sequences
+of columns, which fill in the fields that an INSERT does not give a value:
+
+	create table people (id int auto_increment primary key,
+		city text default 'paris', joined timestamp default current_timestamp)
+	insert into people (name) values ('sam')
+
+A default is a constant, NULL, or current_timestamp, which is the time of the
+insert. A column without a default is NULL if an insert leaves it out.
+
+A table may have one AUTO_INCREMENT int column, whose [sequence] gives the
+column the next value of a counter when an insert leaves it out or inserts a
+NULL into it; an insert of a larger value moves the counter past it. Like the
+sequences of other databases, the counter is not transactional: a value is
+never given out twice, even if the transaction that got it aborts. Each
+change of the counter is written to the log in a Sequence record, which is
+made durable with the next commit, and the counters are brought up to date
+with those records when the database is opened (see
+[Catalog.recoverSequences]). The catalog file also records the counter of
+each table, after the file number of its table, e.g., "t(id int not null
+auto_increment) id 3 sequence 17".
+*/
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The counter of an AUTO_INCREMENT column.
+type sequence struct {
+	last int64 // the last value that was given out, or 0
+
+	table      int // file number of the table, which identifies it in the log
+	field      int // position of the column in the TupleDesc of the table
+	bufferPool *BufferPool
+	sync.Mutex
+}
+
+// Return a sequence that starts after last, for column field of the table with
+// file number table.
+func newSequence(last int64, table int, field int, bp *BufferPool) *sequence {
+	return &sequence{last, table, field, bp, sync.Mutex{}}
+}
+
+// Return the next value of the sequence on behalf of tid.
+func (s *sequence) next(tid TransactionID) int64 {
+	s.Lock()
+	defer s.Unlock()
+	s.last++
+	s.log(tid)
+	return s.last
+}
+
+// Move the counter of the sequence to value if it is larger, so that the
+// values that the sequence gives out next are larger than a value that was
+// inserted into the column.
+func (s *sequence) advance(tid TransactionID, value int64) {
+	s.Lock()
+	defer s.Unlock()
+	if value > s.last {
+		s.last = value
+		s.log(tid)
+	}
+}
+
+// Write a Sequence record with the counter of the sequence, if the database has
+// a log.
+//
+// Caller must hold the sequence lock.
+func (s *sequence) log(tid TransactionID) {
+	bp := s.bufferPool
+	if bp == nil || bp.logFile == nil {
+		return
+	}
+	bp.Lock()
+	defer bp.Unlock()
+	bp.logFile.logSequence(tid, s.table, s.field, s.last)
+}
+
+// Return the last value that the sequence gave out.
+func (s *sequence) lastValue() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.last
+}
+
+// Return the columns of the table with file number id with a sequence of its
+// own for the AUTO_INCREMENT column, which starts after the last value of the
+// sequence the column has, e.g., the sequence of the version of the table
+// that ALTER TABLE rewrites. Returns an error if the table has several
+// AUTO_INCREMENT columns, or one that is not an int column.
+func (c *Catalog) openSequences(id int, named string, desc *TupleDesc, columns []columnInfo) ([]columnInfo, error) {
+	opened := append([]columnInfo{}, columns...)
+	found := false
+	for i, col := range opened {
+		if col.seq == nil {
+			continue
+		}
+		if found {
+			return nil, GoDBError{ParseError, fmt.Sprintf("table '%s' can only have one auto_increment column", named)}
+		}
+		if desc.Fields[i].Ftype != IntType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("auto_increment column '%s' must be an int column", desc.Fields[i].Fname)}
+		}
+		found = true
+		opened[i].seq = newSequence(col.seq.lastValue(), id, i, c.bufferPool)
+	}
+	return opened, nil
+}
+
+// Return the sequence of the AUTO_INCREMENT column of a table, or nil if it has
+// none.
+func (t *Table) sequence() *sequence {
+	for _, col := range t.columns {
+		if col.seq != nil {
+			return col.seq
+		}
+	}
+	return nil
+}
+
+// Bring the sequences of the tables up to date with the Sequence records of the
+// log. Must be called after [Catalog.recoverTables], which decides which
+// tables the records belong to.
+func (c *Catalog) recoverSequences(logFile *LogFile) error {
+	if err := logFile.seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	iter := logFile.ForwardIterator()
+	for {
+		r, err := iter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		s, ok := r.(*SequenceLogRecord)
+		if !ok {
+			continue
+		}
+		t, err := c.GetTableInfoId(s.table)
+		if err != nil || s.field >= len(t.columns) || t.columns[s.field].seq == nil {
+			// the table was dropped or rewritten since
+			continue
+		}
+		seq := t.columns[s.field].seq
+		seq.last = max(seq.last, s.value)
+	}
+	return logFile.seek(0, io.SeekEnd)
+}
+
+// The default of a column that is the time of the insert.
+const currentTimestamp = "current_timestamp"
+
+// Return the value of the DEFAULT of a column of type ftype, or NULL if it has
+// none.
+func (col columnInfo) defaultFor(ftype DBType) (DBValue, error) {
+	switch col.defaultValue {
+	case "", "null":
+		return NullField{}, nil
+	case currentTimestamp:
+		now := time.Now()
+		if ftype == DateType {
+			return DateField{now.Unix() / secondsPerDay}, nil
+		}
+		return TimestampField{now.UnixMicro()}, nil
+	}
+	lit := col.defaultValue
+	if unquoted, ok := strings.CutPrefix(lit, "'"); ok {
+		lit = strings.ReplaceAll(strings.TrimSuffix(unquoted, "'"), "''", "'")
+	}
+	return parseValue(lit, ftype)
+}
+
+// Return the DEFAULT of a column of type ftype as it is written in the catalog
+// file, given the literal of a CREATE TABLE or ALTER TABLE statement, e.g.,
+// "'paris'", "1.5" or "true". Returns an error if the literal is not a value
+// of type ftype.
+func normalizeDefault(lit string, ftype DBType) (string, error) {
+	if lit == "" || strings.EqualFold(lit, "null") {
+		return "", nil
+	}
+	if strings.EqualFold(lit, currentTimestamp) {
+		if ftype != TimestampType && ftype != DateType {
+			return "", GoDBError{TypeMismatchError, fmt.Sprintf("current_timestamp is not a default value of type %s", ftype)}
+		}
+		return currentTimestamp, nil
+	}
+	v, err := columnInfo{defaultValue: lit}.defaultFor(ftype)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case IntField, FloatField, BoolField:
+		return valueText(v), nil
+	default:
+		return "'" + strings.ReplaceAll(valueText(v), "'", "''") + "'", nil
+	}
+}
+
+// Return the columns of a table file, or nil if the file does not belong to a
+// table.
+func fileColumns(f DBFile) []columnInfo {
+	switch f := f.(type) {
+	case *HeapFile:
+		return f.columns
+	case *ColumnFile:
+		return f.columns
+	case *MemFile:
+		return f.columns
+	}
+	return nil
+}
+
+// Return the value of the column in a tuple that an insert leaves it out of:
+// the next value of the sequence of an AUTO_INCREMENT column, which is also
+// the value of an inserted NULL, or the default of the column.
+func (col columnInfo) missingValue(ftype DBType, tid TransactionID) (DBValue, error) {
+	if col.seq != nil {
+		return IntField{col.seq.next(tid)}, nil
+	}
+	return col.defaultFor(ftype)
+}
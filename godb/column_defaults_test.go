@@ -0,0 +1,138 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestColumnDefaults(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (id int auto_increment primary key, name text not null, city varchar(10) default 'it''s', score int default -1, active bool default true, joined timestamp default current_timestamp)", noTransaction)
+	want := "people(id int not null auto_increment, name text not null, city varchar(10) default 'it''s', score int default -1, active bool default true, joined timestamp default current_timestamp) primary key (id)\n" +
+		"index people_pkey on people(id) using btree\n"
+	if got := c.String(); got != want {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+
+	for _, sql := range []string{
+		"insert into people (name) values ('ann')",
+		"insert into people (city, name) values ('rome', 'bob'), (null, 'cid')",
+		"insert into people values (null, 'dan', 'oslo', 5, false, '2024-01-01 10:00:00')",
+		"insert into people (id, name) values (10, 'eve')",
+		"insert into people (name, score) select name, score + 100 from people where id = 10",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	tups := runSQLForTest(t, bp, c, "select id, name, city, score, active from people", noTransaction)
+	want2 := []string{"1 ann it's -1 true", "2 bob rome -1 true", "3 cid NULL -1 true", "4 dan oslo 5 false", "10 eve it's -1 true", "11 eve it's 99 true"}
+	if len(tups) != len(want2) {
+		t.Fatalf("expected %d tuples, got %d", len(want2), len(tups))
+	}
+	for i, tup := range tups {
+		got := ""
+		for j, v := range tup.Fields {
+			if j > 0 {
+				got += " "
+			}
+			got += valueText(v)
+		}
+		if got != want2[i] {
+			t.Errorf("expected %q, got %q", want2[i], got)
+		}
+	}
+	people, _ := c.GetTable("people")
+	for _, tup := range runQueryForTest(t, bp, people, noTransaction) {
+		if _, ok := tup.Fields[5].(TimestampField); !ok {
+			t.Errorf("expected current_timestamp to set joined, got %v", tup.Fields[5])
+		}
+	}
+
+	for _, sql := range []string{
+		"insert into people (city) values ('x')",
+		"insert into people (name, name) values ('x', 'y')",
+		"insert into people (name, missing) values ('x', 1)",
+		"insert into people (name) values ('x', 1)",
+	} {
+		// an error is either found by the parser or by the insert
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	for _, sql := range []string{
+		"create table bad (a int default 'x')",
+		"create table bad (a int default current_timestamp)",
+		"create table bad (a text auto_increment)",
+		"create table bad (a int auto_increment, b int auto_increment)",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+		if _, err := c.GetTableInfo("bad"); err == nil {
+			t.Errorf("%s: expected the table not to be created", sql)
+			c.dropTable("bad")
+		}
+	}
+
+	// the set default action of a foreign key sets the default of the column
+	runSQLForTest(t, bp, c, "create table teams (id int primary key)", noTransaction)
+	runSQLForTest(t, bp, c, "create table members (name text, team int default 0, foreign key (team) references teams (id) on delete set default)", noTransaction)
+	for _, sql := range []string{
+		"insert into teams values (0)",
+		"insert into teams values (1)",
+		"insert into members values ('ann', 1)",
+		"delete from teams where id = 1",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select name from members where team = 0", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the member to be moved to team 0, got %v", tups)
+	}
+}
+
+func TestSequenceRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table t (id int auto_increment, name text)", noTransaction)
+	for i := 0; i < 3; i++ {
+		if _, err := execSQLForTest(t, bp, c, "insert into t (name) values ('a')", noTransaction); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the values of an aborted insert are not given out again, and the values
+	// given out after the catalog file was saved are in the log
+	if _, err := execSQLForTest(t, bp, c, "insert into t (name) values ('b'), ('b')", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := execSQLForTest(t, bp, c, "insert into t (name, id) values ('c', null), ('c', 'x')", noTransaction); err == nil {
+		t.Fatalf("expected the insert of a string id to fail")
+	}
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if _, err := execSQLForTest(t, bp2, c2, "insert into t (name) values ('d')", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select id from t where name = 'd'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{7}) {
+		t.Errorf("expected the sequence to continue after 6 after a restart, got %v", tups)
+	}
+
+	// ALTER TABLE keeps the counter, and the catalog file records it
+	runSQLForTest(t, bp2, c2, "alter table t add column city text default 'paris'", noTransaction)
+	if err := c2.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := c2.format(true); got != "next id 2\nt(id int auto_increment, name text, city text default 'paris') id 1 file t.1.dat sequence 7\n" {
+		t.Errorf("unexpected catalog file:\n%s", got)
+	}
+	bp3, c3 := openTestDatabase(t, disk, root)
+	if _, err := execSQLForTest(t, bp3, c3, "insert into t (name) values ('e')", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp3, c3, "select id, city from t where name = 'e'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{8}) || tups[0].Fields[1] != (StringField{"paris"}) {
+		t.Errorf("expected id 8 in paris after the alter, got %v", tups)
+	}
+}
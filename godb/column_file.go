@@ -0,0 +1,567 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+ColumnFile stores the tuples of a table column by column, so that queries that
+read only a few columns of a wide table only read the pages of those columns.
+A table is stored in a ColumnFile rather than a [HeapFile] if it is created
+with
+
+	CREATE TABLE t (...) USING column
+
+Each tuple of the file has a row number, which is its record id. Each column
+is stored in its own chain of pages, which hold the values of consecutive rows
+of the column, and there is one more chain that holds a deleted flag (a bool)
+for every row. Every page belongs to one chain, but the pages of different
+chains are interleaved in the file in the order they were allocated. A page
+begins with a header:
+
++---------------------------------------------------------------+
+| Column, or the number of columns for the deleted flags (4 b)  |
++---------------------------------------------------------------+
+| Row number of the first value on the page (8 bytes)           |
++---------------------------------------------------------------+
+| Number of values on the page (4 bytes)                        |
++---------------------------------------------------------------+
+
+followed by the values, each written as a tuple with a single field (see
+[Tuple.writeTo]), so that NULLs are stored with a null bitmap. When the file is
+opened, the headers of all pages are read to rebuild the chains.
+
+Tuples are always appended to the end of every chain; a new page is added to a
+chain when its last page is full. Deleting a tuple only sets its deleted flag,
+so that row numbers stay valid, and the space of deleted values is not
+reclaimed. Inserts lock the last page of the deleted flags chain first, so that
+concurrent inserts are serialized and all chains stay the same length.
+
+Pages are read and written through the BufferPool, and can be logged, like the
+pages of a HeapFile.
+*/
+type ColumnFile struct {
+	td          *TupleDesc
+	numPages    int
+	backingFile string
+	chains      [][]columnChainPage // pages of each column in row order; the last chain holds the deleted flags
+	bufPool     *BufferPool
+	columns     []columnInfo // declared column types of the table
+	sync.Mutex
+}
+
+// A page of a column chain, and the row number of its first value.
+type columnChainPage struct {
+	pageNo   int
+	firstRow int
+}
+
+// The record id of a tuple in a ColumnFile.
+type columnFileRid struct {
+	row int
+}
+
+type columnPage struct {
+	column   int
+	firstRow int
+	values   []DBValue
+	numBytes int // bytes used by the header and the values
+	pageNo   int
+	file     *ColumnFile
+
+	dirty       bool
+	dirtier     TransactionID
+	beforeImage *columnPage
+	sync.Mutex
+}
+
+const columnHeaderSize = 16
+
+// Create a ColumnFile.
+// Parameters
+// - fromFile: backing file for the ColumnFile. May be empty or a previously created column file.
+// - td: the TupleDesc for the ColumnFile.
+// - bp: the BufferPool that is used to store pages read from the ColumnFile
+// May return an error if the file cannot be opened or created, or if it is
+// not a column file.
+func NewColumnFile(fromFile string, td *TupleDesc, bp *BufferPool) (*ColumnFile, error) {
+	disk := bp.DiskManager()
+	if err := disk.Open(fromFile); err != nil {
+		return nil, err
+	}
+	size, err := disk.Size(fromFile)
+	if err != nil {
+		return nil, err
+	}
+	f := &ColumnFile{td, int(size / int64(PageSize)), fromFile, make([][]columnChainPage, len(td.Fields)+1), bp, nil, sync.Mutex{}}
+
+	header := make([]byte, columnHeaderSize)
+	for p := 0; p < f.numPages; p++ {
+		if _, err := disk.ReadAt(fromFile, header, int64(p*PageSize)); err != nil {
+			return nil, err
+		}
+		column := int(int32(binary.LittleEndian.Uint32(header[0:])))
+		firstRow := int(binary.LittleEndian.Uint64(header[4:]))
+		if column < 0 || column >= len(f.chains) {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("page %d of %s belongs to unknown column %d", p, fromFile, column)}
+		}
+		f.chains[column] = append(f.chains[column], columnChainPage{p, firstRow})
+	}
+	for _, chain := range f.chains {
+		sort.Slice(chain, func(i, j int) bool {
+			if chain[i].firstRow != chain[j].firstRow {
+				return chain[i].firstRow < chain[j].firstRow
+			}
+			return chain[i].pageNo < chain[j].pageNo
+		})
+	}
+	return f, nil
+}
+
+// Return the name of the backing file
+func (f *ColumnFile) BackingFile() string {
+	return f.backingFile
+}
+
+// Return the number of pages in the column file
+func (f *ColumnFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+// [Operator] descriptor method -- return the TupleDesc for this ColumnFile
+// Supplied as argument to NewColumnFile.
+func (f *ColumnFile) Descriptor() *TupleDesc {
+	return f.td
+}
+
+// Return the chain that holds the deleted flags of the rows.
+func (f *ColumnFile) flagsColumn() int {
+	return len(f.td.Fields)
+}
+
+// Return the descriptor of the values stored in the specified chain.
+func (f *ColumnFile) valueDesc(column int) *TupleDesc {
+	if column == f.flagsColumn() {
+		return &TupleDesc{[]FieldType{{"deleted", "", BoolType}}}
+	}
+	return &TupleDesc{[]FieldType{f.td.Fields[column]}}
+}
+
+// Return the number of bytes a value takes on a page.
+func columnValueSize(v DBValue) int {
+	return (&Tuple{Fields: []DBValue{v}}).size()
+}
+
+func (f *ColumnFile) pageKey(pgNo int) any {
+	return heapHash{f.backingFile, pgNo}
+}
+
+func (f *ColumnFile) readPage(pageNo int) (Page, error) {
+	b := make([]byte, PageSize)
+	n, err := f.bufPool.DiskManager().ReadAt(f.backingFile, b, int64(pageNo*PageSize))
+	if err != nil {
+		return nil, err
+	}
+	if n != PageSize {
+		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	}
+	return f.pageFromBuffer(pageNo, b)
+}
+
+// Construct the page with the specified page number from its serialized form.
+func (f *ColumnFile) pageFromBuffer(pageNo int, b []byte) (Page, error) {
+	pg := newColumnPage(0, 0, pageNo, f)
+	if err := pg.initFromBuffer(bytes.NewBuffer(b)); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+func (f *ColumnFile) flushPage(p Page) error {
+	cp := p.(*columnPage)
+	buf, err := cp.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = f.bufPool.DiskManager().WriteAt(f.backingFile, buf.Bytes(), int64(cp.pageNo*PageSize))
+	return err
+}
+
+// Return the page of the file with the specified number, locked with perm.
+func (f *ColumnFile) getPage(pageNo int, tid TransactionID, perm RWPerm) (*columnPage, error) {
+	pg, err := f.bufPool.GetPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, err
+	}
+	return pg.(*columnPage), nil
+}
+
+// Return a copy of the chain of the specified column.
+func (f *ColumnFile) chain(column int) []columnChainPage {
+	f.Lock()
+	defer f.Unlock()
+	return append([]columnChainPage{}, f.chains[column]...)
+}
+
+// Return the last page of the chain of the specified column, or -1 if the
+// chain is empty.
+func (f *ColumnFile) lastPage(column int) int {
+	f.Lock()
+	defer f.Unlock()
+	chain := f.chains[column]
+	if len(chain) == 0 {
+		return -1
+	}
+	return chain[len(chain)-1].pageNo
+}
+
+// Add an empty page whose first row is firstRow to the end of the chain of the
+// specified column, unless the last page of the chain is no longer last. The
+// page is written to disk, so that it can be read into the buffer pool.
+// Returns the last page of the chain.
+func (f *ColumnFile) appendPage(column int, last int, firstRow int) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	chain := f.chains[column]
+	if len(chain) > 0 && chain[len(chain)-1].pageNo != last {
+		return chain[len(chain)-1].pageNo, nil
+	}
+	pg := newColumnPage(column, firstRow, f.numPages, f)
+	if err := f.flushPage(pg); err != nil {
+		return 0, err
+	}
+	f.numPages++
+	f.chains[column] = append(chain, columnChainPage{pg.pageNo, firstRow})
+	return pg.pageNo, nil
+}
+
+// Return the last page of the chain of the specified column, write locked by
+// tid, adding a page for firstRow if the chain is empty.
+func (f *ColumnFile) lockLastPage(column int, firstRow int, tid TransactionID) (*columnPage, error) {
+	for {
+		last := f.lastPage(column)
+		if last == -1 {
+			if _, err := f.appendPage(column, last, firstRow); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pg, err := f.getPage(last, tid, WritePerm)
+		if err != nil {
+			return nil, err
+		}
+		// another transaction may have added a page while we waited for the
+		// lock
+		if f.lastPage(column) == last {
+			return pg, nil
+		}
+	}
+}
+
+// Append v to the chain of the specified column as the value of row, adding a
+// page to the chain if its last page is full.
+func (f *ColumnFile) appendValue(column int, row int, v DBValue, tid TransactionID) error {
+	pg, err := f.lockLastPage(column, row, tid)
+	if err != nil {
+		return err
+	}
+	if pg.firstRow+len(pg.values) != row {
+		return GoDBError{MalformedDataError, fmt.Sprintf("column %d of %s does not end at row %d", column, f.backingFile, row)}
+	}
+	if !pg.hasRoomFor(columnValueSize(v)) {
+		pageNo, err := f.appendPage(column, pg.pageNo, row)
+		if err != nil {
+			return err
+		}
+		if pg, err = f.getPage(pageNo, tid, WritePerm); err != nil {
+			return err
+		}
+	}
+	pg.values = append(pg.values, v)
+	pg.numBytes += columnValueSize(v)
+	pg.setDirty(tid, true)
+	return nil
+}
+
+// Add the tuple to the end of the ColumnFile, appending each field to the chain
+// of its column. Sets the Rid of the tuple to its row number.
+func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
+	if len(t.Fields) != len(f.td.Fields) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("expected %d fields, got %d", len(f.td.Fields), len(t.Fields))}
+	}
+	if err := checkColumnValues(f.td, f.columns, t); err != nil {
+		return err
+	}
+	for _, v := range t.Fields {
+		if size := columnValueSize(v); size > PageSize-columnHeaderSize {
+			return GoDBError{MalformedDataError, fmt.Sprintf("value of %d bytes does not fit on a page", size)}
+		}
+	}
+
+	// the last page of the deleted flags decides the row number of the tuple,
+	// and stays locked until the transaction ends
+	flags := f.flagsColumn()
+	pg, err := f.lockLastPage(flags, 0, tid)
+	if err != nil {
+		return err
+	}
+	row := pg.firstRow + len(pg.values)
+	for i, v := range t.Fields {
+		if err := f.appendValue(i, row, v, tid); err != nil {
+			return err
+		}
+	}
+	if err := f.appendValue(flags, row, BoolField{false}, tid); err != nil {
+		return err
+	}
+	t.Rid = columnFileRid{row}
+	return nil
+}
+
+// Return the page of the chain of the specified column that holds the value of
+// row, locked with perm, and the position of the value on the page.
+func (f *ColumnFile) findRow(column int, row int, tid TransactionID, perm RWPerm) (*columnPage, int, error) {
+	chain := f.chain(column)
+	i := sort.Search(len(chain), func(i int) bool { return chain[i].firstRow > row }) - 1
+	if i < 0 {
+		return nil, 0, GoDBError{TupleNotFoundError, fmt.Sprintf("row %d does not exist", row)}
+	}
+	pg, err := f.getPage(chain[i].pageNo, tid, perm)
+	if err != nil {
+		return nil, 0, err
+	}
+	if row-pg.firstRow >= len(pg.values) {
+		return nil, 0, GoDBError{TupleNotFoundError, fmt.Sprintf("row %d does not exist", row)}
+	}
+	return pg, row - pg.firstRow, nil
+}
+
+// Remove the provided tuple from the ColumnFile, by setting the deleted flag
+// of the row in its Rid.
+func (f *ColumnFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	rid, ok := t.Rid.(columnFileRid)
+	if !ok {
+		return GoDBError{TupleNotFoundError, "provided tuple is not a column file tuple, based on rid"}
+	}
+	pg, slot, err := f.findRow(f.flagsColumn(), rid.row, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	if pg.values[slot] == (BoolField{true}) {
+		return GoDBError{TupleNotFoundError, "element already deleted"}
+	}
+	pg.values[slot] = BoolField{true}
+	pg.setDirty(tid, true)
+	return nil
+}
+
+// [Operator] iterator method
+// Return a function that iterates through the tuples of the column file,
+// reading all of its columns.
+func (f *ColumnFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	cols := make([]int, len(f.td.Fields))
+	for i := range cols {
+		cols[i] = i
+	}
+	return f.columnIterator(cols, tid)
+}
+
+// Reads the values of one column in row order.
+type columnCursor struct {
+	file  *ColumnFile
+	chain []columnChainPage
+	next  int // position in the chain of the next page to read
+	page  *columnPage
+}
+
+// Return the value of the column in the specified row, which must not be
+// before the row of the previous call.
+func (c *columnCursor) valueAt(row int, tid TransactionID) (DBValue, error) {
+	for c.page == nil || row >= c.page.firstRow+len(c.page.values) {
+		if c.next >= len(c.chain) {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("row %d is missing from a column of %s", row, c.file.backingFile)}
+		}
+		pg, err := c.file.getPage(c.chain[c.next].pageNo, tid, ReadPerm)
+		if err != nil {
+			return nil, err
+		}
+		c.page = pg
+		c.next++
+	}
+	if row < c.page.firstRow {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("row %d is missing from a column of %s", row, c.file.backingFile)}
+	}
+	return c.page.values[row-c.page.firstRow], nil
+}
+
+// Return a function that iterates through the tuples of the column file, only
+// reading the pages of the specified columns. The other fields of the returned
+// tuples are NULL.
+func (f *ColumnFile) columnIterator(cols []int, tid TransactionID) (func() (*Tuple, error), error) {
+	flags := &columnCursor{f, f.chain(f.flagsColumn()), 0, nil}
+	cursors := make([]*columnCursor, len(cols))
+	for i, col := range cols {
+		if col < 0 || col >= len(f.td.Fields) {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("column %d does not exist", col)}
+		}
+		cursors[i] = &columnCursor{f, f.chain(col), 0, nil}
+	}
+	row := 0
+	if len(flags.chain) > 0 {
+		row = flags.chain[0].firstRow
+	}
+	return func() (*Tuple, error) {
+		for {
+			// skip over pages without values, e.g., pages added by
+			// transactions that aborted
+			for flags.page == nil || row >= flags.page.firstRow+len(flags.page.values) {
+				if flags.next >= len(flags.chain) {
+					return nil, nil
+				}
+				pg, err := f.getPage(flags.chain[flags.next].pageNo, tid, ReadPerm)
+				if err != nil {
+					return nil, err
+				}
+				flags.page = pg
+				flags.next++
+				row = max(row, pg.firstRow)
+			}
+			deleted := flags.page.values[row-flags.page.firstRow]
+			row++
+			if deleted == (BoolField{true}) {
+				continue
+			}
+			fields := make([]DBValue, len(f.td.Fields))
+			for i := range fields {
+				fields[i] = NullField{}
+			}
+			for i, c := range cursors {
+				v, err := c.valueAt(row-1, tid)
+				if err != nil {
+					return nil, err
+				}
+				fields[cols[i]] = v
+			}
+			return &Tuple{*f.td, fields, columnFileRid{row - 1}}, nil
+		}
+	}, nil
+}
+
+// Construct a new, empty page of the chain of the specified column
+func newColumnPage(column int, firstRow int, pageNo int, f *ColumnFile) *columnPage {
+	pg := &columnPage{column: column, firstRow: firstRow, numBytes: columnHeaderSize, pageNo: pageNo, file: f, dirtier: -1}
+	pg.SetBeforeImage()
+	return pg
+}
+
+// Return true if a value of the specified size fits on the page.
+func (p *columnPage) hasRoomFor(size int) bool {
+	return p.numBytes+size <= PageSize
+}
+
+func (p *columnPage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+func (p *columnPage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.dirty = dirty
+	if dirty {
+		p.dirtier = tid
+	}
+}
+
+func (p *columnPage) getDirtier() TransactionID {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirtier
+}
+
+func (p *columnPage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *columnPage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the before-image of the page, used for logging and recovery.
+func (p *columnPage) BeforeImage() Page {
+	return p.beforeImage
+}
+
+// Sets the before-image of the page to a copy of the current state of the
+// page.
+func (p *columnPage) SetBeforeImage() {
+	p.beforeImage = &columnPage{
+		column:   p.column,
+		firstRow: p.firstRow,
+		values:   append([]DBValue{}, p.values...),
+		numBytes: p.numBytes,
+		pageNo:   p.pageNo,
+		file:     p.file,
+		dirtier:  -1,
+	}
+}
+
+// Write the page to a new PageSize buffer.
+func (p *columnPage) toBuffer() (*bytes.Buffer, error) {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, int32(p.column))
+	binary.Write(b, binary.LittleEndian, int64(p.firstRow))
+	binary.Write(b, binary.LittleEndian, int32(len(p.values)))
+	for _, v := range p.values {
+		if err := (&Tuple{Fields: []DBValue{v}}).writeTo(b); err != nil {
+			return nil, err
+		}
+	}
+	if b.Len() > PageSize {
+		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+	}
+	b.Write(make([]byte, PageSize-b.Len()))
+	return b, nil
+}
+
+// Read the contents of the page from the supplied buffer.
+func (p *columnPage) initFromBuffer(buf *bytes.Buffer) error {
+	var column, n int32
+	var firstRow int64
+	if err := binary.Read(buf, binary.LittleEndian, &column); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &firstRow); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if column < 0 || int(column) > p.file.flagsColumn() {
+		return GoDBError{MalformedDataError, fmt.Sprintf("page %d belongs to unknown column %d", p.pageNo, column)}
+	}
+	p.column = int(column)
+	p.firstRow = int(firstRow)
+	p.values = make([]DBValue, n)
+	p.numBytes = columnHeaderSize
+	desc := p.file.valueDesc(p.column)
+	for i := range p.values {
+		t, err := readTupleFrom(buf, desc)
+		if err != nil {
+			return err
+		}
+		p.values[i] = t.Fields[0]
+		p.numBytes += columnValueSize(t.Fields[0])
+	}
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
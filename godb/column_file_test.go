@@ -0,0 +1,135 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const columnTestRows = 2000
+
+// Statements that create a column table with columnTestRows rows, enough for
+// several pages per column. The note of every tenth row is NULL.
+var columnTestTable = []string{
+	"create table col_test (name varchar, age int, score float, note text) using column",
+	insertRowsForTest("col_test", columnTestRows, func(i int) string {
+		note := "'" + strings.Repeat("x", i%50) + "'"
+		if i%10 == 0 {
+			note = "null"
+		}
+		return fmt.Sprintf("'name%d', %d, %.1f, %s", i, i, float64(i)/2, note)
+	}),
+}
+
+func findColumnScan(op Operator) *ColumnScan {
+	switch op := op.(type) {
+	case *ColumnScan:
+		return op
+	case *OperatorCard:
+		return findColumnScan(op.Op)
+	case *Project:
+		return findColumnScan(op.child)
+	case *Filter:
+		return findColumnScan(op.child)
+	case *Aggregator:
+		return findColumnScan(op.child)
+	}
+	return nil
+}
+
+func TestColumnFileQuery(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, columnTestTable...)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	cf, _ := c.GetTable("col_test")
+	if cf.NumPages() < 8 {
+		t.Fatalf("expected each column to span several pages, got %d pages", cf.NumPages())
+	}
+
+	_, plan, err := Parse(c, "select name, age from col_test where age < 10")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	scan := findColumnScan(plan)
+	if scan == nil {
+		t.Fatalf("expected the query to use a column scan")
+	}
+	if len(scan.cols) != 2 || scan.cols[0] != 0 || scan.cols[1] != 1 {
+		t.Errorf("expected the scan to read name and age, got columns %v", scan.cols)
+	}
+	tups := runQueryForTest(t, bp, plan, noTransaction)
+	if len(tups) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(tups))
+	}
+	for i, tup := range tups {
+		if tup.Fields[0] != (StringField{fmt.Sprintf("name%d", i)}) || tup.Fields[1] != (IntField{int64(i)}) {
+			t.Errorf("unexpected result %v", tup)
+		}
+	}
+
+	tups = runSQLForTest(t, bp, c, "select * from col_test where age >= 20 and age <= 25", noTransaction)
+	if len(tups) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(tups))
+	}
+	if tups[0].Fields[2] != (FloatField{10}) || tups[0].Fields[3] != (NullField{}) {
+		t.Errorf("unexpected result %v", tups[0])
+	}
+	if tups[5].Fields[3] != (StringField{strings.Repeat("x", 25)}) {
+		t.Errorf("unexpected result %v", tups[5])
+	}
+
+	tups = runSQLForTest(t, bp, c, "select count(*), count(note), max(score) from col_test", noTransaction)
+	if tups[0].Fields[0] != (IntField{columnTestRows}) || tups[0].Fields[1] != (IntField{columnTestRows * 9 / 10}) || tups[0].Fields[2] != (FloatField{(columnTestRows - 1) / 2.0}) {
+		t.Errorf("unexpected aggregates %v", tups[0])
+	}
+
+	runSQLForTest(t, bp, c, "delete from col_test where age >= 1000", noTransaction)
+	runSQLForTest(t, bp, c, "insert into col_test values ('new', 5000, 1.5, null)", noTransaction)
+	tups = runSQLForTest(t, bp, c, "select count(*), max(age) from col_test", noTransaction)
+	if tups[0].Fields[0] != (IntField{1001}) || tups[0].Fields[1] != (IntField{5000}) {
+		t.Errorf("expected 1001 rows after delete and insert, got %v", tups[0])
+	}
+}
+
+// A column scan only reads the pages of the columns it needs, and the file can
+// be reopened from disk.
+func TestColumnScanReadsOnlyReferencedColumns(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, columnTestTable...)
+	cf, _ := c.GetTable("col_test")
+	bp.FlushAllPages()
+
+	bp2, err := NewBufferPoolWithDiskManager(100, disk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2 := NewCatalog("catalog.txt", bp2, root)
+	bp2.logFile, err = NewLogFile(root+"/test.log", bp2, c2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cf2, err := c2.createTable("col_test", *cf.Descriptor(), defaultColumns(cf.Descriptor()), nil, nil, "column")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	ti, _ := c2.GetTableInfo("col_test")
+	if ti.String() != "col_test(name text, age int, score float, note text) using column\n" {
+		t.Errorf("unexpected table: %#v", ti.String())
+	}
+
+	scan := NewColumnScan(cf2.(*ColumnFile), []string{"age"})
+	tups := runQueryForTest(t, bp2, scan, noTransaction)
+	if len(tups) != columnTestRows {
+		t.Fatalf("expected %d rows, got %d", columnTestRows, len(tups))
+	}
+	for i, tup := range tups {
+		if tup.Fields[0] != (NullField{}) || tup.Fields[1] != (IntField{int64(i)}) || tup.Rid != (columnFileRid{i}) {
+			t.Fatalf("unexpected tuple %v", tup)
+		}
+	}
+	for _, pg := range bp2.pages {
+		if col := pg.(*columnPage).column; col != 1 && col != cf2.(*ColumnFile).flagsColumn() {
+			t.Errorf("scan of age read a page of column %d", col)
+		}
+	}
+}
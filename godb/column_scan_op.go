@@ -0,0 +1,38 @@
+package godb
+
+import "strings"
+
+// ColumnScan returns the tuples of a column file, but only reads the columns
+// that the operators above it reference. The other fields of the returned
+// tuples are NULL.
+type ColumnScan struct {
+	file *ColumnFile
+	cols []int // the columns that are read
+}
+
+// Construct a scan over file that reads the named columns. Names that are not
+// columns of the file are ignored.
+func NewColumnScan(file *ColumnFile, fields []string) *ColumnScan {
+	var cols []int
+	for i, f := range file.Descriptor().Fields {
+		for _, name := range fields {
+			if strings.EqualFold(f.Fname, name) {
+				cols = append(cols, i)
+				break
+			}
+		}
+	}
+	return &ColumnScan{file, cols}
+}
+
+// Return the TupleDesc of the scanned column file, which includes the columns
+// that are not read.
+func (s *ColumnScan) Descriptor() *TupleDesc {
+	return s.file.Descriptor()
+}
+
+// Return an iterator over the tuples of the column file that only reads the
+// pages of the scanned columns.
+func (s *ColumnScan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return s.file.columnIterator(s.cols, tid)
+}
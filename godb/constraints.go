@@ -0,0 +1,248 @@
+package godb
+
+/*
+constraints.go implements PRIMARY KEY and UNIQUE constraints.
+
+A table may declare a primary key and any number of unique keys, each on one
+or more columns. No two tuples of the table may have the same values in the
+columns of a key, except that, as in SQL, tuples with a NULL in one of the
+columns never conflict; the columns of the primary key are NOT NULL.
+
+The keys are checked by [HeapFile.insertTuple] and [HeapFile.updateTuple], on
+behalf of the transaction that inserts or updates the tuple, so that every
+path that adds tuples to a table (INSERT, UPDATE, loading a CSV file or
+rewriting the table for ALTER TABLE) enforces them. When a table is created,
+a btree index is created on the first column of each key, so that a check
+looks up the tuples with the same value instead of scanning the table; if the
+index is dropped, the table is scanned.
+
+The keys are stored in the catalog file after the columns of their table,
+e.g., "t(a int not null, b int, c int) primary key (a) unique (b, c)".
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A PRIMARY KEY or UNIQUE constraint on columns of a table.
+type tableKey struct {
+	primary bool
+	columns []string
+	fields  []int // positions of the columns in the TupleDesc of the table
+}
+
+// Return the key as written in the catalog file, e.g., "unique (b, c)".
+func (k tableKey) String() string {
+	kind := "unique"
+	if k.primary {
+		kind = "primary key"
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(k.columns, ", "))
+}
+
+// The name of the index that is created for a key: "t_pkey" for the primary
+// key of table t, or "t_b_c_key" for a unique key on columns b and c.
+func (k tableKey) indexName(tableName string) string {
+	if k.primary {
+		return tableName + "_pkey"
+	}
+	return tableName + "_" + strings.Join(k.columns, "_") + "_key"
+}
+
+// Return keys with the positions of their columns in desc set. Returns an
+// error if a key has a column that is not in desc or has a column twice, or if
+// there are several primary keys.
+func resolveKeys(desc *TupleDesc, keys []tableKey) ([]tableKey, error) {
+	resolved := make([]tableKey, len(keys))
+	primary := false
+	for i, k := range keys {
+		if k.primary && primary {
+			return nil, GoDBError{ParseError, "a table can only have one primary key"}
+		}
+		primary = primary || k.primary
+		if len(k.columns) == 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("%s has no columns", k)}
+		}
+		fields := make([]int, len(k.columns))
+		for j, col := range k.columns {
+			field, err := findFieldInTd(FieldType{col, "", UnknownType}, desc)
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range fields[:j] {
+				if other == field {
+					return nil, GoDBError{ParseError, fmt.Sprintf("column %s appears twice in %s", col, k)}
+				}
+			}
+			fields[j] = field
+		}
+		resolved[i] = tableKey{k.primary, k.columns, fields}
+	}
+	return resolved, nil
+}
+
+// A key at the end of a table line of the catalog file, e.g., "primary key (a)"
+// or "unique (b, c)".
+var tableKeyRe = regexp.MustCompile(`^(.*\))\s*(primary\s+key|unique)\s*\(([\w\s,]*)\)\s*$`)
+
+// Remove the keys and foreign keys from the end of a table line of the catalog
+// file, and return the rest of the line and the keys and foreign keys, in
+// order.
+func parseTableConstraints(line string) (string, []tableKey, []foreignKey) {
+	var keys []tableKey
+	var fks []foreignKey
+	for {
+		if m := foreignKeyRe.FindStringSubmatch(line); m != nil {
+			fk := foreignKey{splitColumns(m[2]), m[3], splitColumns(m[4]), onDeleteAction(m[5]), nil}
+			fks = append([]foreignKey{fk}, fks...)
+			line = m[1]
+			continue
+		}
+		m := tableKeyRe.FindStringSubmatch(line)
+		if m == nil {
+			return line, keys, fks
+		}
+		keys = append([]tableKey{{m[2] != "unique", splitColumns(m[3]), nil}}, keys...)
+		line = m[1]
+	}
+}
+
+// Return the columns that a key on that column alone makes distinct.
+func (t *Table) uniqueColumns() map[string]bool {
+	unique := make(map[string]bool)
+	for _, k := range t.keys {
+		if len(k.columns) == 1 {
+			unique[k.columns[0]] = true
+		}
+	}
+	return unique
+}
+
+// Return true if the values of column in the specified table are distinct,
+// because a key on the column alone says so.
+func (c *Catalog) isUniqueColumn(tableName string, column string) bool {
+	t, err := c.GetTableInfo(tableName)
+	return err == nil && t.uniqueColumns()[column]
+}
+
+// Return a ConstraintViolationError if t has the same values in the columns of
+// a key of the file as another tuple of the file. The tuple at rid self, which
+// is nil for a tuple that is not in the file yet, is the tuple that t replaces,
+// and is not a conflict; neither are the keys whose values t does not change
+// from old, which may be nil.
+func (f *HeapFile) checkKeys(t *Tuple, old *Tuple, self recordID, tid TransactionID) error {
+	for _, k := range f.keys {
+		if hasNullField(t, k.fields) || (old != nil && sameKeyValues(t, old, k.fields)) {
+			continue
+		}
+		dup, err := f.findDuplicate(t, k, self, tid)
+		if err != nil {
+			return err
+		}
+		if dup {
+			values := make([]string, len(k.fields))
+			for i, field := range k.fields {
+				values[i] = fmt.Sprint(t.Fields[field])
+			}
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("duplicate value (%s) violates %s", strings.Join(values, ", "), k)}
+		}
+	}
+	return nil
+}
+
+// Return true if a tuple of the file other than the one at self has the same
+// values as t in the columns of key k.
+func (f *HeapFile) findDuplicate(t *Tuple, k tableKey, self recordID, tid TransactionID) (bool, error) {
+	dup := false
+	err := f.forEachMatch(k.fields, fieldValues(t, k.fields), tid, func(other *Tuple) bool {
+		dup = other.Rid != self
+		return !dup
+	})
+	return dup, err
+}
+
+// Call fn with each tuple of the file that has the specified values in the
+// specified fields, until fn returns false. The tuples are looked up in an
+// index on one of the fields if there is one, and scanned otherwise, on behalf
+// of tid, so that the pages they are on are locked.
+func (f *HeapFile) forEachMatch(fields []int, values []DBValue, tid TransactionID, fn func(t *Tuple) bool) error {
+	for _, idx := range f.getIndexes() {
+		i := fieldPosition(fields, idx.field)
+		if !idx.file.supportsOp(OpEq) || i == -1 {
+			continue
+		}
+		iter, err := idx.file.lookup(OpEq, values[i], tid)
+		if err != nil {
+			return err
+		}
+		for {
+			rid, err := iter()
+			if err != nil || rid == nil {
+				return err
+			}
+			t, err := f.getTuple(rid, tid)
+			if err != nil {
+				return err
+			}
+			if t != nil && hasValues(t, fields, values) && !fn(t) {
+				return nil
+			}
+		}
+	}
+
+	iter, err := f.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil || t == nil {
+			return err
+		}
+		if hasValues(t, fields, values) && !fn(t) {
+			return nil
+		}
+	}
+}
+
+func hasNullField(t *Tuple, fields []int) bool {
+	for _, field := range fields {
+		if isNull(t.Fields[field]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKeyValues(t1 *Tuple, t2 *Tuple, fields []int) bool {
+	return hasValues(t2, fields, fieldValues(t1, fields))
+}
+
+func fieldValues(t *Tuple, fields []int) []DBValue {
+	values := make([]DBValue, len(fields))
+	for i, field := range fields {
+		values[i] = t.Fields[field]
+	}
+	return values
+}
+
+func hasValues(t *Tuple, fields []int, values []DBValue) bool {
+	for i, field := range fields {
+		if !t.Fields[field].EvalPred(values[i], OpEq) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the position of field in fields, or -1 if it is not there.
+func fieldPosition(fields []int, field int) int {
+	for i, f := range fields {
+		if f == field {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,181 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Run sql in a transaction of its own, and fail the test unless it violates a
+// constraint.
+func expectConstraintViolation(t *testing.T, bp *BufferPool, c *Catalog, sql string, what string) {
+	t.Helper()
+	_, err := execSQLForTest(t, bp, c, sql, noTransaction)
+	if gerr, ok := err.(GoDBError); !ok || gerr.code != ConstraintViolationError {
+		t.Errorf("%s: expected a constraint violation, got %v", what, err)
+	}
+}
+
+func TestTableKeys(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (id int primary key, email text unique, a int, b int, unique (a, b))", noTransaction)
+	want := "people(id int not null, email text, a int, b int) primary key (id) unique (email) unique (a, b)\n" +
+		"index people_a_b_key on people(a) using btree\n" +
+		"index people_email_key on people(email) using btree\n" +
+		"index people_pkey on people(id) using btree\n"
+	if got := c.String(); got != want {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+
+	for _, sql := range []string{
+		"insert into people values (1, 'a@x', 1, 1)",
+		"insert into people values (2, null, 1, 2)",
+		"insert into people values (3, null, null, 2)",
+		"insert into people values (4, 'd@x', null, 2)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+	for _, sql := range []string{
+		"insert into people values (1, 'e@x', 5, 5)",
+		"insert into people values (5, 'a@x', 5, 5)",
+		"insert into people values (5, 'e@x', 1, 2)",
+		"update people set id = 2 where id = 1",
+		"update people set email = 'd@x' where id = 1",
+		"update people set b = 2 where id = 1",
+	} {
+		expectConstraintViolation(t, bp, c, sql, sql)
+	}
+	if _, err := execSQLForTest(t, bp, c, "insert into people values (null, 'e@x', 5, 5)", noTransaction); err == nil {
+		t.Errorf("expected an error inserting a NULL primary key")
+	}
+	// a tuple can be updated to the key it already has, and an update frees
+	// the key it changes
+	for _, sql := range []string{
+		"update people set email = 'a@x' where id = 1",
+		"update people set id = 10 where id = 1",
+		"insert into people values (1, 'f@x', 7, 7)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+
+	// the transaction that deletes a key can insert it again, and an aborted
+	// insert leaves no trace
+	tid := BeginTransactionForTest(t, bp)
+	people, _ := c.GetTable("people")
+	for _, tup := range runQueryForTest(t, bp, people, noTransaction) {
+		if tup.Fields[0] == (IntField{10}) {
+			if err := people.deleteTuple(tup, tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+	}
+	runSQLForTest(t, bp, c, "insert into people values (10, 'a@x', null, null)", tid)
+	runSQLForTest(t, bp, c, "insert into people values (11, 'g@x', null, null)", tid)
+	bp.AbortTransaction(tid)
+	if _, err := execSQLForTest(t, bp, c, "insert into people values (11, 'g@x', 2, 2)", noTransaction); err != nil {
+		t.Errorf("expected the aborted insert to free the key: %s", err.Error())
+	}
+
+	// without the index of a key, the table is scanned
+	runSQLForTest(t, bp, c, "drop index people_pkey", noTransaction)
+	expectConstraintViolation(t, bp, c, "insert into people values (11, 'h@x', 3, 3)", "insert without an index")
+
+	// the keys are kept in the catalog file
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got := c2.String(); got != "people(id int not null, email text, a int, b int) primary key (id) unique (email) unique (a, b)\n"+
+		"index people_a_b_key on people(a) using btree\n"+
+		"index people_email_key on people(email) using btree\n" {
+		t.Errorf("unexpected catalog after a restart:\n%s", got)
+	}
+	expectConstraintViolation(t, bp2, c2, "insert into people values (12, 'a@x', 4, 4)", "insert after a restart")
+
+	for _, sql := range []string{
+		"create table bad (a int primary key, b int, primary key (b))",
+		"create table bad (a int, unique (c))",
+		"create table bad (a int, unique (a, a))",
+		"create table bad (a int unique) using column",
+	} {
+		if _, _, err := Parse(c2, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+		if _, err := c2.GetTableInfo("bad"); err == nil {
+			t.Errorf("%s: expected the table not to be created", sql)
+			c2.dropTable("bad")
+		}
+	}
+}
+
+func TestTableKeysRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the keys and their indexes are in the log record of the create
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table t (a int primary key, b text, c int, unique key t_bc (b, c))", tid)
+	runSQLForTest(t, bp, c, "insert into t values (1, 'x', 1)", tid)
+	bp.CommitTransaction(tid)
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	want := "t(a int not null, b text, c int) primary key (a) unique (b, c)\n" +
+		"index t_b_c_key on t(b) using btree\n" +
+		"index t_pkey on t(a) using btree\n"
+	if got := c2.String(); got != want {
+		t.Errorf("unexpected catalog after recovery:\n%s", got)
+	}
+
+	// ALTER TABLE renames the columns of keys, and drops the keys of dropped
+	// columns
+	runSQLForTest(t, bp2, c2, "alter table t rename column c to d", noTransaction)
+	runSQLForTest(t, bp2, c2, "alter table t drop column a", noTransaction)
+	if got := c2.String(); got != "t(b text, d int) unique (b, d)\nindex t_b_c_key on t(b) using btree\n" {
+		t.Errorf("unexpected catalog after alter table:\n%s", got)
+	}
+	expectConstraintViolation(t, bp2, c2, "insert into t values ('x', 1)", "insert after alter table")
+}
+
+func TestTableKeysJoinCardinality(t *testing.T) {
+	if card := EstimateJoinCardinality(100, 1000, false, false); card != 1000 {
+		t.Errorf("expected 1000 without keys, got %d", card)
+	}
+	if card := EstimateJoinCardinality(100, 1000, true, false); card != 1000 {
+		t.Errorf("expected 1000 joining with a key of the first table, got %d", card)
+	}
+	if card := EstimateJoinCardinality(100, 1000, false, true); card != 100 {
+		t.Errorf("expected 100 joining with a key of the second table, got %d", card)
+	}
+	if card := EstimateJoinCardinality(100, 1000, true, true); card != 100 {
+		t.Errorf("expected 100 joining two keys, got %d", card)
+	}
+
+	bp, c, _, _ := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table depts (id int primary key, name text)", noTransaction)
+	runSQLForTest(t, bp, c, "create table emps (name text, dept int)", noTransaction)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 10; i++ {
+		runSQLForTest(t, bp, c, fmt.Sprintf("insert into depts values (%d, 'd')", i), tid)
+	}
+	for i := 0; i < 300; i++ {
+		runSQLForTest(t, bp, c, fmt.Sprintf("insert into emps values ('e', %d)", i%10), tid)
+	}
+	bp.CommitTransaction(tid)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := c.GetTableStats("depts").EstimateDistinct("id"); n != 10 {
+		t.Errorf("expected the primary key to have 10 distinct values, got %d", n)
+	}
+	_, op, err := Parse(c, "select emps.name from emps, depts where emps.dept = depts.id")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if card := op.(*OperatorCard).Cardinality; card != 300 {
+		t.Errorf("expected the join to be estimated at 300 tuples, got %d", card)
+	}
+}
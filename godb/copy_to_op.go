@@ -0,0 +1,223 @@
+package godb
+
+/*
+copy_to_op.go implements CopyToOp, which writes the result of a query to a
+file, for the COPY TO statement and the \e command of the shell:
+
+	copy (select name, age from people where age > 30) to 'people.csv' with (format csv, header)
+	copy people to 'people.jsonl' with (format jsonl)
+
+The tuples are written as they are read from the query, so the result is never
+held in memory. The formats are:
+
+  - csv: fields separated by commas, as described by RFC 4180. Fields that
+    contain a comma, double quote or line break, and empty strings, are
+    enclosed in double quotes, and their double quotes written twice. NULL is an
+    empty field that is not quoted, as [Catalog.LoadCSV] reads it.
+  - tsv: fields separated by tabs, in which backslashes, tabs and line breaks
+    are escaped as \\, \t, \n and \r, and NULL is \N.
+  - jsonl: one JSON object per line, whose keys are the names of the fields.
+    Ints and finite floats are JSON numbers, bools are JSON booleans, NULL is
+    null, and other values are JSON strings.
+
+Values are written as their literals, e.g., dates as 2024-01-31, timestamps as
+2024-01-31 12:00:00.5, and blobs as \x followed by hex digits, which can be
+loaded back into a table. The csv and tsv formats may start with a header line
+with the names of the fields.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type CopyToOp struct {
+	child  Operator
+	path   string
+	format string // "csv", "tsv" or "jsonl"
+	header bool
+}
+
+// Construct an operator that writes the records of the child Operator to the
+// named file in the specified format, "csv", "tsv" or "jsonl", preceded by a
+// header line with the names of the fields if header is true.
+//
+// Returns an error if the format is unknown, or is jsonl and header is true.
+func NewCopyToOp(child Operator, path string, format string, header bool) (*CopyToOp, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "csv", "tsv":
+	case "jsonl":
+		if header {
+			return nil, GoDBError{ParseError, "jsonl files cannot have a header"}
+		}
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown COPY format '%s'", format)}
+	}
+	return &CopyToOp{child, path, format, header}, nil
+}
+
+// The TupleDesc of a CopyToOp is a one column descriptor with an integer field
+// named "count", like the one of an [InsertOp].
+func (op *CopyToOp) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
+}
+
+// Return an iterator function that writes all of the tuples from the child
+// iterator to the file, replacing it if it exists, and then returns a
+// one-field tuple with a "count" field indicating the number of tuples that
+// were written.
+func (op *CopyToOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := op.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	didIterate := false
+	return func() (*Tuple, error) {
+		if didIterate {
+			return nil, nil
+		}
+		didIterate = true
+		cnt, err := op.writeFile(iter)
+		if err != nil {
+			return nil, err
+		}
+		return &Tuple{*op.Descriptor(), []DBValue{IntField{int64(cnt)}}, nil}, nil
+	}, nil
+}
+
+// Write the tuples of iter to the file, and return the number of tuples.
+func (op *CopyToOp) writeFile(iter func() (*Tuple, error)) (int, error) {
+	file, err := os.Create(op.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	names := copyFieldNames(op.child.Descriptor())
+	if op.header {
+		values := make([]DBValue, len(names))
+		for i, name := range names {
+			values[i] = StringField{name}
+		}
+		op.writeRow(w, names, values)
+	}
+	cnt := 0
+	for {
+		t, err := iter()
+		if err != nil {
+			return 0, err
+		}
+		if t == nil {
+			break
+		}
+		op.writeRow(w, names, t.Fields)
+		cnt++
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return cnt, file.Close()
+}
+
+// Return the names of the fields of desc, which are qualified by their table
+// if another field has the same name, e.g., in the result of a join.
+func copyFieldNames(desc *TupleDesc) []string {
+	count := make(map[string]int)
+	for _, f := range desc.Fields {
+		count[f.Fname]++
+	}
+	names := make([]string, len(desc.Fields))
+	for i, f := range desc.Fields {
+		names[i] = f.Fname
+		if count[f.Fname] > 1 && f.TableQualifier != "" {
+			names[i] = f.TableQualifier + "." + f.Fname
+		}
+	}
+	return names
+}
+
+// Write a line of the file with the specified values, whose fields have the
+// specified names. Errors are reported when the writer is flushed.
+func (op *CopyToOp) writeRow(w *bufio.Writer, names []string, values []DBValue) {
+	sep := ","
+	if op.format == "tsv" {
+		sep = "\t"
+	}
+	if op.format == "jsonl" {
+		w.WriteByte('{')
+	}
+	for i, v := range values {
+		if i > 0 {
+			w.WriteString(sep)
+		}
+		switch op.format {
+		case "csv":
+			w.WriteString(csvText(v))
+		case "tsv":
+			w.WriteString(tsvText(v))
+		case "jsonl":
+			w.WriteString(jsonString(names[i]) + ":" + jsonText(v))
+		}
+	}
+	if op.format == "jsonl" {
+		w.WriteByte('}')
+	}
+	w.WriteByte('\n')
+}
+
+// Return a value as a field of a csv file.
+func csvText(v DBValue) string {
+	if isNull(v) {
+		return ""
+	}
+	text := valueText(v)
+	if text == "" || strings.ContainsAny(text, ",\"\r\n") {
+		return `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+	}
+	return text
+}
+
+// Escapes of the characters of tsv fields that have a special meaning.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// Return a value as a field of a tsv file.
+func tsvText(v DBValue) string {
+	if isNull(v) {
+		return `\N`
+	}
+	return tsvEscaper.Replace(valueText(v))
+}
+
+// Return a value as a JSON value.
+func jsonText(v DBValue) string {
+	switch v := v.(type) {
+	case NullField:
+		return "null"
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	case FloatField:
+		if math.IsInf(v.Value, 0) || math.IsNaN(v.Value) {
+			return jsonString(valueText(v))
+		}
+		return valueText(v)
+	case BoolField:
+		return valueText(v)
+	}
+	return jsonString(valueText(v))
+}
+
+// Return a string as a JSON string.
+func jsonString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
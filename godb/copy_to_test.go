@@ -0,0 +1,104 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCopyTo(t *testing.T) {
+	bp, c, _, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table items (id int, name text, price float, sold bool, added date)", noTransaction)
+	for _, sql := range []string{
+		"insert into items values (1, 'plain', 1.5, true, '2024-01-31')",
+		"insert into items values (2, 'a, \"quoted\"\nname', 2, false, '2024-02-29')",
+		"insert into items values (3, 'tab\there \\\\ slash', null, null, null)",
+		"insert into items values (4, '', 0.25, true, '2024-12-25')",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	for _, test := range []struct {
+		options string
+		want    string
+	}{
+		{"format csv, header",
+			"id,name,price,sold,added\n" +
+				"1,plain,1.5,true,2024-01-31\n" +
+				"2,\"a, \"\"quoted\"\"\nname\",2,false,2024-02-29\n" +
+				"3,tab\there \\ slash,,,\n" +
+				"4,\"\",0.25,true,2024-12-25\n"},
+		{"format tsv",
+			"1\tplain\t1.5\ttrue\t2024-01-31\n" +
+				"2\ta, \"quoted\"\\nname\t2\tfalse\t2024-02-29\n" +
+				"3\ttab\\there \\\\ slash\t\\N\t\\N\t\\N\n" +
+				"4\t\t0.25\ttrue\t2024-12-25\n"},
+		{"format jsonl",
+			"{\"id\":1,\"name\":\"plain\",\"price\":1.5,\"sold\":true,\"added\":\"2024-01-31\"}\n" +
+				"{\"id\":2,\"name\":\"a, \\\"quoted\\\"\\nname\",\"price\":2,\"sold\":false,\"added\":\"2024-02-29\"}\n" +
+				"{\"id\":3,\"name\":\"tab\\there \\\\ slash\",\"price\":null,\"sold\":null,\"added\":null}\n" +
+				"{\"id\":4,\"name\":\"\",\"price\":0.25,\"sold\":true,\"added\":\"2024-12-25\"}\n"},
+	} {
+		path := root + "/items.out"
+		tid := BeginTransactionForTest(t, bp)
+		_, op, err := ParseInTransaction(c, fmt.Sprintf("copy (select * from items order by id) to '%s' with (%s)", path, test.options), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tups := runQueryForTest(t, bp, op, noTransaction)
+		bp.CommitTransaction(tid)
+		if len(tups) != 1 || tups[0].Fields[0] != (IntField{4}) {
+			t.Errorf("%s: expected a count of 4, got %v", test.options, tups)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.options, test.want, got)
+		}
+	}
+
+	// a csv file can be loaded back into a table
+	path := root + "/items.csv"
+	if _, err := execSQLForTest(t, bp, c, fmt.Sprintf("copy items to '%s' with (header)", path), noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runSQLForTest(t, bp, c, "create table copies (id int, name text, price float, sold bool, added date)", noTransaction)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if result, err := c.LoadCSV("copies", f, ",", true); err != nil || result.Loaded != 4 || len(result.Rejected) != 0 {
+		t.Fatalf("expected the csv file to be loaded, got %v, %v", result, err)
+	}
+	want := runSQLForTest(t, bp, c, "select * from items order by id", noTransaction)
+	got := runSQLForTest(t, bp, c, "select * from copies order by id", noTransaction)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(got))
+	}
+	for i := range want {
+		for j := range want[i].Fields {
+			if want[i].Fields[j] != got[i].Fields[j] {
+				t.Errorf("row %d: expected %v, got %v", i, want[i].Fields, got[i].Fields)
+				break
+			}
+		}
+	}
+
+	for _, sql := range []string{
+		fmt.Sprintf("copy items to '%s' with (format xml)", path),
+		fmt.Sprintf("copy items to '%s' with (format jsonl, header)", path),
+		fmt.Sprintf("copy items to '%s' with (delimiter '|')", path),
+		fmt.Sprintf("copy (insert into items values (5, 'x', 1, true, '2024-01-01')) to '%s'", path),
+		fmt.Sprintf("copy nowhere to '%s'", path),
+		fmt.Sprintf("copy items from '%s' with (format tsv)", path),
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
@@ -0,0 +1,690 @@
+package godb
+
+/*
+ddl.go implements CREATE TABLE, DROP TABLE, CREATE INDEX, DROP INDEX, CREATE
+VIEW and DROP VIEW as part of a transaction.
+
+The statements write a record with the definition of the table, index or view
+to the log (see log_file.go), so that they can be undone when the transaction
+aborts and recovered after a crash, like the updates of the transaction.
+
+A created table or index is added to the catalog right away. A dropped table
+is removed from the catalog right away, but its files, and those of its
+indexes, are only deleted when the transaction commits, so that an abort can
+add the table back as it was. A dropped index is removed from the catalog, so
+that queries no longer use it, but stays attached to its table until the
+transaction commits, so that updates of the table keep it up to date in case
+the drop is undone. Views have no files, and are added to and removed from the
+catalog right away.
+
+When the database is started, the records are read before the pages of the
+log are recovered (see [Catalog.recoverTables]), so that the catalog has the
+tables of the committed transactions. Update records of tables that no longer
+exist are read as pages of a [droppedFile], whose flushes do nothing.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// The transaction ID of DDL statements that are not part of a transaction,
+// which run in a transaction of their own (see [Catalog.runDDL]).
+const noTransaction TransactionID = -1
+
+// The definition of a table, as written to CreateTable and DropTable log
+// records.
+type tableDef struct {
+	id      int
+	name    string
+	file    string // name of the file of the table in the root directory
+	storage string // "heap" or "column"
+	desc    TupleDesc
+	columns []columnInfo
+	keys    []tableKey
+	fks     []foreignKey
+	indexes []indexDef // indexes of the table
+}
+
+// The definition of an index of a table.
+type indexDef struct {
+	id     int
+	name   string
+	file   string
+	column string
+	method string
+}
+
+// A table dropped by a transaction that has not committed.
+type droppedTable struct {
+	table   *Table
+	indexes []*Index // the indexes of the table, which are dropped with it
+}
+
+// An index created or dropped by a transaction that has not committed.
+type indexChange struct {
+	idx     *Index
+	dropped bool
+}
+
+// A view created or dropped by a transaction that has not committed.
+type viewChange struct {
+	v       *view
+	dropped bool
+}
+
+// Return the definition of the index.
+func (idx *Index) def() indexDef {
+	return indexDef{idx.id, idx.name, idx.fileName, idx.column, idx.method}
+}
+
+// Return the storage method of the table, "heap" or "column".
+func (t *Table) storage() string {
+	if _, ok := t.file.(*ColumnFile); ok {
+		return "column"
+	}
+	return "heap"
+}
+
+// Return the definition of a table and its indexes.
+func (c *Catalog) tableDef(t *Table, indexes []*Index) tableDef {
+	def := tableDef{t.id, t.name, t.fileName, t.storage(), t.desc, t.columns, t.keys, t.foreignKeys, nil}
+	for _, idx := range indexes {
+		def.indexes = append(def.indexes, idx.def())
+	}
+	return def
+}
+
+// Return the files of a table and its indexes whose pages may be cached in the
+// buffer pool.
+func tableFiles(t *Table, indexes []*Index) []DBFile {
+	files := []DBFile{t.file}
+	if hf, ok := t.file.(*HeapFile); ok {
+		files = append(files, hf.overflow)
+	}
+	for _, idx := range indexes {
+		files = append(files, idx.file)
+	}
+	return files
+}
+
+// Return the names of the files on disk of a table and its indexes. Files that
+// now belong to another table or index in the catalog, e.g., one created with
+// the same name after the drop that recovery is redoing, are left out.
+func (c *Catalog) tableFileNames(def *tableDef) []string {
+	inUse := make(map[string]bool)
+	for _, t := range c.tableMap {
+		inUse[t.fileName] = true
+	}
+	for _, idx := range c.indexMap {
+		inUse[idx.fileName] = true
+	}
+	var names []string
+	if !inUse[def.file] {
+		name := c.rootFile(def.file)
+		names = append(names, name)
+		if def.storage != "column" {
+			names = append(names, fsmFileName(name), overflowFileName(name))
+		}
+	}
+	for _, idx := range def.indexes {
+		if !inUse[idx.file] {
+			names = append(names, c.rootFile(idx.file))
+		}
+	}
+	return names
+}
+
+// Run ddl on behalf of tid. If tid is noTransaction, ddl runs in a transaction
+// of its own, which is committed if ddl succeeds, or, if the buffer pool has
+// no log, with noTransaction, in which case the change is not logged.
+func (c *Catalog) runDDL(tid TransactionID, ddl func(tid TransactionID) error) error {
+	bp := c.bufferPool
+	if tid != noTransaction {
+		if !bp.IsRunning(tid) {
+			return GoDBError{IllegalTransactionError, "Transaction is not running or has aborted."}
+		}
+		return ddl(tid)
+	}
+	if bp == nil || bp.logFile == nil {
+		return ddl(noTransaction)
+	}
+	tid = NewTID()
+	if err := bp.BeginTransaction(tid); err != nil {
+		return err
+	}
+	if err := ddl(tid); err != nil {
+		bp.AbortTransaction(tid)
+		return err
+	}
+	bp.CommitTransaction(tid)
+	return nil
+}
+
+// Create a table on behalf of tid, and log its creation, so that it is removed
+// if tid aborts. See [Catalog.createTable]. A btree index is created on the
+// first column of each key, unless an earlier key starts with the same column,
+// and is logged with the table. The tables that the foreign keys reference
+// must exist (see [Catalog.checkNewForeignKeys]).
+func (c *Catalog) createTableInTransaction(tid TransactionID, named string, desc TupleDesc, columns []columnInfo, keys []tableKey, fks []foreignKey, storage string) error {
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if _, ok := c.tableMap[named]; ok {
+			return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+		}
+		for _, drops := range c.dropped {
+			for _, d := range drops {
+				if d.table.name == named {
+					return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' was dropped by a transaction that has not committed", named)}
+				}
+			}
+		}
+		fks, err := c.checkNewForeignKeys(named, &desc, keys, fks)
+		if err != nil {
+			return err
+		}
+		if _, err := c.createTable(named, desc, columns, keys, fks, storage); err != nil {
+			return err
+		}
+		t := c.tableMap[named]
+		indexed := make(map[string]bool)
+		for _, k := range t.keys {
+			if indexed[k.columns[0]] {
+				continue
+			}
+			indexed[k.columns[0]] = true
+			if _, err := c.addIndex(k.indexName(named), named, k.columns[0], "btree"); err != nil {
+				c.dropTable(named)
+				return err
+			}
+		}
+		if tid == noTransaction {
+			return nil
+		}
+		def := c.tableDef(t, c.tableIndexes(named))
+		if err := c.bufferPool.logFile.logTable(CreateTableRecord, tid, &def); err != nil {
+			c.dropTable(named)
+			return err
+		}
+		c.created[tid] = append(c.created[tid], t)
+		return nil
+	})
+}
+
+// Drop a table and its indexes on behalf of tid, and log the drop. The table
+// is removed from the catalog, but its files are only deleted when tid
+// commits, so that the table is restored if tid aborts. A table that foreign
+// keys of other tables reference cannot be dropped. A temporary table is
+// dropped right away (see temp_tables.go).
+func (c *Catalog) dropTableInTransaction(tid TransactionID, named string) error {
+	if t, ok := c.tableMap[named]; ok && t.temporary() {
+		return c.dropTemporaryTable(t)
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if err := c.checkUnreferenced(named, "drop"); err != nil {
+			return err
+		}
+		if err := c.checkNotMaterialized(named); err != nil {
+			return err
+		}
+		if err := c.checkNoViewUses(named); err != nil {
+			return err
+		}
+		if tid == noTransaction {
+			return c.dropTable(named)
+		}
+		t, err := c.GetTableInfo(named)
+		if err != nil {
+			return err
+		}
+		def := c.tableDef(t, c.tableIndexes(named))
+		if err := c.bufferPool.logFile.logTable(DropTableRecord, tid, &def); err != nil {
+			return err
+		}
+		indexes := c.unregisterTable(t)
+		c.dropped[tid] = append(c.dropped[tid], &droppedTable{t, indexes})
+		return nil
+	})
+}
+
+// Create an index on behalf of tid, and log its creation, so that it is
+// removed if tid aborts. See [Catalog.createIndex]. An index that a transaction
+// that has not committed dropped cannot be created again until the drop
+// commits, since its file is only deleted then.
+func (c *Catalog) createIndexInTransaction(tid TransactionID, name string, table string, column string, method string) error {
+	return c.runDDL(tid, func(tid TransactionID) error {
+		for _, changes := range c.indexChanges {
+			for _, ch := range changes {
+				if ch.dropped && ch.idx.name == name {
+					return GoDBError{DuplicateTableError, fmt.Sprintf("index '%s' was dropped by a transaction that has not committed", name)}
+				}
+			}
+		}
+		if err := c.createIndex(tid, name, table, column, method); err != nil {
+			return err
+		}
+		if tid == noTransaction {
+			return nil
+		}
+		idx := c.indexMap[name]
+		def := idx.def()
+		if err := c.bufferPool.logFile.logIndex(CreateIndexRecord, tid, c.tableMap[table].id, &def); err != nil {
+			c.dropIndex(name)
+			return err
+		}
+		c.indexChanges[tid] = append(c.indexChanges[tid], indexChange{idx, false})
+		return nil
+	})
+}
+
+// Drop an index on behalf of tid, and log the drop. The index is removed from
+// the catalog, but stays attached to its table, and its file is only deleted
+// when tid commits, so that the index is restored if tid aborts.
+func (c *Catalog) dropIndexInTransaction(tid TransactionID, name string) error {
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if tid == noTransaction {
+			return c.dropIndex(name)
+		}
+		idx, ok := c.indexMap[name]
+		if !ok {
+			return GoDBError{NoSuchTableError, fmt.Sprintf("no index '%s' found", name)}
+		}
+		t, err := c.GetTableInfo(idx.table)
+		if err != nil {
+			return err
+		}
+		def := idx.def()
+		if err := c.bufferPool.logFile.logIndex(DropIndexRecord, tid, t.id, &def); err != nil {
+			return err
+		}
+		delete(c.indexMap, name)
+		c.indexChanges[tid] = append(c.indexChanges[tid], indexChange{idx, true})
+		return nil
+	})
+}
+
+// Detach an index that is no longer in the catalog from the heap file of its
+// table, if the table is in the catalog, and return the name of the file of the
+// index, unless an index in the catalog uses it.
+func (c *Catalog) detachIndex(idx *Index) []string {
+	if t, ok := c.tableMap[idx.table]; ok {
+		if hf, ok := t.file.(*HeapFile); ok {
+			hf.removeIndex(idx)
+		}
+	}
+	return c.unusedIndexFile(idx.fileName)
+}
+
+// Return the name of the index file fileName in the root directory, unless an
+// index in the catalog uses it.
+func (c *Catalog) unusedIndexFile(fileName string) []string {
+	for _, idx := range c.indexMap {
+		if idx.fileName == fileName {
+			return nil
+		}
+	}
+	return []string{c.rootFile(fileName)}
+}
+
+// Forget the tables, indexes and views created and dropped by tid, which has
+// committed, and detach the indexes it dropped from their tables. Returns the
+// files of the dropped tables and indexes, whose cached pages should be
+// discarded, and the names of the files to delete.
+func (c *Catalog) commitDDL(tid TransactionID) ([]DBFile, []string) {
+	var files []DBFile
+	var names []string
+	for _, d := range c.dropped[tid] {
+		def := c.tableDef(d.table, d.indexes)
+		files = append(files, tableFiles(d.table, d.indexes)...)
+		names = append(names, c.tableFileNames(&def)...)
+	}
+	for _, ch := range c.indexChanges[tid] {
+		if ch.dropped {
+			files = append(files, ch.idx.file)
+			names = append(names, c.detachIndex(ch.idx)...)
+		}
+	}
+	delete(c.dropped, tid)
+	delete(c.created, tid)
+	delete(c.indexChanges, tid)
+	delete(c.viewChanges, tid)
+	return files, names
+}
+
+// Undo the tables, indexes and views created and dropped by tid, which is
+// aborting: the tables it created are removed from the catalog, and those it
+// dropped are added back with their indexes, e.g., the old version of a table
+// that ALTER TABLE rewrote. Then the indexes and views it dropped are added
+// back, and those it created removed, in the reverse order of the statements.
+// Called before the updates of tid are rolled back, so that the pages of the
+// dropped tables in the log can be read. Returns the files of the created
+// tables and indexes, whose cached pages should be discarded, and the names of
+// the files to delete once the updates are rolled back.
+func (c *Catalog) abortDDL(tid TransactionID) ([]DBFile, []string) {
+	var removed []*droppedTable
+	created := make(map[*Table]bool)
+	for _, t := range c.created[tid] {
+		created[t] = true
+		if c.tableMap[t.name] == t {
+			removed = append(removed, &droppedTable{t, c.unregisterTable(t)})
+		}
+	}
+	drops := c.dropped[tid]
+	for i := len(drops) - 1; i >= 0; i-- {
+		if created[drops[i].table] {
+			// created and dropped again by tid
+			removed = append(removed, drops[i])
+			continue
+		}
+		c.registerTable(drops[i].table)
+		for _, idx := range drops[i].indexes {
+			c.indexMap[idx.name] = idx
+		}
+	}
+	changes := c.indexChanges[tid]
+	var removedIndexes []*Index
+	for i := len(changes) - 1; i >= 0; i-- {
+		idx := changes[i].idx
+		if changes[i].dropped {
+			c.indexMap[idx.name] = idx
+			continue
+		}
+		if c.indexMap[idx.name] == idx {
+			delete(c.indexMap, idx.name)
+		}
+		removedIndexes = append(removedIndexes, idx)
+	}
+	views := c.viewChanges[tid]
+	for i := len(views) - 1; i >= 0; i-- {
+		v := views[i].v
+		if views[i].dropped {
+			c.viewMap[v.name] = v
+		} else if c.viewMap[v.name] == v {
+			delete(c.viewMap, v.name)
+		}
+	}
+	delete(c.created, tid)
+	delete(c.dropped, tid)
+	delete(c.indexChanges, tid)
+	delete(c.viewChanges, tid)
+
+	var files []DBFile
+	var names []string
+	for _, d := range removed {
+		def := c.tableDef(d.table, d.indexes)
+		files = append(files, tableFiles(d.table, d.indexes)...)
+		names = append(names, c.tableFileNames(&def)...)
+	}
+	for _, idx := range removedIndexes {
+		files = append(files, idx.file)
+		names = append(names, c.detachIndex(idx)...)
+	}
+	return files, names
+}
+
+// Bring the tables of the catalog up to date with the CreateTable and
+// DropTable records of the log, e.g., when the catalog file was saved before
+// a crash, while a transaction that created or dropped tables was running.
+// The tables created by committed transactions, and those dropped by
+// transactions that did not commit, are added to the catalog; the tables
+// dropped by committed transactions, and those created by transactions that
+// did not commit, are removed and their files deleted, even if a transaction
+// that did not commit dropped them again. The indexes of the CreateIndex and
+// DropIndex records, and the views of the CreateView and DropView records, are
+// then brought up to date the same way. The files are deleted last, so that
+// files that a kept table uses are not.
+//
+// Must be called before the pages of the log are recovered, since it decides
+// which files the pages of update records belong to.
+func (c *Catalog) recoverTables(logFile *LogFile) error {
+	if err := logFile.seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	committed := make(map[TransactionID]bool)
+	var records []*TableLogRecord
+	var indexRecords []*IndexLogRecord
+	var viewRecords []*ViewLogRecord
+	iter := logFile.ForwardIterator()
+	for {
+		r, err := iter()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		switch r := r.(type) {
+		case *TableLogRecord:
+			records = append(records, r)
+		case *IndexLogRecord:
+			indexRecords = append(indexRecords, r)
+		case *ViewLogRecord:
+			viewRecords = append(viewRecords, r)
+		default:
+			if r.Type() == CommitRecord {
+				committed[r.Tid()] = true
+			}
+		}
+	}
+
+	// the last record of each file number has the latest definition of its
+	// table, e.g., with the indexes it had when it was dropped
+	last := make(map[int]*TableLogRecord)
+	keep := make(map[int]bool)
+	for _, r := range records {
+		c.nextFileId = max(c.nextFileId, r.def.id+1)
+		for _, idx := range r.def.indexes {
+			c.nextFileId = max(c.nextFileId, idx.id+1)
+		}
+		last[r.def.id] = r
+		if _, ok := keep[r.def.id]; !ok || r.Type() == CreateTableRecord || committed[r.Tid()] {
+			keep[r.def.id] = (r.Type() == CreateTableRecord) == committed[r.Tid()]
+		}
+	}
+	var removed []tableDef
+	for _, r := range records {
+		if last[r.def.id] != r || keep[r.def.id] {
+			continue
+		}
+		def := r.def
+		if t, err := c.GetTableInfoId(r.def.id); err == nil {
+			def = c.tableDef(t, c.unregisterTable(t))
+		}
+		removed = append(removed, def)
+	}
+	for _, r := range records {
+		if last[r.def.id] != r || !keep[r.def.id] {
+			continue
+		}
+		// a table with the same name in the catalog wins
+		_, err := c.GetTableInfoId(r.def.id)
+		if _, ok := c.tableMap[r.def.name]; err != nil && !ok {
+			if err := c.openTableDef(&r.def); err != nil {
+				return err
+			}
+		}
+	}
+	names, err := c.recoverIndexes(indexRecords, committed)
+	if err != nil {
+		return err
+	}
+	c.recoverViews(viewRecords, committed)
+	disk := c.bufferPool.DiskManager()
+	for _, def := range removed {
+		for _, name := range c.tableFileNames(&def) {
+			disk.Remove(name)
+		}
+	}
+	for _, name := range names {
+		disk.Remove(name)
+	}
+	return logFile.seek(0, io.SeekEnd)
+}
+
+// Bring the indexes of the catalog up to date with the CreateIndex and
+// DropIndex records of the log, like [Catalog.recoverTables] does with tables.
+// Indexes whose tables are no longer in the catalog are not added. Returns the
+// names of the files of the indexes that were removed, which should be
+// deleted.
+func (c *Catalog) recoverIndexes(records []*IndexLogRecord, committed map[TransactionID]bool) ([]string, error) {
+	last := make(map[int]*IndexLogRecord)
+	keep := make(map[int]bool)
+	for _, r := range records {
+		c.nextFileId = max(c.nextFileId, r.def.id+1)
+		last[r.def.id] = r
+		if _, ok := keep[r.def.id]; !ok || r.Type() == CreateIndexRecord || committed[r.Tid()] {
+			keep[r.def.id] = (r.Type() == CreateIndexRecord) == committed[r.Tid()]
+		}
+	}
+	var names []string
+	for _, r := range records {
+		if last[r.def.id] != r {
+			continue
+		}
+		var idx *Index
+		for _, other := range c.indexMap {
+			if other.id == r.def.id {
+				idx = other
+			}
+		}
+		if !keep[r.def.id] {
+			if idx != nil {
+				delete(c.indexMap, idx.name)
+				names = append(names, c.detachIndex(idx)...)
+			} else {
+				names = append(names, c.unusedIndexFile(r.def.file)...)
+			}
+			continue
+		}
+		// an index with the same name in the catalog wins
+		if _, ok := c.indexMap[r.def.name]; idx != nil || ok {
+			continue
+		}
+		t, err := c.GetTableInfoId(r.table)
+		if err != nil {
+			continue
+		}
+		if _, err := c.openIndex(r.def.id, r.def.name, r.def.file, t.name, r.def.column, r.def.method); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// Bring the views of the catalog up to date with the CreateView and DropView
+// records of the log, like [Catalog.recoverTables] does with tables. Views are
+// identified by their name, and a kept view gets the definition of its last
+// record.
+func (c *Catalog) recoverViews(records []*ViewLogRecord, committed map[TransactionID]bool) {
+	last := make(map[string]*ViewLogRecord)
+	keep := make(map[string]bool)
+	for _, r := range records {
+		name := r.view.name
+		last[name] = r
+		if _, ok := keep[name]; !ok || r.Type() == CreateViewRecord || committed[r.Tid()] {
+			keep[name] = (r.Type() == CreateViewRecord) == committed[r.Tid()]
+		}
+	}
+	for name, r := range last {
+		if keep[name] {
+			v := r.view
+			c.viewMap[name] = &v
+		} else {
+			delete(c.viewMap, name)
+		}
+	}
+}
+
+// Add a table and its indexes to the catalog from their definition, opening
+// their existing files.
+func (c *Catalog) openTableDef(def *tableDef) error {
+	if _, err := c.openTable(def.id, def.name, def.file, *def.desc.copy(), def.columns, def.keys, def.fks, def.storage); err != nil {
+		return err
+	}
+	for _, idx := range def.indexes {
+		if _, err := c.openIndex(idx.id, idx.name, idx.file, def.name, idx.column, idx.method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The file of the pages of update records in the log whose file has been
+// dropped. Since file numbers are never reused, the pages no longer belong to
+// any file, and flushing them, e.g., during recovery, does nothing.
+type droppedFile struct {
+	id int
+}
+
+// A page of a [droppedFile].
+type droppedPage struct {
+	file   *droppedFile
+	pageNo int
+}
+
+type droppedPageKey struct {
+	id     int
+	pageNo int
+}
+
+func (f *droppedFile) insertTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "the file has been dropped"}
+}
+
+func (f *droppedFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "the file has been dropped"}
+}
+
+func (f *droppedFile) readPage(pageNo int) (Page, error) {
+	return nil, GoDBError{IllegalOperationError, "the file has been dropped"}
+}
+
+func (f *droppedFile) flushPage(page Page) error {
+	return nil
+}
+
+func (f *droppedFile) pageKey(pgNo int) any {
+	return droppedPageKey{f.id, pgNo}
+}
+
+func (f *droppedFile) NumPages() int {
+	return 0
+}
+
+func (f *droppedFile) Descriptor() *TupleDesc {
+	return &TupleDesc{}
+}
+
+func (f *droppedFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return nil, GoDBError{IllegalOperationError, "the file has been dropped"}
+}
+
+func (p *droppedPage) isDirty() bool {
+	return false
+}
+
+func (p *droppedPage) setDirty(tid TransactionID, dirty bool) {
+}
+
+func (p *droppedPage) getFile() DBFile {
+	return p.file
+}
+
+func (p *droppedPage) PageNo() int {
+	return p.pageNo
+}
+
+func (p *droppedPage) getDirtier() TransactionID {
+	return 0
+}
+
+func (p *droppedPage) BeforeImage() Page {
+	return p
+}
+
+func (p *droppedPage) SetBeforeImage() {
+}
+
+func (p *droppedPage) toBuffer() (*bytes.Buffer, error) {
+	return bytes.NewBuffer(make([]byte, PageSize)), nil
+}
@@ -0,0 +1,219 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDDLRollback(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table kept (id int, name text)", noTransaction)
+	runSQLForTest(t, bp, c, "create index kept_id on kept(id)", noTransaction)
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "insert into kept values (1, 'a')", tid)
+	bp.CommitTransaction(tid)
+	kept, _ := c.GetTable("kept")
+
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table temp (a int)", tid)
+	runSQLForTest(t, bp, c, "insert into temp values (1)", tid)
+	runSQLForTest(t, bp, c, "drop table kept", tid)
+	if _, err := c.GetTable("kept"); err == nil {
+		t.Errorf("expected the dropped table to be gone")
+	}
+	if _, _, err := Parse(c, "create table kept (x int)"); err == nil {
+		t.Errorf("expected an error creating a table whose drop has not committed")
+	}
+	bp.AbortTransaction(tid)
+
+	if _, err := c.GetTable("temp"); err == nil {
+		t.Errorf("expected the created table to be removed by the abort")
+	}
+	if _, ok := disk.files[root+"/temp.dat"]; ok {
+		t.Errorf("expected the file of the created table to be deleted by the abort")
+	}
+	f, err := c.GetTable("kept")
+	if err != nil || f != kept {
+		t.Fatalf("expected the dropped table to be restored by the abort")
+	}
+	if c.findIndex("kept", "id", OpEq) == nil {
+		t.Errorf("expected the index of the dropped table to be restored by the abort")
+	}
+	if n := len(runQueryForTest(t, bp, kept, noTransaction)); n != 1 {
+		t.Errorf("expected 1 tuple in the restored table, got %d", n)
+	}
+
+	// the files and pages of a dropped table are deleted when the drop commits
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "drop table kept", tid)
+	if _, ok := disk.files[root+"/kept.dat"]; !ok {
+		t.Errorf("expected the file of the dropped table to be kept until commit")
+	}
+	bp.CommitTransaction(tid)
+	for _, name := range []string{"kept.dat", "kept.dat.fsm", "kept.dat.ovf", "kept_id.idx"} {
+		if _, ok := disk.files[root+"/"+name]; ok {
+			t.Errorf("expected %s to be deleted by the drop", name)
+		}
+	}
+	for _, pg := range bp.pages {
+		if pg.getFile() == kept {
+			t.Errorf("expected the pages of the dropped table to be discarded")
+		}
+	}
+}
+
+func TestDDLRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	for _, sql := range []string{"create table a (x int)", "create table b (x int)", "drop table b", "create table c (x int)"} {
+		runSQLForTest(t, bp, c, sql, noTransaction)
+	}
+	ids := map[string]int{}
+	for _, name := range []string{"a", "c"} {
+		ti, _ := c.GetTableInfo(name)
+		ids[name] = ti.id
+	}
+	if ids["c"] != ids["a"]+2 {
+		t.Errorf("expected the file number of a dropped table not to be reused, got %v", ids)
+	}
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "insert into a values (1)", tid)
+	bp.CommitTransaction(tid)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a committed table that is not in the catalog file, and a transaction
+	// that creates and drops tables but does not commit before the crash
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table d (x int)", tid)
+	runSQLForTest(t, bp, c, "insert into d values (2)", tid)
+	bp.CommitTransaction(tid)
+	ti, _ := c.GetTableInfo("d")
+	ids["d"] = ti.id
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table e (x int)", tid)
+	runSQLForTest(t, bp, c, "drop table a", tid)
+	lost := c.nextFileId
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got := c2.String(); got != "a(x int)\nc(x int)\nd(x int)\n" {
+		t.Errorf("unexpected tables after recovery:\n%s", got)
+	}
+	for name, id := range ids {
+		if ti, err := c2.GetTableInfo(name); err != nil || ti.id != id {
+			t.Errorf("expected table %s to keep file number %d", name, id)
+		}
+	}
+	if c2.nextFileId < lost {
+		t.Errorf("expected file numbers up to %d to stay used, next is %d", lost, c2.nextFileId)
+	}
+	if _, ok := disk.files[root+"/e.dat"]; ok {
+		t.Errorf("expected the file of the uncommitted table to be deleted")
+	}
+	for name, want := range map[string]DBValue{"a": IntField{1}, "d": IntField{2}} {
+		f, _ := c2.GetTable(name)
+		tups := runQueryForTest(t, bp2, f, noTransaction)
+		if len(tups) != 1 || tups[0].Fields[0] != want {
+			t.Errorf("expected table %s to contain %v after recovery, got %v", name, want, tups)
+		}
+	}
+
+	// recovery saved the catalog, so the file numbers survive another restart
+	_, c3 := openTestDatabase(t, disk, root)
+	if c3.String() != c2.String() || c3.nextFileId != c2.nextFileId {
+		t.Errorf("expected the recovered catalog to be saved")
+	}
+	if ti, err := c3.GetTableInfo("d"); err != nil || ti.id != ids["d"] {
+		t.Errorf("expected table d to keep file number %d", ids["d"])
+	}
+}
+
+func TestIndexDDLRollback(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table p (id int, name text)", noTransaction)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 10; i++ {
+		runSQLForTest(t, bp, c, fmt.Sprintf("insert into p values (%d, 'x')", i), tid)
+	}
+	bp.CommitTransaction(tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create index p_id on p(id)", tid)
+	if c.findIndex("p", "id", OpEq) == nil {
+		t.Errorf("expected the index to be used by the transaction that creates it")
+	}
+	bp.AbortTransaction(tid)
+	if c.findIndex("p", "id", OpEq) != nil {
+		t.Errorf("expected the created index to be removed by the abort")
+	}
+	if _, ok := disk.files[root+"/p_id.idx"]; ok {
+		t.Errorf("expected the file of the created index to be deleted by the abort")
+	}
+	if n := len(runSQLForTest(t, bp, c, "select * from p where id = 3", noTransaction)); n != 1 {
+		t.Errorf("expected 1 tuple after the abort, got %d", n)
+	}
+
+	runSQLForTest(t, bp, c, "create index p_id on p(id)", noTransaction)
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "drop index p_id", tid)
+	if c.findIndex("p", "id", OpEq) != nil {
+		t.Errorf("expected the dropped index to be gone")
+	}
+	if _, _, err := Parse(c, "create index p_id on p(name)"); err == nil {
+		t.Errorf("expected an error creating an index whose drop has not committed")
+	}
+	runSQLForTest(t, bp, c, "insert into p values (10, 'y')", tid)
+	bp.AbortTransaction(tid)
+	if c.findIndex("p", "id", OpEq) == nil {
+		t.Fatalf("expected the dropped index to be restored by the abort")
+	}
+	if n := len(runSQLForTest(t, bp, c, "select * from p where id = 10", noTransaction)); n != 0 {
+		t.Errorf("expected the aborted insert to be undone in the restored index, got %d tuples", n)
+	}
+	if n := len(runSQLForTest(t, bp, c, "select * from p where id = 3", noTransaction)); n != 1 {
+		t.Errorf("expected 1 tuple through the restored index, got %d", n)
+	}
+
+	// the file of a dropped index is deleted when the drop commits
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "drop index p_id", tid)
+	if _, ok := disk.files[root+"/p_id.idx"]; !ok {
+		t.Errorf("expected the file of the dropped index to be kept until commit")
+	}
+	bp.CommitTransaction(tid)
+	if _, ok := disk.files[root+"/p_id.idx"]; ok {
+		t.Errorf("expected the file of the dropped index to be deleted by the commit")
+	}
+}
+
+func TestIndexDDLRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table p (id int, name text)", noTransaction)
+	runSQLForTest(t, bp, c, "create index p_name on p(name)", noTransaction)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// a committed index that is not in the catalog file, and a transaction
+	// that creates and drops indexes but does not commit before the crash
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create index p_id on p(id)", tid)
+	runSQLForTest(t, bp, c, "insert into p values (1, 'a')", tid)
+	bp.CommitTransaction(tid)
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create index p_both on p(name)", tid)
+	runSQLForTest(t, bp, c, "drop index p_name", tid)
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	for name, want := range map[string]bool{"p_id": true, "p_name": true, "p_both": false} {
+		if _, ok := c2.indexMap[name]; ok != want {
+			t.Errorf("index %s: expected it to exist after recovery to be %v", name, want)
+		}
+	}
+	if _, ok := disk.files[root+"/p_both.idx"]; ok {
+		t.Errorf("expected the file of the uncommitted index to be deleted")
+	}
+	if n := len(runSQLForTest(t, bp2, c2, "select * from p where id = 1", noTransaction)); n != 1 {
+		t.Errorf("expected 1 tuple through the recovered index, got %d", n)
+	}
+}
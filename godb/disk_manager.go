@@ -0,0 +1,309 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+A DiskManager performs the I/O of the files of a database: heap files, column
+files, index files, free-space maps and the log. Files are identified by name,
+and are read and written at explicit offsets, so that callers do not need to
+keep track of file positions.
+
+[FileDiskManager] keeps the files it has opened open, rather than opening and
+closing a file for every page that is read or written. [MemDiskManager] keeps
+files in memory, which is useful in tests, as is wrapping a DiskManager to
+inject faults.
+
+Every DBFile gets its DiskManager from its [BufferPool] (see
+[BufferPool.DiskManager]).
+*/
+type DiskManager interface {
+	// Open the named file, creating it if it does not exist. Must be called
+	// before a file is used, e.g., when a DBFile is created, since it also
+	// notices when a file was removed or replaced since it was last opened.
+	Open(fileName string) error
+
+	// Read len(b) bytes from the named file, starting at offset off. Like
+	// [os.File.ReadAt], returns an error if fewer bytes are read, which is
+	// io.EOF at the end of the file.
+	ReadAt(fileName string, b []byte, off int64) (int, error)
+
+	// Write b to the named file at offset off, extending the file if needed.
+	WriteAt(fileName string, b []byte, off int64) (int, error)
+
+	// Return the size of the named file in bytes.
+	Size(fileName string) (int64, error)
+
+	// Change the size of the named file.
+	Truncate(fileName string, size int64) error
+
+	// Make the writes to the named file durable.
+	Sync(fileName string) error
+
+	// Close and delete the named file.
+	Remove(fileName string) error
+
+	// Close all open files.
+	Close() error
+
+	// Return the number of reads and writes performed so far.
+	Stats() IOStats
+}
+
+// Counts of the I/O performed by a DiskManager.
+type IOStats struct {
+	Reads        int64
+	Writes       int64
+	BytesRead    int64
+	BytesWritten int64
+	Syncs        int64
+}
+
+func (s IOStats) String() string {
+	return fmt.Sprintf("%d reads (%d bytes), %d writes (%d bytes), %d syncs", s.Reads, s.BytesRead, s.Writes, s.BytesWritten, s.Syncs)
+}
+
+// Counters shared by the DiskManager implementations; safe for concurrent use.
+type ioCounter struct {
+	reads, writes, bytesRead, bytesWritten, syncs atomic.Int64
+}
+
+func (c *ioCounter) countRead(n int) {
+	c.reads.Add(1)
+	c.bytesRead.Add(int64(n))
+}
+
+func (c *ioCounter) countWrite(n int) {
+	c.writes.Add(1)
+	c.bytesWritten.Add(int64(n))
+}
+
+func (c *ioCounter) Stats() IOStats {
+	return IOStats{c.reads.Load(), c.writes.Load(), c.bytesRead.Load(), c.bytesWritten.Load(), c.syncs.Load()}
+}
+
+// The DiskManager used by buffer pools created with [NewBufferPool], and by
+// files that have no buffer pool. It is shared so that a file is only open
+// once, however many buffer pools use it.
+var defaultDiskManager DiskManager = NewFileDiskManager()
+
+// A DiskManager for files in the file system, which keeps one open file
+// descriptor per file.
+type FileDiskManager struct {
+	files map[string]*os.File
+	sync.Mutex
+	ioCounter
+}
+
+// Create a FileDiskManager with no open files.
+func NewFileDiskManager() *FileDiskManager {
+	return &FileDiskManager{make(map[string]*os.File), sync.Mutex{}, ioCounter{}}
+}
+
+// Return the open file with the specified name, opening it if needed. If
+// reopen is true, a file that no longer refers to the file with that name in
+// the file system, e.g., because it was deleted, is reopened.
+func (dm *FileDiskManager) file(fileName string, reopen bool) (*os.File, error) {
+	dm.Lock()
+	defer dm.Unlock()
+	file, ok := dm.files[fileName]
+	if ok && reopen {
+		fi, err := file.Stat()
+		cur, statErr := os.Stat(fileName)
+		if err != nil || statErr != nil || !os.SameFile(fi, cur) {
+			file.Close()
+			ok = false
+		}
+	}
+	if !ok {
+		var err error
+		file, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			delete(dm.files, fileName)
+			return nil, err
+		}
+		dm.files[fileName] = file
+	}
+	return file, nil
+}
+
+func (dm *FileDiskManager) Open(fileName string) error {
+	_, err := dm.file(fileName, true)
+	return err
+}
+
+func (dm *FileDiskManager) ReadAt(fileName string, b []byte, off int64) (int, error) {
+	file, err := dm.file(fileName, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.ReadAt(b, off)
+	dm.countRead(n)
+	return n, err
+}
+
+func (dm *FileDiskManager) WriteAt(fileName string, b []byte, off int64) (int, error) {
+	file, err := dm.file(fileName, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.WriteAt(b, off)
+	dm.countWrite(n)
+	return n, err
+}
+
+func (dm *FileDiskManager) Size(fileName string) (int64, error) {
+	file, err := dm.file(fileName, false)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (dm *FileDiskManager) Truncate(fileName string, size int64) error {
+	file, err := dm.file(fileName, false)
+	if err != nil {
+		return err
+	}
+	return file.Truncate(size)
+}
+
+func (dm *FileDiskManager) Sync(fileName string) error {
+	file, err := dm.file(fileName, false)
+	if err != nil {
+		return err
+	}
+	dm.syncs.Add(1)
+	return file.Sync()
+}
+
+func (dm *FileDiskManager) Remove(fileName string) error {
+	dm.Lock()
+	if file, ok := dm.files[fileName]; ok {
+		file.Close()
+		delete(dm.files, fileName)
+	}
+	dm.Unlock()
+	return os.Remove(fileName)
+}
+
+func (dm *FileDiskManager) Close() error {
+	dm.Lock()
+	defer dm.Unlock()
+	var firstErr error
+	for name, file := range dm.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(dm.files, name)
+	}
+	return firstErr
+}
+
+// A DiskManager that keeps files in memory. Files are lost when the
+// MemDiskManager is discarded.
+type MemDiskManager struct {
+	files map[string][]byte
+	sync.Mutex
+	ioCounter
+}
+
+// Create a MemDiskManager with no files.
+func NewMemDiskManager() *MemDiskManager {
+	return &MemDiskManager{make(map[string][]byte), sync.Mutex{}, ioCounter{}}
+}
+
+func (dm *MemDiskManager) Open(fileName string) error {
+	dm.Lock()
+	defer dm.Unlock()
+	if _, ok := dm.files[fileName]; !ok {
+		dm.files[fileName] = nil
+	}
+	return nil
+}
+
+func (dm *MemDiskManager) ReadAt(fileName string, b []byte, off int64) (int, error) {
+	dm.Lock()
+	defer dm.Unlock()
+	data := dm.files[fileName]
+	n := 0
+	if off < int64(len(data)) {
+		n = copy(b, data[off:])
+	}
+	dm.countRead(n)
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (dm *MemDiskManager) WriteAt(fileName string, b []byte, off int64) (int, error) {
+	dm.Lock()
+	defer dm.Unlock()
+	data := dm.files[fileName]
+	if end := off + int64(len(b)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	n := copy(data[off:], b)
+	dm.files[fileName] = data
+	dm.countWrite(n)
+	return n, nil
+}
+
+func (dm *MemDiskManager) Size(fileName string) (int64, error) {
+	dm.Lock()
+	defer dm.Unlock()
+	return int64(len(dm.files[fileName])), nil
+}
+
+func (dm *MemDiskManager) Truncate(fileName string, size int64) error {
+	dm.Lock()
+	defer dm.Unlock()
+	data := dm.files[fileName]
+	if size <= int64(len(data)) {
+		dm.files[fileName] = data[:size]
+	} else {
+		dm.files[fileName] = append(data, make([]byte, size-int64(len(data)))...)
+	}
+	return nil
+}
+
+func (dm *MemDiskManager) Sync(fileName string) error {
+	dm.syncs.Add(1)
+	return nil
+}
+
+func (dm *MemDiskManager) Remove(fileName string) error {
+	dm.Lock()
+	defer dm.Unlock()
+	if _, ok := dm.files[fileName]; !ok {
+		return &os.PathError{Op: "remove", Path: fileName, Err: os.ErrNotExist}
+	}
+	delete(dm.files, fileName)
+	return nil
+}
+
+func (dm *MemDiskManager) Close() error {
+	return nil
+}
+
+// A file of a DiskManager. Used by files that are read and written
+// sequentially, like the log.
+type diskFile struct {
+	disk DiskManager
+	name string
+}
+
+// Return the name of the file.
+func (f diskFile) Name() string {
+	return f.name
+}
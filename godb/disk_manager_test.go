@@ -0,0 +1,164 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// Create a buffer pool and catalog whose files use disk and are in a temporary
+// directory, with a table dm_test that holds nTups tuples. Returns the
+// directory.
+func makeDiskManagerTestDatabase(t *testing.T, disk DiskManager, nTups int) (*BufferPool, *Catalog, *HeapFile, string) {
+	t.Helper()
+	bp, err := NewBufferPoolWithDiskManager(20, disk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	root := t.TempDir()
+	c := NewCatalog("catalog.txt", bp, root)
+	bp.logFile, err = NewLogFile(root+"/dm_test.log", bp, c)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	td, t1, _ := makeTupleTestVars()
+	f, err := c.addTable("dm_test", td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := f.(*HeapFile)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < nTups; i++ {
+		tup := Tuple{td, []DBValue{t1.Fields[0], IntField{int64(i)}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+	return bp, c, hf, root
+}
+
+func TestMemDiskManager(t *testing.T) {
+	disk := NewMemDiskManager()
+	_, _, hf, root := makeDiskManagerTestDatabase(t, disk, 500)
+	if hf.NumPages() < 2 {
+		t.Fatalf("expected several pages, got %d", hf.NumPages())
+	}
+	if _, err := os.Stat(hf.BackingFile()); !os.IsNotExist(err) {
+		t.Errorf("expected the heap file to be kept in memory only")
+	}
+	if size, _ := disk.Size(hf.BackingFile()); size != int64(hf.NumPages()*PageSize) {
+		t.Errorf("expected %d bytes in memory, got %d", hf.NumPages()*PageSize, size)
+	}
+	stats := disk.Stats()
+	if stats.Writes == 0 || stats.Syncs == 0 {
+		t.Errorf("expected writes and syncs to be counted, got %v", stats)
+	}
+
+	// the table and the log can be read back through the same disk manager
+	bp2, err := NewBufferPoolWithDiskManager(20, disk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2 := NewCatalog("catalog.txt", bp2, root)
+	hf2, err := c2.addTable("dm_test", *hf.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lf, err := NewLogFile(root+"/dm_test.log", bp2, c2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bp2.Recover(lf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(runQueryForTest(t, bp2, hf2, noTransaction)); n != 500 {
+		t.Errorf("expected 500 tuples, got %d", n)
+	}
+	if disk.Stats().Reads <= stats.Reads {
+		t.Errorf("expected reads to be counted")
+	}
+}
+
+func TestFileDiskManagerKeepsFilesOpen(t *testing.T) {
+	disk := NewFileDiskManager()
+	defer disk.Close()
+	bp, _, hf, _ := makeDiskManagerTestDatabase(t, disk, 500)
+
+	before := disk.Stats()
+	for p := 0; p < hf.NumPages(); p++ {
+		if _, err := hf.readPage(p); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	after := disk.Stats()
+	if after.Reads-before.Reads != int64(hf.NumPages()) || after.BytesRead-before.BytesRead != int64(hf.NumPages()*PageSize) {
+		t.Errorf("expected %d page reads, got %v", hf.NumPages(), after)
+	}
+	// the heap file, its free-space map and overflow file, and the log
+	if len(disk.files) != 4 {
+		t.Errorf("expected 4 open files, got %d", len(disk.files))
+	}
+
+	// a file that is deleted behind the disk manager's back is reopened
+	os.Remove(hf.BackingFile())
+	hf2, err := NewHeapFile(hf.BackingFile(), hf.Descriptor(), bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hf2.NumPages() != 0 {
+		t.Errorf("expected the recreated file to be empty, got %d pages", hf2.NumPages())
+	}
+}
+
+var errInjected = errors.New("injected I/O error")
+
+// A DiskManager that fails reads or writes of a file on demand.
+type faultyDiskManager struct {
+	DiskManager
+	fileName   string
+	failReads  bool
+	failWrites bool
+}
+
+func (dm *faultyDiskManager) ReadAt(fileName string, b []byte, off int64) (int, error) {
+	if dm.failReads && fileName == dm.fileName {
+		return 0, errInjected
+	}
+	return dm.DiskManager.ReadAt(fileName, b, off)
+}
+
+func (dm *faultyDiskManager) WriteAt(fileName string, b []byte, off int64) (int, error) {
+	if dm.failWrites && fileName == dm.fileName {
+		return 0, errInjected
+	}
+	return dm.DiskManager.WriteAt(fileName, b, off)
+}
+
+func TestDiskManagerFaults(t *testing.T) {
+	disk := &faultyDiskManager{NewMemDiskManager(), "", false, false}
+	bp, _, hf, _ := makeDiskManagerTestDatabase(t, disk, 500)
+	disk.fileName = hf.BackingFile()
+
+	pg, err := hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	disk.failWrites = true
+	if err := hf.flushPage(pg); !errors.Is(err, errInjected) {
+		t.Errorf("expected the write error to be returned, got %v", err)
+	}
+	disk.failWrites = false
+
+	// evict the pages of the table, so that they are read again
+	bp.discardPages(hf)
+	disk.failReads = true
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	if _, err := bp.GetPage(hf, 0, tid, ReadPerm); !errors.Is(err, errInjected) {
+		t.Errorf("expected the read error to be returned, got %v", err)
+	}
+	disk.failReads = false
+	if _, err := bp.GetPage(hf, 0, tid, ReadPerm); err != nil {
+		t.Errorf("expected the page to be read once reads succeed, got %v", err)
+	}
+}
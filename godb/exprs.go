@@ -13,7 +13,7 @@ import (
 //other values from tuples.
 
 type Expr interface {
-	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField or StringField
+	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField, StringField or NullField
 	GetExprType() FieldType             //Return the type of the Expression
 }
 
@@ -48,13 +48,27 @@ func (c *ConstExpr) EvalExpr(_ *Tuple) (DBValue, error) {
 	return c.val, nil
 }
 
+// Return a constant with the value of c converted to type t, e.g., the string
+// '2024-01-01' converted to a date, or c itself if the value is NULL or cannot
+// be converted.
+func (c *ConstExpr) castTo(t DBType) *ConstExpr {
+	if c.constType == t || t == UnknownType || isNull(c.val) {
+		return c
+	}
+	v, err := castValue(c.val, t)
+	if err != nil {
+		return c
+	}
+	return &ConstExpr{v, t}
+}
+
 type FuncExpr struct {
 	op   string
 	args []*Expr
 }
 
 func (f *FuncExpr) GetExprType() FieldType {
-	fType, exists := funcs[f.op]
+	fType, exists := f.funcType()
 	//todo return err
 	if !exists {
 		return FieldType{f.op, "", IntType}
@@ -94,6 +108,30 @@ var funcs = map[string]FuncType{
 	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
 }
 
+// Arithmetic functions of floats, which are used instead of the functions of
+// the same name in funcs if one of the arguments is a float. The other argument
+// may be an int, which is converted to a float.
+var floatFuncs = map[string]FuncType{
+	"+": {[]DBType{FloatType, FloatType}, FloatType, addFloatFunc},
+	"-": {[]DBType{FloatType, FloatType}, FloatType, minusFloatFunc},
+	"*": {[]DBType{FloatType, FloatType}, FloatType, timesFloatFunc},
+	"/": {[]DBType{FloatType, FloatType}, FloatType, divFloatFunc},
+}
+
+// Return the type of the function of f, which is the float version of an
+// arithmetic function if one of its arguments is a float.
+func (f *FuncExpr) funcType() (FuncType, bool) {
+	if fType, ok := floatFuncs[f.op]; ok {
+		for _, arg := range f.args {
+			if (*arg).GetExprType().Ftype == FloatType {
+				return fType, true
+			}
+		}
+	}
+	fType, ok := funcs[f.op]
+	return fType, ok
+}
+
 func ListOfFunctions() string {
 	fList := ""
 	for name, f := range funcs {
@@ -104,12 +142,7 @@ func ListOfFunctions() string {
 			if hasArg {
 				args = args + ","
 			}
-			switch a {
-			case IntType:
-				args = args + "int"
-			case StringType:
-				args = args + "string"
-			}
+			args = args + a.String()
 			hasArg = true
 		}
 		args = args + ")"
@@ -189,6 +222,22 @@ func addFunc(args []any) any {
 	return args[0].(int64) + args[1].(int64)
 }
 
+func addFloatFunc(args []any) any {
+	return args[0].(float64) + args[1].(float64)
+}
+
+func minusFloatFunc(args []any) any {
+	return args[0].(float64) - args[1].(float64)
+}
+
+func timesFloatFunc(args []any) any {
+	return args[0].(float64) * args[1].(float64)
+}
+
+func divFloatFunc(args []any) any {
+	return args[0].(float64) / args[1].(float64)
+}
+
 func sqFunc(args []any) any {
 	return args[0].(int64) * args[0].(int64)
 }
@@ -211,7 +260,7 @@ func subStrFunc(args []any) any {
 }
 
 func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	fType, exists := funcs[f.op]
+	fType, exists := f.funcType()
 	if !exists {
 		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", f.op)}
 	}
@@ -221,11 +270,14 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 	argvals := make([]any, len(fType.argTypes))
 	for i, argType := range fType.argTypes {
 		arg := *f.args[i]
-		if arg.GetExprType().Ftype != argType {
+		ftype := arg.GetExprType().Ftype
+		if ftype != argType && ftype != UnknownType && !(ftype == IntType && argType == FloatType) {
 			typeName := "string"
 			switch argType {
 			case IntType:
 				typeName = "int"
+			case FloatType:
+				typeName = "float"
 			}
 			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, typeName)}
 		}
@@ -233,17 +285,30 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 		if err != nil {
 			return nil, err
 		}
+		// functions of NULL are NULL
+		if isNull(val) {
+			return NullField{}, nil
+		}
 		switch argType {
 		case IntType:
 			argvals[i] = val.(IntField).Value
 		case StringType:
 			argvals[i] = val.(StringField).Value
+		case FloatType:
+			// ints are promoted to floats
+			if intVal, ok := val.(IntField); ok {
+				argvals[i] = float64(intVal.Value)
+			} else {
+				argvals[i] = val.(FloatField).Value
+			}
 		}
 	}
 	result := fType.f(argvals)
 	switch fType.outType {
 	case IntType:
 		return IntField{result.(int64)}, nil
+	case FloatType:
+		return FloatField{result.(float64)}, nil
 	case StringType:
 		return StringField{result.(string)}, nil
 	}
@@ -0,0 +1,87 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+)
+
+// A fixed-width histogram over a single float field. Like an [IntHistogram],
+// but values are spread over bins of equal real-valued width, and a range
+// predicate counts the fraction of each bin that it overlaps.
+type FloatHistogram struct {
+	bins     []int64
+	min      float64
+	max      float64
+	n        int64
+	binWidth float64
+}
+
+// NewFloatHistogram creates a new FloatHistogram with the specified number of
+// bins covering the values from vMin to vMax (inclusive).
+func NewFloatHistogram(nBins int64, vMin float64, vMax float64) (*FloatHistogram, error) {
+	if nBins <= 0 {
+		return nil, fmt.Errorf("nBins must be positive")
+	}
+	if vMin > vMax {
+		return nil, fmt.Errorf("min must be less than or equal to max")
+	}
+	binWidth := (vMax - vMin) / float64(nBins)
+	if binWidth == 0 {
+		binWidth = 1
+	}
+	return &FloatHistogram{make([]int64, nBins), vMin, vMax, 0, binWidth}, nil
+}
+
+func (h *FloatHistogram) bin(v float64) int {
+	bin := int(math.Floor((v - h.min) / h.binWidth))
+	return max(0, min(bin, len(h.bins)-1))
+}
+
+// Add a value v to the histogram.
+func (h *FloatHistogram) AddValue(v float64) {
+	h.bins[h.bin(v)]++
+	h.n++
+}
+
+// Estimate the selectivity of a predicate and operand on the values represented
+// by this histogram.
+//
+// Equality is estimated as if the values in a bin were spread evenly over one
+// distinct value per unit of its width.
+func (h *FloatHistogram) EstimateSelectivity(op BoolOp, v float64) float64 {
+	if h.n == 0 {
+		return 0.0
+	}
+	switch op {
+	case OpEq:
+		if v < h.min || v > h.max {
+			return 0.0
+		}
+		return float64(h.bins[h.bin(v)]) / float64(h.n) / max(1, h.binWidth)
+	case OpNeq:
+		return 1 - h.EstimateSelectivity(OpEq, v)
+	case OpLt, OpLe:
+		return h.fractionBelow(v)
+	case OpGt, OpGe:
+		return 1 - h.fractionBelow(v)
+	}
+	return 1.0
+}
+
+// Return the estimated fraction of values less than v.
+func (h *FloatHistogram) fractionBelow(v float64) float64 {
+	if v <= h.min {
+		return 0.0
+	}
+	if v > h.max {
+		return 1.0
+	}
+	b := h.bin(v)
+	total := 0.0
+	for i := 0; i < b; i++ {
+		total += float64(h.bins[i])
+	}
+	binL := h.min + h.binWidth*float64(b)
+	total += float64(h.bins[b]) * min(1, (v-binL)/h.binWidth)
+	return total / float64(h.n)
+}
@@ -0,0 +1,465 @@
+package godb
+
+/*
+foreign_keys.go implements FOREIGN KEY constraints.
+
+A foreign key of a table (the child) references a primary or unique key of a
+table (the parent), which may be the child itself:
+
+	create table orders (id int primary key, cust int,
+		foreign key (cust) references customers (id) on delete cascade)
+
+Every tuple of the child whose columns of the foreign key are not NULL must
+have the values of a tuple of the parent. This is checked when a tuple is
+inserted into or updated in the child, by looking the values up in the
+parent on behalf of the transaction, so that the pages of the parent tuple
+stay read-locked until the transaction ends, and the tuple cannot be deleted
+by another transaction in the meantime.
+
+When a parent tuple that child tuples reference is deleted, the ON DELETE
+action of the foreign key decides what happens to them:
+
+	restrict     the delete fails (the default, also called NO ACTION)
+	cascade      the child tuples are deleted
+	set default  the columns of the foreign key of the child tuples are set to
+	             their DEFAULT values, or NULL
+
+The values of a parent tuple that child tuples reference cannot be updated,
+a parent table cannot be dropped or truncated, and the parent columns of a
+foreign key cannot be dropped or renamed.
+
+The checks and actions are run by the [HeapFile] of the tables, like those of
+keys (see constraints.go). The foreign keys are stored in the catalog file
+after the keys of their table, e.g., "orders(id int not null, cust int)
+primary key (id) foreign key (cust) references customers (id) on delete
+cascade".
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A FOREIGN KEY constraint of a table.
+type foreignKey struct {
+	columns       []string // columns of the table
+	parent        string   // the referenced table
+	parentColumns []string // the referenced columns, a key of the parent
+	onDelete      string   // "restrict", "cascade" or "set default"
+	fields        []int    // positions of the columns in the TupleDesc of the table
+}
+
+// Return the foreign key as written in the catalog file, e.g.,
+// "foreign key (a) references t (b) on delete cascade". The default action,
+// restrict, is left out.
+func (fk foreignKey) String() string {
+	s := fmt.Sprintf("foreign key (%s) references %s (%s)", strings.Join(fk.columns, ", "), fk.parent, strings.Join(fk.parentColumns, ", "))
+	if fk.onDelete != "restrict" {
+		s += " on delete " + fk.onDelete
+	}
+	return s
+}
+
+// A foreign key at the end of a table line of the catalog file.
+var foreignKeyRe = regexp.MustCompile(`^(.*\))\s*foreign\s+key\s*\(([\w\s,]*)\)\s*references\s+(\w+)\s*\(([\w\s,]*)\)(?:\s*on\s+delete\s+(restrict|cascade|set\s+default))?\s*$`)
+
+// Return the ON DELETE action named by a clause, e.g., "set  default" or
+// "no action", or restrict if the clause is empty.
+func onDeleteAction(clause string) string {
+	action := strings.Join(strings.Fields(strings.ToLower(clause)), " ")
+	if action == "" || action == "no action" {
+		return "restrict"
+	}
+	return action
+}
+
+// Split a list of column names, e.g., "a, b".
+func splitColumns(list string) []string {
+	var columns []string
+	for _, col := range strings.Split(list, ",") {
+		if col := strings.TrimSpace(col); col != "" {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// Return foreign keys with the positions of their columns in desc set. Returns
+// an error if a foreign key has a column that is not in desc, or does not have
+// as many columns as the columns it references.
+func resolveForeignKeys(desc *TupleDesc, fks []foreignKey) ([]foreignKey, error) {
+	resolved := make([]foreignKey, len(fks))
+	for i, fk := range fks {
+		if len(fk.columns) == 0 || len(fk.columns) != len(fk.parentColumns) {
+			return nil, GoDBError{ParseError, fmt.Sprintf("%s must have as many columns as it references", fk)}
+		}
+		fields := make([]int, len(fk.columns))
+		for j, col := range fk.columns {
+			field, err := findFieldInTd(FieldType{col, "", UnknownType}, desc)
+			if err != nil {
+				return nil, err
+			}
+			fields[j] = field
+		}
+		resolved[i] = fk
+		resolved[i].fields = fields
+	}
+	return resolved, nil
+}
+
+// Check the foreign keys of a table that is being created with the specified
+// TupleDesc and keys, and return them with the referenced columns of the
+// foreign keys that do not name them set to the primary key of the parent.
+// The parent must exist, unless it is the table itself, and the referenced
+// columns must be a key of the parent with the types of the columns of the
+// foreign key.
+func (c *Catalog) checkNewForeignKeys(named string, desc *TupleDesc, keys []tableKey, fks []foreignKey) ([]foreignKey, error) {
+	checked := make([]foreignKey, len(fks))
+	for i, fk := range fks {
+		parentDesc, parentKeys := desc, keys
+		if fk.parent != named {
+			parent, err := c.GetTableInfo(fk.parent)
+			if err != nil {
+				return nil, err
+			}
+			parentDesc, parentKeys = &parent.desc, parent.keys
+		}
+		if len(fk.parentColumns) == 0 {
+			for _, k := range parentKeys {
+				if k.primary {
+					fk.parentColumns = k.columns
+				}
+			}
+		}
+		isKey := false
+		for _, k := range parentKeys {
+			isKey = isKey || sameColumns(k.columns, fk.parentColumns)
+		}
+		if !isKey {
+			return nil, GoDBError{ParseError, fmt.Sprintf("the columns that %s references are not a key of %s", fk, fk.parent)}
+		}
+		if len(fk.columns) != len(fk.parentColumns) {
+			return nil, GoDBError{ParseError, fmt.Sprintf("%s must have as many columns as it references", fk)}
+		}
+		for j, col := range fk.columns {
+			field, err := findFieldInTd(FieldType{col, "", UnknownType}, desc)
+			if err != nil {
+				return nil, err
+			}
+			parentField, err := findFieldInTd(FieldType{fk.parentColumns[j], "", UnknownType}, parentDesc)
+			if err != nil {
+				return nil, err
+			}
+			if desc.Fields[field].Ftype != parentDesc.Fields[parentField].Ftype {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %s of %s does not have the type of %s.%s", col, fk, fk.parent, fk.parentColumns[j])}
+			}
+		}
+		checked[i] = fk
+	}
+	return checked, nil
+}
+
+// Return true if the lists have the same columns, in any order.
+func sameColumns(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(cols []string) []string {
+		cols = append([]string{}, cols...)
+		sort.Strings(cols)
+		return cols
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A foreign key of a child table.
+type reference struct {
+	child *Table
+	fk    foreignKey
+}
+
+// Return the foreign keys that reference the specified table, including its
+// own, ordered by the name of their table.
+func (c *Catalog) referencesTo(tableName string) []reference {
+	var refs []reference
+	for _, t := range c.tableMap {
+		for _, fk := range t.foreignKeys {
+			if fk.parent == tableName {
+				refs = append(refs, reference{t, fk})
+			}
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].child.name < refs[j].child.name })
+	return refs
+}
+
+// Return an error if a foreign key of another table references the specified
+// column of a table, which cannot be dropped or renamed.
+func (c *Catalog) checkColumnUnreferenced(tableName string, column string, action string) error {
+	for _, ref := range c.referencesTo(tableName) {
+		if ref.child.name == tableName {
+			continue
+		}
+		for _, col := range ref.fk.parentColumns {
+			if col == column {
+				return GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s column '%s' of table '%s', which %s of table '%s' references", action, column, tableName, ref.fk, ref.child.name)}
+			}
+		}
+	}
+	return nil
+}
+
+// Return an error if the foreign keys of other tables reference the specified
+// table, which cannot be dropped or truncated.
+func (c *Catalog) checkUnreferenced(tableName string, action string) error {
+	for _, ref := range c.referencesTo(tableName) {
+		if ref.child.name != tableName {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s table '%s', which %s of table '%s' references", action, tableName, ref.fk, ref.child.name)}
+		}
+	}
+	return nil
+}
+
+// Return the table of the file in its catalog, or nil if the file is not the
+// file of a table.
+func (f *HeapFile) table() *Table {
+	if f.catalog == nil {
+		return nil
+	}
+	t, err := f.catalog.GetTableInfoDBFile(f)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// Return the heap file of the table that fk references, and the positions of
+// the referenced columns in its TupleDesc.
+func (c *Catalog) parentFile(fk foreignKey) (*HeapFile, []int, error) {
+	parent, err := c.GetTableInfo(fk.parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	hf, ok := parent.file.(*HeapFile)
+	if !ok {
+		return nil, nil, GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' that %s references is not a heap table", fk.parent, fk)}
+	}
+	fields := make([]int, len(fk.parentColumns))
+	for i, col := range fk.parentColumns {
+		if fields[i], err = findFieldInTd(FieldType{col, "", UnknownType}, &parent.desc); err != nil {
+			return nil, nil, err
+		}
+	}
+	return hf, fields, nil
+}
+
+// Return a ConstraintViolationError if the parent of a foreign key of the
+// file's table has no tuple with the values of t in the columns of the key.
+// Foreign keys whose values t does not change from old, which may be nil, are
+// not checked.
+func (f *HeapFile) checkForeignKeys(t *Tuple, old *Tuple, tid TransactionID) error {
+	table := f.table()
+	if table == nil {
+		return nil
+	}
+	for _, fk := range table.foreignKeys {
+		if old != nil && sameKeyValues(t, old, fk.fields) {
+			continue
+		}
+		if err := f.checkForeignKey(table, fk, t, tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return a ConstraintViolationError if the parent of the foreign key fk of
+// table, the table of the file, has no tuple with the values of t in the
+// columns of the key, unless one of them is NULL.
+func (f *HeapFile) checkForeignKey(table *Table, fk foreignKey, t *Tuple, tid TransactionID) error {
+	if hasNullField(t, fk.fields) {
+		return nil
+	}
+	parent, parentFields, err := f.catalog.parentFile(fk)
+	if err != nil {
+		return err
+	}
+	values := fieldValues(t, fk.fields)
+	// a tuple may reference itself
+	found := parent == f && hasValues(t, parentFields, values)
+	if !found {
+		err = parent.forEachMatch(parentFields, values, tid, func(*Tuple) bool {
+			found = true
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return GoDBError{ConstraintViolationError, fmt.Sprintf("values (%s) of %s of table '%s' are not in table '%s'", formatValues(values), fk, table.name, fk.parent)}
+	}
+	return nil
+}
+
+// Return the tuples of the child of ref that reference parent, a tuple of the
+// file, other than parent itself.
+func (f *HeapFile) referencingTuples(ref reference, parent *Tuple, tid TransactionID) ([]*Tuple, error) {
+	table := f.table()
+	var parentFields []int
+	for _, col := range ref.fk.parentColumns {
+		field, err := findFieldInTd(FieldType{col, "", UnknownType}, &table.desc)
+		if err != nil {
+			return nil, err
+		}
+		parentFields = append(parentFields, field)
+	}
+	if hasNullField(parent, parentFields) {
+		return nil, nil
+	}
+	child, ok := ref.child.file.(*HeapFile)
+	if !ok {
+		return nil, nil
+	}
+	var tups []*Tuple
+	err := child.forEachMatch(ref.fk.fields, fieldValues(parent, parentFields), tid, func(t *Tuple) bool {
+		if child != f || t.Rid != parent.Rid {
+			tups = append(tups, t)
+		}
+		return true
+	})
+	return tups, err
+}
+
+// Check that the tuple t of the file can be deleted: return a
+// ConstraintViolationError if a foreign key whose action is restrict
+// references it. Returns the foreign keys that reference the table of the
+// file, and the values of the tuple, for [HeapFile.applyDeleteActions].
+func (f *HeapFile) checkDeleteReferences(t *Tuple, tid TransactionID) ([]reference, *Tuple, error) {
+	table := f.table()
+	if table == nil {
+		return nil, nil, nil
+	}
+	refs := f.catalog.referencesTo(table.name)
+	if len(refs) == 0 {
+		return nil, nil, nil
+	}
+	old, err := f.getTuple(t.Rid, tid)
+	if err != nil || old == nil {
+		return nil, nil, err
+	}
+	for _, ref := range refs {
+		if ref.fk.onDelete != "restrict" {
+			continue
+		}
+		tups, err := f.referencingTuples(ref, old, tid)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tups) > 0 {
+			return nil, nil, GoDBError{ConstraintViolationError, fmt.Sprintf("cannot delete from table '%s' a tuple that %s of table '%s' references", table.name, ref.fk, ref.child.name)}
+		}
+	}
+	return refs, old, nil
+}
+
+// Run the cascade and set default actions of the foreign keys that reference
+// old, a deleted tuple of the file. The referencing tuples are found after
+// old is deleted, so that tuples that reference each other are not deleted
+// again.
+func (f *HeapFile) applyDeleteActions(old *Tuple, refs []reference, tid TransactionID) error {
+	for _, ref := range refs {
+		if ref.fk.onDelete == "restrict" {
+			continue
+		}
+		tups, err := f.referencingTuples(ref, old, tid)
+		if err != nil {
+			return err
+		}
+		child := ref.child.file.(*HeapFile)
+		for _, t := range tups {
+			if ref.fk.onDelete == "cascade" {
+				err = child.deleteTuple(t, tid)
+			} else {
+				newT := &Tuple{t.Desc, append([]DBValue{}, t.Fields...), nil}
+				for _, field := range ref.fk.fields {
+					if newT.Fields[field], err = columnDefault(ref.child, field); err != nil {
+						return err
+					}
+				}
+				// the update does not check a key that the default leaves
+				// unchanged, whose parent is the deleted tuple
+				if sameKeyValues(newT, t, ref.fk.fields) {
+					if err := child.checkForeignKey(ref.child, ref.fk, newT, tid); err != nil {
+						return err
+					}
+				}
+				err = child.updateTuple(t, newT, tid)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return a ConstraintViolationError if updating the tuple t of the file to
+// newT changes values of t that a foreign key references.
+func (f *HeapFile) checkUpdateReferences(t *Tuple, newT *Tuple, tid TransactionID) error {
+	table := f.table()
+	if table == nil {
+		return nil
+	}
+	refs := f.catalog.referencesTo(table.name)
+	if len(refs) == 0 {
+		return nil
+	}
+	old, err := f.getTuple(t.Rid, tid)
+	if err != nil || old == nil {
+		return err
+	}
+	for _, ref := range refs {
+		changed := false
+		for _, col := range ref.fk.parentColumns {
+			field, err := findFieldInTd(FieldType{col, "", UnknownType}, &table.desc)
+			if err != nil {
+				return err
+			}
+			changed = changed || !sameKeyValues(old, newT, []int{field})
+		}
+		if !changed {
+			continue
+		}
+		tups, err := f.referencingTuples(ref, old, tid)
+		if err != nil {
+			return err
+		}
+		if len(tups) > 0 {
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("cannot update values of table '%s' that %s of table '%s' references", table.name, ref.fk, ref.child.name)}
+		}
+	}
+	return nil
+}
+
+// Return the value that the set default action sets a column of a table to,
+// the DEFAULT of the column (see column_defaults.go).
+func columnDefault(t *Table, field int) (DBValue, error) {
+	return t.columns[field].defaultFor(t.desc.Fields[field].Ftype)
+}
+
+func formatValues(values []DBValue) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = valueText(v)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,211 @@
+package godb
+
+import (
+	"testing"
+)
+
+// Statements that create tables customers(id, name) and orders(id, cust,
+// note), whose foreign key on cust has the specified ON DELETE clause, with
+// customers 1 to 3 and two orders of customer 1 and one of customer 2.
+func foreignKeyTestTables(onDelete string) []string {
+	return []string{
+		"create table customers (id int primary key, name text)",
+		"create table orders (id int primary key, cust int, note text, foreign key (cust) references customers (id) " + onDelete + ")",
+		"insert into customers values (1, 'ann'), (2, 'bob'), (3, 'cid')",
+		"insert into orders values (10, 1, 'a'), (11, 1, 'b'), (12, 2, 'c')",
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, foreignKeyTestTables("")...)
+	if got := c.String(); got != "customers(id int not null, name text) primary key (id)\n"+
+		"orders(id int not null, cust int, note text) primary key (id) foreign key (cust) references customers (id)\n"+
+		"index customers_pkey on customers(id) using btree\n"+
+		"index orders_pkey on orders(id) using btree\n" {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+
+	for _, sql := range []string{
+		"insert into orders values (13, 4, 'd')",
+		"update orders set cust = 4 where id = 10",
+		"delete from customers where id = 1",
+		"update customers set id = 5 where id = 2",
+	} {
+		expectConstraintViolation(t, bp, c, sql, sql)
+	}
+	for _, sql := range []string{
+		"insert into orders values (13, null, 'd')",
+		"update orders set cust = 3 where id = 13",
+		"update customers set name = 'al' where id = 1",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+	expectConstraintViolation(t, bp, c, "delete from customers where id = 3", "delete of a customer with an order")
+	if _, err := execSQLForTest(t, bp, c, "delete from orders where id = 13", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := execSQLForTest(t, bp, c, "delete from customers where id = 3", noTransaction); err != nil {
+		t.Errorf("expected a customer without orders to be deleted: %s", err.Error())
+	}
+
+	// the parent tuple is read-locked by the transaction that references it
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "insert into orders values (14, 2, 'e')", tid)
+	customers, _ := c.GetTable("customers")
+	locked := false
+	for _, l := range bp.lockTable.heldLocks() {
+		locked = locked || (l.page == customers.pageKey(0) && l.tid == tid)
+	}
+	if !locked {
+		t.Errorf("expected the page of the customer to be locked")
+	}
+	bp.AbortTransaction(tid)
+
+	for _, sql := range []string{
+		"drop table customers",
+		"truncate table customers",
+		"alter table customers drop column id",
+		"alter table customers rename column id to cid",
+		"create table bad (a int, foreign key (a) references missing (id))",
+		"create table bad (a int, foreign key (a) references customers (name))",
+		"create table bad (a text, foreign key (a) references customers (id))",
+		"create table bad (a int, b int, foreign key (a, b) references customers (id))",
+		"create table bad (a int, foreign key (a) references customers (id)) using column",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+		if _, err := c.GetTableInfo("bad"); err == nil {
+			t.Errorf("%s: expected the table not to be created", sql)
+			c.dropTable("bad")
+		}
+	}
+
+	// the foreign keys are kept in the catalog file
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got, want := c2.String(), c.String(); got != want {
+		t.Errorf("unexpected catalog after a restart:\n%s", got)
+	}
+	expectConstraintViolation(t, bp2, c2, "insert into orders values (15, 4, 'f')", "insert after a restart")
+	expectConstraintViolation(t, bp2, c2, "delete from customers where id = 2", "delete after a restart")
+
+	// a child table can be dropped, and then its parent
+	runSQLForTest(t, bp2, c2, "drop table orders", noTransaction)
+	runSQLForTest(t, bp2, c2, "drop table customers", noTransaction)
+}
+
+func TestForeignKeyDeleteActions(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, foreignKeyTestTables("on delete cascade")...)
+	if _, err := execSQLForTest(t, bp, c, "delete from customers where id = 1", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from orders", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{12}) {
+		t.Errorf("expected the orders of customer 1 to be deleted, got %v", tups)
+	}
+	// an aborted delete keeps the orders
+	tid := BeginTransactionForTest(t, bp)
+	customers, _ := c.GetTable("customers")
+	for _, tup := range runQueryForTest(t, bp, customers, noTransaction) {
+		if tup.Fields[0] == (IntField{2}) {
+			if err := customers.deleteTuple(tup, tid); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+	}
+	bp.AbortTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select id from orders", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the abort to restore the order, got %v", tups)
+	}
+
+	bp, c, _, _ = newTestDatabase(t, foreignKeyTestTables("on delete set default")...)
+	if _, err := execSQLForTest(t, bp, c, "delete from customers where id = 1", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from orders where cust = 2", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the order of customer 2 to be kept, got %v", tups)
+	}
+	orders, _ := c.GetTable("orders")
+	nulls := 0
+	for _, tup := range runQueryForTest(t, bp, orders, noTransaction) {
+		if isNull(tup.Fields[1]) {
+			nulls++
+		}
+	}
+	if nulls != 2 {
+		t.Errorf("expected the orders of customer 1 to have a NULL customer, got %d", nulls)
+	}
+
+	// a tuple whose key is already the default is not left without a parent
+	bp, c, _, _ = newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table p (id int primary key)", noTransaction)
+	runSQLForTest(t, bp, c, "create table ch (id int, pid int default 0, foreign key (pid) references p (id) on delete set default)", noTransaction)
+	for _, sql := range []string{
+		"insert into p values (0)",
+		"insert into p values (1)",
+		"insert into ch values (1, 0)",
+		"insert into ch values (2, 1)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	expectConstraintViolation(t, bp, c, "delete from p where id = 0", "delete of the default parent")
+	if _, err := execSQLForTest(t, bp, c, "delete from p where id = 1", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from ch where pid = 0", noTransaction); len(tups) != 2 {
+		t.Errorf("expected both children to reference the default parent, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from p", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{0}) {
+		t.Errorf("expected the default parent to be kept, got %v", tups)
+	}
+
+	// a table may reference itself, and a cascade follows the references
+	bp, c, _, _ = newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table emps (id int primary key, boss int, constraint emps_boss foreign key (boss) references emps on delete cascade)", noTransaction)
+	if got := c.String(); got != "emps(id int not null, boss int) primary key (id) foreign key (boss) references emps (id) on delete cascade\nindex emps_pkey on emps(id) using btree\n" {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+	for _, sql := range []string{
+		"insert into emps values (1, 1)",
+		"insert into emps values (2, 1)",
+		"insert into emps values (3, 2)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	expectConstraintViolation(t, bp, c, "insert into emps values (4, 5)", "insert of a missing boss")
+	runSQLForTest(t, bp, c, "alter table emps rename column id to eid", noTransaction)
+	if _, err := execSQLForTest(t, bp, c, "delete from emps where eid = 2", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select eid from emps", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the employees of 2 to be deleted, got %v", tups)
+	}
+}
+
+func TestForeignKeyRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table customers (id int primary key)", noTransaction)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the foreign keys are in the log record of the create
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table orders (cust int, foreign key (cust) references customers (id) on delete set default)", tid)
+	bp.CommitTransaction(tid)
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got := c2.String(); got != "customers(id int not null) primary key (id)\n"+
+		"orders(cust int) foreign key (cust) references customers (id) on delete set default\n"+
+		"index customers_pkey on customers(id) using btree\n" {
+		t.Errorf("unexpected catalog after recovery:\n%s", got)
+	}
+	expectConstraintViolation(t, bp2, c2, "insert into orders values (1)", "insert after recovery")
+}
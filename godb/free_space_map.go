@@ -0,0 +1,119 @@
+package godb
+
+import (
+	"sync"
+)
+
+/*
+A freeSpaceMap records how much free space each page of a [HeapFile] has, so
+that inserts can go straight to a page with room instead of reading every page
+of the file. It is kept in memory and persisted in a side file next to the heap
+file (the heap file name with a ".fsm" suffix), with one byte per page:
+
++-----------------------------------------------+
+| page 0 | page 1 | page 2 | ...                 |
++-----------------------------------------------+
+
+The byte of a page is the largest tuple that fits on the page (see
+[heapPage.freeSpace]) divided by fsmUnit and rounded down, so a page with a
+value of v has room for any tuple of at most v*fsmUnit bytes.
+
+The map is updated in memory whenever a tuple is inserted into or deleted from
+a page, and written to the side file when the page is flushed, so that the side
+file describes the pages on disk. Because pages modified by transactions that
+abort are discarded from the buffer pool, the map may overstate or understate
+the free space of a page; it is only a hint, and [HeapFile.insertTuple] checks
+that the page it picks actually has room. Pages with no entry in the side file,
+e.g., the pages of a heap file created before free-space maps existed, are
+assumed to be empty until they are read.
+*/
+type freeSpaceMap struct {
+	disk     DiskManager
+	fileName string
+	free     []byte
+	sync.Mutex
+}
+
+// Number of bytes of free space represented by one unit of a free-space map
+// entry.
+const fsmUnit = (PageSize + 255) / 256
+
+// Return the name of the free-space map side file of the specified heap file.
+func fsmFileName(heapFile string) string {
+	return heapFile + ".fsm"
+}
+
+// Open the free-space map of a heap file with numPages pages, reading it from
+// its side file if it exists.
+func newFreeSpaceMap(disk DiskManager, heapFile string, numPages int) (*freeSpaceMap, error) {
+	fileName := fsmFileName(heapFile)
+	if err := disk.Open(fileName); err != nil {
+		return nil, err
+	}
+	size, err := disk.Size(fileName)
+	if err != nil {
+		return nil, err
+	}
+	free := make([]byte, max(numPages, int(size)))
+	n, err := disk.ReadAt(fileName, free[:size], 0)
+	if err != nil {
+		return nil, err
+	}
+	free = free[:numPages]
+	for i := n; i < numPages; i++ {
+		free[i] = fsmEntry(maxTupleSize())
+	}
+	return &freeSpaceMap{disk, fileName, free, sync.Mutex{}}, nil
+}
+
+// Return the free-space map entry of a page on which tuples of up to free bytes
+// fit.
+func fsmEntry(free int) byte {
+	if free <= 0 {
+		return 0
+	}
+	return byte(min(free/fsmUnit, 255))
+}
+
+// Record in memory that tuples of up to free bytes fit on the specified page.
+func (m *freeSpaceMap) set(pageNo int, free int) {
+	m.Lock()
+	defer m.Unlock()
+	for len(m.free) <= pageNo {
+		m.free = append(m.free, 0)
+	}
+	m.free[pageNo] = fsmEntry(free)
+}
+
+// Record that tuples of up to free bytes fit on the specified page, and write
+// the entry of the page to the side file.
+func (m *freeSpaceMap) write(pageNo int, free int) error {
+	m.set(pageNo, free)
+	_, err := m.disk.WriteAt(m.fileName, []byte{fsmEntry(free)}, int64(pageNo))
+	return err
+}
+
+// Remove the entries of the pages from numPages on, both in memory and in the
+// side file.
+func (m *freeSpaceMap) truncate(numPages int) error {
+	m.Lock()
+	defer m.Unlock()
+	if len(m.free) > numPages {
+		m.free = m.free[:numPages]
+	}
+	return m.disk.Truncate(m.fileName, int64(numPages))
+}
+
+// Return the first of the first numPages pages that has room for a tuple of the
+// specified size, or -1 if there is no such page.
+func (m *freeSpaceMap) find(size int, numPages int) int {
+	m.Lock()
+	defer m.Unlock()
+	need := (size + fsmUnit - 1) / fsmUnit
+	for p := 0; p < numPages && p < len(m.free); p++ {
+		if int(m.free[p]) >= need {
+			return p
+		}
+	}
+	return -1
+}
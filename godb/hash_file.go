@@ -0,0 +1,569 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+/*
+HashFile implements an extendible hash index over one column of a table. Like a
+[BTreeFile], it is used as a secondary index (see [Index]) that maps a key to
+the heapFileRid of a tuple in the table's heap file, but it only supports
+equality lookups.
+
+A HashFile is a sequence of PageSize pages that are read and written through
+the BufferPool. Page 0 is the directory, and every other page is a bucket.
+Every page begins with a header:
+
++--------------------------------------------------------+
+| Page kind: directory or bucket (1 byte)                |
++--------------------------------------------------------+
+| Global depth (directory) or local depth (bucket) (4 b) |
++--------------------------------------------------------+
+| Number of entries (4 bytes)                            |
++--------------------------------------------------------+
+| Overflow page of a bucket, or -1 (4 bytes)             |
++--------------------------------------------------------+
+
+The directory has 2^depth entries, each the page number (4 bytes) of a bucket;
+a key whose hash is h is stored in the bucket at position h mod 2^depth. A
+bucket entry is a key followed by the page and slot of the rid, as in a
+BTreeFile.
+
+When a bucket is full it is split in two on the next bit of the hash, doubling
+the directory first if the bucket's local depth equals the global depth. The
+directory must fit on a single page, which limits the global depth. A bucket
+that cannot be split, because it is at the maximum depth or because all of its
+entries have the same hash, is extended with a chain of overflow pages
+instead. Buckets are never merged.
+*/
+
+type hashPageKind int8
+
+const (
+	hashDirectoryPage hashPageKind = iota
+	hashBucketPage    hashPageKind = iota
+)
+
+const hashHeaderSize = 13
+
+type HashFile struct {
+	keyType     FieldType
+	td          *TupleDesc
+	numPages    int
+	backingFile string
+	bufPool     *BufferPool
+	sync.Mutex
+}
+
+type hashPage struct {
+	kind    hashPageKind
+	pageNo  int
+	depth   int
+	next    int // overflow page of a bucket
+	entries []indexEntry
+	buckets []int // directory pages: bucket page numbers
+	file    *HashFile
+
+	dirty       bool
+	dirtier     TransactionID
+	beforeImage *hashPage
+	sync.Mutex
+}
+
+// Create a HashFile.
+// Parameters
+// - fromFile: backing file for the HashFile. May be empty or a previously created index file.
+// - keyType: the type of the indexed column.
+// - bp: the BufferPool that is used to store pages read from the HashFile
+// May return an error if the file cannot be opened or created.
+func NewHashFile(fromFile string, keyType FieldType, bp *BufferPool) (*HashFile, error) {
+	disk := bp.DiskManager()
+	if err := disk.Open(fromFile); err != nil {
+		return nil, err
+	}
+	size, err := disk.Size(fromFile)
+	if err != nil {
+		return nil, err
+	}
+	hf := &HashFile{keyType, indexTupleDesc(keyType), int(size / int64(PageSize)), fromFile, bp, sync.Mutex{}}
+
+	if hf.numPages == 0 {
+		// a new file has a directory of depth 0 that points to one empty
+		// bucket
+		dir := newHashPage(hashDirectoryPage, 0, hf)
+		dir.buckets = []int{1}
+		if err := hf.flushPage(dir); err != nil {
+			return nil, err
+		}
+		if err := hf.flushPage(newHashPage(hashBucketPage, 1, hf)); err != nil {
+			return nil, err
+		}
+		hf.numPages = 2
+	}
+	return hf, nil
+}
+
+func newHashPage(kind hashPageKind, pageNo int, f *HashFile) *hashPage {
+	pg := &hashPage{kind: kind, pageNo: pageNo, next: -1, file: f, dirtier: -1}
+	pg.SetBeforeImage()
+	return pg
+}
+
+// Return the largest global depth for which the directory fits on a page.
+func hashMaxDepth() int {
+	depth := 0
+	for hashHeaderSize+4*(2<<depth) <= PageSize {
+		depth++
+	}
+	return depth
+}
+
+// Return the hash of a key.
+func hashKey(key DBValue) int {
+	var buf bytes.Buffer
+	(&Tuple{Fields: []DBValue{key}}).writeTo(&buf)
+	h := fnv.New32a()
+	h.Write(buf.Bytes())
+	return int(h.Sum32())
+}
+
+// Return the name of the backing file
+func (f *HashFile) BackingFile() string {
+	return f.backingFile
+}
+
+// Return the number of pages in the file
+func (f *HashFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+// [Operator] descriptor method -- the tuples of a HashFile consist of the
+// key and the page and slot number of the record id.
+func (f *HashFile) Descriptor() *TupleDesc {
+	return f.td
+}
+
+func (f *HashFile) pageKey(pgNo int) any {
+	return heapHash{f.backingFile, pgNo}
+}
+
+func (f *HashFile) readPage(pageNo int) (Page, error) {
+	b := make([]byte, PageSize)
+	n, err := f.bufPool.DiskManager().ReadAt(f.backingFile, b, int64(pageNo*PageSize))
+	if err != nil {
+		return nil, err
+	}
+	if n != PageSize {
+		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	}
+	return f.pageFromBuffer(pageNo, b)
+}
+
+// Construct the page with the specified page number from its serialized form.
+func (f *HashFile) pageFromBuffer(pageNo int, b []byte) (Page, error) {
+	pg := newHashPage(hashBucketPage, pageNo, f)
+	if err := pg.initFromBuffer(bytes.NewBuffer(b)); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+func (f *HashFile) flushPage(p Page) error {
+	hp := p.(*hashPage)
+	buf, err := hp.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = f.bufPool.DiskManager().WriteAt(f.backingFile, buf.Bytes(), int64(hp.pageNo*PageSize))
+	return err
+}
+
+// Insert an index tuple (key, page, slot) into the index.
+func (f *HashFile) insertTuple(t *Tuple, tid TransactionID) error {
+	e, err := tupleToIndexEntry(t)
+	if err != nil {
+		return err
+	}
+	return f.insertEntry(e.key, e.rid, tid)
+}
+
+// Delete an index tuple (key, page, slot) from the index.
+func (f *HashFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	e, err := tupleToIndexEntry(t)
+	if err != nil {
+		return err
+	}
+	return f.deleteEntry(e.key, e.rid, tid)
+}
+
+func (f *HashFile) getHashPage(pageNo int, tid TransactionID, perm RWPerm) (*hashPage, error) {
+	pg, err := f.bufPool.GetPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, err
+	}
+	return pg.(*hashPage), nil
+}
+
+// Return the page number of the bucket that holds (or would hold) entries with
+// the specified hash, taking a read lock on the directory.
+func (f *HashFile) findBucket(h int, tid TransactionID) (int, error) {
+	dir, err := f.getHashPage(0, tid, ReadPerm)
+	if err != nil {
+		return 0, err
+	}
+	return dir.buckets[h&(len(dir.buckets)-1)], nil
+}
+
+// Allocate a new, empty bucket page at the end of the file and return it write
+// locked.
+func (f *HashFile) allocatePage(depth int, tid TransactionID) (*hashPage, error) {
+	f.Lock()
+	pageNo := f.numPages
+	pg := newHashPage(hashBucketPage, pageNo, f)
+	pg.depth = depth
+	err := f.flushPage(pg)
+	if err != nil {
+		f.Unlock()
+		return nil, err
+	}
+	f.numPages++
+	f.Unlock()
+	return f.getHashPage(pageNo, tid, WritePerm)
+}
+
+// Add an entry for key and rid to the index, splitting buckets as needed.
+func (f *HashFile) insertEntry(key DBValue, rid recordID, tid TransactionID) error {
+	heapRid, err := toHeapFileRid(rid)
+	if err != nil {
+		return err
+	}
+	e := indexEntry{key, heapRid}
+	if err := e.checkSize(); err != nil {
+		return err
+	}
+	h := hashKey(key)
+	for {
+		bucketNo, err := f.findBucket(h, tid)
+		if err != nil {
+			return err
+		}
+		bucket, err := f.getHashPage(bucketNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+
+		// add the entry to the first page of the chain with room for it
+		pg := bucket
+		for {
+			pg.entries = append(pg.entries, e)
+			if pg.fits() {
+				pg.setDirty(tid, true)
+				return nil
+			}
+			pg.entries = pg.entries[:len(pg.entries)-1]
+			if pg.next == -1 {
+				break
+			}
+			if pg, err = f.getHashPage(pg.next, tid, WritePerm); err != nil {
+				return err
+			}
+		}
+
+		if bucket.next == -1 && bucket.depth < hashMaxDepth() && bucket.hasDistinctHashes(h) {
+			if err := f.splitBucket(bucket, tid); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ovf, err := f.allocatePage(bucket.depth, tid)
+		if err != nil {
+			return err
+		}
+		ovf.entries = append(ovf.entries, e)
+		ovf.setDirty(tid, true)
+		pg.next = ovf.pageNo
+		pg.setDirty(tid, true)
+		return nil
+	}
+}
+
+// Split a full bucket on the next bit of the hash, doubling the directory if
+// needed.
+func (f *HashFile) splitBucket(bucket *hashPage, tid TransactionID) error {
+	dir, err := f.getHashPage(0, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	if bucket.depth == dir.depth {
+		dir.buckets = append(dir.buckets, dir.buckets...)
+		dir.depth++
+	}
+	bit := 1 << bucket.depth
+	newBucket, err := f.allocatePage(bucket.depth+1, tid)
+	if err != nil {
+		return err
+	}
+	bucket.depth++
+
+	var stay []indexEntry
+	for _, e := range bucket.entries {
+		if hashKey(e.key)&bit != 0 {
+			newBucket.entries = append(newBucket.entries, e)
+		} else {
+			stay = append(stay, e)
+		}
+	}
+	bucket.entries = stay
+	for i, b := range dir.buckets {
+		if b == bucket.pageNo && i&bit != 0 {
+			dir.buckets[i] = newBucket.pageNo
+		}
+	}
+	bucket.setDirty(tid, true)
+	newBucket.setDirty(tid, true)
+	dir.setDirty(tid, true)
+	return nil
+}
+
+// Remove the entry for key and rid from its bucket.
+func (f *HashFile) deleteEntry(key DBValue, rid recordID, tid TransactionID) error {
+	heapRid, err := toHeapFileRid(rid)
+	if err != nil {
+		return err
+	}
+	e := indexEntry{key, heapRid}
+	pageNo, err := f.findBucket(hashKey(key), tid)
+	if err != nil {
+		return err
+	}
+	for pageNo != -1 {
+		pg, err := f.getHashPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		for i, e2 := range pg.entries {
+			if e2.compare(e) == 0 {
+				pg.entries = append(pg.entries[:i], pg.entries[i+1:]...)
+				pg.setDirty(tid, true)
+				return nil
+			}
+		}
+		pageNo = pg.next
+	}
+	return GoDBError{TupleNotFoundError, fmt.Sprintf("no index entry for key %v", key)}
+}
+
+func (f *HashFile) supportsOp(op BoolOp) bool {
+	return op == OpEq
+}
+
+// Return an iterator over the rids of the entries whose key equals value.
+func (f *HashFile) lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error) {
+	if !f.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("hash index does not support %s lookups", op)}
+	}
+	pageNo, err := f.findBucket(hashKey(value), tid)
+	if err != nil {
+		return nil, err
+	}
+	var pg *hashPage
+	i := 0
+	return func() (recordID, error) {
+		for pageNo != -1 {
+			if pg == nil {
+				var err error
+				if pg, err = f.getHashPage(pageNo, tid, ReadPerm); err != nil {
+					return nil, err
+				}
+				i = 0
+			}
+			if i >= len(pg.entries) {
+				pageNo = pg.next
+				pg = nil
+				continue
+			}
+			e := pg.entries[i]
+			i++
+			if e.key.EvalPred(value, OpEq) {
+				return e.rid, nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// [Operator] iterator method -- return the entries of the index, in no
+// particular order, as tuples of the form (key, page, slot).
+func (f *HashFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	pageNo := 1
+	var pg *hashPage
+	i := 0
+	return func() (*Tuple, error) {
+		for pageNo < f.NumPages() {
+			if pg == nil {
+				var err error
+				if pg, err = f.getHashPage(pageNo, tid, ReadPerm); err != nil {
+					return nil, err
+				}
+				i = 0
+			}
+			if i >= len(pg.entries) {
+				pageNo++
+				pg = nil
+				continue
+			}
+			e := pg.entries[i]
+			i++
+			return e.tuple(f.td), nil
+		}
+		return nil, nil
+	}, nil
+}
+
+// Return true if the entries of the bucket, together with an entry whose hash
+// is h, do not all have the same hash, so that splitting the bucket can make
+// room.
+func (p *hashPage) hasDistinctHashes(h int) bool {
+	for _, e := range p.entries {
+		if hashKey(e.key) != h {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if the page can be written in PageSize bytes.
+func (p *hashPage) fits() bool {
+	size := hashHeaderSize + 4*len(p.buckets)
+	for _, e := range p.entries {
+		size += e.size()
+		if size > PageSize {
+			return false
+		}
+	}
+	return size <= PageSize
+}
+
+func (p *hashPage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+func (p *hashPage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.dirty = dirty
+	if dirty {
+		p.dirtier = tid
+	}
+}
+
+func (p *hashPage) getDirtier() TransactionID {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirtier
+}
+
+func (p *hashPage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *hashPage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the before-image of the page, used for logging and recovery.
+func (p *hashPage) BeforeImage() Page {
+	return p.beforeImage
+}
+
+// Sets the before-image of the page to a copy of the current state of the
+// page.
+func (p *hashPage) SetBeforeImage() {
+	p.beforeImage = &hashPage{
+		kind:    p.kind,
+		pageNo:  p.pageNo,
+		depth:   p.depth,
+		next:    p.next,
+		entries: append([]indexEntry{}, p.entries...),
+		buckets: append([]int{}, p.buckets...),
+		file:    p.file,
+		dirtier: -1,
+	}
+}
+
+// Write the page to a new PageSize buffer.
+func (p *hashPage) toBuffer() (*bytes.Buffer, error) {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, int8(p.kind))
+	binary.Write(b, binary.LittleEndian, int32(p.depth))
+	if p.kind == hashDirectoryPage {
+		binary.Write(b, binary.LittleEndian, int32(len(p.buckets)))
+	} else {
+		binary.Write(b, binary.LittleEndian, int32(len(p.entries)))
+	}
+	binary.Write(b, binary.LittleEndian, int32(p.next))
+	for _, bucket := range p.buckets {
+		binary.Write(b, binary.LittleEndian, int32(bucket))
+	}
+	for _, e := range p.entries {
+		if err := e.writeTo(b); err != nil {
+			return nil, err
+		}
+	}
+	if b.Len() > PageSize {
+		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+	}
+	b.Write(make([]byte, PageSize-b.Len()))
+	return b, nil
+}
+
+// Read the contents of the page from the supplied buffer.
+func (p *hashPage) initFromBuffer(buf *bytes.Buffer) error {
+	var kind int8
+	var depth, n, next int32
+	if err := binary.Read(buf, binary.LittleEndian, &kind); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &depth); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &next); err != nil {
+		return err
+	}
+	p.kind = hashPageKind(kind)
+	p.depth = int(depth)
+	p.next = int(next)
+	p.entries = nil
+	p.buckets = nil
+	for i := 0; i < int(n); i++ {
+		if p.kind == hashDirectoryPage {
+			var bucket int32
+			if err := binary.Read(buf, binary.LittleEndian, &bucket); err != nil {
+				return err
+			}
+			p.buckets = append(p.buckets, int(bucket))
+		} else {
+			e, err := readIndexEntry(buf, p.file.keyType)
+			if err != nil {
+				return err
+			}
+			p.entries = append(p.entries, e)
+		}
+	}
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
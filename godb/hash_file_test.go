@@ -0,0 +1,191 @@
+package godb
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Create a hash file with keys of type keyType in an empty database.
+func makeHashTestFile(t *testing.T, keyType DBType) (*BufferPool, *HashFile, *MemDiskManager, string) {
+	t.Helper()
+	bp, c, disk, root := newTestDatabase(t)
+	hf, err := NewHashFile("hash_test.idx", FieldType{"key", "", keyType}, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// register the file so that its pages can be logged
+	c.indexMap["hash_test"] = &Index{c.nextFileId, "hash_test", "hash_test.idx", "", "key", 0, "hash", hf}
+	c.nextFileId++
+	return bp, hf, disk, root
+}
+
+func countHashLookup(t *testing.T, hf *HashFile, v DBValue, tid TransactionID) int {
+	iter, err := hf.lookup(OpEq, v, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for {
+		rid, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if rid == nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestHashFileInsertAndLookup(t *testing.T) {
+	bp, hf, _, _ := makeHashTestFile(t, IntType)
+	tid := BeginTransactionForTest(t, bp)
+
+	const nKeys = 2000
+	for i, k := range rand.Perm(2 * nKeys) {
+		err := hf.insertEntry(IntField{int64(k % nKeys)}, heapFileRid{i, 0}, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if hf.NumPages() <= 2 {
+		t.Fatalf("expected buckets to have split, got %d pages", hf.NumPages())
+	}
+	for _, k := range []int64{0, 1, 777, nKeys - 1} {
+		if got := countHashLookup(t, hf, IntField{k}, tid); got != 2 {
+			t.Errorf("lookup %d: expected 2 entries, got %d", k, got)
+		}
+	}
+	if got := countHashLookup(t, hf, IntField{nKeys}, tid); got != 0 {
+		t.Errorf("lookup %d: expected no entries, got %d", nKeys, got)
+	}
+	if _, err := hf.lookup(OpLt, IntField{10}, tid); err == nil {
+		t.Errorf("expected error for a range lookup on a hash index")
+	}
+
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		n++
+	}
+	if n != 2*nKeys {
+		t.Errorf("expected %d entries, got %d", 2*nKeys, n)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestHashFileDuplicatesAndDelete(t *testing.T) {
+	bp, hf, _, _ := makeHashTestFile(t, StringType)
+	tid := BeginTransactionForTest(t, bp)
+
+	// far more entries for one key than fit on a page need overflow pages
+	for i := 0; i < 1000; i++ {
+		key := "sam"
+		if i%2 == 1 {
+			key = "joe"
+		}
+		if err := hf.insertEntry(StringField{key}, heapFileRid{i, 0}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if got := countHashLookup(t, hf, StringField{"sam"}, tid); got != 500 {
+		t.Errorf("expected 500 entries for sam, got %d", got)
+	}
+	for i := 0; i < 1000; i += 2 {
+		if err := hf.deleteEntry(StringField{"sam"}, heapFileRid{i, 0}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if got := countHashLookup(t, hf, StringField{"sam"}, tid); got != 0 {
+		t.Errorf("expected all entries for sam to be deleted, got %d", got)
+	}
+	if got := countHashLookup(t, hf, StringField{"joe"}, tid); got != 500 {
+		t.Errorf("expected 500 entries for joe, got %d", got)
+	}
+	if err := hf.deleteEntry(StringField{"sam"}, heapFileRid{0, 0}, tid); err == nil {
+		t.Errorf("expected error deleting a missing entry")
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestHashFilePersistence(t *testing.T) {
+	bp, hf, disk, root := makeHashTestFile(t, IntType)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 3000; i++ {
+		if err := hf.insertEntry(IntField{int64(i)}, heapFileRid{i, 1}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	bp2, _ := openTestDatabase(t, disk, root)
+	hf2, err := NewHashFile("hash_test.idx", FieldType{"key", "", IntType}, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = BeginTransactionForTest(t, bp2)
+	for _, k := range []int64{0, 1234, 2999} {
+		if got := countHashLookup(t, hf2, IntField{k}, tid); got != 1 {
+			t.Errorf("expected one entry for %d after reopening, got %d", k, got)
+		}
+	}
+	bp2.CommitTransaction(tid)
+}
+
+func findIndexJoin(op Operator) *IndexJoin {
+	switch op := op.(type) {
+	case *IndexJoin:
+		return op
+	case *OperatorCard:
+		return findIndexJoin(op.Op)
+	case *Project:
+		return findIndexJoin(op.child)
+	case *Filter:
+		return findIndexJoin(op.child)
+	}
+	return nil
+}
+
+func TestIndexJoin(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, append(indexTestTable,
+		"create table idx_test2 (name varchar, age int)",
+		"insert into idx_test2 values ('joe', 0), ('joe', 100), ('joe', 200)")...)
+	runSQLForTest(t, bp, c, "create index idx_test_age_hash on idx_test(age) using hash", noTransaction)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// three probes are cheaper than scanning the 2000 tuples of idx_test
+	for _, sql := range []string{
+		"select idx_test2.name, idx_test.age from idx_test2, idx_test where idx_test2.age = idx_test.age",
+		"select idx_test2.name, idx_test.age from idx_test, idx_test2 where idx_test.age = idx_test2.age",
+	} {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		join := findIndexJoin(plan)
+		if join == nil {
+			t.Fatalf("expected %q to use an index join", sql)
+		}
+		if join.index.name != "idx_test_age_hash" {
+			t.Errorf("expected the join to use the hash index, got %s", join.index.name)
+		}
+		tups := runQueryForTest(t, bp, plan, noTransaction)
+		if len(tups) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(tups))
+		}
+		for _, tup := range tups {
+			if tup.Fields[0].(StringField).Value != "joe" || tup.Fields[1].(IntField).Value%100 != 0 {
+				t.Errorf("unexpected result %v", tup)
+			}
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 // A HeapFile is an unordered collection of tuples.
@@ -18,14 +19,19 @@ import (
 // database tables using the method [LoadFromCSV]
 type HeapFile struct {
 	//<strip lab1>
-	td            *TupleDesc
-	numPages      int
-	backingFile   string
-	lastEmptyPage int
+	td          *TupleDesc
+	numPages    int
+	backingFile string
+	fsm         *freeSpaceMap // free space of each page, used to pick a page for inserts
+	overflow    *overflowFile // pages that hold values too large for a heap page
 	//</strip>
 	// HeapFile should include the fields below;  you may want to add
 	// additional fields
 	bufPool *BufferPool
+	indexes []*Index     // secondary indexes kept in sync with the file
+	columns []columnInfo // declared column types, if the file belongs to a table
+	keys    []tableKey   // PRIMARY KEY and UNIQUE constraints of the table
+	catalog *Catalog     // catalog of the table, used to check its foreign keys
 	sync.Mutex
 }
 
@@ -44,17 +50,24 @@ type heapFileRid struct {
 // May return an error if the file cannot be opened or created.
 func NewHeapFile(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, error) {
 	//<strip lab1>
-	f, err := os.OpenFile(fromFile, os.O_CREATE|os.O_WRONLY, 0644)
+	disk := bp.DiskManager()
+	if err := disk.Open(fromFile); err != nil {
+		return nil, err
+	}
+	size, err := disk.Size(fromFile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	fi, err := f.Stat()
+	numPages := int(size / int64(PageSize))
+	fsm, err := newFreeSpaceMap(disk, fromFile, numPages)
 	if err != nil {
 		return nil, err
 	}
-	numPages := fi.Size() / int64(PageSize)
-	return &HeapFile{td, int(numPages), fromFile, -1, bp, sync.Mutex{}}, nil
+	f := &HeapFile{td, numPages, fromFile, fsm, nil, bp, nil, nil, nil, nil, sync.Mutex{}}
+	if f.overflow, err = newOverflowFile(f); err != nil {
+		return nil, err
+	}
+	return f, nil
 	//</strip>
 }
 
@@ -81,6 +94,9 @@ func (f *HeapFile) NumPages() int {
 // Returns an error if the field cannot be opened or if a line is malformed
 // We provide the implementation of this method, but it won't work until
 // [HeapFile.insertTuple] is implemented
+//
+// Each row is inserted in a transaction of its own; [Catalog.LoadCSV] loads
+// large files much faster (see bulk_load.go).
 func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLastField bool) error {
 	scanner := bufio.NewScanner(file)
 	cnt := 0
@@ -104,6 +120,11 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 		}
 		var newFields []DBValue
 		for fno, field := range fields {
+			// empty values are NULL
+			if strings.TrimSpace(field) == "" {
+				newFields = append(newFields, NullField{})
+				continue
+			}
 			switch f.Descriptor().Fields[fno].Ftype {
 			case IntType:
 				field = strings.TrimSpace(field)
@@ -114,17 +135,24 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 				intValue := int(floatVal)
 				newFields = append(newFields, IntField{int64(intValue)})
 			case StringType:
-				if len(field) > StringLength {
-					field = field[0:StringLength]
-				}
 				newFields = append(newFields, StringField{field})
+			default:
+				ftype := f.Descriptor().Fields[fno].Ftype
+				v, err := parseValue(strings.TrimSpace(field), ftype)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to %s, tuple %d", field, ftype, cnt)}
+				}
+				newFields = append(newFields, v)
 			}
 		}
 		newT := Tuple{*f.Descriptor(), newFields, nil}
 		tid := NewTID()
 		bp := f.bufPool
 		bp.BeginTransaction(tid)
-		f.insertTuple(&newT, tid)
+		if err := f.insertTuple(&newT, tid); err != nil {
+			bp.AbortTransaction(tid)
+			return GoDBError{MalformedDataError, fmt.Sprintf("LoadFromCSV: couldn't insert tuple %d: %s", cnt, err.Error())}
+		}
 
 		// Force dirty pages to disk. CommitTransaction may not be implemented
 		// yet if this is called in lab 1 or 2.
@@ -141,117 +169,193 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 // called by the [BufferPool.GetPage] method when it cannot find the page in its
 // cache.
 //
-// This method will need to open the file supplied to the constructor, seek to
-// the appropriate offset, read the bytes in, and construct a [heapPage] object,
-// using the [heapPage.initFromBuffer] method.
+// This method will need to read the bytes of the page from the file supplied to
+// the constructor through the [DiskManager] of the buffer pool, and construct a
+// [heapPage] object, using the [heapPage.initFromBuffer] method.
 func (f *HeapFile) readPage(pageNo int) (Page, error) {
 	//<strip lab1>
-	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
 	b := make([]byte, PageSize)
-	n, err := file.ReadAt(b, int64(pageNo*PageSize))
+	n, err := f.bufPool.DiskManager().ReadAt(f.backingFile, b, int64(pageNo*PageSize))
 	if err != nil {
 		return nil, err
 	}
 	if n != PageSize {
 		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
 	}
-	pg, err := newHeapPage(f.Descriptor(), pageNo, f)
+	pg, err := f.pageFromBuffer(pageNo, b)
 	if err != nil {
 		return nil, err
 	}
-	pg.initFromBuffer(bytes.NewBuffer(b))
+	// the free-space map may be stale if a transaction that modified the page
+	// aborted
+	pg.(*heapPage).updateFreeSpace()
 	return pg, nil
 	//</strip>
 }
 
-// Add the tuple to the HeapFile. This method should search through pages in the
-// heap file, looking for empty slots and adding the tuple in the first empty
-// slot if finds.
+// Construct the heap page with the specified page number from its serialized
+// form. Used by [HeapFile.readPage] and when reading pages back from the log.
+func (f *HeapFile) pageFromBuffer(pageNo int, b []byte) (Page, error) {
+	pg, err := newHeapPage(f.Descriptor(), pageNo, f)
+	if err != nil {
+		return nil, err
+	}
+	// a page that fails verification must not be used; a page whose tuples
+	// do not match the descriptor is read as empty
+	if err := pg.initFromBuffer(bytes.NewBuffer(b)); err != nil {
+		if dbErr, ok := err.(GoDBError); ok && dbErr.code == CorruptPageError {
+			return nil, err
+		}
+	}
+	return pg, nil
+}
+
+// A page that failed verification when it was read from disk.
+type CorruptPage struct {
+	Table  string
+	PageNo int
+	Err    error
+}
+
+func (p CorruptPage) String() string {
+	return fmt.Sprintf("table %s, page %d: %s", p.Table, p.PageNo, p.Err.Error())
+}
+
+// Read every page of the HeapFile from disk, bypassing the buffer pool, and
+// return the pages that fail verification (see [heapPage.initFromBuffer]).
+// Returns an error if the file cannot be read.
+func (f *HeapFile) verifyPages() ([]CorruptPage, error) {
+	var bad []CorruptPage
+	for p := 0; p < f.NumPages(); p++ {
+		_, err := f.readPage(p)
+		if dbErr, ok := err.(GoDBError); ok && dbErr.code == CorruptPageError {
+			bad = append(bad, CorruptPage{"", p, err})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return bad, nil
+}
+
+// Return an error if a field of t is not a valid value for its declared column
+// type, e.g., a string that is longer than a varchar(n) column allows, or a
+// NULL in a NOT NULL column.
+func checkColumnValues(td *TupleDesc, columns []columnInfo, t *Tuple) error {
+	for i, col := range columns {
+		if i >= len(t.Fields) {
+			break
+		}
+		if col.notNull && isNull(t.Fields[i]) {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("null value in column %s violates not null constraint", td.Fields[i].Fname)}
+		}
+		s, ok := t.Fields[i].(StringField)
+		if ok && col.length > 0 && utf8.RuneCountInString(s.Value) > col.length {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("value too long for column %s of type %s", td.Fields[i].Fname, col)}
+		}
+	}
+	return nil
+}
+
+// Add the tuple to the HeapFile. This method uses the free-space map of the file
+// to find a page with room for the tuple, and inserts the tuple there. Strings
+// and blobs that are too large to store on the page are written to overflow
+// pages first, and the page only stores references to them.
 //
-// If none are found, it should create a new [heapPage] and insert the tuple
-// there, and write the heapPage to the end of the HeapFile (e.g., using the
-// [flushPage] method.)
+// If there is no such page, it should create a new [heapPage] and insert the
+// tuple there, and write the heapPage to the end of the HeapFile (e.g., using
+// the [flushPage] method.)
 //
-// To iterate through pages, it should use the [BufferPool.GetPage method]
-// rather than directly reading pages itself. For lab 1, you do not need to
-// worry about concurrent transactions modifying the Page or HeapFile. We will
-// add support for concurrent modifications in lab 3.
+// To access pages, it should use the [BufferPool.GetPage method] rather than
+// directly reading pages itself, so that pages are locked by the transaction.
 //
 // The page the tuple is inserted into should be marked as dirty.
+//
+// Returns a ConstraintViolationError if the tuple violates a key of the table
+// (see constraints.go) or one of its foreign keys (see foreign_keys.go).
 func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 	//<strip lab1>
-	var start int
-
-	f.Lock()
-	if f.lastEmptyPage == -1 {
-		start = 0
-	} else {
-		start = f.lastEmptyPage
+	if err := checkColumnValues(f.td, f.columns, t); err != nil {
+		return err
+	}
+	if err := f.checkKeys(t, nil, nil, tid); err != nil {
+		return err
 	}
-	endPage := f.numPages
-	f.Unlock()
+	if err := f.checkForeignKeys(t, nil, tid); err != nil {
+		return err
+	}
+	if err := f.checkIndexEntries(t); err != nil {
+		return err
+	}
+	stored, err := f.storeOverflowValues(t, tid)
+	if err != nil {
+		return err
+	}
+	size := stored.size()
 
-	for p := start; p < endPage; p++ {
-		pg, err := f.bufPool.GetPage(f, p, tid, ReadPerm)
+	for {
+		p := f.fsm.find(size, f.NumPages())
+		if p == -1 {
+			var err error
+			if p, err = f.allocatePage(); err != nil {
+				return err
+			}
+		}
+		pg, err := f.bufPool.GetPage(f, p, tid, WritePerm)
 		if err != nil {
 			return err
 		}
-		if pg.(*heapPage).getNumEmptySlots() == 0 {
+		heapp := pg.(*heapPage)
+		_, err = heapp.insertTuple(stored)
+		if err == ErrPageFull {
+			// the free-space map was stale, or another transaction filled the
+			// page first; correct the map and look again
+			heapp.updateFreeSpace()
 			continue
 		}
-
-		pg, err = f.bufPool.GetPage(f, p, tid, WritePerm)
 		if err != nil {
 			return err
 		}
-		heapp := pg.(*heapPage)
-		_, err = heapp.insertTuple(t)
-		if err != nil && err != ErrPageFull {
+		heapp.setDirty(tid, true)
+		t.Rid = stored.Rid
+		if err := f.insertIndexEntries(t, tid); err != nil {
+			// remove the tuple, so that an insert that fails leaves nothing
+			// behind, and callers such as bulk loads can skip the tuple
+			f.unstoreTuple(stored, tid)
+			t.Rid = nil
 			return err
 		}
-		if err == nil {
-			heapp.setDirty(tid, true)
-			f.Lock()
-			f.lastEmptyPage = p // this is fine because lastEmptyPage is a hint, not forcing
-			f.Unlock()
-			return nil
-		}
+		return nil
 	}
+	//</strip>
+}
 
-	f.Lock()
-	//no free slots, create new page
-	heapp, err := newHeapPage(f.td, f.numPages, f)
-	err = f.flushPage(heapp) // flush an empty page to later add to buffer pool, helps maintain dirtiness
-	if err != nil {
-		f.Unlock()
-		return err
+// Delete a tuple that insertTuple stored, but could not add to the indexes,
+// from its page, and free its overflow pages.
+func (f *HeapFile) unstoreTuple(stored *Tuple, tid TransactionID) {
+	rid := stored.Rid.(heapFileRid)
+	// adding the index entries may have evicted the page
+	if pg, err := f.bufPool.GetPage(f, rid.pageNo, tid, WritePerm); err == nil {
+		pg.(*heapPage).deleteTuple(rid)
 	}
-	f.lastEmptyPage = f.numPages
-	p := f.numPages
-	f.numPages++
-	f.Unlock()
+	f.freeOverflowValues(stored, tid)
+}
 
-	pg, err := f.bufPool.GetPage(f, p, tid, WritePerm)
+// Append an empty page to the end of the HeapFile and return its page number.
+// The page is written to disk, so that it can be read into the buffer pool, and
+// is recorded as empty in the free-space map. Concurrent callers are given
+// distinct pages.
+func (f *HeapFile) allocatePage() (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	heapp, err := newHeapPage(f.td, f.numPages, f)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	heapp = pg.(*heapPage)
-	_, err = heapp.insertTuple(t)
-	if err != nil {
-		return err
+	if err := f.flushPage(heapp); err != nil {
+		return 0, err
 	}
-	heapp.setDirty(tid, true)
-
-	f.Lock()
-	f.lastEmptyPage = p
-	f.Unlock()
-
-	return nil
-	//</strip>
+	f.numPages++
+	return heapp.pageNo, nil
 }
 
 // Remove the provided tuple from the HeapFile.
@@ -263,8 +367,26 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 // to identify the heap page and slot within the page that the tuple came from.
 //
 // The page the tuple is deleted from should be marked as dirty.
+//
+// If the foreign keys of other tables reference the tuple, the delete is
+// refused, or the referencing tuples are deleted or updated, depending on the
+// ON DELETE actions of the keys (see foreign_keys.go).
 func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 	//<strip lab1>
+	refs, old, err := f.checkDeleteReferences(t, tid)
+	if err != nil {
+		return err
+	}
+	if err := f.removeTuple(t, tid); err != nil {
+		return err
+	}
+	return f.applyDeleteActions(old, refs, tid)
+	//</strip>
+}
+
+// Remove the tuple from the file, like [HeapFile.deleteTuple] but without the
+// actions of the foreign keys that reference it.
+func (f *HeapFile) removeTuple(t *Tuple, tid TransactionID) error {
 	if t.Rid == nil {
 		return GoDBError{TupleNotFoundError, "provided tuple has null rid, cannot delete"}
 	}
@@ -287,19 +409,107 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 		return GoDBError{IncompatibleTypesError, "buffer pool returned non-heap page when heap page expected"}
 	}
 	hp.setDirty(tid, true)
+	old := hp.getTuple(rid)
 	err = hp.deleteTuple(rid)
 	if err != nil {
 		return err
 	}
+	// the index entries are for the values, rather than for the references
+	// to their overflow pages
+	full, err := f.loadOverflowValues(old, tid)
+	if err != nil {
+		return err
+	}
+	if err := f.freeOverflowValues(old, tid); err != nil {
+		return err
+	}
+	return f.deleteIndexEntries(full, rid, tid)
+}
 
-	f.Lock()
-	if rid.pageNo < f.lastEmptyPage {
-		f.lastEmptyPage = rid.pageNo
+// Replace the tuple t, which must have its Rid set, with newT, and set the Rid
+// of newT. The new tuple takes the place of the old one on its page if it fits
+// there; otherwise the old tuple is deleted and the new one is inserted like
+// any other tuple. Like [HeapFile.insertTuple], returns a
+// ConstraintViolationError if newT violates a key or foreign key of the table,
+// or if it changes the values that the foreign key of another table
+// references.
+func (f *HeapFile) updateTuple(t *Tuple, newT *Tuple, tid TransactionID) error {
+	rid, ok := t.Rid.(heapFileRid)
+	if !ok || rid.pageNo < 0 || rid.pageNo >= f.NumPages() {
+		return GoDBError{TupleNotFoundError, "provided tuple is not a tuple of the heap file"}
+	}
+	if err := checkColumnValues(f.td, f.columns, newT); err != nil {
+		return err
+	}
+	if err := f.checkKeys(newT, t, rid, tid); err != nil {
+		return err
+	}
+	if err := f.checkForeignKeys(newT, t, tid); err != nil {
+		return err
+	}
+	if err := f.checkUpdateReferences(t, newT, tid); err != nil {
+		return err
+	}
+	if err := f.checkIndexEntries(newT); err != nil {
+		return err
+	}
+	// getting the overflow pages of the new values may evict the heap page,
+	// so they are written before the heap page is got
+	stored, err := f.storeOverflowValues(newT, tid)
+	if err != nil {
+		return err
+	}
+	pg, err := f.bufPool.GetPage(f, rid.pageNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	hp := pg.(*heapPage)
+	old := hp.getTuple(rid)
+	if old == nil {
+		return GoDBError{TupleNotFoundError, "provided tuple has been deleted"}
+	}
+	err = hp.updateTuple(rid, stored)
+	if err == ErrPageFull {
+		if err := f.freeOverflowValues(stored, tid); err != nil {
+			return err
+		}
+		if err := f.removeTuple(t, tid); err != nil {
+			return err
+		}
+		return f.insertTuple(newT, tid)
 	}
-	f.Unlock()
+	if err != nil {
+		return err
+	}
+	hp.setDirty(tid, true)
+	newT.Rid = rid
 
-	return nil
-	//</strip>
+	full, err := f.loadOverflowValues(old, tid)
+	if err != nil {
+		return err
+	}
+	if err := f.freeOverflowValues(old, tid); err != nil {
+		return err
+	}
+	return f.updateIndexEntries(full, newT, tid)
+}
+
+// Return the tuple with the specified record id, or nil if there is no such
+// tuple.
+func (f *HeapFile) getTuple(rid recordID, tid TransactionID) (*Tuple, error) {
+	heapRid, ok := rid.(heapFileRid)
+	if !ok || heapRid.pageNo < 0 || heapRid.pageNo >= f.NumPages() {
+		return nil, nil
+	}
+	pg, err := f.bufPool.GetPage(f, heapRid.pageNo, tid, ReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	t := pg.(*heapPage).getTuple(heapRid)
+	if t == nil {
+		return nil, nil
+	}
+	return f.loadOverflowValues(&Tuple{*f.td, t.Fields, t.Rid}, tid)
 }
 
 // Method to force the specified page back to the backing file at the
@@ -310,19 +520,16 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 func (f *HeapFile) flushPage(p Page) error {
 	//<strip lab1>
 	// note that this method is not thread safe
-	file, err := os.OpenFile(f.backingFile, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
 	hp := p.(*heapPage)
 
 	buf, err := hp.toBuffer()
 	if err != nil {
 		return err
 	}
-	_, err = file.WriteAt(buf.Bytes(), int64(hp.pageNo*PageSize))
-	return err
+	if _, err = f.bufPool.DiskManager().WriteAt(f.backingFile, buf.Bytes(), int64(hp.pageNo*PageSize)); err != nil {
+		return err
+	}
+	return f.fsm.write(hp.pageNo, hp.freeSpace())
 	// </strip>
 }
 
@@ -351,7 +558,9 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	return func() (*Tuple, error) {
 		for {
 			if pgIter == nil {
-				if pgNo == nPages {
+				// the file may have been shortened by a vacuum that ran
+				// while the iterator waited for a lock
+				if pgNo == nPages || pgNo >= f.NumPages() {
 					return nil, nil
 				}
 				p, err := f.bufPool.GetPage(f, pgNo, tid, ReadPerm)
@@ -368,7 +577,7 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 			if next == nil {
 				pgIter = nil
 			} else {
-				return &Tuple{*f.td, next.Fields, next.Rid}, nil
+				return f.loadOverflowValues(&Tuple{*f.td, next.Fields, next.Rid}, tid)
 			}
 		}
 	}, nil
@@ -2,6 +2,9 @@ package godb
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -168,6 +171,224 @@ func TestHeapFileSerializeVeryLarge(t *testing.T) {
 	testSerializeN(t, 4000)
 }
 
+// Reopen the heap file backing hf with an empty buffer pool that uses the same
+// disk manager, so that its pages are read back from disk.
+func reopenHeapFileForTest(t *testing.T, hf *HeapFile) (*BufferPool, *HeapFile) {
+	bp, err := NewBufferPoolWithDiskManager(10, hf.bufPool.disk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	root := filepath.Dir(hf.BackingFile())
+	c := NewCatalog("catalog.txt", bp, root)
+	bp.logFile, err = NewLogFile(root+"/test.log", bp, c)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	name := strings.TrimSuffix(filepath.Base(hf.BackingFile()), ".dat")
+	hf2, err := c.addTable(name, *hf.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp, hf2.(*HeapFile)
+}
+
+// Record ids handed out by insertTuple stay valid after their pages are
+// written to disk and read back, even after other tuples on the same pages are
+// deleted.
+func TestHeapFileRidsSurviveEviction(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, "create table test (name varchar, age int)")
+	hf := heapFileForTest(t, c, "test")
+	td, _, _ := makeTupleTestVars()
+	const nTups = 1000
+	rids := make([]recordID, nTups)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < nTups; i++ {
+		tup := Tuple{td, []DBValue{StringField{strings.Repeat("x", i%20)}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		rids[i] = tup.Rid
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+	if hf.NumPages() < 2 {
+		t.Fatalf("expected tuples to span several pages, got %d", hf.NumPages())
+	}
+
+	bp2, hf2 := reopenHeapFileForTest(t, hf)
+	tid = BeginTransactionForTest(t, bp2)
+	for i := 0; i < nTups; i += 3 {
+		tup, err := hf2.getTuple(rids[i], tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil || tup.Fields[1] != (IntField{int64(i)}) {
+			t.Fatalf("expected tuple %d at rid %v, got %v", i, rids[i], tup)
+		}
+		if err := hf2.deleteTuple(&Tuple{td, nil, rids[i]}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp2.CommitTransaction(tid)
+	bp2.FlushAllPages()
+
+	bp3, hf3 := reopenHeapFileForTest(t, hf)
+	tid = BeginTransactionForTest(t, bp3)
+	iter, err := hf3.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		i := tup.Fields[1].(IntField).Value
+		if i%3 == 0 {
+			t.Errorf("tuple %d was not deleted", i)
+		}
+		if tup.Rid != rids[i] {
+			t.Errorf("tuple %d moved from %v to %v", i, rids[i], tup.Rid)
+		}
+		n++
+	}
+	if n != nTups-(nTups+2)/3 {
+		t.Errorf("expected %d tuples, got %d", nTups-(nTups+2)/3, n)
+	}
+	if err := hf3.deleteTuple(&Tuple{td, nil, rids[0]}, tid); err == nil {
+		t.Errorf("expected error deleting an already deleted tuple")
+	}
+	bp3.CommitTransaction(tid)
+}
+
+// Inserts use the free-space map to fill the space freed by deletes, including
+// after the file is reopened, rather than appending pages.
+func TestHeapFileFreeSpaceMap(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, "create table test (name varchar, age int)")
+	hf := heapFileForTest(t, c, "test")
+	td, _, _ := makeTupleTestVars()
+	tid := BeginTransactionForTest(t, bp)
+	var rids []recordID
+	for hf.NumPages() < 3 {
+		tup := Tuple{td, []DBValue{StringField{"sam"}, IntField{int64(len(rids))}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		rids = append(rids, tup.Rid)
+	}
+	// free ten slots on the first page
+	for _, rid := range rids[:10] {
+		if err := hf.deleteTuple(&Tuple{td, nil, rid}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	bp2, hf2 := reopenHeapFileForTest(t, hf)
+	if p := hf2.fsm.find(1, hf2.NumPages()); p != 0 {
+		t.Fatalf("expected the free-space map to find room on page 0, got %d", p)
+	}
+	tid = BeginTransactionForTest(t, bp2)
+	for i := 0; i < 10; i++ {
+		tup := Tuple{td, []DBValue{StringField{"joe"}, IntField{int64(i)}}, nil}
+		if err := hf2.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup.Rid.(heapFileRid).pageNo != 0 {
+			t.Errorf("expected tuple %d to be inserted on page 0, got %v", i, tup.Rid)
+		}
+	}
+	if hf2.NumPages() != 3 {
+		t.Errorf("expected 3 pages, got %d", hf2.NumPages())
+	}
+	bp2.CommitTransaction(tid)
+}
+
+// Concurrent inserters that all need a new page are each given a different one.
+func TestHeapFileAllocatePageConcurrent(t *testing.T) {
+	_, c, _, _ := newTestDatabase(t, "create table test (name varchar, age int)")
+	hf := heapFileForTest(t, c, "test")
+	const nAlloc = 20
+	pages := make(chan int, nAlloc)
+	var wg sync.WaitGroup
+	for i := 0; i < nAlloc; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := hf.allocatePage()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			pages <- p
+		}()
+	}
+	wg.Wait()
+	close(pages)
+	seen := make(map[int]bool)
+	for p := range pages {
+		if seen[p] {
+			t.Errorf("page %d was allocated twice", p)
+		}
+		seen[p] = true
+	}
+	if len(seen) != nAlloc || hf.NumPages() != nAlloc {
+		t.Errorf("expected %d distinct pages, got %d of %d", nAlloc, len(seen), hf.NumPages())
+	}
+}
+
+// A damaged page of a table is reported by VerifyTables, and reading it through
+// the buffer pool fails rather than returning garbage tuples.
+func TestHeapFileVerifyPages(t *testing.T) {
+	bp, c, disk, _ := newTestDatabase(t, "create table t (name varchar, age int)")
+	hf := heapFileForTest(t, c, "t")
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; hf.NumPages() < 3; i++ {
+		tup := Tuple{*hf.Descriptor(), []DBValue{StringField{"sam"}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	bp.FlushAllPages()
+
+	bad, err := c.VerifyTables()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(bad) != 0 {
+		t.Fatalf("expected no damaged pages, got %v", bad)
+	}
+
+	// flip a bit in a tuple on page 1
+	b := make([]byte, 1)
+	off := int64(2*PageSize - 10)
+	if _, err := disk.ReadAt(hf.BackingFile(), b, off); err != nil {
+		t.Fatalf(err.Error())
+	}
+	b[0] ^= 1
+	if _, err := disk.WriteAt(hf.BackingFile(), b, off); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bad, err = c.VerifyTables()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(bad) != 1 || bad[0].Table != "t" || bad[0].PageNo != 1 {
+		t.Fatalf("expected page 1 of t to be damaged, got %v", bad)
+	}
+
+	bp2, hf2 := reopenHeapFileForTest(t, hf)
+	tid = BeginTransactionForTest(t, bp2)
+	_, err = bp2.GetPage(hf2, 1, tid, ReadPerm)
+	if dbErr, ok := err.(GoDBError); !ok || dbErr.code != CorruptPageError {
+		t.Errorf("expected a CorruptPageError reading page 1, got %v", err)
+	}
+	bp2.CommitTransaction(tid)
+}
+
 func TestHeapFileLoadCSV(t *testing.T) {
 	_, _, _, hf, _, tid := makeTestVars(t)
 	f, err := os.Open("test_heap_file.csv")
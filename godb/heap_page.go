@@ -4,6 +4,8 @@ import (
 	"bytes"
 	//<silentstrip lab1>
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	//</silentstrip>
 	"sync"
 )
@@ -15,48 +17,47 @@ interface requires.  You will want to use an interface like what we provide to
 implement the methods of [HeapFile] that insert, delete, and iterate through
 tuples.
 
-In GoDB all tuples are fixed length, which means that given a TupleDesc it is
-possible to figure out how many tuple "slots" fit on a given page.
+In GoDB tuples are variable length, because strings are stored with their
+actual length rather than padded to a fixed size. Pages therefore use a slotted
+layout: a slot directory at the start of the page records where each tuple is
+stored, and the tuples themselves are packed at the end of the page, growing
+towards the directory.
 
-In addition, all pages are PageSize bytes.  They begin with a header with a 32
-bit integer with the number of slots (tuples), and a second 32 bit integer with
-the number of used slots.
+All pages are PageSize bytes.  They begin with a header with four 32 bit
+integers: the number of slots in the directory, the number of used slots, the
+version of the page format, and a CRC-32 checksum of the rest of the page. The
+header is followed by the slot directory, which has two 32 bit integers for
+each slot: the offset of the tuple from the start of the page and its length in
+bytes. An empty slot has an offset of 0.
 
-Each tuple occupies the same number of bytes.  You can use the go function
-unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
-(represented as an int64) requires unsafe.Sizeof(int64(0)) bytes.  For strings,
-we encode them as byte arrays of StringLength, so they are size
-((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  The size in bytes  of a
-tuple is just the sum of the size in bytes of its fields.
++-----------------------------------------------------------------------+
+| numSlots | numUsed | version | checksum | slot 0 | slot 1 | ...        |
++-----------------------------------------------------------------------+
+| ... free space ... | tuple 1 | tuple 0                                 |
++-----------------------------------------------------------------------+
 
-Once you have figured out how big a record is, you can determine the number of
-slots on on the page as:
+The checksum is verified when a page is read, so that a torn or otherwise
+damaged page is reported as a CorruptPageError rather than being read as
+garbage tuples.
 
-remPageSize = PageSize - 8 // bytes after header
-numSlots = remPageSize / bytesPerTuple //integer division will round down
-
-To serialize a page to a buffer, you can then:
-
-write the number of slots as an int32
-write the number of used slots as an int32
-write the tuples themselves to the buffer
-
-You will follow the inverse process to read pages from a buffer.
+A page is full when a tuple does not fit in the free space between the
+directory and the tuples, including the slot it needs if there is no empty slot
+to reuse.
 
 Note that to process deletions you will likely delete tuples at a specific
-position (slot) in the heap page.  This means that after a page is read from
-disk, tuples should retain the same slot number. Because GoDB will never evict a
-dirty page, it's OK if tuples are renumbered when they are written back to disk.
+position (slot) in the heap page.  Deleted slots stay in the directory, so that
+tuples retain the same slot number after a page is written to disk and read
+back, and record ids remain valid.
 
 */
 
 type heapPage struct {
 	//<strip lab1>
 	desc     TupleDesc
-	numSlots int32
 	numUsed  int32
+	numBytes int // bytes used by the header, the slot directory and the tuples
 	dirty    bool
-	tuples   []*Tuple
+	tuples   []*Tuple // one entry per slot; nil if the slot is empty
 	pageNo   int
 	file     *HeapFile
 	//</strip>
@@ -66,7 +67,16 @@ type heapPage struct {
 }
 
 // <silentstrip lab1>
-const HeaderSize = 8
+const HeaderSize = 16
+
+// Version of the heap page format, stored in the page header
+const heapPageVersion = 1
+
+// Offset of the checksum in the page header
+const checksumOffset = 12
+
+// Size of an entry in the slot directory
+const SlotSize = 8
 
 // </silentstrip>
 // Construct a new heap page
@@ -74,10 +84,10 @@ func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (*heapPage, error) {
 	//<strip lab1>
 	var pg heapPage
 	pg.desc = *desc
-	pg.numSlots = int32((PageSize - HeaderSize) / desc.bytesPerTuple())
 	pg.numUsed = 0
+	pg.numBytes = HeaderSize
 	pg.dirty = false
-	pg.tuples = make([]*Tuple, pg.numSlots)
+	pg.tuples = nil
 	pg.pageNo = pageNo
 	pg.file = f
 	pg.dirtier = -1
@@ -86,15 +96,44 @@ func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) (*heapPage, error) {
 	//</strip>
 }
 
+// Return the number of slots in the slot directory, including empty slots.
 func (h *heapPage) getNumSlots() int {
 	//<strip lab1>
-	return int(h.numSlots)
+	return len(h.tuples)
 	//</strip>
 }
 
 // <silentstrip lab1>
 func (h *heapPage) getNumEmptySlots() int {
-	return int(h.numSlots - h.numUsed)
+	return len(h.tuples) - int(h.numUsed)
+}
+
+// Return the largest tuple, in bytes, that fits on an empty page.
+func maxTupleSize() int {
+	return PageSize - HeaderSize - SlotSize
+}
+
+// Return the size of the largest tuple that fits in the free space of the page,
+// including the slot it needs if there is no empty slot to reuse.
+func (h *heapPage) freeSpace() int {
+	free := PageSize - h.numBytes
+	if h.getNumEmptySlots() == 0 {
+		free -= SlotSize
+	}
+	return max(free, 0)
+}
+
+// Return true if a tuple of the specified size fits in the free space of the
+// page.
+func (h *heapPage) hasRoomFor(size int) bool {
+	return size <= h.freeSpace()
+}
+
+// Record the free space of the page in the free-space map of its file.
+func (h *heapPage) updateFreeSpace() {
+	if h.file != nil && h.file.fsm != nil {
+		h.file.fsm.set(h.pageNo, h.freeSpace())
+	}
 }
 
 var ErrPageFull = GoDBError{PageFullError, "page is full"}
@@ -104,15 +143,27 @@ var ErrPageFull = GoDBError{PageFullError, "page is full"}
 // no free slots.  Set the tuples rid and return it.
 func (h *heapPage) insertTuple(t *Tuple) (recordID, error) {
 	//<strip lab1>
-	for i := 0; i < int(h.numSlots); i++ {
-		if h.tuples[i] == nil {
-			h.tuples[i] = t
-			h.numUsed++
-			t.Rid = heapFileRid{h.pageNo, i}
-			return t.Rid, nil
+	size := t.size()
+	if !h.hasRoomFor(size) {
+		return 0, ErrPageFull
+	}
+	slot := len(h.tuples)
+	for i, t2 := range h.tuples {
+		if t2 == nil {
+			slot = i
+			break
 		}
 	}
-	return 0, ErrPageFull
+	if slot == len(h.tuples) {
+		h.tuples = append(h.tuples, nil)
+		h.numBytes += SlotSize
+	}
+	h.tuples[slot] = t
+	h.numUsed++
+	h.numBytes += size
+	h.updateFreeSpace()
+	t.Rid = heapFileRid{h.pageNo, slot}
+	return t.Rid, nil
 	//</strip>
 }
 
@@ -125,18 +176,55 @@ func (h *heapPage) deleteTuple(rid recordID) error {
 		return GoDBError{TupleNotFoundError, "supplied rid is not a heapFileRid"}
 	}
 	slot := heapRid.slotNo
-	if slot < 0 || slot >= int(h.numSlots) {
+	if slot < 0 || slot >= len(h.tuples) {
 		return GoDBError{TupleNotFoundError, "slot does not exist on delete"}
 	}
 	if h.tuples[slot] == nil {
 		return GoDBError{TupleNotFoundError, "element already deleted"}
 	}
 	h.numUsed--
+	h.numBytes -= h.tuples[slot].size()
 	h.tuples[slot] = nil
+	// empty slots at the end of the directory can be reclaimed, since no
+	// tuple refers to them
+	for len(h.tuples) > 0 && h.tuples[len(h.tuples)-1] == nil {
+		h.tuples = h.tuples[:len(h.tuples)-1]
+		h.numBytes -= SlotSize
+	}
+	h.updateFreeSpace()
 	return nil
 	//</strip>
 }
 
+// Return the tuple at the specified record ID, or nil if the slot is empty or
+// the ID is invalid.
+func (h *heapPage) getTuple(rid recordID) *Tuple {
+	heapRid, ok := rid.(heapFileRid)
+	if !ok || heapRid.slotNo < 0 || heapRid.slotNo >= len(h.tuples) {
+		return nil
+	}
+	return h.tuples[heapRid.slotNo]
+}
+
+// Replace the tuple at the specified record ID with t, which keeps the slot and
+// record ID of the old tuple. Returns ErrPageFull if t does not fit in the space
+// of the old tuple and the free space of the page.
+func (h *heapPage) updateTuple(rid recordID, t *Tuple) error {
+	old := h.getTuple(rid)
+	if old == nil {
+		return GoDBError{TupleNotFoundError, "tuple to update does not exist"}
+	}
+	oldSize, size := old.size(), t.size()
+	if size > PageSize-h.numBytes+oldSize {
+		return ErrPageFull
+	}
+	h.tuples[rid.(heapFileRid).slotNo] = t
+	h.numBytes += size - oldSize
+	h.updateFreeSpace()
+	t.Rid = rid
+	return nil
+}
+
 // Page method - return whether or not the page is dirty
 func (h *heapPage) isDirty() bool {
 	//<strip lab1|lab2|lab3|lab4>
@@ -162,6 +250,13 @@ func (h *heapPage) setDirty(tid TransactionID, dirty bool) {
 	}
 }
 
+// Return the transaction that last dirtied the page.
+func (h *heapPage) getDirtier() TransactionID {
+	h.Lock()
+	defer h.Unlock()
+	return h.dirtier
+}
+
 // Page method - return the corresponding HeapFile
 // for this page.
 func (p *heapPage) getFile() DBFile {
@@ -172,63 +267,90 @@ func (p *heapPage) getFile() DBFile {
 
 // Allocate a new bytes.Buffer and write the heap page to it. Returns an error
 // if the write to the the buffer fails. You will likely want to call this from
-// your [HeapFile.flushPage] method.  You should write the page header, using
-// the binary.Write method in LittleEndian order, followed by the tuples of the
-// page, written using the Tuple.writeTo method.
+// your [HeapFile.flushPage] method.  You should write the page header and the
+// slot directory, using the binary.Write method in LittleEndian order, and the
+// tuples of the page, written using the Tuple.writeTo method, at the end of the
+// page.
 func (h *heapPage) toBuffer() (*bytes.Buffer, error) {
 	//<strip lab1>
-	b := new(bytes.Buffer)
-
-	err := binary.Write(b, binary.LittleEndian, (int32)(h.numSlots))
-	if err != nil {
-		return nil, err
-	}
-	err = binary.Write(b, binary.LittleEndian, (int32)(h.numUsed))
-	if err != nil {
-		return nil, err
-	}
+	page := make([]byte, PageSize)
+	binary.LittleEndian.PutUint32(page[0:], uint32(len(h.tuples)))
+	binary.LittleEndian.PutUint32(page[4:], uint32(h.numUsed))
 
-	for i := 0; i < len(h.tuples); i++ {
-		t := h.tuples[i]
-		if t != nil {
-			err = t.writeTo(b)
-			if err != nil {
-				return nil, err
-			}
+	end := PageSize
+	dirEnd := HeaderSize + SlotSize*len(h.tuples)
+	var tb bytes.Buffer
+	for i, t := range h.tuples {
+		if t == nil {
+			continue
 		}
+		tb.Reset()
+		if err := t.writeTo(&tb); err != nil {
+			return nil, err
+		}
+		end -= tb.Len()
+		if end < dirEnd {
+			return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+		}
+		copy(page[end:], tb.Bytes())
+		slot := HeaderSize + SlotSize*i
+		binary.LittleEndian.PutUint32(page[slot:], uint32(end))
+		binary.LittleEndian.PutUint32(page[slot+4:], uint32(tb.Len()))
 	}
-	if b.Len() > PageSize {
-		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
-	}
-	b.Write(make([]byte, PageSize-b.Len())) // pad to page size
-
-	return b, nil
+	binary.LittleEndian.PutUint32(page[8:], heapPageVersion)
+	binary.LittleEndian.PutUint32(page[checksumOffset:], pageChecksum(page))
+	return bytes.NewBuffer(page), nil
 	//</strip>
 }
 
-// Read the contents of the HeapPage from the supplied buffer.
+// Return the checksum of a serialized page, computed over all of its bytes
+// except the checksum itself.
+func pageChecksum(page []byte) uint32 {
+	sum := crc32.ChecksumIEEE(page[:checksumOffset])
+	return crc32.Update(sum, crc32.IEEETable, page[checksumOffset+4:])
+}
+
+// Read the contents of the HeapPage from the supplied buffer. Returns a
+// CorruptPageError if the checksum or the format version of the page is wrong.
 func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
 	//<strip lab1>
-	var numSlotsHeader, numUsedHeader int32
-	err := binary.Read(buf, binary.LittleEndian, &numSlotsHeader)
-	if err != nil {
-		return err
+	page := buf.Bytes()
+	if len(page) != PageSize {
+		return GoDBError{CorruptPageError, fmt.Sprintf("page %d has %d bytes, expected %d", h.pageNo, len(page), PageSize)}
 	}
-	err = binary.Read(buf, binary.LittleEndian, &numUsedHeader)
-	if err != nil {
-		return err
+	if version := binary.LittleEndian.Uint32(page[8:]); version != heapPageVersion {
+		return GoDBError{CorruptPageError, fmt.Sprintf("page %d has unknown format version %d", h.pageNo, version)}
 	}
-	tups := make([]*Tuple, numSlotsHeader)
-	for i := 0; i < int(numUsedHeader); i++ {
-		t, err := readTupleFrom(buf, &h.desc)
-		t.Rid = heapFileRid{h.pageNo, i}
+	if sum := binary.LittleEndian.Uint32(page[checksumOffset:]); sum != pageChecksum(page) {
+		return GoDBError{CorruptPageError, fmt.Sprintf("page %d has a bad checksum", h.pageNo)}
+	}
+	numSlots := int(binary.LittleEndian.Uint32(page[0:]))
+	numUsed := int32(binary.LittleEndian.Uint32(page[4:]))
+	if HeaderSize+SlotSize*numSlots > len(page) {
+		return GoDBError{MalformedDataError, "slot directory is larger than the page"}
+	}
+	tups := make([]*Tuple, numSlots)
+	numBytes := HeaderSize + SlotSize*numSlots
+	for i := range tups {
+		slot := HeaderSize + SlotSize*i
+		offset := int(binary.LittleEndian.Uint32(page[slot:]))
+		length := int(binary.LittleEndian.Uint32(page[slot+4:]))
+		if offset == 0 {
+			continue
+		}
+		if offset+length > len(page) {
+			return GoDBError{MalformedDataError, "tuple extends past the end of the page"}
+		}
+		t, err := readTupleFrom(bytes.NewBuffer(page[offset:offset+length]), &h.desc)
 		if err != nil {
 			return err
 		}
+		t.Rid = heapFileRid{h.pageNo, i}
 		tups[i] = t
+		numBytes += length
 	}
-	h.numSlots = numSlotsHeader
-	h.numUsed = numUsedHeader
+	h.numUsed = numUsed
+	h.numBytes = numBytes
 	h.dirty = false
 	h.tuples = tups
 	h.SetBeforeImage()
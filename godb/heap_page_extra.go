@@ -2,16 +2,25 @@ package godb
 
 // Returns the before-image of the page. This is used for logging and recovery.
 func (p *heapPage) BeforeImage() Page {
-	// TODO: some code goes here
+	return p.beforeImage
 }
 
 // Sets the before-image of the page to the current state of the page. Be sure
 // that changing the page does not change the before-image.
 func (p *heapPage) SetBeforeImage() {
-	// TODO: some code goes here
+	img := &heapPage{desc: p.desc, numUsed: p.numUsed, numBytes: p.numBytes, pageNo: p.pageNo, file: p.file, dirtier: -1}
+	img.tuples = make([]*Tuple, len(p.tuples))
+	for i, t := range p.tuples {
+		if t != nil {
+			fs := make([]DBValue, len(t.Fields))
+			copy(fs, t.Fields)
+			img.tuples[i] = &Tuple{t.Desc, fs, t.Rid}
+		}
+	}
+	p.beforeImage = img
 }
 
 // Returns the page number of the page.
 func (p *heapPage) PageNo() int {
-	// TODO: some code goes here
+	return p.pageNo
 }
@@ -1,19 +1,24 @@
 package godb
 
 import (
+	"bytes"
+	"strings"
 	"testing"
-	"unsafe"
 )
 
+// Return the number of copies of t that fit on an empty page.
+func tuplesPerPageForTest(t *Tuple) int {
+	return (PageSize - HeaderSize) / (SlotSize + t.size())
+}
+
 func TestHeapPageInsert(t *testing.T) {
 	td, t1, t2, hf, _, _ := makeTestVars(t)
 	pg, err := newHeapPage(&td, 0, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	var expectedSlots = (PageSize - 8) / (StringLength + int(unsafe.Sizeof(int64(0))))
-	if pg.getNumSlots() != expectedSlots {
-		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, pg.getNumSlots())
+	if pg.getNumSlots() != 0 {
+		t.Fatalf("Incorrect number of slots, expected 0, got %d", pg.getNumSlots())
 	}
 
 	_, err = pg.insertTuple(&t1)
@@ -85,7 +90,7 @@ func TestHeapPageInsertTuple(t *testing.T) {
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPageForTest(&t1)
 
 	for i := 0; i < free; i++ {
 		var addition = Tuple{
@@ -129,12 +134,12 @@ func TestHeapPageInsertTuple(t *testing.T) {
 
 // Unit test for deleteTuple
 func TestHeapPageDeleteTuple(t *testing.T) {
-	td, _, _, hf, _, _ := makeTestVars(t)
+	td, t1, _, hf, _, _ := makeTestVars(t)
 	page, err := newHeapPage(&td, 0, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPageForTest(&t1)
 
 	list := make([]recordID, free)
 	for i := 0; i < free; i++ {
@@ -195,12 +200,12 @@ func TestHeapPageDirty(t *testing.T) {
 
 // Unit test for toBuffer and initFromBuffer
 func TestHeapPageSerialization(t *testing.T) {
-	td, _, _, hf, _, _ := makeTestVars(t)
+	td, t1, _, hf, _, _ := makeTestVars(t)
 	page, err := newHeapPage(&td, 0, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPageForTest(&t1)
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -253,12 +258,12 @@ func TestHeapPageSerialization(t *testing.T) {
 }
 
 func TestHeapPageBufferLen(t *testing.T) {
-	td, _, _, hf, _, _ := makeTestVars(t)
+	td, t1, _, hf, _, _ := makeTestVars(t)
 	page, err := newHeapPage(&td, 0, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
-	free := page.getNumSlots()
+	free := tuplesPerPageForTest(&t1)
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -277,3 +282,93 @@ func TestHeapPageBufferLen(t *testing.T) {
 		t.Fatalf("HeapPage.toBuffer returns buffer of unexpected size;  NOTE:  This error may be OK, but many implementations that don't write full pages break.")
 	}
 }
+
+// Tuples of different sizes share a page, and keep their slot numbers when the
+// page is written and read back after deletions
+func TestHeapPageVariableLengthSlots(t *testing.T) {
+	td, _, _, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var rids []recordID
+	for i := 0; i < 20; i++ {
+		tup := Tuple{td, []DBValue{StringField{strings.Repeat("x", i*10)}, IntField{int64(i)}}, nil}
+		rid, err := page.insertTuple(&tup)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		rids = append(rids, rid)
+	}
+	for i := 0; i < 20; i += 3 {
+		if err := page.deleteTuple(rids[i]); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	page2, _ := newHeapPage(&td, 0, hf)
+	if err := page2.initFromBuffer(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, rid := range rids {
+		tup := page2.getTuple(rid)
+		if i%3 == 0 {
+			if tup != nil {
+				t.Errorf("expected slot %d to be empty", i)
+			}
+			continue
+		}
+		if tup == nil || tup.Fields[1].(IntField).Value != int64(i) || len(tup.Fields[0].(StringField).Value) != i*10 {
+			t.Fatalf("expected tuple %d in its original slot, got %v", i, tup)
+		}
+	}
+
+	// a tuple that needs most of the page only fits on an empty page
+	big := Tuple{td, []DBValue{StringField{strings.Repeat("y", PageSize-100)}, IntField{0}}, nil}
+	if _, err := page2.insertTuple(&big); err == nil {
+		t.Errorf("expected error inserting a large tuple into a used page")
+	}
+	page3, _ := newHeapPage(&td, 1, hf)
+	if _, err := page3.insertTuple(&big); err != nil {
+		t.Errorf("expected a large tuple to fit on an empty page, got %v", err)
+	}
+}
+
+// Damaged pages are rejected with a CorruptPageError when they are read back
+func TestHeapPageChecksum(t *testing.T) {
+	td, t1, t2, hf, _, _ := makeTestVars(t)
+	page, err := newHeapPage(&td, 0, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	page.insertTuple(&t1)
+	page.insertTuple(&t2)
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	good := buf.Bytes()
+
+	for _, off := range []int{0, 8, checksumOffset, HeaderSize, PageSize / 2, PageSize - 1} {
+		b := make([]byte, PageSize)
+		copy(b, good)
+		b[off] ^= 0x10
+		page2, _ := newHeapPage(&td, 0, hf)
+		err := page2.initFromBuffer(bytes.NewBuffer(b))
+		if dbErr, ok := err.(GoDBError); !ok || dbErr.code != CorruptPageError {
+			t.Errorf("expected a CorruptPageError after changing byte %d, got %v", off, err)
+		}
+	}
+
+	page2, _ := newHeapPage(&td, 0, hf)
+	if err := page2.initFromBuffer(bytes.NewBuffer(good)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page2.getNumSlots() != 2 {
+		t.Errorf("expected 2 slots, got %d", page2.getNumSlots())
+	}
+}
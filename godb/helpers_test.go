@@ -0,0 +1,137 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Helpers shared by tests that need a database: a fresh database in a
+// temporary directory, a way to reopen it as if after a crash, and a way to run
+// SQL statements or operators in it.
+
+const testBufferPoolSize = 500
+
+// Open the database whose catalog file is in root and whose other files are
+// managed by disk, recovering it from its log. An empty catalog file is
+// created if root has none.
+func openTestDatabase(t *testing.T, disk DiskManager, root string) (*BufferPool, *Catalog) {
+	t.Helper()
+	if _, err := os.Stat(root + "/catalog.txt"); os.IsNotExist(err) {
+		if err := os.WriteFile(root+"/catalog.txt", nil, 0644); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp, err := NewBufferPoolWithDiskManager(testBufferPoolSize, disk)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", bp, root)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp, c
+}
+
+// Create an empty database in a temporary directory, keeping all files but the
+// catalog file in memory, and run the supplied statements in it, each in a
+// transaction of its own. Returns the disk manager and the directory, so that
+// the database can be reopened with openTestDatabase.
+func newTestDatabase(t *testing.T, statements ...string) (*BufferPool, *Catalog, *MemDiskManager, string) {
+	t.Helper()
+	root := t.TempDir()
+	disk := NewMemDiskManager()
+	bp, c := openTestDatabase(t, disk, root)
+	for _, sql := range statements {
+		runSQLForTest(t, bp, c, sql, noTransaction)
+	}
+	return bp, c, disk, root
+}
+
+// Run op on behalf of tid and return the tuples it produces. If tid is
+// noTransaction, op runs in a transaction of its own, which is committed if op
+// succeeds and aborted otherwise.
+func execQueryForTest(t *testing.T, bp *BufferPool, op Operator, tid TransactionID) ([]*Tuple, error) {
+	t.Helper()
+	if op == nil {
+		return nil, nil
+	}
+	ownTid := tid == noTransaction
+	if ownTid {
+		tid = BeginTransactionForTest(t, bp)
+	}
+	var tups []*Tuple
+	iter, err := op.Iterator(tid)
+	for err == nil {
+		var tup *Tuple
+		if tup, err = iter(); tup == nil {
+			break
+		}
+		tups = append(tups, tup)
+	}
+	if ownTid {
+		if err != nil {
+			bp.AbortTransaction(tid)
+		} else {
+			bp.CommitTransaction(tid)
+		}
+	}
+	return tups, err
+}
+
+// Like execQueryForTest, but fail the test if op fails.
+func runQueryForTest(t *testing.T, bp *BufferPool, op Operator, tid TransactionID) []*Tuple {
+	t.Helper()
+	tups, err := execQueryForTest(t, bp, op, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return tups
+}
+
+// Parse sql and run it on behalf of tid like execQueryForTest. Statements that
+// do not produce an operator, e.g., CREATE TABLE, run while they are parsed and
+// return no tuples.
+func execSQLForTest(t *testing.T, bp *BufferPool, c *Catalog, sql string, tid TransactionID) ([]*Tuple, error) {
+	t.Helper()
+	_, op, err := ParseInTransaction(c, sql, tid)
+	if err != nil {
+		return nil, err
+	}
+	return execQueryForTest(t, bp, op, tid)
+}
+
+// Like execSQLForTest, but fail the test if sql fails.
+func runSQLForTest(t *testing.T, bp *BufferPool, c *Catalog, sql string, tid TransactionID) []*Tuple {
+	t.Helper()
+	tups, err := execSQLForTest(t, bp, c, sql, tid)
+	if err != nil {
+		t.Fatalf("%s: %s", sql, err.Error())
+	}
+	return tups
+}
+
+// Build an INSERT statement that adds n rows to table, the values of the i-th
+// row being row(i), e.g., "'sam', 1".
+func insertRowsForTest(table string, n int, row func(i int) string) string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = "(" + row(i) + ")"
+	}
+	return fmt.Sprintf("insert into %s values %s", table, strings.Join(rows, ", "))
+}
+
+// Return the heap file that stores the named table.
+func heapFileForTest(t *testing.T, c *Catalog, table string) *HeapFile {
+	t.Helper()
+	f, err := c.GetTable(table)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, ok := f.(*HeapFile)
+	if !ok {
+		t.Fatalf("expected %s to be stored in a heap file, got %T", table, f)
+	}
+	return hf
+}
@@ -0,0 +1,333 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// indexFile is implemented by the access methods that can be used as a
+// secondary index on a table. An index file stores entries that map a value of
+// the indexed column (the key) to the record id of a tuple in the table's heap
+// file. Entries are added and removed under the transaction that modifies the
+// base table, so page locks and log records cover the index as well.
+type indexFile interface {
+	DBFile
+
+	// Add an entry for the supplied key and record id.
+	insertEntry(key DBValue, rid recordID, tid TransactionID) error
+
+	// Remove the entry for the supplied key and record id. Returns a
+	// TupleNotFoundError if there is no such entry.
+	deleteEntry(key DBValue, rid recordID, tid TransactionID) error
+
+	// Return an iterator over the record ids of the entries whose key
+	// satisfies "key op value". The iterator returns nil, nil when there are
+	// no more matching entries.
+	lookup(op BoolOp, value DBValue, tid TransactionID) (func() (recordID, error), error)
+
+	// Return true if the index can answer lookups with the specified operator.
+	supportsOp(op BoolOp) bool
+}
+
+// An Index is a secondary index on one column of a table. Indexes are
+// registered in the [Catalog] next to their base table and persisted in the
+// catalog file.
+type Index struct {
+	id       int
+	name     string
+	fileName string // name of the file of the index in the root directory
+	table    string
+	column   string
+	field    int    // position of the indexed column in the table's TupleDesc
+	method   string // access method, "btree" or "hash"
+	file     indexFile
+}
+
+// Return the name of the index.
+func (idx *Index) Name() string {
+	return idx.name
+}
+
+func (idx *Index) String() string {
+	return fmt.Sprintf("index %s on %s(%s) using %s\n", idx.name, idx.table, idx.column, idx.method)
+}
+
+// An entry of an index file, mapping a key to the rid of a heap file tuple.
+type indexEntry struct {
+	key DBValue
+	rid heapFileRid
+}
+
+// Size of the rid stored with each entry
+const indexRidSize = 8
+
+// The largest entry that can be stored in an index file, in bytes. Keys are
+// limited to a fraction of a page so that every node of a B+ tree can be split.
+const maxIndexEntrySize = PageSize / 4
+
+// Return the TupleDesc of the tuples returned by an index file's iterator:
+// the key and the page and slot number of the record id.
+func indexTupleDesc(keyType FieldType) *TupleDesc {
+	keyType.TableQualifier = ""
+	return &TupleDesc{[]FieldType{keyType, {"page", "", IntType}, {"slot", "", IntType}}}
+}
+
+func toHeapFileRid(rid recordID) (heapFileRid, error) {
+	heapRid, ok := rid.(heapFileRid)
+	if !ok {
+		return heapFileRid{}, GoDBError{TypeMismatchError, "index entries must reference heap file tuples"}
+	}
+	return heapRid, nil
+}
+
+// Convert the tuple to an entry. The tuple must have the layout of
+// [indexTupleDesc].
+func tupleToIndexEntry(t *Tuple) (indexEntry, error) {
+	if len(t.Fields) != 3 {
+		return indexEntry{}, GoDBError{TypeMismatchError, "index tuple must have a key, page and slot"}
+	}
+	page, ok1 := t.Fields[1].(IntField)
+	slot, ok2 := t.Fields[2].(IntField)
+	if !ok1 || !ok2 {
+		return indexEntry{}, GoDBError{TypeMismatchError, "index tuple page and slot must be ints"}
+	}
+	return indexEntry{t.Fields[0], heapFileRid{int(page.Value), int(slot.Value)}}, nil
+}
+
+func (e indexEntry) tuple(td *TupleDesc) *Tuple {
+	return &Tuple{*td, []DBValue{e.key, IntField{int64(e.rid.pageNo)}, IntField{int64(e.rid.slotNo)}}, nil}
+}
+
+// Compare two entries by key and then by rid, returning -1, 0 or 1.
+func (e indexEntry) compare(e2 indexEntry) int {
+	if c := compareKeys(e.key, e2.key); c != 0 {
+		return c
+	}
+	switch {
+	case e.rid.pageNo != e2.rid.pageNo:
+		if e.rid.pageNo < e2.rid.pageNo {
+			return -1
+		}
+		return 1
+	case e.rid.slotNo != e2.rid.slotNo:
+		if e.rid.slotNo < e2.rid.slotNo {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// Return the number of bytes written by [indexEntry.writeTo].
+func (e indexEntry) size() int {
+	var buf bytes.Buffer
+	(&Tuple{Fields: []DBValue{e.key}}).writeTo(&buf)
+	return buf.Len() + indexRidSize
+}
+
+// Return an error if the entry is too large to be stored in an index file.
+func (e indexEntry) checkSize() error {
+	if e.size() > maxIndexEntrySize {
+		return GoDBError{MalformedDataError, fmt.Sprintf("index key of %d bytes is too large", e.size())}
+	}
+	return nil
+}
+
+// Write the key, followed by the page and slot of the rid.
+func (e indexEntry) writeTo(b *bytes.Buffer) error {
+	if err := (&Tuple{Fields: []DBValue{e.key}}).writeTo(b); err != nil {
+		return err
+	}
+	binary.Write(b, binary.LittleEndian, int32(e.rid.pageNo))
+	binary.Write(b, binary.LittleEndian, int32(e.rid.slotNo))
+	return nil
+}
+
+// Read an entry written by [indexEntry.writeTo].
+func readIndexEntry(buf *bytes.Buffer, keyType FieldType) (indexEntry, error) {
+	t, err := readTupleFrom(buf, &TupleDesc{[]FieldType{keyType}})
+	if err != nil {
+		return indexEntry{}, err
+	}
+	var page, slot int32
+	if err := binary.Read(buf, binary.LittleEndian, &page); err != nil {
+		return indexEntry{}, err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &slot); err != nil {
+		return indexEntry{}, err
+	}
+	return indexEntry{t.Fields[0], heapFileRid{int(page), int(slot)}}, nil
+}
+
+// Open (or create, if it does not exist) the file backing an index that uses
+// the specified access method.
+func newIndexFile(method string, fromFile string, keyType FieldType, bp *BufferPool) (indexFile, error) {
+	switch method {
+	case "btree":
+		return NewBTreeFile(fromFile, keyType, bp)
+	case "hash":
+		return NewHashFile(fromFile, keyType, bp)
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unknown index method %s", method)}
+}
+
+// Return an error if a value of t is too large to be stored in the index on
+// its field. Checked before t is stored, so that a tuple that cannot be indexed
+// is not stored either.
+func (f *HeapFile) checkIndexEntries(t *Tuple) error {
+	for _, idx := range f.getIndexes() {
+		if isNull(t.Fields[idx.field]) {
+			continue
+		}
+		if err := (indexEntry{t.Fields[idx.field], heapFileRid{}}).checkSize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add an entry for t, which must have its Rid set, to each index on the file.
+// NULLs are not stored in indexes, since no lookup can match them. If an entry
+// cannot be added, the entries added before it are removed, so that t is in
+// all of the indexes or in none.
+func (f *HeapFile) insertIndexEntries(t *Tuple, tid TransactionID) error {
+	indexes := f.getIndexes()
+	for i, idx := range indexes {
+		if isNull(t.Fields[idx.field]) {
+			continue
+		}
+		if err := idx.file.insertEntry(t.Fields[idx.field], t.Rid, tid); err != nil {
+			for _, prev := range indexes[:i] {
+				if !isNull(t.Fields[prev.field]) {
+					prev.file.deleteEntry(t.Fields[prev.field], t.Rid, tid)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the entries for t, which was stored at rid, from each index on the
+// file.
+func (f *HeapFile) deleteIndexEntries(t *Tuple, rid recordID, tid TransactionID) error {
+	for _, idx := range f.getIndexes() {
+		if isNull(t.Fields[idx.field]) {
+			continue
+		}
+		if err := idx.file.deleteEntry(t.Fields[idx.field], rid, tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace the entries for old with entries for t, both of which must have their
+// Rid set, in each index on a field whose value or record id changed.
+func (f *HeapFile) updateIndexEntries(old *Tuple, t *Tuple, tid TransactionID) error {
+	for _, idx := range f.getIndexes() {
+		oldKey, key := old.Fields[idx.field], t.Fields[idx.field]
+		if oldKey == key && old.Rid == t.Rid {
+			continue
+		}
+		if !isNull(oldKey) {
+			if err := idx.file.deleteEntry(oldKey, old.Rid, tid); err != nil {
+				return err
+			}
+		}
+		if !isNull(key) {
+			if err := idx.file.insertEntry(key, t.Rid, tid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *HeapFile) getIndexes() []*Index {
+	f.Lock()
+	defer f.Unlock()
+	return f.indexes
+}
+
+func (f *HeapFile) addIndex(idx *Index) {
+	f.Lock()
+	defer f.Unlock()
+	f.indexes = append(append([]*Index{}, f.indexes...), idx)
+}
+
+func (f *HeapFile) removeIndex(idx *Index) {
+	f.Lock()
+	defer f.Unlock()
+	indexes := make([]*Index, 0, len(f.indexes))
+	for _, i := range f.indexes {
+		if i != idx {
+			indexes = append(indexes, i)
+		}
+	}
+	f.indexes = indexes
+}
+
+// Populate a newly created index with an entry for every tuple of its table on
+// behalf of tid, or in a transaction of its own if tid is noTransaction, like
+// [ComputeTableStats].
+func (c *Catalog) buildIndex(tid TransactionID, idx *Index, hf *HeapFile) error {
+	if tid == noTransaction {
+		tid = NewTID()
+		if err := c.bufferPool.BeginTransaction(tid); err != nil {
+			return err
+		}
+		if err := c.buildIndex(tid, idx, hf); err != nil {
+			c.bufferPool.AbortTransaction(tid)
+			return err
+		}
+		c.bufferPool.CommitTransaction(tid)
+		return nil
+	}
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return nil
+		}
+		if isNull(t.Fields[idx.field]) {
+			continue
+		}
+		if err := idx.file.insertEntry(t.Fields[idx.field], t.Rid, tid); err != nil {
+			return err
+		}
+	}
+}
+
+// Create an index named name on the specified column of a table, and build it
+// from the existing contents of the table on behalf of tid, or in a
+// transaction of its own if tid is noTransaction. The creation is logged, so
+// that the index is removed if tid aborts (see ddl.go).
+func (c *Catalog) CreateIndex(tid TransactionID, name string, table string, column string, method string) error {
+	return c.createIndexInTransaction(tid, name, table, column, method)
+}
+
+// Create an index like [Catalog.CreateIndex], without logging its creation.
+func (c *Catalog) createIndex(tid TransactionID, name string, table string, column string, method string) error {
+	if _, ok := c.indexMap[name]; !ok {
+		// remove any file left behind by an index that was never registered
+		c.bufferPool.DiskManager().Remove(c.indexNameToFile(name))
+	}
+	idx, err := c.addIndex(name, table, column, method)
+	if err != nil {
+		return err
+	}
+	hf := c.tableMap[table].file.(*HeapFile)
+	if err := c.buildIndex(tid, idx, hf); err != nil {
+		c.dropIndex(name)
+		return err
+	}
+	return nil
+}
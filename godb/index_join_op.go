@@ -0,0 +1,98 @@
+package godb
+
+import "fmt"
+
+// IndexJoin is an index nested loops join. For each tuple of the outer
+// operator, it looks up the value of the outer join expression in an index on
+// the join column of the inner table, and joins the tuple with each matching
+// inner tuple. Unlike [EqualityJoin], it never reads the whole inner table.
+type IndexJoin struct {
+	outerField Expr
+	outer      Operator
+	inner      *HeapFile
+	index      *Index
+
+	// True if the inner table is the left side of the join, so that its fields
+	// come first in the output tuples.
+	innerLeft bool
+}
+
+// Construct an index nested loops join of outer and inner on "outerField =
+// t[index column]" for inner tuples t. Returns an error if the index cannot
+// answer equality lookups, or if the type of outerField does not match the type
+// of the indexed column.
+func NewIndexJoin(outer Operator, outerField Expr, inner *HeapFile, index *Index, innerLeft bool) (*IndexJoin, error) {
+	if !index.file.supportsOp(OpEq) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("index %s does not support equality lookups", index.name)}
+	}
+	if outerField.GetExprType().Ftype != inner.Descriptor().Fields[index.field].Ftype {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot join %s with indexed column %s", outerField.GetExprType().Fname, index.column)}
+	}
+	return &IndexJoin{outerField, outer, inner, index, innerLeft}, nil
+}
+
+// Return a TupleDesc for this join, with the fields of the left side of the
+// join followed by the fields of the right side.
+func (j *IndexJoin) Descriptor() *TupleDesc {
+	if j.innerLeft {
+		return j.inner.Descriptor().merge(j.outer.Descriptor())
+	}
+	return j.outer.Descriptor().merge(j.inner.Descriptor())
+}
+
+// Return an iterator over the results of the join. The join predicate is
+// checked again on each inner tuple fetched through the index.
+func (j *IndexJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	outerIter, err := j.outer.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var outerT *Tuple
+	var outerV DBValue
+	var rids func() (recordID, error)
+
+	return func() (*Tuple, error) {
+		for {
+			if rids == nil {
+				outerT, err = outerIter()
+				if err != nil {
+					return nil, err
+				}
+				if outerT == nil {
+					return nil, nil
+				}
+				outerV, err = j.outerField.EvalExpr(outerT)
+				if err != nil {
+					return nil, err
+				}
+				if isNull(outerV) {
+					continue
+				}
+				rids, err = j.index.file.lookup(OpEq, outerV, tid)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			rid, err := rids()
+			if err != nil {
+				return nil, err
+			}
+			if rid == nil {
+				rids = nil
+				continue
+			}
+			innerT, err := j.inner.getTuple(rid, tid)
+			if err != nil {
+				return nil, err
+			}
+			if innerT == nil || !innerT.Fields[j.index.field].EvalPred(outerV, OpEq) {
+				continue
+			}
+			if j.innerLeft {
+				return joinTuples(innerT, outerT), nil
+			}
+			return joinTuples(outerT, innerT), nil
+		}
+	}, nil
+}
@@ -0,0 +1,56 @@
+package godb
+
+import "fmt"
+
+// IndexScan returns the tuples of a heap file whose indexed column satisfies
+// a predicate of the form "column op value", by looking the value up in an
+// index on the column rather than scanning the whole file.
+type IndexScan struct {
+	file  *HeapFile
+	index *Index
+	op    BoolOp
+	value DBValue
+}
+
+// Construct an index scan over file that returns the tuples t for which
+// "t[index column] op value" holds. Returns an error if the index cannot
+// answer lookups with op.
+func NewIndexScan(file *HeapFile, index *Index, op BoolOp, value DBValue) (*IndexScan, error) {
+	if !index.file.supportsOp(op) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("index %s does not support %s lookups", index.name, op)}
+	}
+	return &IndexScan{file, index, op, value}, nil
+}
+
+// Return the TupleDesc of the scanned heap file.
+func (s *IndexScan) Descriptor() *TupleDesc {
+	return s.file.Descriptor()
+}
+
+// Return an iterator that looks up matching record ids in the index and
+// fetches the corresponding tuples from the heap file. The predicate is checked
+// again on each fetched tuple.
+func (s *IndexScan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	rids, err := s.index.file.lookup(s.op, s.value, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			rid, err := rids()
+			if err != nil {
+				return nil, err
+			}
+			if rid == nil {
+				return nil, nil
+			}
+			t, err := s.file.getTuple(rid, tid)
+			if err != nil {
+				return nil, err
+			}
+			if t != nil && t.Fields[s.index.field].EvalPred(s.value, s.op) {
+				return t, nil
+			}
+		}
+	}, nil
+}
@@ -7,16 +7,39 @@ type InsertOp struct {
 	child      Operator
 	insertFile DBFile
 	//</strip>
+	fields []int // positions in the file's TupleDesc of the child's fields, or nil if it has them all
 }
 
 // Construct an insert operator that inserts the records in the child Operator
 // into the specified DBFile.
 func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 	//<strip lab1|lab2>
-	return &InsertOp{child, insertFile}
+	return &InsertOp{child, insertFile, nil}
 	//</strip>
 }
 
+// Construct an insert operator that inserts the records in the child Operator,
+// which have a field for each of the named columns of the specified DBFile,
+// e.g., for "insert into t (b, a) values (...)". The other fields are set to
+// the defaults of their columns (see column_defaults.go).
+//
+// Returns an error if a column is not in the file, or is named twice.
+func NewInsertOpWithColumns(insertFile DBFile, child Operator, columns []string) (*InsertOp, error) {
+	td := insertFile.Descriptor()
+	fields := make([]int, len(columns))
+	for i, col := range columns {
+		field, err := findFieldInTd(FieldType{col, "", UnknownType}, td)
+		if err != nil {
+			return nil, err
+		}
+		if fieldPosition(fields[:i], field) != -1 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("column %s is inserted twice", col)}
+		}
+		fields[i] = field
+	}
+	return &InsertOp{child, insertFile, fields}, nil
+}
+
 // The insert TupleDesc is a one column descriptor with an integer field named "count"
 func (i *InsertOp) Descriptor() *TupleDesc {
 	//<strip lab1|lab2>
@@ -29,6 +52,10 @@ func (i *InsertOp) Descriptor() *TupleDesc {
 // one-field tuple with a "count" field indicating the number of tuples that
 // were inserted.  Tuples should be inserted using the [DBFile.insertTuple]
 // method.
+//
+// The fields that a tuple leaves out are filled in, and the AUTO_INCREMENT
+// column is given the next value of its sequence, before the fields are
+// checked against the types of the file's TupleDesc.
 func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	//<strip lab1|lab2>
 	iter, err := iop.child.Iterator(tid)
@@ -50,15 +77,28 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if t == nil {
 				break
 			}
-			if len(td.Fields) != len(t.Fields) {
-				return nil, GoDBError{TypeMismatchError, "inserted tuple doesn't have same number of fields as table."}
+			converted, err := iop.fillFields(t, td, tid)
+			if err != nil {
+				return nil, err
 			}
-			for i, f := range t.Desc.Fields {
-				if f.Ftype != td.Fields[i].Ftype {
-					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("expected type %s in %dth inserted field, got %s", td.Fields[i].Ftype.String(), i, f.Ftype.String())}
+			for i, v := range converted.Fields {
+				vtype := valueType(v)
+				if isNull(v) || vtype == td.Fields[i].Ftype {
+					continue
+				}
+				// constants such as '2024-01-01' or 1 may be converted to
+				// the type of the column, e.g., a date or float
+				v, err := castValue(v, td.Fields[i].Ftype)
+				if err != nil {
+					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("expected type %s in %dth inserted field, got %s", td.Fields[i].Ftype.String(), i, vtype.String())}
 				}
+				if converted == t {
+					converted = &Tuple{*td, append([]DBValue{}, t.Fields...), nil}
+				}
+				converted.Fields[i] = v
 			}
-			err = iop.insertFile.insertTuple(t, tid)
+			iop.advanceSequences(converted, tid)
+			err = iop.insertFile.insertTuple(converted, tid)
 			if err != nil {
 				return nil, err
 			}
@@ -69,3 +109,65 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	}, nil
 	//</strip>
 }
+
+// Return t with a field for each field of td: the fields of t, in the
+// positions of the inserted columns, and the defaults of the other columns.
+// Returns t itself if it has all the fields and the file has no defaults to
+// fill in.
+func (iop *InsertOp) fillFields(t *Tuple, td *TupleDesc, tid TransactionID) (*Tuple, error) {
+	fields := iop.fields
+	if fields == nil {
+		if len(td.Fields) != len(t.Fields) {
+			return nil, GoDBError{TypeMismatchError, "inserted tuple doesn't have same number of fields as table."}
+		}
+	} else if len(fields) != len(t.Fields) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("inserted tuple has %d fields, but %d columns are inserted", len(t.Fields), len(fields))}
+	}
+	columns := fileColumns(iop.insertFile)
+	if fields == nil && (columns == nil || !hasAutoIncrement(columns)) {
+		return t, nil
+	}
+
+	values := make([]DBValue, len(td.Fields))
+	if fields == nil {
+		copy(values, t.Fields)
+	} else {
+		for i, field := range fields {
+			values[field] = t.Fields[i]
+		}
+	}
+	for i, v := range values {
+		if columns == nil {
+			if v == nil {
+				values[i] = NullField{}
+			}
+			continue
+		}
+		if v == nil || (columns[i].seq != nil && isNull(v)) {
+			var err error
+			if values[i], err = columns[i].missingValue(td.Fields[i].Ftype, tid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Tuple{*td, values, nil}, nil
+}
+
+// Move the sequence of the AUTO_INCREMENT column of the file past the value
+// that t inserts into the column.
+func (iop *InsertOp) advanceSequences(t *Tuple, tid TransactionID) {
+	for i, col := range fileColumns(iop.insertFile) {
+		if v, ok := t.Fields[i].(IntField); ok && col.seq != nil {
+			col.seq.advance(tid, v.Value)
+		}
+	}
+}
+
+func hasAutoIncrement(columns []columnInfo) bool {
+	for _, col := range columns {
+		if col.seq != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -48,6 +48,10 @@ func (joinOp *EqualityJoin) loadOuterBatch(n int, iter func() (*Tuple, error)) (
 		if err != nil {
 			return nil, false, err
 		}
+		// NULL is not equal to anything, so it never joins
+		if isNull(v) {
+			continue
+		}
 
 		hashmap[v] = append(hashmap[v], t)
 		n--
@@ -17,14 +17,24 @@ func EstimateJoinCost(card1 int, card2 int, cost1 float64, cost2 float64) float6
 	//</silentstrip>
 }
 
-// Estimate the cardinality of the result of a join between two tables, given
-// the join operator, primary key information, and table statistics.
-func EstimateJoinCardinality(t1card int, t2card int) int {
+// Estimate the cardinality of the result of an equality join between two
+// tables, given their cardinalities and whether a key of each table makes the
+// values of its join field distinct (see constraints.go), in which case each
+// tuple of the other table matches at most one of its tuples.
+func EstimateJoinCardinality(t1card int, t2card int, t1unique bool, t2unique bool) int {
 	//<silentstrip lab1|lab2|lab3>
 	if t1card == 0 || t2card == 0 {
 		return 0
 	}
 
+	switch {
+	case t1unique && t2unique:
+		return min(t1card, t2card)
+	case t1unique:
+		return t2card
+	case t2unique:
+		return t1card
+	}
 	return max(1, max(t1card, t2card))
 	//</silentstrip>
 }
@@ -37,11 +47,13 @@ type TableInfo struct {
 
 // A JoinNode represents a join between two tables.
 type JoinNode struct {
-	leftTable TableInfo
-	leftField string
+	leftTable  TableInfo
+	leftField  string
+	leftUnique bool // whether a key makes the values of the field distinct
 
-	rightTable TableInfo
-	rightField string
+	rightTable  TableInfo
+	rightField  string
+	rightUnique bool
 }
 
 // <silentstrip lab1|lab2|lab3>
@@ -106,10 +118,12 @@ func OrderJoins(joins []*JoinNode) ([]*JoinNode, error) {
 // Return a new LogicalJoinNode with the inner and outer tables swapped.
 func (j *JoinNode) Swap() *JoinNode {
 	return &JoinNode{
-		leftTable:  j.rightTable,
-		leftField:  j.rightField,
-		rightTable: j.leftTable,
-		rightField: j.leftField,
+		leftTable:   j.rightTable,
+		leftField:   j.rightField,
+		leftUnique:  j.rightUnique,
+		rightTable:  j.leftTable,
+		rightField:  j.leftField,
+		rightUnique: j.leftUnique,
 	}
 }
 
@@ -147,22 +161,24 @@ func AddJoin(join *JoinNode, order_stats *orderStats) *orderStats {
 			&orderStats{
 				order: []*JoinNode{join},
 				cost:  EstimateJoinCost(card_lhs, card_rhs, cost_lhs, cost_rhs),
-				card:  EstimateJoinCardinality(card_lhs, card_rhs),
+				card:  EstimateJoinCardinality(card_lhs, card_rhs, join.leftUnique, join.rightUnique),
 			})
 
 		options = append(options,
 			&orderStats{
 				order: []*JoinNode{swapped_join},
 				cost:  EstimateJoinCost(card_rhs, card_lhs, cost_rhs, cost_lhs),
-				card:  EstimateJoinCardinality(card_rhs, card_lhs),
+				card:  EstimateJoinCardinality(card_rhs, card_lhs, join.rightUnique, join.leftUnique),
 			})
 	} else {
+		// the values of a field of the tables joined so far may repeat, even
+		// if they are distinct in its table
 		if HasTable(order_stats.order, join.leftTable.name) {
 			options = append(options,
 				&orderStats{
 					order: append(order_stats.order, join),
 					cost:  EstimateJoinCost(order_stats.card, card_rhs, order_stats.cost, cost_rhs),
-					card:  EstimateJoinCardinality(order_stats.card, card_rhs),
+					card:  EstimateJoinCardinality(order_stats.card, card_rhs, false, join.rightUnique),
 				})
 		}
 		if HasTable(order_stats.order, join.rightTable.name) {
@@ -170,7 +186,7 @@ func AddJoin(join *JoinNode, order_stats *orderStats) *orderStats {
 				&orderStats{
 					order: append(order_stats.order, swapped_join),
 					cost:  EstimateJoinCost(order_stats.card, card_lhs, order_stats.cost, cost_lhs),
-					card:  EstimateJoinCardinality(order_stats.card, card_lhs),
+					card:  EstimateJoinCardinality(order_stats.card, card_lhs, false, join.leftUnique),
 				})
 		}
 	}
@@ -0,0 +1,415 @@
+package godb
+
+/*
+jsonl_load.go implements the bulk loading of JSON Lines files, in which each
+line is a JSON object, by the \j command of the shell and the COPY statement:
+
+	copy people from 'people.jsonl' with (format jsonl)
+
+The members of an object are the fields of a row, and are matched to the
+columns of the table by name, regardless of case. A column that an object has
+no member for is given its DEFAULT, or the next value of its sequence if it is
+AUTO_INCREMENT, as if an INSERT left it out. JSON null is NULL, numbers are
+loaded into int and float columns, true and false into bool columns, and
+strings into columns of any type whose literal they are, e.g., "2024-01-31"
+into a date column. String columns take any value, and the text of numbers,
+booleans, objects and arrays. A line that is not a JSON object, has a member
+that is not a column of the table or is not a value of its type, or violates
+a constraint of the table is rejected, and reported with its line number.
+Blank lines are skipped. The rows are loaded like those of a CSV file (see
+bulk_load.go).
+
+[Catalog.ImportJSONL] also creates the table, with a column for each member
+name of the objects of the first lines of the file, whose type is the most
+specific one that all their values in those lines are values of: int if they
+are all integers, float if they are all numbers, bool, date or timestamp if
+they are all booleans, or strings that are dates or timestamps, and text
+otherwise.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Load the rows of a JSON Lines file into the named table, in a transaction of
+// its own.
+//
+// Returns an error, and loads no rows, if the table does not exist, is the
+// table of a materialized view, or the file cannot be read. Rows that cannot be
+// loaded are reported in the result rather than as an error.
+func (c *Catalog) LoadJSONL(named string, r io.Reader) (*BulkLoadResult, error) {
+	return c.loadJSONL(noTransaction, named, r)
+}
+
+// Create a table with the specified name whose columns are inferred from the
+// first sampleRows lines of a JSON Lines file, and load the rows of the file
+// into it, in a transaction of its own. The table is not created if the load
+// fails.
+//
+// Returns an error if the table already exists, or a member name of the
+// sampled objects is not a valid column name.
+func (c *Catalog) ImportJSONL(named string, r io.Reader, sampleRows int) (*BulkLoadResult, error) {
+	return c.importJSONL(noTransaction, named, r, sampleRows)
+}
+
+// Return the TupleDesc of a table for the rows of a JSON Lines file, inferred
+// from its first sampleRows lines, like [Catalog.ImportJSONL] does. Lines that
+// are not JSON objects are ignored.
+func InferJSONLSchema(r io.Reader, sampleRows int) (*TupleDesc, error) {
+	objects, err := newJSONLReader(r).peek(sampleRows)
+	if err != nil {
+		return nil, err
+	}
+	return inferJSONLDesc(objects)
+}
+
+// Load the rows of a JSON Lines file into the named table on behalf of tid, like
+// [Catalog.LoadJSONL], or in a transaction of its own if tid is noTransaction.
+func (c *Catalog) loadJSONL(tid TransactionID, named string, r io.Reader) (*BulkLoadResult, error) {
+	return c.loadJSONLRows(tid, named, newJSONLReader(r))
+}
+
+// Create the named table for the rows of a JSON Lines file on behalf of tid,
+// like [Catalog.ImportJSONL], or in a transaction of its own if tid is
+// noTransaction.
+func (c *Catalog) importJSONL(tid TransactionID, named string, r io.Reader, sampleRows int) (*BulkLoadResult, error) {
+	if sampleRows < 1 {
+		return nil, GoDBError{IllegalOperationError, "the schema of a table must be inferred from at least one row"}
+	}
+	if c.bufferPool == nil || c.bufferPool.logFile == nil {
+		return nil, GoDBError{IllegalOperationError, "bulk loads require a log file"}
+	}
+	reader := newJSONLReader(r)
+	objects, err := reader.peek(sampleRows)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := inferJSONLDesc(objects)
+	if err != nil {
+		return nil, err
+	}
+	var result *BulkLoadResult
+	err = c.runDDL(tid, func(tid TransactionID) error {
+		err := c.createTableInTransaction(tid, named, *desc, defaultColumns(desc), nil, nil, "heap")
+		if err == nil {
+			result, err = c.loadJSONLRows(tid, named, reader)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Load the rows that reader reads into the named table on behalf of tid.
+func (c *Catalog) loadJSONLRows(tid TransactionID, named string, reader *jsonlReader) (*BulkLoadResult, error) {
+	return c.loadRows(tid, named, func(t *Table, tid TransactionID) (*Tuple, int, error) {
+		members, line, err := reader.read()
+		if err != nil {
+			return nil, line, err
+		}
+		tup, err := t.jsonlTuple(members, tid)
+		return tup, line, err
+	})
+}
+
+// A member of a JSON object, whose value has not been decoded.
+type jsonMember struct {
+	name  string
+	value json.RawMessage
+}
+
+// A line of a JSON Lines file.
+type jsonlLine struct {
+	text []byte
+	line int
+}
+
+// A reader of the objects of a JSON Lines file, which skips blank lines.
+type jsonlReader struct {
+	r     *bufio.Reader
+	line  int         // the number of the last line read from r
+	ahead []jsonlLine // the lines that peek read, which read returns next
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{r: bufio.NewReader(r)}
+}
+
+// Return the members of the object on the next line, and the number of the
+// line, or io.EOF at the end of the file. Returns a MalformedDataError if the
+// line is not a JSON object.
+func (r *jsonlReader) read() ([]jsonMember, int, error) {
+	if len(r.ahead) > 0 {
+		l := r.ahead[0]
+		r.ahead = r.ahead[1:]
+		members, err := parseJSONObject(l.text)
+		return members, l.line, err
+	}
+	text, line, err := r.readLine()
+	if err != nil {
+		return nil, line, err
+	}
+	members, err := parseJSONObject(text)
+	return members, line, err
+}
+
+// Read the next n lines, which read then returns, and return the objects of
+// those that are JSON objects.
+func (r *jsonlReader) peek(n int) ([][]jsonMember, error) {
+	var objects [][]jsonMember
+	for len(r.ahead) < n {
+		text, line, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.ahead = append(r.ahead, jsonlLine{text, line})
+		if members, err := parseJSONObject(text); err == nil {
+			objects = append(objects, members)
+		}
+	}
+	return objects, nil
+}
+
+// Return the next line of the file that is not blank, and its number, or io.EOF
+// at the end of the file.
+func (r *jsonlReader) readLine() ([]byte, int, error) {
+	for {
+		text, err := r.r.ReadBytes('\n')
+		if len(text) == 0 {
+			return nil, r.line, err
+		}
+		r.line++
+		if len(bytes.TrimSpace(text)) > 0 {
+			return text, r.line, nil
+		}
+		if err != nil {
+			return nil, r.line, err
+		}
+	}
+}
+
+// Return the members of the JSON object that text is, in order, or a
+// MalformedDataError if it is not a JSON object.
+func parseJSONObject(text []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, GoDBError{MalformedDataError, "expected a JSON object"}
+	}
+	var members []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid JSON: %s", err.Error())}
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, GoDBError{MalformedDataError, "invalid JSON: expected a member name"}
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid JSON: %s", err.Error())}
+		}
+		members = append(members, jsonMember{name, value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid JSON: %s", err.Error())}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, GoDBError{MalformedDataError, "invalid JSON: unexpected data after the object"}
+	}
+	return members, nil
+}
+
+// Return the value of type ftype of a JSON value, or a TypeMismatchError if it
+// is not a value of that type.
+func jsonValue(raw json.RawMessage, ftype DBType) (DBValue, error) {
+	switch raw[0] {
+	case 'n':
+		return NullField{}, nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid JSON string %s", raw)}
+		}
+		if ftype == StringType {
+			return StringField{s}, nil
+		}
+		return parseValue(strings.TrimSpace(s), ftype)
+	case 't', 'f':
+		if ftype == BoolType || ftype == StringType {
+			return parseValue(string(raw), ftype)
+		}
+	case '{', '[':
+		if ftype == StringType {
+			var b bytes.Buffer
+			if err := json.Compact(&b, raw); err != nil {
+				return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid JSON: %s", err.Error())}
+			}
+			return StringField{b.String()}, nil
+		}
+	default:
+		if ftype == IntType && bytes.ContainsAny(raw, ".eE") {
+			// a number with a fraction or exponent is an int if it is integral
+			f, err := strconv.ParseFloat(string(raw), 64)
+			if err == nil && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+				return IntField{int64(f)}, nil
+			}
+		} else if ftype == IntType || ftype == FloatType || ftype == StringType {
+			return parseValue(string(raw), ftype)
+		}
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s is not a value of type %s", raw, ftype)}
+}
+
+// Return the tuple of the table for the members of a JSON object. The columns
+// that the object has no member for are given their default, and the
+// AUTO_INCREMENT column the next value of its sequence on behalf of tid if it
+// is missing or NULL.
+func (t *Table) jsonlTuple(members []jsonMember, tid TransactionID) (*Tuple, error) {
+	desc := t.file.Descriptor()
+	values := make([]DBValue, len(desc.Fields))
+	for _, m := range members {
+		i := jsonFieldIndex(desc, m.name)
+		if i == -1 {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("table %s has no column named %s", t.name, m.name)}
+		}
+		if values[i] != nil {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("column %s is given more than once", desc.Fields[i].Fname)}
+		}
+		v, err := jsonValue(m.value, desc.Fields[i].Ftype)
+		if dbErr, ok := err.(GoDBError); ok {
+			return nil, GoDBError{dbErr.code, fmt.Sprintf("column %s: %s", desc.Fields[i].Fname, dbErr.errString)}
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	for i, v := range values {
+		if v != nil {
+			continue
+		}
+		values[i] = NullField{}
+		if i < len(t.columns) && t.columns[i].seq == nil {
+			def, err := t.columns[i].defaultFor(desc.Fields[i].Ftype)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = def
+		}
+	}
+	t.fillSequences(values, tid)
+	return &Tuple{*desc, values, nil}, nil
+}
+
+// Return the index of the field of desc with the specified name, regardless of
+// case, or -1 if there is none.
+func jsonFieldIndex(desc *TupleDesc, name string) int {
+	for i, f := range desc.Fields {
+		if f.Fname == name {
+			return i
+		}
+	}
+	for i, f := range desc.Fields {
+		if strings.EqualFold(f.Fname, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Column names that the catalog file can record.
+var columnNameRe = regexp.MustCompile(`^\w+$`)
+
+// Return the TupleDesc of a table for the members of the objects of a sample
+// of a JSON Lines file, with a field for each member name, in lower case, in
+// the order the names first appear.
+func inferJSONLDesc(objects [][]jsonMember) (*TupleDesc, error) {
+	var names []string
+	values := make(map[string][]json.RawMessage)
+	for _, members := range objects {
+		for _, m := range members {
+			name := strings.ToLower(m.name)
+			if !columnNameRe.MatchString(name) {
+				return nil, GoDBError{ParseError, fmt.Sprintf("%q is not a valid column name", m.name)}
+			}
+			if _, ok := values[name]; !ok {
+				names = append(names, name)
+			}
+			values[name] = append(values[name], m.value)
+		}
+	}
+	if len(names) == 0 {
+		return nil, GoDBError{ParseError, "no JSON objects to infer the columns of a table from"}
+	}
+	fields := make([]FieldType, len(names))
+	for i, name := range names {
+		fields[i] = FieldType{name, "", inferJSONType(values[name])}
+	}
+	return &TupleDesc{fields}, nil
+}
+
+// Return the most specific type that all of the JSON values are values of:
+// int, float or bool for numbers and booleans, date or timestamp for strings
+// that are their literals, and otherwise StringType, which is also the type of
+// values that are all null.
+func inferJSONType(values []json.RawMessage) DBType {
+	for _, ftype := range []DBType{IntType, FloatType, BoolType, DateType, TimestampType} {
+		found, all := false, true
+		for _, raw := range values {
+			if raw[0] == 'n' {
+				continue
+			}
+			found = true
+			if !jsonInferredAs(raw, ftype) {
+				all = false
+				break
+			}
+		}
+		if found && all {
+			return ftype
+		}
+	}
+	return StringType
+}
+
+// Return true if a JSON value that is not null can be inferred to be a value of
+// type ftype: numbers of int and float, booleans of bool, and strings of date
+// and timestamp, if they are values of that type. Numbers with a fraction or
+// exponent are not inferred to be ints, even if they are integral.
+func jsonInferredAs(raw json.RawMessage, ftype DBType) bool {
+	switch raw[0] {
+	case '"':
+		if ftype != DateType && ftype != TimestampType {
+			return false
+		}
+	case 't', 'f':
+		if ftype != BoolType {
+			return false
+		}
+	case '{', '[':
+		return false
+	default:
+		if ftype != IntType && ftype != FloatType {
+			return false
+		}
+		if ftype == IntType && bytes.ContainsAny(raw, ".eE") {
+			return false
+		}
+	}
+	_, err := jsonValue(raw, ftype)
+	return err == nil
+}
@@ -0,0 +1,182 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONL(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (id int auto_increment, name text not null, age int, score float, city text default 'paris', joined date)", noTransaction)
+	input := `{"id": 1, "name": "ann", "age": 30, "score": 1.5, "city": "rome", "joined": "2024-01-31"}` + "\n" +
+		`{"NAME": "bob", "age": null, "score": 2}` + "\n" +
+		"\n" +
+		`{"name": {"first": "cy"}, "age": "41"}` + "\n" +
+		`{"name": "dee", "age": 1.5}` + "\n" +
+		`{"name": "eve", "joined": 20240131}` + "\n" +
+		`{"name": "fay", "height": 2}` + "\n" +
+		`{"age": 5}` + "\n" +
+		`["not", "an", "object"]` + "\n" +
+		`{"name": "gil"} trailing` + "\n" +
+		`{"name": "hal", "name": "hal"}` + "\n" +
+		`{"name": "ivy", "id": 10}` + "\n" +
+		`{"name": "jo", "age": 2.5e1}`
+	result, err := c.LoadJSONL("people", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var lines []string
+	for _, r := range result.Rejected {
+		lines = append(lines, fmt.Sprint(r.Line))
+	}
+	if result.Loaded != 5 || strings.Join(lines, ",") != "5,6,7,8,9,10,11" {
+		t.Errorf("expected 5 loaded rows and rejected lines 5-11, got %d and %v", result.Loaded, result.Rejected)
+	}
+	for _, r := range result.Rejected {
+		if r.Line == 5 && !strings.Contains(r.Reason, "age") {
+			t.Errorf("expected the reason of line 5 to name its column, got %s", r.Reason)
+		}
+	}
+	for i, want := range []GoDBErrorCode{TypeMismatchError, TypeMismatchError, MalformedDataError, TypeMismatchError, MalformedDataError} {
+		if i < len(result.Rejected) && result.Rejected[i].Code != want {
+			t.Errorf("expected line %d to be rejected with %v, got %v", result.Rejected[i].Line, want, result.Rejected[i].Code)
+		}
+	}
+	tups := runSQLForTest(t, bp, c, "select id, name, age, score, city from people order by id", noTransaction)
+	if len(tups) != 5 {
+		t.Fatalf("expected 5 people, got %v", tups)
+	}
+	for i, want := range []string{
+		"1 ann 30 1.5 rome",
+		"2 bob NULL 2 paris",
+		`3 {"first":"cy"} 41 NULL paris`,
+		"10 ivy NULL NULL paris",
+		"11 jo 25 NULL paris",
+	} {
+		var got []string
+		for _, f := range tups[i].Fields {
+			if isNull(f) {
+				got = append(got, "NULL")
+			} else {
+				got = append(got, valueText(f))
+			}
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("row %d: expected %s, got %s", i, want, strings.Join(got, " "))
+		}
+	}
+
+	// files written by COPY TO can be loaded back
+	path := t.TempDir() + "/people.jsonl"
+	if _, err := execSQLForTest(t, bp, c, fmt.Sprintf("copy people to '%s' with (format jsonl)", path), noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runSQLForTest(t, bp, c, "create table copies (id int, name text, age int, score float, city text, joined date)", noTransaction)
+	tid := BeginTransactionForTest(t, bp)
+	_, op, err := ParseInTransaction(c, fmt.Sprintf("copy copies from '%s' with (format jsonl)", path), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	if result := op.(*BulkLoadResult); result.Loaded != 5 || len(result.Rejected) != 0 {
+		t.Errorf("expected the copy to be loaded, got %d rows and %v", result.Loaded, result.Rejected)
+	}
+	if tups := runSQLForTest(t, bp, c, "select count(*) from copies where joined = '2024-01-31'", noTransaction); tups[0].Fields[0] != (IntField{1}) {
+		t.Errorf("expected the date to be loaded back, got %v", tups)
+	}
+
+	for _, sql := range []string{
+		fmt.Sprintf("copy copies from '%s' with (format jsonl, header)", path),
+		fmt.Sprintf("copy copies from '%s' with (format jsonl, delimiter '|')", path),
+		fmt.Sprintf("copy copies from '%s' with (format tsv)", path),
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestImportJSONL(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	input := `{"Id": 1, "price": 1, "ok": true, "day": "2024-01-31", "at": "2024-01-31 10:00:00", "tags": ["a"], "note": null}` + "\n" +
+		`{"Id": 2, "price": 2.5, "ok": false, "day": "2024-02-01", "at": "2024-02-01", "tags": "b", "extra": "x"}` + "\n" +
+		`not json` + "\n" +
+		`{"Id": 3, "price": 3, "ok": null, "day": "2024-02-02", "at": "2024-02-02T10:00:00Z", "tags": null}` + "\n" +
+		`{"Id": 4.5, "price": "n/a"}` + "\n" +
+		`{"Id": 5, "day": "tomorrow"}` + "\n"
+	desc, err := InferJSONLSchema(strings.NewReader(input), 4)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var cols []string
+	for _, f := range desc.Fields {
+		cols = append(cols, f.Fname+" "+columnTypeName(f.Ftype))
+	}
+	if want := "id int, price float, ok bool, day date, at timestamp, tags text, note text, extra text"; strings.Join(cols, ", ") != want {
+		t.Errorf("expected columns %s, got %s", want, strings.Join(cols, ", "))
+	}
+
+	result, err := c.ImportJSONL("events", strings.NewReader(input), 4)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if result.Loaded != 3 || len(result.Rejected) != 3 || result.Rejected[0].Line != 3 ||
+		result.Rejected[1].Line != 5 || result.Rejected[2].Line != 6 {
+		t.Errorf("expected 3 loaded rows and rejected lines 3, 5 and 6, got %d and %v", result.Loaded, result.Rejected)
+	}
+	for _, r := range result.Rejected[1:] {
+		if !strings.Contains(r.Reason, "id") && !strings.Contains(r.Reason, "day") {
+			t.Errorf("expected the reason to name the column, got %s", r.Reason)
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select id, tags from events where price > 2", noTransaction); len(tups) != 2 ||
+		tups[0].Fields[1] != (StringField{"b"}) || !isNull(tups[1].Fields[1]) {
+		t.Errorf("unexpected events %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select data_type from godb_columns where table_name = 'events' and column_name = 'tags'", noTransaction); len(tups) != 1 ||
+		tups[0].Fields[0] != (StringField{"text"}) {
+		t.Errorf("expected the inferred column to have type text, got %v", tups)
+	}
+
+	// the imported table survives a restart
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if tups := runSQLForTest(t, bp2, c2, "select count(*) from events", noTransaction); tups[0].Fields[0] != (IntField{3}) {
+		t.Errorf("expected the imported rows to be recovered, got %v", tups)
+	}
+
+	// a failed import does not create the table
+	tid := BeginTransactionForTest(t, bp2)
+	if _, err := c2.importJSONL(tid, "aborted", strings.NewReader(`{"a": 1}`), 10); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2.AbortTransaction(tid)
+	if _, err := c2.GetTable("aborted"); err == nil {
+		t.Errorf("expected the table of an aborted import to be removed")
+	}
+
+	for _, input := range []string{"", "not json\n", `{"first name": "x"}`, `{"a": 1}`} {
+		named := "events"
+		if input != `{"a": 1}` {
+			named = "other"
+		}
+		if _, err := c2.ImportJSONL(named, strings.NewReader(input), 10); err == nil {
+			t.Errorf("expected importing %q into %s to be an error", input, named)
+		}
+	}
+	if _, err := c2.GetTable("other"); err == nil {
+		t.Errorf("expected no table to be created by a failed import")
+	}
+
+	path := root + "/events.jsonl"
+	if err := os.WriteFile(path, []byte(`{"id": 6}`), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := execSQLForTest(t, bp2, c2, fmt.Sprintf("copy events from '%s' with (format jsonl)", path), noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select count(*) from events", noTransaction); tups[0].Fields[0] != (IntField{4}) {
+		t.Errorf("expected a row to be added by COPY FROM, got %v", tups)
+	}
+}
@@ -194,3 +194,27 @@ func (t *LockTable) TryLock(file DBFile, pageNo int, tid TransactionID, perm RWP
 
 	return Wait
 }
+
+// A lock that a transaction holds on a page.
+type heldLock struct {
+	page  any // the page key
+	tid   TransactionID
+	write bool
+}
+
+// Return the locks held on each page. A transaction that holds both a read
+// and a write lock on a page is listed once, with its write lock.
+func (t *LockTable) heldLocks() []heldLock {
+	var held []heldLock
+	for pg, locks := range t.locks {
+		if locks.write != nil {
+			held = append(held, heldLock{pg, *locks.write, true})
+		}
+		for _, tid := range locks.read {
+			if locks.write == nil || *locks.write != tid {
+				held = append(held, heldLock{pg, tid, false})
+			}
+		}
+	}
+	return held
+}
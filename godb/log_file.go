@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
 )
 
 /*
@@ -32,12 +31,24 @@ variable-length, and have the following high-level structure:
 +--------------------------------------------------------+
 
 Records start with a type, which will be one of the following: AbortRecord,
-CommitRecord, UpdateRecord, BeginRecord. The type is followed by the ID of
-the transaction that created the record.
+CommitRecord, UpdateRecord, BeginRecord, CreateTableRecord, DropTableRecord,
+SequenceRecord, BulkLoadRecord, CreateIndexRecord, DropIndexRecord,
+CreateViewRecord, DropViewRecord. The type is followed by the ID of the
+transaction that created the record.
 
 The contents of the body depends on the type. Abort, Commit, and Begin
-records are empty. Update records consist of the before and after pages. A
-page has the following format:
+records are empty. CreateTable and DropTable records contain the definition
+of the table: its file number, name, storage method, fields and declared
+column types, and, for a drop, the indexes of the table. Sequence records
+contain the file number of a table, the position of its AUTO_INCREMENT column
+and the new value of the counter of the column (see column_defaults.go).
+BulkLoad records contain the file number of a heap file, and the first page
+number and number of the pages that a bulk load appends to it, whose contents
+are not logged (see bulk_load.go). CreateIndex and DropIndex records contain
+the file number of the table of the index and the definition of the index.
+CreateView and DropView records contain the name and query of a view, and
+whether it is materialized (see views.go). Update records consist of the
+before and after pages. A page has the following format:
 
 +--------------------------------------------------------+
 | File num (4 bytes)                                     |
@@ -49,11 +60,13 @@ page has the following format:
 +--------------------------------------------------------+
 
 The file number of a page is an internal identifier for the page's file that
-is tracked by the catalog.
+is tracked by the catalog. File numbers are never reused, so the pages of
+update records whose file has since been dropped are read as pages of a
+[droppedFile], which are ignored when they are flushed.
 */
 
 type LogFile struct {
-	file       *os.File
+	file       diskFile
 	buf        bytes.Buffer
 	offset     int64
 	bufferPool *BufferPool
@@ -67,6 +80,15 @@ const (
 	CommitRecord LogRecordType = iota
 	UpdateRecord LogRecordType = iota
 	BeginRecord  LogRecordType = iota
+
+	CreateTableRecord LogRecordType = iota
+	DropTableRecord   LogRecordType = iota
+	SequenceRecord    LogRecordType = iota
+	BulkLoadRecord    LogRecordType = iota
+	CreateIndexRecord LogRecordType = iota
+	DropIndexRecord   LogRecordType = iota
+	CreateViewRecord  LogRecordType = iota
+	DropViewRecord    LogRecordType = iota
 )
 
 func (t LogRecordType) String() string {
@@ -79,6 +101,22 @@ func (t LogRecordType) String() string {
 		return "update"
 	case BeginRecord:
 		return "begin"
+	case CreateTableRecord:
+		return "create table"
+	case DropTableRecord:
+		return "drop table"
+	case SequenceRecord:
+		return "sequence"
+	case BulkLoadRecord:
+		return "bulk load"
+	case CreateIndexRecord:
+		return "create index"
+	case DropIndexRecord:
+		return "drop index"
+	case CreateViewRecord:
+		return "create view"
+	case DropViewRecord:
+		return "drop view"
 	default:
 		return "unknown"
 	}
@@ -89,12 +127,12 @@ func NewLogFile(fileName string, bufferPool *BufferPool, catalog *Catalog) (*Log
 	if bufferPool == nil || catalog == nil {
 		return nil, fmt.Errorf("bufferPool and catalog must be non-nil")
 	}
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
+	disk := bufferPool.DiskManager()
+	if err := disk.Open(fileName); err != nil {
 		return nil, err
 	}
 	var buf bytes.Buffer
-	return &LogFile{file, buf, 0, bufferPool, catalog}, nil
+	return &LogFile{diskFile{disk, fileName}, buf, 0, bufferPool, catalog}, nil
 }
 
 func (w *LogFile) write(data any) {
@@ -103,33 +141,42 @@ func (w *LogFile) write(data any) {
 	w.offset += size
 }
 
+// Write the buffered log records to the end of the log file and make them
+// durable.
 func (w *LogFile) Force() error {
 	if w.buf.Len() == 0 {
 		return nil
 	}
 
-	_, err := w.file.Write(w.buf.Bytes())
-	if err != nil {
+	// the buffered records end at the current offset
+	start := w.offset - int64(w.buf.Len())
+	if _, err := w.file.disk.WriteAt(w.file.name, w.buf.Bytes(), start); err != nil {
 		return err
 	}
 
-	off, _ := w.file.Seek(0, io.SeekCurrent)
-	if off != w.offset {
-		log.Printf("offset mismatch: %d != %d", off, w.offset)
-	}
-
 	w.buf.Reset()
-	return w.file.Sync()
+	return w.file.disk.Sync(w.file.name)
 }
 
+// Move the offset at which the log is read and written, like [os.File.Seek].
 func (f *LogFile) seek(offset int64, whence int) error {
 	if err := f.Force(); err != nil {
 		return err
 	}
 
-	new_offset, err := f.file.Seek(offset, whence)
-	if err != nil {
-		return fmt.Errorf("invalid seek (%d, %d): %w", offset, whence, err)
+	new_offset := offset
+	switch whence {
+	case io.SeekCurrent:
+		new_offset += f.offset
+	case io.SeekEnd:
+		size, err := f.file.disk.Size(f.file.name)
+		if err != nil {
+			return err
+		}
+		new_offset += size
+	}
+	if new_offset < 0 {
+		return fmt.Errorf("invalid seek (%d, %d): negative offset", offset, whence)
 	}
 	f.offset = new_offset
 
@@ -143,11 +190,19 @@ func (f *LogFile) read(data any) error {
 		return err
 	}
 
-	if err = binary.Read(f.file, binary.LittleEndian, data); err != nil {
+	b := make([]byte, binary.Size(data))
+	n, err := f.file.disk.ReadAt(f.file.name, b, f.offset)
+	if n == 0 && err == io.EOF {
+		return io.EOF
+	}
+	if n < len(b) {
+		return io.ErrUnexpectedEOF
+	}
+	if err = binary.Read(bytes.NewReader(b), binary.LittleEndian, data); err != nil {
 		return err
 	}
 	// log.Printf("read @%d", f.offset)
-	f.offset += int64(binary.Size(data))
+	f.offset += int64(len(b))
 	return nil
 }
 
@@ -169,6 +224,24 @@ func (w *LogFile) writeFooter(offset int64) {
 	w.write(offset)
 }
 
+// A page that can be written to the log. The file that owns the page must be
+// registered with the catalog so that it has a file number, and must be able
+// to rebuild the page from its serialized form (see [loggedFile]).
+type loggedPage interface {
+	Page
+	PageNo() int
+	getDirtier() TransactionID
+	BeforeImage() Page
+	SetBeforeImage()
+	toBuffer() (*bytes.Buffer, error)
+}
+
+// A file whose pages can be read back from the log.
+type loggedFile interface {
+	DBFile
+	pageFromBuffer(pageNo int, buf []byte) (Page, error)
+}
+
 func (w *LogFile) readPage() (Page, error) {
 	var fileId int32
 	if err := w.read(&fileId); err != nil {
@@ -178,44 +251,43 @@ func (w *LogFile) readPage() (Page, error) {
 	if err := w.read(&pageNo); err != nil {
 		return nil, err
 	}
-	f, err := w.catalog.GetTableInfoId(int(fileId))
-	if err != nil {
-		return nil, err
-	}
-	pg, err := newHeapPage(f.file.Descriptor(), int(pageNo), f.file.(*HeapFile))
-	if err != nil {
-		return nil, err
-	}
 	buf := make([]byte, PageSize)
 	if err := w.read(buf); err != nil {
 		return nil, err
 	}
-	if err := pg.initFromBuffer(bytes.NewBuffer(buf)); err != nil {
+	f, err := w.catalog.getFileById(int(fileId))
+	if dbErr, ok := err.(GoDBError); ok && dbErr.code == NoSuchTableError {
+		return &droppedPage{&droppedFile{int(fileId)}, int(pageNo)}, nil
+	}
+	if err != nil {
 		return nil, err
 	}
-	return pg, nil
+	lf, ok := f.(loggedFile)
+	if !ok {
+		return nil, fmt.Errorf("file %d does not support logging", fileId)
+	}
+	return lf.pageFromBuffer(int(pageNo), buf)
 }
 
 func (w *LogFile) writePage(page Page) error {
-	switch p := page.(type) {
-	case *heapPage:
-		// if w.catalog == nil {
-		// 	return fmt.Errorf("catalog must be non-nil")
-		// }
-		f, err := w.catalog.GetTableInfoDBFile(page.getFile())
-		if err != nil {
-			return err
-		}
-		w.write(int32(f.id))
-		w.write(int32(p.PageNo()))
-		buf, err := p.toBuffer()
-		if err != nil {
-			return err
-		}
-		w.write(buf.Bytes())
-	default:
+	p, ok := page.(loggedPage)
+	if !ok {
 		return fmt.Errorf("unsupported page type: %T", page)
 	}
+	// if w.catalog == nil {
+	// 	return fmt.Errorf("catalog must be non-nil")
+	// }
+	id, err := w.catalog.getFileId(page.getFile())
+	if err != nil {
+		return err
+	}
+	w.write(int32(id))
+	w.write(int32(p.PageNo()))
+	buf, err := p.toBuffer()
+	if err != nil {
+		return err
+	}
+	w.write(buf.Bytes())
 	return nil
 }
 
@@ -258,6 +330,222 @@ func (w *LogFile) LogBegin(tid TransactionID) {
 	w.writeFooter(offset)
 }
 
+// Write a CreateTable or DropTable record with the definition of the table,
+// and force the log, so that the record is durable before the catalog file
+// can reflect the change.
+func (w *LogFile) logTable(typ LogRecordType, tid TransactionID, def *tableDef) error {
+	offset := w.offset
+	w.writeHeader(typ, tid)
+	w.writeTableDef(def)
+	w.writeFooter(offset)
+	return w.Force()
+}
+
+// Write a CreateIndex or DropIndex record with the definition of an index of
+// the table with file number table, and force the log, like
+// [LogFile.logTable].
+func (w *LogFile) logIndex(typ LogRecordType, tid TransactionID, table int, def *indexDef) error {
+	offset := w.offset
+	w.writeHeader(typ, tid)
+	w.write(int32(table))
+	w.writeIndexDef(def)
+	w.writeFooter(offset)
+	return w.Force()
+}
+
+// Write a CreateView or DropView record with the definition of a view, and
+// force the log, like [LogFile.logTable].
+func (w *LogFile) logView(typ LogRecordType, tid TransactionID, v *view) error {
+	offset := w.offset
+	w.writeHeader(typ, tid)
+	w.writeString(v.name)
+	w.writeString(v.query)
+	w.write(v.materialized)
+	w.writeFooter(offset)
+	return w.Force()
+}
+
+// Write a Sequence record that sets the counter of the AUTO_INCREMENT column
+// field of the table with file number table to value. The record is not
+// forced; it is made durable with the next commit.
+func (w *LogFile) logSequence(tid TransactionID, table int, field int, value int64) {
+	offset := w.offset
+	w.writeHeader(SequenceRecord, tid)
+	w.write(int32(table))
+	w.write(int32(field))
+	w.write(value)
+	w.writeFooter(offset)
+}
+
+// Write a BulkLoad record for numPages pages that tid appends to the heap file
+// with file number table, starting at page firstPage, and force the log, so
+// that the record is durable before the pages are written.
+func (w *LogFile) logBulkLoad(tid TransactionID, table int, firstPage int, numPages int) error {
+	offset := w.offset
+	w.writeHeader(BulkLoadRecord, tid)
+	w.write(int32(table))
+	w.write(int32(firstPage))
+	w.write(int32(numPages))
+	w.writeFooter(offset)
+	return w.Force()
+}
+
+func (f *LogFile) writeTableDef(def *tableDef) {
+	f.write(int32(def.id))
+	f.writeString(def.name)
+	f.writeString(def.file)
+	f.writeString(def.storage)
+	f.writeTupleDesc(&def.desc)
+	for _, col := range def.columns {
+		f.writeString(col.typeName)
+		f.write(int32(col.length))
+		f.write(col.notNull)
+		f.writeString(col.defaultValue)
+		f.write(col.seq != nil)
+		if col.seq != nil {
+			f.write(col.seq.lastValue())
+		}
+	}
+	f.write(int8(len(def.keys)))
+	for _, k := range def.keys {
+		f.write(k.primary)
+		f.writeStrings(k.columns)
+	}
+	f.write(int8(len(def.fks)))
+	for _, fk := range def.fks {
+		f.writeStrings(fk.columns)
+		f.writeString(fk.parent)
+		f.writeStrings(fk.parentColumns)
+		f.writeString(fk.onDelete)
+	}
+	f.write(int8(len(def.indexes)))
+	for i := range def.indexes {
+		f.writeIndexDef(&def.indexes[i])
+	}
+}
+
+func (f *LogFile) writeIndexDef(def *indexDef) {
+	f.write(int32(def.id))
+	f.writeString(def.name)
+	f.writeString(def.file)
+	f.writeString(def.column)
+	f.writeString(def.method)
+}
+
+func (f *LogFile) readTableDef(def *tableDef) error {
+	var id int32
+	if err := f.read(&id); err != nil {
+		return err
+	}
+	def.id = int(id)
+	var err error
+	if def.name, err = f.readString(); err != nil {
+		return err
+	}
+	if def.file, err = f.readString(); err != nil {
+		return err
+	}
+	if def.storage, err = f.readString(); err != nil {
+		return err
+	}
+	if err := f.readTupleDesc(&def.desc); err != nil {
+		return err
+	}
+	def.columns = make([]columnInfo, len(def.desc.Fields))
+	for i := range def.columns {
+		col := &def.columns[i]
+		if col.typeName, err = f.readString(); err != nil {
+			return err
+		}
+		var length int32
+		if err := f.read(&length); err != nil {
+			return err
+		}
+		col.length = int(length)
+		if err := f.read(&col.notNull); err != nil {
+			return err
+		}
+		if col.defaultValue, err = f.readString(); err != nil {
+			return err
+		}
+		var autoIncrement bool
+		if err := f.read(&autoIncrement); err != nil {
+			return err
+		}
+		if autoIncrement {
+			var last int64
+			if err := f.read(&last); err != nil {
+				return err
+			}
+			// the file number and position are set when the table is opened
+			col.seq = newSequence(last, def.id, i, nil)
+		}
+	}
+	var n int8
+	if err := f.read(&n); err != nil {
+		return err
+	}
+	def.keys = make([]tableKey, int(n))
+	for i := range def.keys {
+		k := &def.keys[i]
+		if err := f.read(&k.primary); err != nil {
+			return err
+		}
+		if k.columns, err = f.readStrings(); err != nil {
+			return err
+		}
+	}
+	if err := f.read(&n); err != nil {
+		return err
+	}
+	def.fks = make([]foreignKey, int(n))
+	for i := range def.fks {
+		fk := &def.fks[i]
+		if fk.columns, err = f.readStrings(); err != nil {
+			return err
+		}
+		if fk.parent, err = f.readString(); err != nil {
+			return err
+		}
+		if fk.parentColumns, err = f.readStrings(); err != nil {
+			return err
+		}
+		if fk.onDelete, err = f.readString(); err != nil {
+			return err
+		}
+	}
+	if err := f.read(&n); err != nil {
+		return err
+	}
+	def.indexes = make([]indexDef, int(n))
+	for i := range def.indexes {
+		if err := f.readIndexDef(&def.indexes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *LogFile) readIndexDef(def *indexDef) error {
+	var id int32
+	if err := f.read(&id); err != nil {
+		return err
+	}
+	def.id = int(id)
+	var err error
+	if def.name, err = f.readString(); err != nil {
+		return err
+	}
+	if def.file, err = f.readString(); err != nil {
+		return err
+	}
+	if def.column, err = f.readString(); err != nil {
+		return err
+	}
+	def.method, err = f.readString()
+	return err
+}
+
 func (f *LogFile) writeString(s string) {
 	f.write(int32(len(s)))
 	f.write([]byte(s))
@@ -275,6 +563,28 @@ func (f *LogFile) readString() (string, error) {
 	return string(buf), nil
 }
 
+func (f *LogFile) writeStrings(s []string) {
+	f.write(int8(len(s)))
+	for _, str := range s {
+		f.writeString(str)
+	}
+}
+
+func (f *LogFile) readStrings() ([]string, error) {
+	var n int8
+	if err := f.read(&n); err != nil {
+		return nil, err
+	}
+	s := make([]string, int(n))
+	for i := range s {
+		var err error
+		if s[i], err = f.readString(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
 func (f *LogFile) writeFieldType(t FieldType) {
 	f.writeString(t.Fname)
 	f.writeString(t.TableQualifier)
@@ -349,6 +659,56 @@ type UpdateLogRecord struct {
 	After  Page
 }
 
+// A Sequence record.
+type SequenceLogRecord struct {
+	GenericLogRecord
+	table int
+	field int
+	value int64
+}
+
+// A BulkLoad record.
+type BulkLoadLogRecord struct {
+	GenericLogRecord
+	table     int
+	firstPage int
+	numPages  int
+}
+
+// A CreateTable or DropTable record.
+type TableLogRecord struct {
+	GenericLogRecord
+	def tableDef
+}
+
+// Return the name of the table that was created or dropped.
+func (r *TableLogRecord) TableName() string {
+	return r.def.name
+}
+
+// A CreateIndex or DropIndex record.
+type IndexLogRecord struct {
+	GenericLogRecord
+	table int // file number of the table of the index
+	def   indexDef
+}
+
+// Return the name of the index that was created or dropped.
+func (r *IndexLogRecord) IndexName() string {
+	return r.def.name
+}
+
+// A CreateView or DropView record.
+type ViewLogRecord struct {
+	GenericLogRecord
+	view view
+}
+
+// Return the name of the view that was created or dropped.
+func (r *ViewLogRecord) ViewName() string {
+	return r.view.name
+}
+
 // Returns an iterator over the records in a log file.
 //
 // If the end of the file is reached, the iterator will return nil, nil. If the
@@ -390,6 +750,74 @@ func (f *LogFile) ForwardIterator() func() (LogRecord, error) {
 			ret = &update
 		}
 
+		if record.Type() == CreateTableRecord || record.Type() == DropTableRecord {
+			table := &TableLogRecord{GenericLogRecord: record}
+			if err := f.readTableDef(&table.def); err != nil {
+				return partial("table definition", err)
+			}
+			ret = table
+		}
+
+		if record.Type() == CreateIndexRecord || record.Type() == DropIndexRecord {
+			index := &IndexLogRecord{GenericLogRecord: record}
+			var table int32
+			if err := f.read(&table); err != nil {
+				return partial("index table", err)
+			}
+			if err := f.readIndexDef(&index.def); err != nil {
+				return partial("index definition", err)
+			}
+			index.table = int(table)
+			ret = index
+		}
+
+		if record.Type() == CreateViewRecord || record.Type() == DropViewRecord {
+			v := &ViewLogRecord{GenericLogRecord: record}
+			var err error
+			if v.view.name, err = f.readString(); err != nil {
+				return partial("view name", err)
+			}
+			if v.view.query, err = f.readString(); err != nil {
+				return partial("view query", err)
+			}
+			if err := f.read(&v.view.materialized); err != nil {
+				return partial("view materialized", err)
+			}
+			ret = v
+		}
+
+		if record.Type() == SequenceRecord {
+			seq := &SequenceLogRecord{GenericLogRecord: record}
+			var table, field int32
+			if err := f.read(&table); err != nil {
+				return partial("sequence table", err)
+			}
+			if err := f.read(&field); err != nil {
+				return partial("sequence column", err)
+			}
+			if err := f.read(&seq.value); err != nil {
+				return partial("sequence value", err)
+			}
+			seq.table, seq.field = int(table), int(field)
+			ret = seq
+		}
+
+		if record.Type() == BulkLoadRecord {
+			load := &BulkLoadLogRecord{GenericLogRecord: record}
+			var table, firstPage, numPages int32
+			if err := f.read(&table); err != nil {
+				return partial("bulk load table", err)
+			}
+			if err := f.read(&firstPage); err != nil {
+				return partial("bulk load first page", err)
+			}
+			if err := f.read(&numPages); err != nil {
+				return partial("bulk load page count", err)
+			}
+			load.table, load.firstPage, load.numPages = int(table), int(firstPage), int(numPages)
+			ret = load
+		}
+
 		var recordOffset int64
 		if err := f.read(&recordOffset); err != nil || recordOffset != record.offset {
 			return partial("offset", err)
@@ -458,7 +886,18 @@ func (f *LogFile) OutputPrettyLog() error {
 			log.Printf("%d RECORD %s (%d) offset=%d\n", pos, record.Type().String(), record.Tid(), record.Offset())
 		} else if record.Type() == UpdateRecord {
 			update := record.(*UpdateLogRecord)
-			log.Printf("%d RECORD %s (%d) offset=%d page=%v\n", pos, record.Type().String(), record.Tid(), record.Offset(), update.Before.(*heapPage).getFile().pageKey(update.Before.(*heapPage).pageNo))
+			before := update.Before.(loggedPage)
+			log.Printf("%d RECORD %s (%d) offset=%d page=%v\n", pos, record.Type().String(), record.Tid(), record.Offset(), before.getFile().pageKey(before.PageNo()))
+		} else if seq, ok := record.(*SequenceLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d table=%d value=%d\n", pos, record.Type().String(), record.Tid(), record.Offset(), seq.table, seq.value)
+		} else if load, ok := record.(*BulkLoadLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d table=%d pages=%d-%d\n", pos, record.Type().String(), record.Tid(), record.Offset(), load.table, load.firstPage, load.firstPage+load.numPages-1)
+		} else if table, ok := record.(*TableLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d table=%s id=%d\n", pos, record.Type().String(), record.Tid(), record.Offset(), table.def.name, table.def.id)
+		} else if index, ok := record.(*IndexLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d index=%s id=%d table=%d\n", pos, record.Type().String(), record.Tid(), record.Offset(), index.def.name, index.def.id, index.table)
+		} else if v, ok := record.(*ViewLogRecord); ok {
+			log.Printf("%d RECORD %s (%d) offset=%d view=%s\n", pos, record.Type().String(), record.Tid(), record.Offset(), v.view.name)
 		} else {
 			log.Printf("unexpected record: %#v", record)
 		}
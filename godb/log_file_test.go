@@ -109,7 +109,7 @@ func TestLogRecoverUndoRedo(t *testing.T) {
 
 	// insert a page of tuples for each transaction. each transaction should
 	// have tuples on separate pages.
-	tuplesPerPage := PageSize / hf.Descriptor().bytesPerTuple()
+	tuplesPerPage := tuplesPerPageForTest(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 	tid := NewTID()
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
@@ -227,7 +227,7 @@ func TestLogRecoverUndo(t *testing.T) {
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
 	}
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < 2000; i++ {
 		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}, tid); err != nil {
 			t.Error(err)
 		}
@@ -287,7 +287,7 @@ func TestLogRecoverRedo(t *testing.T) {
 	if err := bp.BeginTransaction(tid); err != nil {
 		t.Error(err)
 	}
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < 2000; i++ {
 		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i)}}}, tid); err != nil {
 			t.Error(err)
 		}
@@ -332,8 +332,8 @@ func TestLogRecoverRedo(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if i != 1000 {
-		t.Fatalf("expected 1000 tuples, got %d", i)
+	if i != 2000 {
+		t.Fatalf("expected 2000 tuples, got %d", i)
 	}
 	bp.CommitTransaction(tid)
 }
@@ -420,6 +420,37 @@ func TestLogRollbackFlushed(t *testing.T) {
 	checkFirstPage()
 }
 
+// TestLogAbortKeepsCommitted tests that aborting a transaction does not lose the
+// changes of a committed transaction to a page that the aborted transaction
+// modified, which are not on disk, since pages are not flushed at commit.
+func TestLogAbortKeepsCommitted(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	hf, err := c.addTable("log_abort_committed", TupleDesc{Fields: []FieldType{{Fname: "f", Ftype: IntType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, commit := range []bool{true, false} {
+		tid := NewTID()
+		if err := bp.BeginTransaction(tid); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.insertTuple(&Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{IntField{int64(i + 1)}}}, tid); err != nil {
+			t.Fatal(err)
+		}
+		if commit {
+			bp.CommitTransaction(tid)
+		} else {
+			bp.AbortTransaction(tid)
+		}
+	}
+
+	tups := runQueryForTest(t, bp, hf, noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{1}) {
+		t.Errorf("expected only the committed tuple after the abort, got %v", tups)
+	}
+}
+
 // TestLogStealForce tests that the buffer pool can evict dirty pages and that
 // it writes a log entry when it does so. It also tests that dirty pages are not
 // flushed when a transaction commits, but that a log entry is written.
@@ -0,0 +1,204 @@
+package godb
+
+/*
+materialized_views.go implements materialized views, which are views whose
+result is stored in a heap file, so that queries read the stored result rather
+than run the query of the view:
+
+	create materialized view sales as select c.name as name, sum(o.total) as total from orders o join customers c on o.cust = c.id group by c.name
+	refresh materialized view sales
+	drop materialized view sales
+
+The result is stored in a table with the name of the view, whose columns are
+the fields of the query, so the view can be used in a query anywhere a table
+can, has statistics of its own for the join optimizer, and may have indexes.
+The fields of the query must have names that are valid column names, e.g.,
+aggregates must be given an alias. The table is only changed by REFRESH
+MATERIALIZED VIEW, which replaces its tuples with the current result of the
+query in one transaction, the one that runs the statement or, outside of a
+transaction, one of its own. Readers lock the pages of the table that they
+read, and the refresh locks all of them, so readers see either the old
+contents of the view or the new ones.
+
+Like CREATE TABLE and DROP TABLE, CREATE MATERIALIZED VIEW and DROP
+MATERIALIZED VIEW are part of the transaction they are run in, which creates or
+drops both the view and its table, and undoes both if it aborts. The table of
+the view is in the catalog file, and the query in the views file (see
+views.go).
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The field names of a query that can be the columns of a materialized view.
+var viewColumnRe = regexp.MustCompile(`^\w+$`)
+
+// Return the operator of the query of a materialized view, and the fields of
+// the tuples it returns.
+func (c *Catalog) materializedViewQuery(v *view) (Operator, *TupleDesc, error) {
+	plan, err := v.plan(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkNoTemporaryTables(plan); err != nil {
+		return nil, nil, err
+	}
+	op, err := makePhysicalPlan(c, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	desc := &TupleDesc{}
+	for _, f := range op.Descriptor().Fields {
+		name := strings.ToLower(f.Fname)
+		if !viewColumnRe.MatchString(name) {
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("field '%s' of materialized view '%s' must be given a column name with AS", f.Fname, v.name)}
+		}
+		if _, err := findFieldInTd(FieldType{name, "", UnknownType}, desc); err == nil {
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("materialized view '%s' has two fields named '%s'", v.name, name)}
+		}
+		desc.Fields = append(desc.Fields, FieldType{name, "", f.Ftype})
+	}
+	return op, desc, nil
+}
+
+// Add a materialized view with the specified SELECT statement to the catalog,
+// and store the result of the query in its table.
+//
+// Returns an error if a table, index or view with the same name already exists,
+// or the query is not a valid SELECT statement of the tables and views of the
+// catalog.
+func (c *Catalog) createMaterializedView(tid TransactionID, named string, query string) error {
+	if err := c.checkViewName(named); err != nil {
+		return err
+	}
+	v := &view{named, strings.TrimSpace(query), true}
+	_, desc, err := c.materializedViewQuery(v)
+	if err != nil {
+		return err
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if tid == noTransaction {
+			return GoDBError{IllegalOperationError, "CREATE MATERIALIZED VIEW requires a log file"}
+		}
+		if err := c.createTableInTransaction(tid, named, *desc, defaultColumns(desc), nil, nil, "heap"); err != nil {
+			return err
+		}
+		if err := c.fillMaterializedView(tid, v); err != nil {
+			return err
+		}
+		return c.addView(tid, v)
+	})
+}
+
+// Replace the tuples of the table of a materialized view with the result of its
+// query on behalf of tid, and recompute the statistics of the table.
+//
+// Returns an error if there is no materialized view with the specified name, or
+// its query no longer returns the fields of its table, e.g., because a table
+// that it uses was altered.
+func (c *Catalog) refreshMaterializedView(tid TransactionID, named string) error {
+	v := c.getView(named)
+	if v == nil || !v.materialized {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no materialized view named '%s'", named)}
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		if tid == noTransaction {
+			return GoDBError{IllegalOperationError, "REFRESH MATERIALIZED VIEW requires a log file"}
+		}
+		t, err := c.GetTableInfo(named)
+		if err != nil {
+			return err
+		}
+		iter, err := t.file.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				return err
+			}
+			if tup == nil {
+				break
+			}
+			if err := t.file.deleteTuple(tup, tid); err != nil {
+				return err
+			}
+		}
+		return c.fillMaterializedView(tid, v)
+	})
+}
+
+// Insert the result of the query of a materialized view into its table, which
+// is empty, on behalf of tid, and compute the statistics of the table.
+func (c *Catalog) fillMaterializedView(tid TransactionID, v *view) error {
+	t, err := c.GetTableInfo(v.name)
+	if err != nil {
+		return err
+	}
+	op, desc, err := c.materializedViewQuery(v)
+	if err != nil {
+		return err
+	}
+	if !desc.equals(&t.desc) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("the query of materialized view '%s' no longer returns the columns of the view", v.name)}
+	}
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return err
+		}
+		if tup == nil {
+			break
+		}
+		newTup := Tuple{*t.file.Descriptor(), tup.Fields, nil}
+		if err := t.file.insertTuple(&newTup, tid); err != nil {
+			return err
+		}
+	}
+	stats, err := computeTableStats(tid, t.file)
+	if err != nil {
+		return err
+	}
+	stats.unique = t.uniqueColumns()
+	t.stats = stats
+	return nil
+}
+
+// Remove a materialized view and its table from the catalog on behalf of tid.
+func (c *Catalog) dropMaterializedView(tid TransactionID, named string) error {
+	v := c.getView(named)
+	if v == nil || !v.materialized {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no materialized view named '%s'", named)}
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		// the table is checked before the view is removed, so that a view
+		// whose table cannot be dropped is kept
+		if err := c.checkUnreferenced(named, "drop"); err != nil {
+			return err
+		}
+		if err := c.checkNoViewUses(named); err != nil {
+			return err
+		}
+		if err := c.removeView(tid, v); err != nil {
+			return err
+		}
+		return c.dropTableInTransaction(tid, named)
+	})
+}
+
+// Return an error if the table with the specified name is the table of a
+// materialized view, which only REFRESH MATERIALIZED VIEW may change.
+func (c *Catalog) checkNotMaterialized(named string) error {
+	if v := c.getView(named); v != nil && v.materialized {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("'%s' is a materialized view, which can only be changed by REFRESH MATERIALIZED VIEW", named)}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestMaterializedViews(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table customers (id int primary key, name text)", noTransaction)
+	runSQLForTest(t, bp, c, "create table orders (id int primary key, cust int, total int)", noTransaction)
+	for _, sql := range []string{
+		"insert into customers values (1, 'ann')",
+		"insert into customers values (2, 'bob')",
+		"insert into orders values (10, 1, 50)",
+		"insert into orders values (11, 1, 200)",
+		"insert into orders values (12, 2, 300)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	sql := "create materialized view sales as select c.name as name, sum(o.total) as total from orders o join customers c on o.cust = c.id group by c.name"
+	if qtype, _, err := Parse(c, sql); err != nil || qtype != CreateViewQueryType {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	if got := c.getView("sales").String(); got != "materialized view sales as "+sql[len("create materialized view sales as "):] {
+		t.Errorf("unexpected view: %s", got)
+	}
+	if stats := c.GetTableStats("sales"); stats == nil || stats.EstimateCardinality(1) != 2 {
+		t.Errorf("expected the view to have statistics of its two tuples, got %v", stats)
+	}
+	if tups := runSQLForTest(t, bp, c, "select total from sales where name = 'ann'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{250}) {
+		t.Errorf("expected the total of ann, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select c.id from sales s join customers c on s.name = c.name where s.total > 260", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{2}) {
+		t.Errorf("expected a join with the view, got %v", tups)
+	}
+
+	// the view keeps its contents until it is refreshed
+	if _, err := execSQLForTest(t, bp, c, "insert into orders values (13, 2, 1)", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select total from sales where name = 'bob'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{300}) {
+		t.Errorf("expected the old total of bob, got %v", tups)
+	}
+	if qtype, _, err := Parse(c, "refresh materialized view sales"); err != nil || qtype != RefreshViewQueryType {
+		t.Fatalf("refresh: %v", err)
+	}
+	if tups := runSQLForTest(t, bp, c, "select total from sales where name = 'bob'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{301}) {
+		t.Errorf("expected the new total of bob, got %v", tups)
+	}
+
+	// an aborted refresh keeps the old contents
+	if _, err := execSQLForTest(t, bp, c, "insert into orders values (14, 2, 1)", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "refresh materialized view sales", tid)
+	bp.AbortTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select total from sales", noTransaction); len(tups) != 2 || tups[0].Fields[0] != (IntField{250}) || tups[1].Fields[0] != (IntField{301}) {
+		t.Errorf("expected the abort to restore the view, got %v", tups)
+	}
+
+	for _, sql := range []string{
+		"insert into sales values ('cid', 1)",
+		"delete from sales",
+		"update sales set total = 0",
+		"drop table sales",
+		"drop view sales",
+		"truncate table sales",
+		"alter table sales add column x int",
+		"refresh materialized view orders",
+		"drop materialized view orders",
+		"create materialized view sales as select id from orders",
+		"create materialized view bad as select sum(total) from orders",
+		"create materialized view bad as select o.id, c.id from orders o join customers c on o.cust = c.id",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	if _, err := c.GetTableInfo("bad"); err == nil || c.getView("bad") != nil {
+		t.Errorf("expected the invalid views not to be created")
+	}
+
+	// the view and its contents survive a restart
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got, want := c2.String(), c.String(); got != want {
+		t.Errorf("unexpected catalog after a restart:\n%s", got)
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select total from sales where name = 'bob'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{301}) {
+		t.Errorf("expected the view after a restart, got %v", tups)
+	}
+	runSQLForTest(t, bp2, c2, "drop materialized view sales", noTransaction)
+	if _, err := c2.GetTableInfo("sales"); err == nil || c2.getView("sales") != nil {
+		t.Errorf("expected the view and its table to be dropped")
+	}
+}
@@ -1,14 +1,53 @@
 package godb
 
+/*
+mem_file.go implements MemFile, a DBFile that keeps its tuples in memory, one
+per page, e.g., the tuples of a temporary table (see temp_tables.go).
+
+The pages of a MemFile are not read through the buffer pool, so they are
+neither locked nor logged, and a MemFile must not be shared by concurrent
+transactions. Instead, the file keeps the changes of each transaction that
+has not ended, which are undone if the transaction aborts (see
+[MemFile.abort]). The page of a tuple that a running transaction deleted is
+not reused until the transaction commits, so that an abort can put the tuple
+back.
+*/
+
+import (
+	"fmt"
+	"sync"
+)
+
 type MemPage struct {
 	file  *MemFile
 	tuple Tuple
 }
 
 type MemFile struct {
-	fileNo int
-	desc   *TupleDesc
-	pages  []*MemPage
+	fileNo  int
+	desc    *TupleDesc
+	pages   []*MemPage
+	columns []columnInfo // declared types of the columns, or nil
+
+	// changes of the transactions that have not ended, in the order they were
+	// made, and the pages whose tuples they deleted
+	changes map[TransactionID][]memChange
+	deleted map[int]bool
+
+	sync.Mutex
+}
+
+// A change of a page of a MemFile: the tuple on the page before the change, or
+// nil if the change inserted the tuple on the page.
+type memChange struct {
+	pageNo int
+	old    *MemPage
+}
+
+// Create an empty MemFile with the specified fields, whose columns have the
+// specified declared types, or the default ones if columns is nil.
+func NewMemFile(desc *TupleDesc, columns []columnInfo) *MemFile {
+	return &MemFile{0, desc, nil, columns, make(map[TransactionID][]memChange), make(map[int]bool), sync.Mutex{}}
 }
 
 func (mp *MemPage) isDirty() bool {
@@ -23,27 +62,88 @@ func (mp *MemPage) getFile() DBFile {
 }
 
 func (mf *MemFile) NumPages() int {
+	mf.Lock()
+	defer mf.Unlock()
 	return len(mf.pages)
 }
 
+// Add the tuple to the first free page of the file, or to a new page at the
+// end of the file if no page is free, on behalf of tid.
 func (mf *MemFile) insertTuple(t *Tuple, tid TransactionID) error {
-	for i := range mf.pages {
-		if mf.pages[i] == nil {
-			t.Rid = i
-			mf.pages[i] = &MemPage{file: mf, tuple: *t}
+	if len(t.Fields) != len(mf.desc.Fields) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("expected %d fields, got %d", len(mf.desc.Fields), len(t.Fields))}
+	}
+	if err := checkColumnValues(mf.desc, mf.columns, t); err != nil {
+		return err
+	}
+	mf.Lock()
+	defer mf.Unlock()
+	pageNo := len(mf.pages)
+	for i, page := range mf.pages {
+		if page == nil && !mf.deleted[i] {
+			pageNo = i
+			break
 		}
 	}
-	t.Rid = len(mf.pages)
-	mf.pages = append(mf.pages, &MemPage{file: mf, tuple: *t})
+	if pageNo == len(mf.pages) {
+		mf.pages = append(mf.pages, nil)
+	}
+	t.Rid = pageNo
+	// the tuple is stored with the fields of the file, which may be qualified
+	// by another name than the fields it was inserted with
+	mf.pages[pageNo] = &MemPage{file: mf, tuple: Tuple{*mf.desc, t.Fields, pageNo}}
+	mf.changes[tid] = append(mf.changes[tid], memChange{pageNo, nil})
 	return nil
 }
 
+// Remove the tuple from its page on behalf of tid.
 func (mf *MemFile) deleteTuple(t *Tuple, tid TransactionID) error {
-	mf.pages[t.Rid.(int)] = nil
+	mf.Lock()
+	defer mf.Unlock()
+	pageNo, ok := t.Rid.(int)
+	if !ok || pageNo < 0 || pageNo >= len(mf.pages) || mf.pages[pageNo] == nil {
+		return GoDBError{TupleNotFoundError, "tuple is not in the file"}
+	}
+	mf.changes[tid] = append(mf.changes[tid], memChange{pageNo, mf.pages[pageNo]})
+	mf.pages[pageNo] = nil
+	mf.deleted[pageNo] = true
 	return nil
 }
 
+// Forget the changes of tid, which has committed, so that the pages of the
+// tuples it deleted can be reused.
+func (mf *MemFile) commit(tid TransactionID) {
+	mf.Lock()
+	defer mf.Unlock()
+	for _, ch := range mf.changes[tid] {
+		if ch.old != nil {
+			delete(mf.deleted, ch.pageNo)
+		}
+	}
+	delete(mf.changes, tid)
+}
+
+// Undo the changes of tid, which is aborting, in reverse order.
+func (mf *MemFile) abort(tid TransactionID) {
+	mf.Lock()
+	defer mf.Unlock()
+	changes := mf.changes[tid]
+	for i := len(changes) - 1; i >= 0; i-- {
+		ch := changes[i]
+		mf.pages[ch.pageNo] = ch.old
+		if ch.old != nil {
+			delete(mf.deleted, ch.pageNo)
+		}
+	}
+	delete(mf.changes, tid)
+}
+
 func (mf *MemFile) readPage(pageNo int) (Page, error) {
+	mf.Lock()
+	defer mf.Unlock()
+	if pageNo < 0 || pageNo >= len(mf.pages) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("page %d is not in the file", pageNo)}
+	}
 	return mf.pages[pageNo], nil
 }
 
@@ -67,6 +167,8 @@ func (mf *MemFile) Descriptor() *TupleDesc {
 func (mf *MemFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	i := 0
 	return func() (*Tuple, error) {
+		mf.Lock()
+		defer mf.Unlock()
 		for {
 			if i >= len(mf.pages) {
 				return nil, nil
@@ -78,16 +180,22 @@ func (mf *MemFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 			}
 
 			i++
-			return &page.tuple, nil
+			return &Tuple{*mf.desc, page.tuple.Fields, page.tuple.Rid}, nil
 		}
 	}, nil
 }
 
+// Return a MemFile with the specified tuples, which must not be empty, whose
+// fields are those of the first tuple. The tuples are not part of a
+// transaction.
 func CreateMemFileFromTuples(tuples []Tuple) *MemFile {
 	desc := tuples[0].Desc
-	file := &MemFile{desc: &desc, pages: make([]*MemPage, len(tuples))}
-	for _, t := range tuples {
-		file.insertTuple(&t, 0)
+	file := NewMemFile(&desc, nil)
+	file.pages = make([]*MemPage, 0, len(tuples))
+	for i := range tuples {
+		t := tuples[i]
+		t.Rid = i
+		file.pages = append(file.pages, &MemPage{file: file, tuple: t})
 	}
 	return file
 }
@@ -0,0 +1,84 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestMemFileFromTuples(t *testing.T) {
+	td, t1, t2 := makeTupleTestVars()
+	mf := CreateMemFileFromTuples([]Tuple{t1, t2})
+	if mf.NumPages() != 2 {
+		t.Fatalf("expected 2 pages, got %d", mf.NumPages())
+	}
+	iter, _ := mf.Iterator(0)
+	n := 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !tup.Desc.equals(&td) {
+			t.Errorf("unexpected descriptor %v", tup.Desc)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("expected 2 tuples, got %d", n)
+	}
+}
+
+func TestMemFileTransactions(t *testing.T) {
+	td, t1, t2 := makeTupleTestVars()
+	mf := NewMemFile(&td, nil)
+	count := func() int {
+		iter, _ := mf.Iterator(0)
+		n := 0
+		for tup, _ := iter(); tup != nil; tup, _ = iter() {
+			n++
+		}
+		return n
+	}
+
+	tid := NewTID()
+	for _, tup := range []Tuple{t1, t2, t1} {
+		if err := mf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	mf.commit(tid)
+
+	// a page freed by a running transaction is not reused by an insert
+	tid = NewTID()
+	first := Tuple{td, t1.Fields, 0}
+	if err := mf.deleteTuple(&first, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := mf.insertTuple(&t2, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if t2.Rid != 3 || mf.NumPages() != 4 {
+		t.Errorf("expected the insert to append page 3, got page %v of %d", t2.Rid, mf.NumPages())
+	}
+	if err := mf.deleteTuple(&first, tid); err == nil {
+		t.Errorf("expected the delete of a deleted tuple to fail")
+	}
+	mf.abort(tid)
+	if count() != 3 {
+		t.Errorf("expected the abort to restore 3 tuples, got %d", count())
+	}
+
+	// once the delete commits, the page is reused
+	tid = NewTID()
+	mf.deleteTuple(&first, tid)
+	mf.commit(tid)
+	tid = NewTID()
+	if err := mf.insertTuple(&t2, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if t2.Rid != 0 || mf.NumPages() != 4 {
+		t.Errorf("expected the insert to reuse page 0, got page %v of %d", t2.Rid, mf.NumPages())
+	}
+	mf.commit(tid)
+	if count() != 3 {
+		t.Errorf("expected 3 tuples, got %d", count())
+	}
+}
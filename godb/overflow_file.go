@@ -0,0 +1,538 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+/*
+Strings and blobs that are too large to store in a tuple on a heap page, e.g.,
+documents or JSON payloads bigger than a page, are kept in overflow pages. Every
+[HeapFile] has an overflowFile, a side file next to the heap file (the heap file
+name with a ".ovf" suffix). When a tuple does not fit on a page, its largest
+string or blob is stored in a chain of pages of that file, then the next
+largest, and so on until the tuple fits. The tuple on the heap page only holds
+an [overflowRef] in place of each such value, which is written where the
+length of the value would be:
+
++------------------------------------------------------------------+
+| -1 (4 bytes) | first page (4 bytes) | length of value (8 bytes)  |
++------------------------------------------------------------------+
+
+An overflow page begins with a header with four 32 bit integers: the next page
+of the chain (-1 on the last page), the number of bytes of the value on the
+page (-1 if the page is free), the version of the page format and a checksum,
+as on a heap page. The bytes of the value follow the header.
+
+Overflow pages are read and written through the BufferPool, are locked like
+heap pages, and are logged when the transaction that modified them commits, so
+that aborts and recovery restore the values along with the tuples that refer to
+them. A chain is written when its tuple is inserted, and freed when the tuple is
+deleted. Free pages are reused before the file is extended; they are found by
+reading the header of every page when the file is opened. Since the transaction
+that freed a page may still abort, a page is only reused once it is write
+locked and still free.
+*/
+type overflowFile struct {
+	heapFile    *HeapFile
+	backingFile string
+	numPages    int
+	free        map[int]bool // pages that may be free; checked when they are reused
+	sync.Mutex
+}
+
+type overflowPage struct {
+	next   int // next page of the chain, or -1 on the last page
+	data   []byte
+	free   bool
+	pageNo int
+	file   *overflowFile
+
+	dirty       bool
+	dirtier     TransactionID
+	beforeImage *overflowPage
+	sync.Mutex
+}
+
+const overflowHeaderSize = 16
+
+// Version of the overflow page format, stored in the page header. It differs
+// from heapPageVersion, so that a heap page is not mistaken for an overflow
+// page.
+const overflowPageVersion = 2
+
+// A reference to a string or blob stored in a chain of overflow pages, which
+// takes the place of the value in a tuple stored on a heap page. References are
+// replaced by the values they refer to before tuples leave the HeapFile.
+type overflowRef struct {
+	firstPage int
+	length    int
+}
+
+// Written in place of the length of a string to mark an overflowRef.
+const overflowMarker = -1
+
+// Number of bytes an overflowRef takes in a serialized tuple.
+const overflowRefSize = 16
+
+// References are not compared with other values.
+func (r overflowRef) EvalPred(v DBValue, op BoolOp) bool {
+	return false
+}
+
+// Write the reference to b, starting with overflowMarker.
+func (r overflowRef) writeTo(b *bytes.Buffer) error {
+	if err := binary.Write(b, binary.LittleEndian, int32(overflowMarker)); err != nil {
+		return err
+	}
+	if err := binary.Write(b, binary.LittleEndian, int32(r.firstPage)); err != nil {
+		return err
+	}
+	return binary.Write(b, binary.LittleEndian, int64(r.length))
+}
+
+// Read a reference from b, after its overflowMarker.
+func readOverflowRef(b *bytes.Buffer) (overflowRef, error) {
+	var firstPage int32
+	var length int64
+	if err := binary.Read(b, binary.LittleEndian, &firstPage); err != nil {
+		return overflowRef{}, err
+	}
+	if err := binary.Read(b, binary.LittleEndian, &length); err != nil {
+		return overflowRef{}, err
+	}
+	if firstPage < 0 || length < 0 {
+		return overflowRef{}, GoDBError{MalformedDataError, fmt.Sprintf("invalid overflow reference to page %d", firstPage)}
+	}
+	return overflowRef{int(firstPage), int(length)}, nil
+}
+
+// Return the number of bytes of a value that fit on an overflow page.
+func overflowPageCapacity() int {
+	return PageSize - overflowHeaderSize
+}
+
+// Return the bytes of a string or blob value.
+func overflowValue(v DBValue) (string, bool) {
+	switch v := v.(type) {
+	case StringField:
+		return v.Value, true
+	case BlobField:
+		return v.Value, true
+	}
+	return "", false
+}
+
+// Return the name of the overflow side file of the specified heap file.
+func overflowFileName(heapFile string) string {
+	return heapFile + ".ovf"
+}
+
+// Open the overflow file of a heap file, creating it if it does not exist, and
+// find its free pages.
+func newOverflowFile(hf *HeapFile) (*overflowFile, error) {
+	disk := hf.bufPool.DiskManager()
+	fileName := overflowFileName(hf.backingFile)
+	if err := disk.Open(fileName); err != nil {
+		return nil, err
+	}
+	// an empty heap file refers to no values, so the pages were left behind
+	// by a heap file that was removed
+	if hf.numPages == 0 {
+		if err := disk.Truncate(fileName, 0); err != nil {
+			return nil, err
+		}
+	}
+	size, err := disk.Size(fileName)
+	if err != nil {
+		return nil, err
+	}
+	f := &overflowFile{hf, fileName, int(size / int64(PageSize)), make(map[int]bool), sync.Mutex{}}
+
+	header := make([]byte, overflowHeaderSize)
+	for p := 0; p < f.numPages; p++ {
+		if _, err := disk.ReadAt(fileName, header, int64(p*PageSize)); err != nil {
+			return nil, err
+		}
+		if int32(binary.LittleEndian.Uint32(header[4:])) == -1 {
+			f.free[p] = true
+		}
+	}
+	return f, nil
+}
+
+// Overflow pages hold values rather than tuples; tuples are inserted through
+// the HeapFile.
+func (f *overflowFile) insertTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "cannot insert tuples into an overflow file"}
+}
+
+func (f *overflowFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "cannot delete tuples from an overflow file"}
+}
+
+func (f *overflowFile) Descriptor() *TupleDesc {
+	return &TupleDesc{}
+}
+
+func (f *overflowFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return nil, GoDBError{IllegalOperationError, "cannot iterate over an overflow file"}
+}
+
+// Return the number of pages in the overflow file
+func (f *overflowFile) NumPages() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.numPages
+}
+
+func (f *overflowFile) pageKey(pgNo int) any {
+	return heapHash{f.backingFile, pgNo}
+}
+
+func (f *overflowFile) readPage(pageNo int) (Page, error) {
+	b := make([]byte, PageSize)
+	n, err := f.heapFile.bufPool.DiskManager().ReadAt(f.backingFile, b, int64(pageNo*PageSize))
+	if err != nil {
+		return nil, err
+	}
+	if n != PageSize {
+		return nil, GoDBError{MalformedDataError, "not enough bytes read in ReadPage"}
+	}
+	return f.pageFromBuffer(pageNo, b)
+}
+
+// Construct the page with the specified page number from its serialized form.
+func (f *overflowFile) pageFromBuffer(pageNo int, b []byte) (Page, error) {
+	pg := newOverflowPage(pageNo, f)
+	if err := pg.initFromBuffer(bytes.NewBuffer(b)); err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+// Write the page to the backing file. The caller must hold the lock of the
+// file.
+func (f *overflowFile) writePage(pg *overflowPage) error {
+	buf, err := pg.toBuffer()
+	if err != nil {
+		return err
+	}
+	_, err = f.heapFile.bufPool.DiskManager().WriteAt(f.backingFile, buf.Bytes(), int64(pg.pageNo*PageSize))
+	return err
+}
+
+func (f *overflowFile) flushPage(p Page) error {
+	pg := p.(*overflowPage)
+	f.Lock()
+	defer f.Unlock()
+	if err := f.writePage(pg); err != nil {
+		return err
+	}
+	// recovery may write pages past the end of the file, and pages that were
+	// freed or reused since the file was opened
+	f.numPages = max(f.numPages, pg.pageNo+1)
+	if pg.free {
+		f.free[pg.pageNo] = true
+	} else {
+		delete(f.free, pg.pageNo)
+	}
+	return nil
+}
+
+// Return the page of the file with the specified number, locked with perm.
+func (f *overflowFile) getPage(pageNo int, tid TransactionID, perm RWPerm) (*overflowPage, error) {
+	pg, err := f.heapFile.bufPool.GetPage(f, pageNo, tid, perm)
+	if err != nil {
+		return nil, err
+	}
+	return pg.(*overflowPage), nil
+}
+
+// Take a page from the set of free pages, or append a free page to the end of
+// the file if there is none, and return its page number.
+func (f *overflowFile) takeFreePage() (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	for p := range f.free {
+		delete(f.free, p)
+		return p, nil
+	}
+	pg := newOverflowPage(f.numPages, f)
+	if err := f.writePage(pg); err != nil {
+		return 0, err
+	}
+	f.numPages++
+	return pg.pageNo, nil
+}
+
+// Return a free page of the file, write locked by tid.
+func (f *overflowFile) allocatePage(tid TransactionID) (*overflowPage, error) {
+	for {
+		pageNo, err := f.takeFreePage()
+		if err != nil {
+			return nil, err
+		}
+		pg, err := f.getPage(pageNo, tid, WritePerm)
+		if err != nil {
+			return nil, err
+		}
+		// the transaction that freed the page may have aborted, or another
+		// transaction may have reused it first
+		if pg.free {
+			return pg, nil
+		}
+	}
+}
+
+// Write value to a new chain of pages on behalf of tid, and return the first
+// page of the chain.
+func (f *overflowFile) writeValue(value string, tid TransactionID) (int, error) {
+	capacity := overflowPageCapacity()
+	next := -1
+	// the chain is written back to front, so that every page can point to the
+	// page after it; each page is modified right after it is got, since
+	// getting a page may evict the pages that were got before
+	for end := len(value); end > 0; {
+		start := (end - 1) / capacity * capacity
+		pg, err := f.allocatePage(tid)
+		if err != nil {
+			return 0, err
+		}
+		pg.free = false
+		pg.next = next
+		pg.data = []byte(value[start:end])
+		pg.setDirty(tid, true)
+		next = pg.pageNo
+		end = start
+	}
+	return next, nil
+}
+
+// Read the referenced value from its chain of pages, locking them with
+// ReadPerm on behalf of tid.
+func (f *overflowFile) readValue(ref overflowRef, tid TransactionID) (string, error) {
+	value := make([]byte, 0, ref.length)
+	for p := ref.firstPage; p != -1; {
+		if len(value) >= ref.length {
+			return "", GoDBError{MalformedDataError, fmt.Sprintf("overflow chain at page %d of %s is longer than its value", ref.firstPage, f.backingFile)}
+		}
+		pg, err := f.getPage(p, tid, ReadPerm)
+		if err != nil {
+			return "", err
+		}
+		if pg.free {
+			return "", GoDBError{MalformedDataError, fmt.Sprintf("overflow chain at page %d of %s contains free page %d", ref.firstPage, f.backingFile, p)}
+		}
+		value = append(value, pg.data...)
+		p = pg.next
+	}
+	if len(value) != ref.length {
+		return "", GoDBError{MalformedDataError, fmt.Sprintf("overflow chain at page %d of %s has %d bytes, expected %d", ref.firstPage, f.backingFile, len(value), ref.length)}
+	}
+	return string(value), nil
+}
+
+// Free the chain of pages of the referenced value on behalf of tid, so that
+// the pages can be reused.
+func (f *overflowFile) freeValue(ref overflowRef, tid TransactionID) error {
+	for p := ref.firstPage; p != -1; {
+		pg, err := f.getPage(p, tid, WritePerm)
+		if err != nil {
+			return err
+		}
+		if pg.free {
+			return GoDBError{MalformedDataError, fmt.Sprintf("overflow chain at page %d of %s contains free page %d", ref.firstPage, f.backingFile, p)}
+		}
+		p = pg.next
+		pg.free = true
+		pg.next = -1
+		pg.data = nil
+		pg.setDirty(tid, true)
+
+		f.Lock()
+		f.free[pg.pageNo] = true
+		f.Unlock()
+	}
+	return nil
+}
+
+// Return the tuple to store on a heap page for t: t itself if it fits on a
+// page, or else a copy of t in which the largest strings and blobs, one at a
+// time, are written to overflow pages and replaced by references to them,
+// until the copy fits. Returns an error without writing any pages if the tuple
+// does not fit on a page even so.
+func (f *HeapFile) storeOverflowValues(t *Tuple, tid TransactionID) (*Tuple, error) {
+	stored := t
+	for stored.size() > maxTupleSize() {
+		// only values longer than a reference make the tuple smaller
+		largest, length := -1, overflowRefSize
+		for i, v := range stored.Fields {
+			if s, ok := overflowValue(v); ok && len(s) > length {
+				largest, length = i, len(s)
+			}
+		}
+		if largest == -1 {
+			return nil, GoDBError{MalformedDataError, fmt.Sprintf("tuple of %d bytes does not fit on a page", stored.size())}
+		}
+		if stored == t {
+			stored = &Tuple{t.Desc, append([]DBValue{}, t.Fields...), nil}
+		}
+		stored.Fields[largest] = overflowRef{-1, length}
+	}
+	for i, v := range stored.Fields {
+		ref, ok := v.(overflowRef)
+		if !ok {
+			continue
+		}
+		s, _ := overflowValue(t.Fields[i])
+		first, err := f.overflow.writeValue(s, tid)
+		if err != nil {
+			return nil, err
+		}
+		ref.firstPage = first
+		stored.Fields[i] = ref
+	}
+	return stored, nil
+}
+
+// Return t, a tuple stored on a heap page, with the values it keeps in overflow
+// pages read back, or t itself if it has none.
+func (f *HeapFile) loadOverflowValues(t *Tuple, tid TransactionID) (*Tuple, error) {
+	loaded := t
+	for i, v := range t.Fields {
+		ref, ok := v.(overflowRef)
+		if !ok {
+			continue
+		}
+		s, err := f.overflow.readValue(ref, tid)
+		if err != nil {
+			return nil, err
+		}
+		if loaded == t {
+			loaded = &Tuple{t.Desc, append([]DBValue{}, t.Fields...), t.Rid}
+		}
+		if f.td.Fields[i].Ftype == BlobType {
+			loaded.Fields[i] = BlobField{s}
+		} else {
+			loaded.Fields[i] = StringField{s}
+		}
+	}
+	return loaded, nil
+}
+
+// Free the overflow pages of the values of t, a tuple stored on a heap page.
+func (f *HeapFile) freeOverflowValues(t *Tuple, tid TransactionID) error {
+	for _, v := range t.Fields {
+		if ref, ok := v.(overflowRef); ok {
+			if err := f.overflow.freeValue(ref, tid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Construct a new, free overflow page
+func newOverflowPage(pageNo int, f *overflowFile) *overflowPage {
+	pg := &overflowPage{next: -1, free: true, pageNo: pageNo, file: f, dirtier: -1}
+	pg.SetBeforeImage()
+	return pg
+}
+
+func (p *overflowPage) isDirty() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirty
+}
+
+func (p *overflowPage) setDirty(tid TransactionID, dirty bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.dirty = dirty
+	if dirty {
+		p.dirtier = tid
+	}
+}
+
+func (p *overflowPage) getDirtier() TransactionID {
+	p.Lock()
+	defer p.Unlock()
+	return p.dirtier
+}
+
+func (p *overflowPage) getFile() DBFile {
+	return p.file
+}
+
+// Returns the page number of the page.
+func (p *overflowPage) PageNo() int {
+	return p.pageNo
+}
+
+// Returns the before-image of the page, used for logging and recovery.
+func (p *overflowPage) BeforeImage() Page {
+	return p.beforeImage
+}
+
+// Sets the before-image of the page to a copy of the current state of the
+// page.
+func (p *overflowPage) SetBeforeImage() {
+	p.beforeImage = &overflowPage{
+		next:    p.next,
+		data:    append([]byte(nil), p.data...),
+		free:    p.free,
+		pageNo:  p.pageNo,
+		file:    p.file,
+		dirtier: -1,
+	}
+}
+
+// Write the page to a new PageSize buffer.
+func (p *overflowPage) toBuffer() (*bytes.Buffer, error) {
+	if len(p.data) > overflowPageCapacity() {
+		return nil, GoDBError{MalformedDataError, "buffer is greater than page size"}
+	}
+	page := make([]byte, PageSize)
+	length := int32(len(p.data))
+	if p.free {
+		length = -1
+	}
+	binary.LittleEndian.PutUint32(page[0:], uint32(int32(p.next)))
+	binary.LittleEndian.PutUint32(page[4:], uint32(length))
+	binary.LittleEndian.PutUint32(page[8:], overflowPageVersion)
+	copy(page[overflowHeaderSize:], p.data)
+	binary.LittleEndian.PutUint32(page[checksumOffset:], pageChecksum(page))
+	return bytes.NewBuffer(page), nil
+}
+
+// Read the contents of the page from the supplied buffer. Returns a
+// CorruptPageError if the checksum or the format version of the page is wrong.
+func (p *overflowPage) initFromBuffer(buf *bytes.Buffer) error {
+	page := buf.Bytes()
+	if len(page) != PageSize {
+		return GoDBError{CorruptPageError, fmt.Sprintf("overflow page %d has %d bytes, expected %d", p.pageNo, len(page), PageSize)}
+	}
+	if version := binary.LittleEndian.Uint32(page[8:]); version != overflowPageVersion {
+		return GoDBError{CorruptPageError, fmt.Sprintf("overflow page %d has unknown format version %d", p.pageNo, version)}
+	}
+	if sum := binary.LittleEndian.Uint32(page[checksumOffset:]); sum != pageChecksum(page) {
+		return GoDBError{CorruptPageError, fmt.Sprintf("overflow page %d has a bad checksum", p.pageNo)}
+	}
+	next := int(int32(binary.LittleEndian.Uint32(page[0:])))
+	length := int(int32(binary.LittleEndian.Uint32(page[4:])))
+	if length < -1 || length > overflowPageCapacity() {
+		return GoDBError{MalformedDataError, fmt.Sprintf("overflow page %d has invalid length %d", p.pageNo, length)}
+	}
+	p.next = next
+	p.free = length == -1
+	p.data = nil
+	if !p.free {
+		p.data = append([]byte(nil), page[overflowHeaderSize:overflowHeaderSize+length]...)
+	}
+	p.dirty = false
+	p.SetBeforeImage()
+	return nil
+}
@@ -0,0 +1,192 @@
+package godb
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// A table whose values may span several pages.
+const overflowTestTable = "create table docs (id int, body text, data blob)"
+
+// Return a tuple of the docs table whose body and data span several pages.
+func makeOverflowTestTuple(hf *HeapFile, id int) Tuple {
+	body := strings.Repeat(`{"key": "value", "n": 12345}, `, PageSize/10)
+	data := make([]byte, 2*PageSize+17)
+	for i := range data {
+		data[i] = byte(i * id)
+	}
+	return Tuple{*hf.Descriptor(), []DBValue{IntField{int64(id)}, StringField{body}, BlobField{string(data)}}, nil}
+}
+
+// Return the number of overflow pages needed to store the body and data of a
+// tuple.
+func overflowPagesForTest(tup Tuple) int {
+	pages := 0
+	for _, v := range tup.Fields[1:] {
+		s, _ := overflowValue(v)
+		pages += (len(s) + overflowPageCapacity() - 1) / overflowPageCapacity()
+	}
+	return pages
+}
+
+func TestOverflowValues(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, overflowTestTable)
+	hf := heapFileForTest(t, c, "docs")
+	big := makeOverflowTestTuple(hf, 1)
+	tid := BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &big, tid)
+	small := Tuple{*hf.Descriptor(), []DBValue{IntField{2}, StringField{"small"}, NullField{}}, nil}
+	insertTupleForTest(t, hf, &small, tid)
+	bp.CommitTransaction(tid)
+	if big.Fields[1].(StringField).Value != makeOverflowTestTuple(hf, 1).Fields[1].(StringField).Value {
+		t.Errorf("expected the inserted tuple to keep its values")
+	}
+	if hf.NumPages() != 1 {
+		t.Errorf("expected the tuples to fit on one heap page, got %d pages", hf.NumPages())
+	}
+	if n := hf.overflow.NumPages(); n != overflowPagesForTest(big) {
+		t.Errorf("expected %d overflow pages, got %d", overflowPagesForTest(big), n)
+	}
+
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runSQLForTest(t, bp, c, `insert into docs values (3, 'short', '\\x00ff')`, noTransaction)
+	tups := runSQLForTest(t, bp, c, "select id, body, data from docs", noTransaction)
+	if len(tups) != 3 {
+		t.Fatalf("expected 3 tuples, got %d", len(tups))
+	}
+	if tups[0].Fields[1] != big.Fields[1] || tups[0].Fields[2] != big.Fields[2] {
+		t.Errorf("large values were not read back intact")
+	}
+	if tups[2].Fields[2] != (BlobField{"\x00\xff"}) || tups[2].Fields[2].(BlobField).String() != `\x00ff` {
+		t.Errorf("unexpected blob %v", tups[2].Fields[2])
+	}
+	if _, err := castValue(StringField{`\xzz`}, BlobType); err == nil {
+		t.Errorf("expected an error converting invalid hex to a blob")
+	}
+
+	// the pages of deleted values are reused
+	runSQLForTest(t, bp, c, "delete from docs where id = 1", noTransaction)
+	if len(hf.overflow.free) != overflowPagesForTest(big) {
+		t.Errorf("expected delete to free %d overflow pages, got %d", overflowPagesForTest(big), len(hf.overflow.free))
+	}
+	again := makeOverflowTestTuple(hf, 4)
+	tid = BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &again, tid)
+	bp.CommitTransaction(tid)
+	if n := hf.overflow.NumPages(); n != overflowPagesForTest(big) {
+		t.Errorf("expected the overflow pages to be reused, got %d pages", n)
+	}
+
+	// the values are durable
+	bp.FlushAllPages()
+	_, c2 := openTestDatabase(t, disk, root)
+	hf2 := heapFileForTest(t, c2, "docs")
+	if len(hf2.overflow.free) != 0 {
+		t.Errorf("expected no free overflow pages after reopening, got %d", len(hf2.overflow.free))
+	}
+	if err := c2.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tups = runSQLForTest(t, hf2.bufPool, c2, "select id, body, data from docs where id = 4", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[1] != again.Fields[1] || tups[0].Fields[2] != again.Fields[2] {
+		t.Errorf("large values were not read back intact after reopening")
+	}
+}
+
+// Overflow pages are logged with the heap pages that refer to them, so that
+// committed values are recovered and aborted ones are rolled back.
+func TestOverflowRecovery(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t, overflowTestTable)
+	hf := heapFileForTest(t, c, "docs")
+	committed := makeOverflowTestTuple(hf, 1)
+	tid := BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &committed, tid)
+	bp.CommitTransaction(tid)
+
+	logged := 0
+	if err := bp.LogFile().seek(0, io.SeekStart); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter := bp.LogFile().ForwardIterator()
+	for r, err := iter(); r != nil || err != nil; r, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if u, ok := r.(*UpdateLogRecord); ok {
+			if _, ok := u.After.(*overflowPage); ok {
+				logged++
+			}
+		}
+	}
+	if logged != overflowPagesForTest(committed) {
+		t.Errorf("expected %d overflow pages to be logged, got %d", overflowPagesForTest(committed), logged)
+	}
+
+	// the pages were never flushed, so the values are only in the log
+	bp2, c2 := openTestDatabase(t, disk, root)
+	hf2 := heapFileForTest(t, c2, "docs")
+	tups := runQueryForTest(t, bp2, hf2, noTransaction)
+	if len(tups) != 1 || tups[0].Fields[1] != committed.Fields[1] || tups[0].Fields[2] != committed.Fields[2] {
+		t.Fatalf("expected the committed values to be recovered, got %d tuples", len(tups))
+	}
+
+	aborted := makeOverflowTestTuple(hf2, 2)
+	tid = BeginTransactionForTest(t, bp2)
+	insertTupleForTest(t, hf2, &aborted, tid)
+	bp2.AbortTransaction(tid)
+	if n := len(runQueryForTest(t, bp2, hf2, noTransaction)); n != 1 {
+		t.Errorf("expected 1 tuple after abort, got %d", n)
+	}
+	_, c3 := openTestDatabase(t, disk, root)
+	hf3 := heapFileForTest(t, c3, "docs")
+	if len(hf3.overflow.free) != overflowPagesForTest(aborted) {
+		t.Errorf("expected the pages of the aborted value to be free, got %d free pages", len(hf3.overflow.free))
+	}
+}
+
+// A tuple of values that each fit on a page, but not together, has its largest
+// values moved to overflow pages until it fits.
+func TestOverflowWideTuple(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	var td TupleDesc
+	var fields []DBValue
+	for i := 0; i < 5; i++ {
+		td.Fields = append(td.Fields, FieldType{fmt.Sprintf("c%d", i), "", StringType})
+		fields = append(fields, StringField{strings.Repeat(string(rune('a'+i)), 1000+i)})
+	}
+	f, err := c.addTable("wide", td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := f.(*HeapFile)
+	tup := Tuple{td, fields, nil}
+	tid := BeginTransactionForTest(t, bp)
+	insertTupleForTest(t, hf, &tup, tid)
+	bp.CommitTransaction(tid)
+
+	if n := hf.overflow.NumPages(); n != 1 {
+		t.Errorf("expected only the largest value to be moved to an overflow page, got %d pages", n)
+	}
+	tid = BeginTransactionForTest(t, bp)
+	pg, err := bp.GetPage(hf, 0, tid, ReadPerm)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := pg.(*heapPage).tuples[0].Fields[4].(overflowRef); !ok {
+		t.Errorf("expected the largest value to be stored in overflow pages")
+	}
+	bp.CommitTransaction(tid)
+	tups := runQueryForTest(t, bp, hf, noTransaction)
+	if len(tups) != 1 {
+		t.Fatalf("expected 1 tuple, got %d", len(tups))
+	}
+	for i, v := range tups[0].Fields {
+		if v != fields[i] {
+			t.Errorf("value %d was not read back intact", i)
+		}
+	}
+}
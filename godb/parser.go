@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -29,6 +30,7 @@ const (
 	ExprFunc  SelectExprType = iota
 	ExprStar  SelectExprType = iota
 	ExprAggr  SelectExprType = iota
+	ExprNull  SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -59,6 +61,13 @@ func NewConstSelectNode(value string, alias string) LogicalSelectNode {
 	return lsn
 }
 
+func NewNullSelectNode(alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprNull
+	lsn.alias = alias
+	return lsn
+}
+
 func NewStarSelectNode(table string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprStar
@@ -98,6 +107,8 @@ func (t SelectExprType) String() string {
 		return "ExprStar"
 	case ExprAggr:
 		return "ExprAggr"
+	case ExprNull:
+		return "ExprNull"
 	default:
 		return "Unknown"
 	}
@@ -119,6 +130,10 @@ func (op BoolOp) String() string {
 		return "<"
 	case OpLike:
 		return " LIKE "
+	case OpIsNull:
+		return " IS "
+	case OpIsNotNull:
+		return " IS NOT "
 	default:
 		return "??"
 	}
@@ -182,7 +197,7 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 // If catalog is non null, will try to resolve table name from catalog
 // otherwise, will not.
 func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
-	if lsn.exprType == ExprConst {
+	if lsn.exprType == ExprConst || lsn.exprType == ExprNull {
 		return "", "", nil
 	}
 	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
@@ -298,6 +313,22 @@ func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, e
 			return []*LogicalFilterNode{{*left, *right, op}}, nil, nil
 		}
 
+	case *sqlparser.IsExpr:
+		var op BoolOp
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			op = OpIsNull
+		case sqlparser.IsNotNullStr:
+			op = OpIsNotNull
+		default:
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported predicate %s", expr.Operator)}
+		}
+		left, err := parseExpr(c, expr.Expr, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*LogicalFilterNode{{*left, NewNullSelectNode(""), op}}, nil, nil
+
 	default:
 		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
 	}
@@ -321,6 +352,19 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 			}
 		case sqlparser.SimpleTableExpr:
 			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
+			if v := c.getView(tableName); v != nil && !v.materialized {
+				// a view is planned like a subquery, whose alias is the
+				// name of the view unless it is given another one
+				subplan, err := v.plan(c)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
+				if subplan.alias == "" {
+					subplan.alias = tableName
+				}
+				return nil, []*LogicalPlan{subplan}, nil, nil
+			}
 			//fmt.Printf("got simple table, name %s\n", tableName)
 			dbFile, err := c.GetTable(tableName)
 			if err != nil {
@@ -431,6 +475,32 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		exprList[1] = right
 		outer := NewFuncSelectNode(opname, exprList, alias)
 		return &outer, nil
+	case *sqlparser.UnaryExpr:
+		switch expr.Operator {
+		case sqlparser.UPlusStr:
+			return parseExpr(c, expr.Expr, alias)
+		case sqlparser.UMinusStr:
+			if val, ok := expr.Expr.(*sqlparser.SQLVal); ok && (val.Type == sqlparser.IntVal || val.Type == sqlparser.FloatVal) {
+				// a negative number, e.g., -1.5
+				str := string(val.Val)
+				if strings.HasPrefix(str, "-") {
+					str = str[1:]
+				} else {
+					str = "-" + str
+				}
+				field := NewConstSelectNode(str, alias)
+				return &field, nil
+			}
+			// the negation of any other expression is 0 - expr
+			arg, err := parseExpr(c, expr.Expr, "")
+			if err != nil {
+				return nil, err
+			}
+			zero := NewConstSelectNode("0", "")
+			outer := NewFuncSelectNode("-", []*LogicalSelectNode{&zero, arg}, alias)
+			return &outer, nil
+		}
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s", expr.Operator)}
 	case *sqlparser.ParenExpr:
 		return parseExpr(c, expr.Expr, alias)
 	case *sqlparser.ColName:
@@ -445,12 +515,19 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		return &field, nil
 	case *sqlparser.SQLVal:
 		str := sqlparser.String(expr)
-		if str[0] == '\'' {
-			str = str[1 : len(str)-1]
-			//str = str[-1]
+		if expr.Type == sqlparser.StrVal {
+			// the unescaped value, e.g., \x00ff for a blob written '\\x00ff'
+			str = string(expr.Val)
 		}
 		field := NewConstSelectNode(str, alias)
 		return &field, nil
+	case sqlparser.BoolVal:
+		// converted to a bool when compared with or inserted into a bool field
+		field := NewConstSelectNode(strconv.FormatBool(bool(expr)), alias)
+		return &field, nil
+	case *sqlparser.NullVal:
+		field := NewNullSelectNode(alias)
+		return &field, nil
 	default:
 		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
 	}
@@ -685,9 +762,13 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		var fval DBValue
 		constType := StringType
 		intFval, e := strconv.Atoi(s.value)
+		floatFval, fe := strconv.ParseFloat(s.value, 64)
 		if e == nil {
 			constType = IntType
 			fval = IntField{int64(intFval)}
+		} else if fe == nil && strings.ContainsAny(s.value, "0123456789") { // not "inf" or "nan"
+			constType = FloatType
+			fval = FloatField{floatFval}
 		} else {
 			fval = StringField{s.value}
 		}
@@ -697,6 +778,13 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		}
 		ce := ConstExpr{fval, constType}
 		return &ce, fieldName, nil
+	case ExprNull:
+		fieldName := "null"
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		ce := ConstExpr{NullField{}, UnknownType}
+		return &ce, fieldName, nil
 	case ExprFunc:
 		fieldName := *s.funcOp
 		if s.alias != "" {
@@ -757,6 +845,10 @@ func opToStr(op BoolOp) string {
 		return "<"
 	case OpLike:
 		return " LIKE "
+	case OpIsNull:
+		return " IS "
+	case OpIsNotNull:
+		return " IS NOT "
 
 	}
 	return "??"
@@ -776,6 +868,10 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 		indent = indent + "\t"
 		OutputPhysicalPlan(printf, *op.left, indent)
 		OutputPhysicalPlan(printf, *op.right, indent)
+	case *IndexJoin:
+		printf("%sIndex Join, %+v == %s.%s using %s, card:%d\n", indent, exprToStr(op.outerField), op.inner.BackingFile(), op.index.column, op.index.name, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.outer, indent)
 	case *Project:
 		selectStr := ""
 		for _, ex := range op.selectFields {
@@ -793,6 +889,19 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 	case *HeapFile:
 		printf("%sHeap Scan %s, card:%d\n", indent, op.BackingFile(), oc.Cardinality)
 
+	case *ColumnFile:
+		printf("%sColumn Scan %s, card:%d\n", indent, op.BackingFile(), oc.Cardinality)
+
+	case *ColumnScan:
+		colStr := ""
+		for _, col := range op.cols {
+			colStr += op.file.Descriptor().Fields[col].Fname + ","
+		}
+		printf("%sColumn Scan %s (%s), card:%d\n", indent, op.file.BackingFile(), colStr, oc.Cardinality)
+
+	case *IndexScan:
+		printf("%sIndex Scan %s on %s, %s %s %v, card:%d\n", indent, op.index.name, op.file.BackingFile(), op.index.column, opToStr(op.op), op.value, oc.Cardinality)
+
 	case *OrderBy:
 		orderStr := ""
 		if len(op.orderBy) > 0 {
@@ -881,10 +990,136 @@ type TableAndField struct {
 	field string
 }
 
+// Return an index scan that can replace the filter "field op value" over
+// child, or nil if child is not a base table, there is no index on the field
+// that supports op, or the table statistics say that a scan is cheaper.
+func chooseIndexScan(c *Catalog, child *OperatorCard, field Expr, op BoolOp, value Expr, stats Stats, sel float64) *IndexScan {
+	hf, ok := child.Op.(*HeapFile)
+	if !ok {
+		return nil
+	}
+	fieldExpr, ok := field.(*FieldExpr)
+	if !ok {
+		return nil
+	}
+	constExpr, ok := value.(*ConstExpr)
+	if !ok || constExpr.constType != fieldExpr.selectField.Ftype {
+		return nil
+	}
+	ts, ok := stats.(*TableStats)
+	if !ok {
+		return nil
+	}
+	t, err := c.GetTableInfoDBFile(hf)
+	if err != nil {
+		return nil
+	}
+	idx := c.findIndex(t.name, fieldExpr.selectField.Fname, op)
+	if idx == nil {
+		return nil
+	}
+	if ts.EstimateIndexScanCost(sel) >= ts.EstimateScanCost() {
+		return nil
+	}
+	scan, err := NewIndexScan(hf, idx, op, constExpr.val)
+	if err != nil {
+		return nil
+	}
+	return scan
+}
+
+// Return an index nested loops join that can replace the equality join of
+// outer and inner on "outerField = innerField", or nil if inner is not a base
+// table, there is no index on innerField that supports equality lookups, or the
+// table statistics say that reading all of inner is cheaper than probing the
+// index once per outer tuple.
+func chooseIndexJoin(c *Catalog, outer *OperatorCard, outerField Expr, inner *OperatorCard, innerField Expr, stats Stats, innerLeft bool) *IndexJoin {
+	hf, ok := inner.Op.(*HeapFile)
+	if !ok {
+		return nil
+	}
+	fieldExpr, ok := innerField.(*FieldExpr)
+	if !ok {
+		return nil
+	}
+	ts, ok := stats.(*TableStats)
+	if !ok {
+		return nil
+	}
+	t, err := c.GetTableInfoDBFile(hf)
+	if err != nil {
+		return nil
+	}
+	idx := c.findIndex(t.name, fieldExpr.selectField.Fname, OpEq)
+	if idx == nil {
+		return nil
+	}
+	if ts.EstimateIndexJoinCost(fieldExpr.selectField.Fname, outer.Cardinality) >= ts.EstimateScanCost() {
+		return nil
+	}
+	join, err := NewIndexJoin(outer, outerField, hf, idx, innerLeft)
+	if err != nil {
+		return nil
+	}
+	return join
+}
+
+// Return the names of the columns of table t that the plan references, or nil if
+// the plan references all of them with a *. Unqualified names are assumed to
+// refer to every table of the plan, so the result may include columns that are
+// not needed, or names that are not columns of t.
+func (p *LogicalPlan) referencedFields(t *LogicalTableNode) []string {
+	var fields []string
+	all := false
+	var visit func(n *LogicalSelectNode)
+	visit = func(n *LogicalSelectNode) {
+		if n == nil {
+			return
+		}
+		if n.table == "" || n.table == t.tableName || n.table == t.alias {
+			switch n.exprType {
+			case ExprStar:
+				all = true
+			case ExprField:
+				fields = append(fields, n.field)
+			}
+		}
+		for _, arg := range n.args {
+			visit(arg)
+		}
+	}
+	for _, f := range p.filters {
+		visit(&f.fieldExpr)
+		visit(&f.constExpr)
+	}
+	for _, j := range p.joins {
+		visit(j.left)
+		visit(j.right)
+	}
+	for _, s := range p.selects {
+		visit(s)
+	}
+	for _, a := range p.aggs {
+		visit(a)
+	}
+	for _, g := range p.groupByFields {
+		visit(g.expr)
+	}
+	for _, o := range p.orderByFields {
+		visit(o.expr)
+	}
+	visit(p.limit)
+	if all {
+		return nil
+	}
+	return fields
+}
+
 func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	tableMap := make(map[string]*PlanNode) // mapping from table aliases to operators
 	tableStats := make(map[string]Stats)   // mapping from table aliases to table stats
 	sel := make(map[string]float64)        // mapping from table aliases to selectivities
+	baseTables := make(map[string]string)  // mapping from table aliases to table names
 
 	for _, p := range plan.subqueries {
 		subPhysP, err := makePhysicalPlan(c, p)
@@ -899,10 +1134,10 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	}
 
 	for _, t := range plan.tables {
-		var stats Stats
-		stats = c.GetTableStats(t.tableName)
-		if stats == nil {
-			stats = &DummyStats{}
+		// tables without statistics, e.g., system tables, use dummy ones
+		var stats Stats = &DummyStats{}
+		if ts := c.GetTableStats(t.tableName); ts != nil {
+			stats = ts
 		}
 
 		name := t.tableName
@@ -910,6 +1145,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			name = t.alias
 		}
 		tableStats[name] = stats
+		baseTables[name] = t.tableName
 
 		td := (*t.file).Descriptor()
 		td.setTableAlias(name)
@@ -918,7 +1154,14 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if stats != nil {
 			card = stats.EstimateCardinality(1.0)
 		}
-		tableMap[name] = &PlanNode{NewOperatorCard(*t.file, card), td}
+		// column tables only read the columns the query references
+		scan := Operator(*t.file)
+		if cf, ok := scan.(*ColumnFile); ok {
+			if fields := plan.referencedFields(t); fields != nil {
+				scan = NewColumnScan(cf, fields)
+			}
+		}
+		tableMap[name] = &PlanNode{NewOperatorCard(scan, card), td}
 		sel[name] = 1.0
 	}
 
@@ -940,6 +1183,9 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		if constExpr, ok := rightExpr.(*ConstExpr); ok {
+			rightExpr = constExpr.castTo(leftExpr.GetExprType().Ftype)
+		}
 
 		op := node.op
 		desc := *op.Descriptor()
@@ -960,9 +1206,14 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 		sel[table] *= filterSel
 
-		newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, op)
-		if err != nil {
-			return nil, err
+		var newOp Operator
+		if scan := chooseIndexScan(c, op, leftExpr, f.predOp, rightExpr, table_stats, filterSel); scan != nil {
+			newOp = scan
+		} else {
+			newOp, err = NewFilter(rightExpr, f.predOp, leftExpr, op)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		tableMap[table] = &PlanNode{NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel)), &desc}
@@ -992,10 +1243,12 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 
 		join_order[i] = &JoinNode{
-			leftTable:  TableInfo{leftName, leftStats, sel[leftName]},
-			leftField:  leftField,
-			rightTable: TableInfo{rightName, rightStats, sel[rightName]},
-			rightField: rightField,
+			leftTable:   TableInfo{leftName, leftStats, sel[leftName]},
+			leftField:   leftField,
+			leftUnique:  c.isUniqueColumn(baseTables[leftName], leftField),
+			rightTable:  TableInfo{rightName, rightStats, sel[rightName]},
+			rightField:  rightField,
+			rightUnique: c.isUniqueColumn(baseTables[rightName], rightField),
 		}
 		selects[TableAndField{leftName, leftField}] = j.left
 		selects[TableAndField{rightName, rightField}] = j.right
@@ -1010,6 +1263,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	}
 
 	//finally apply joins
+	joined := make(map[string]bool) // tables that have been joined with another
 	for _, j := range join_order {
 		left := selects[TableAndField{j.leftTable.name, j.leftField}]
 		right := selects[TableAndField{j.rightTable.name, j.rightField}]
@@ -1055,12 +1309,23 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			return nil, err
 		}
 
-		newOp, err := NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
-		if err != nil {
-			return nil, err
+		var newOp Operator
+		if join := chooseIndexJoin(c, op1, leftExpr, op2, rightExpr, tableStats[rTabName], false); join != nil {
+			newOp = join
+		} else if join := chooseIndexJoin(c, op2, rightExpr, op1, leftExpr, tableStats[lTabName], true); join != nil {
+			newOp = join
+		} else {
+			newOp, err = NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		newNode := &PlanNode{NewOperatorCard(newOp, EstimateJoinCardinality(node1.op.Cardinality, node2.op.Cardinality)), newOp.Descriptor()}
+		// the values of a field of a table that has been joined may repeat
+		unique1 := !joined[lTabName] && c.isUniqueColumn(baseTables[lTabName], lFieldName)
+		unique2 := !joined[rTabName] && c.isUniqueColumn(baseTables[rTabName], rFieldName)
+		joined[lTabName], joined[rTabName] = true, true
+		newNode := &PlanNode{NewOperatorCard(newOp, EstimateJoinCardinality(node1.op.Cardinality, node2.op.Cardinality, unique1, unique2)), newOp.Descriptor()}
 		for key, node := range tableMap {
 			if node.op == op1 {
 				tableMap[key] = newNode
@@ -1135,6 +1400,11 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 				if err != nil {
 					return nil, err
 				}
+				if fieldName == "*" {
+					// COUNT(*) counts every tuple, while COUNT(field)
+					// skips tuples where field is NULL
+					aggExpr = &ConstExpr{IntField{1}, IntType}
+				}
 
 				switch *s.funcOp {
 				case "max":
@@ -1247,14 +1517,25 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 }
 
 func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
-	if insStmt.Columns != nil {
-		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
-	}
 	tab := insStmt.Table.Name
 	file, err := c.GetTable(sqlparser.String(tab))
 	if err != nil {
 		return nil, err
 	}
+	if err := c.checkNotMaterialized(sqlparser.String(tab)); err != nil {
+		return nil, err
+	}
+	// the columns that an insert leaves out are set to their defaults
+	newInsertOp := func(child Operator) (Operator, error) {
+		if insStmt.Columns == nil {
+			return NewInsertOp(file, child), nil
+		}
+		columns := make([]string, len(insStmt.Columns))
+		for i, col := range insStmt.Columns {
+			columns[i] = col.String()
+		}
+		return NewInsertOpWithColumns(file, child, columns)
+	}
 
 	switch stmt := insStmt.Rows.(type) {
 	case sqlparser.Values:
@@ -1275,8 +1556,7 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 			exprAr = append(exprAr, tupAr)
 		}
 		iterOp := NewValueOp(exprAr)
-		insertOp := NewInsertOp(file, iterOp)
-		return insertOp, nil
+		return newInsertOp(iterOp)
 
 	case *sqlparser.Select:
 		plan, err := parseStatement(c, stmt)
@@ -1288,38 +1568,45 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 			return nil, err
 		}
 
-		insertOp := NewInsertOp(file, op)
-		return insertOp, nil
+		return newInsertOp(op)
 	}
 	return nil, nil
 }
 
-func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
-	if len(delStmt.TableExprs) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+// Plan a scan of the single table in tableExprs that returns the records that
+// satisfy where, for a statement such as DELETE that modifies those records.
+// Returns the file of the table, the scan, and the table map used to generate
+// expressions over the table. what describes the statement in error messages.
+func parseTableScan(c *Catalog, tableExprs sqlparser.TableExprs, where *sqlparser.Where, what string) (DBFile, Operator, map[string]*PlanNode, error) {
+	multipleTables := GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", what)}
+	if len(tableExprs) > 1 {
+		return nil, nil, nil, multipleTables
 	}
-	tables, subplans, joins, err := parseFrom(c, delStmt.TableExprs[0])
+	tables, subplans, joins, err := parseFrom(c, tableExprs[0])
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if len(tables) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, multipleTables
 	}
 	if subplans != nil || joins != nil {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, multipleTables
+	}
+	if err := c.checkNotMaterialized(tables[0].tableName); err != nil {
+		return nil, nil, nil, err
 	}
 
 	tableMap := make(map[string]*PlanNode)
 	tableMap[tables[0].tableName] = &PlanNode{&OperatorCard{Op: *tables[0].file, Cardinality: 0}, (*tables[0].file).Descriptor()}
 
 	var filters []*LogicalFilterNode = make([]*LogicalFilterNode, 0)
-	if delStmt.Where != nil {
-		filters, joins, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
+	if where != nil {
+		filters, joins, err = parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		if joins != nil {
-			return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+			return nil, nil, nil, multipleTables
 		}
 	}
 	var newOp Operator
@@ -1327,19 +1614,22 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 	for _, f := range filters {
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, subplans, tables)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
+		}
+		if constExpr, ok := rightExpr.(*ConstExpr); ok {
+			rightExpr = constExpr.castTo(leftExpr.GetExprType().Ftype)
 		}
 
 		//op := node.op
@@ -1348,11 +1638,43 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 		//newInt, _ := strconv.Atoi(f.constVal)
 		newOp, err = NewFilter(rightExpr, f.predOp, leftExpr, newOp)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 
-	return NewDeleteOp(*tables[0].file, newOp), nil
+	return *tables[0].file, newOp, tableMap, nil
+}
+
+func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
+	file, scan, _, err := parseTableScan(c, delStmt.TableExprs, delStmt.Where, "deleting from")
+	if err != nil {
+		return nil, err
+	}
+	return NewDeleteOp(file, scan), nil
+}
+
+func parseUpdate(c *Catalog, updStmt *sqlparser.Update) (Operator, error) {
+	if len(updStmt.OrderBy) > 0 || updStmt.Limit != nil {
+		return nil, GoDBError{ParseError, "godb does not support ORDER BY or LIMIT in UPDATE"}
+	}
+	file, scan, tableMap, err := parseTableScan(c, updStmt.TableExprs, updStmt.Where, "updating")
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(updStmt.Exprs))
+	exprs := make([]Expr, len(updStmt.Exprs))
+	for i, upd := range updStmt.Exprs {
+		fields[i] = upd.Name.Name.Lowered()
+		sel, err := parseExpr(c, upd.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		exprs[i], _, err = sel.generateExpr(c, file.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewUpdateOp(file, scan, fields, exprs)
 }
 
 type QueryType int
@@ -1364,38 +1686,346 @@ const (
 	AbortXactionType     QueryType = iota
 	CreateTableQueryType QueryType = iota
 	DropTableQueryType   QueryType = iota
+	CreateIndexQueryType QueryType = iota
+	DropIndexQueryType   QueryType = iota
+	VacuumQueryType      QueryType = iota
+	TruncateQueryType    QueryType = iota
+	AlterTableQueryType  QueryType = iota
+	CreateViewQueryType  QueryType = iota
+	DropViewQueryType    QueryType = iota
+	RefreshViewQueryType QueryType = iota
+	CopyQueryType        QueryType = iota
 	UnknownQueryType     QueryType = iota
 )
 
-func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
+// sqlparser accepts CREATE INDEX and DROP INDEX but throws away everything
+// except the table name, so these statements are matched before parsing.
+var (
+	createIndexRe = regexp.MustCompile(`(?is)^\s*create\s+index\s+(\w+)(?:\s+using\s+(\w+))?\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)(?:\s+using\s+(\w+))?\s*$`)
+	dropIndexRe   = regexp.MustCompile(`(?is)^\s*drop\s+index\s+(\w+)(?:\s+on\s+(\w+))?\s*$`)
+)
+
+// sqlparser accepts CREATE VIEW and DROP VIEW but throws away the query of the
+// view, and does not know materialized views, so these statements are matched
+// before parsing.
+var (
+	createViewRe  = regexp.MustCompile(`(?is)^\s*create\s+(materialized\s+)?view\s+(\w+)\s+as\s+(select\b.*)$`)
+	dropViewRe    = regexp.MustCompile(`(?is)^\s*drop\s+(materialized\s+)?view\s+(\w+)\s*$`)
+	refreshViewRe = regexp.MustCompile(`(?is)^\s*refresh\s+materialized\s+view\s+(\w+)\s*$`)
+)
+
+// Process a CREATE VIEW, DROP VIEW or REFRESH MATERIALIZED VIEW statement. A
+// refresh runs on behalf of tid (see [ParseInTransaction]). Returns false if
+// the query is not a view statement.
+func processViewDDL(c *Catalog, query string, tid TransactionID) (QueryType, bool, error) {
+	if m := createViewRe.FindStringSubmatch(query); m != nil {
+		create := c.createView
+		if m[1] != "" {
+			create = c.createMaterializedView
+		}
+		if err := create(tid, strings.ToLower(m[2]), m[3]); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return CreateViewQueryType, true, nil
+	}
+	if m := dropViewRe.FindStringSubmatch(query); m != nil {
+		drop := c.dropView
+		if m[1] != "" {
+			drop = c.dropMaterializedView
+		}
+		if err := drop(tid, strings.ToLower(m[2])); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return DropViewQueryType, true, nil
+	}
+	if m := refreshViewRe.FindStringSubmatch(query); m != nil {
+		if err := c.refreshMaterializedView(tid, strings.ToLower(m[1])); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return RefreshViewQueryType, true, nil
+	}
+	return UnknownQueryType, false, nil
+}
+
+// sqlparser does not know the COPY statement, which bulk loads a CSV or JSON
+// Lines file into a table (see bulk_load.go and jsonl_load.go), e.g., "copy t
+// from 'data.csv' with (delimiter '|', header)" or "copy t from 'data.jsonl'
+// with (format jsonl)", or writes the result of a query to a file (see copy_to_op.go),
+// e.g., "copy (select a from t) to 'a.tsv' with (format tsv, header)" or "copy t
+// to 't.jsonl' with (format jsonl)".
+var (
+	copyRe       = regexp.MustCompile(`(?is)^\s*copy\s+(\w+)\s+from\s+'((?:[^']|'')*)'(?:\s+with)?\s*(?:\((.*)\))?\s*$`)
+	copyToRe     = regexp.MustCompile(`(?is)^\s*copy\s+(?:\((.*)\)|(\w+))\s+to\s+'((?:[^']|'')*)'(?:\s+with)?\s*(?:\((.*)\))?\s*$`)
+	copyOptionRe = regexp.MustCompile(`(?is)^\s*(?:(delimiter)\s+'([^']|'')'|(header)(?:\s+(true|false))?|format\s+(\w+))\s*(?:,|$)`)
+)
+
+// The options of a COPY statement.
+type copyOptions struct {
+	format    string // "csv", unless a FORMAT option selects another
+	sep       string // separator of the fields, or "" if there is no DELIMITER option
+	hasHeader bool
+}
+
+// Return the options of a COPY statement, whose default is the csv format
+// without a header.
+func parseCopyOptions(options string) (copyOptions, error) {
+	opts := copyOptions{"csv", "", false}
+	for rest := options; strings.TrimSpace(rest) != ""; {
+		m := copyOptionRe.FindStringSubmatch(rest)
+		if m == nil {
+			return opts, GoDBError{ParseError, fmt.Sprintf("invalid COPY options '%s'", options)}
+		}
+		if m[1] != "" {
+			opts.sep = strings.ReplaceAll(m[2], "''", "'")
+		}
+		if m[3] != "" {
+			opts.hasHeader = !strings.EqualFold(m[4], "false")
+		}
+		if m[5] != "" {
+			opts.format = strings.ToLower(m[5])
+		}
+		rest = rest[len(m[0]):]
+	}
+	return opts, nil
+}
+
+// Return the operator of a COPY TO statement that writes the result of query,
+// or of the named table if query is empty, to the file at path.
+func parseCopyTo(c *Catalog, query string, table string, path string, options string) (*CopyToOp, error) {
+	opts, err := parseCopyOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if opts.sep != "" {
+		return nil, GoDBError{ParseError, "COPY TO does not have a DELIMITER option"}
+	}
+	if query == "" {
+		query = "select * from " + table
+	}
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, "COPY TO requires a SELECT query"}
+	}
+	plan, err := parseStatement(c, sel)
+	if err != nil {
+		return nil, err
+	}
+	op, err := makePhysicalPlan(c, plan)
+	if err != nil {
+		return nil, err
+	}
+	return NewCopyToOp(op, path, opts.format, opts.hasHeader)
+}
+
+// sqlparser does not know the VACUUM statement, which compacts a table.
+var vacuumRe = regexp.MustCompile(`(?is)^\s*vacuum\s+(\w+)\s*$`)
+
+// sqlparser does not know the bool and boolean column types, so CREATE TABLE
+// statements declare them as bit columns instead, which [parseColumnType]
+// reads as bools. It also does not accept the USING clause that selects the
+// storage method of a table, which is removed before parsing, and requires
+// UNIQUE keys to be named, so unnamed ones are given a name, which is unused.
+// FOREIGN KEY constraints, which it does not know, are removed before parsing
+// (see [extractForeignKeys]), and the DEFAULT values it does not know, negative
+// numbers and bools, are quoted, which [normalizeDefault] accepts. The
+// TEMPORARY keyword of CREATE TEMPORARY TABLE is also removed before parsing.
+var (
+	temporaryTableRe   = regexp.MustCompile(`(?is)^(\s*create\s+)temp(?:orary)?\s+(table\b.*)$`)
+	createTableRe      = regexp.MustCompile(`(?is)^\s*create\s+table\b`)
+	boolColumnRe       = regexp.MustCompile(`(?i)([(,]\s*\w+\s+)bool(?:ean)?\b`)
+	usingClauseRe      = regexp.MustCompile(`(?is)^(.*\))\s*using\s+(\w+)\s*$`)
+	uniqueKeyRe        = regexp.MustCompile(`(?i)(,\s*)unique\s*\(`)
+	signedDefaultRe    = regexp.MustCompile(`(?i)(\sdefault\s+)(-\d[\d.]*|true|false)\b`)
+	foreignKeyClauseRe = regexp.MustCompile(`(?is),\s*(?:constraint\s+\w+\s+)?foreign\s+key\s*(?:\w+\s*)?\(([\w\s,]+)\)\s*references\s+(\w+)\s*(?:\(([\w\s,]+)\))?(?:\s*on\s+delete\s+(restrict|cascade|set\s+default|no\s+action))?`)
+)
+
+// sqlparser accepts ALTER TABLE but throws away everything except the table
+// name, so ADD COLUMN, DROP COLUMN and RENAME COLUMN are matched before
+// parsing. The default value of an added column is a quoted string or a bare
+// value, e.g., 'abc', 1.5, true or null, and becomes the DEFAULT of the column.
+var (
+	alterAddColumnRe    = regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\w+)\s+add\s+(?:column\s+)?(\w+)\s+(\w+(?:\s*\(\s*\d+\s*\))?)(\s+not\s+null)?(?:\s+default\s+('(?:[^']|'')*'|[-+.\w]+))?(\s+not\s+null)?\s*$`)
+	alterDropColumnRe   = regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\w+)\s+drop\s+(?:column\s+)?(\w+)\s*$`)
+	alterRenameColumnRe = regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\w+)\s+rename\s+(?:column\s+)?(\w+)\s+to\s+(\w+)\s*$`)
+)
+
+// Process an ALTER TABLE statement on behalf of tid (see
+// [ParseInTransaction]). Returns false if the query is not an ALTER TABLE
+// statement that changes the columns of a table.
+func processAlterTable(c *Catalog, query string, tid TransactionID) (QueryType, bool, error) {
+	var err error
+	if m := alterAddColumnRe.FindStringSubmatch(query); m != nil {
+		table, name := strings.ToLower(m[1]), strings.ToLower(m[2])
+		col, ftype, typeErr := parseColumnType(strings.Join(strings.Fields(m[3]), ""))
+		if typeErr != nil {
+			return UnknownQueryType, true, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", m[3])}
+		}
+		col.notNull = m[4] != "" || m[6] != ""
+		// the default is also the value of the column in the existing tuples
+		if col.defaultValue, err = normalizeDefault(m[5], ftype); err != nil {
+			return UnknownQueryType, true, err
+		}
+		var value DBValue
+		if value, err = col.defaultFor(ftype); err != nil {
+			return UnknownQueryType, true, err
+		}
+		err = c.addColumnInTransaction(tid, table, FieldType{name, "", ftype}, col, value)
+	} else if m := alterDropColumnRe.FindStringSubmatch(query); m != nil {
+		err = c.dropColumnInTransaction(tid, strings.ToLower(m[1]), strings.ToLower(m[2]))
+	} else if m := alterRenameColumnRe.FindStringSubmatch(query); m != nil {
+		err = c.renameColumnInTransaction(tid, strings.ToLower(m[1]), strings.ToLower(m[2]), strings.ToLower(m[3]))
+	} else {
+		return UnknownQueryType, false, nil
+	}
+	if err != nil {
+		return UnknownQueryType, true, err
+	}
+	return AlterTableQueryType, true, nil
+}
+
+// Process a CREATE INDEX or DROP INDEX statement on behalf of tid. Returns
+// false if the query is not an index statement.
+func processIndexDDL(c *Catalog, query string, tid TransactionID) (QueryType, bool, error) {
+	if m := createIndexRe.FindStringSubmatch(query); m != nil {
+		name, table, column := strings.ToLower(m[1]), strings.ToLower(m[3]), strings.ToLower(m[4])
+		method := "btree"
+		if m[2] != "" {
+			method = strings.ToLower(m[2])
+		} else if m[5] != "" {
+			method = strings.ToLower(m[5])
+		}
+		if err := c.CreateIndex(tid, name, table, column, method); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return CreateIndexQueryType, true, nil
+	}
+	if m := dropIndexRe.FindStringSubmatch(query); m != nil {
+		name := strings.ToLower(m[1])
+		if m[2] != "" {
+			if idx, ok := c.indexMap[name]; ok && idx.table != strings.ToLower(m[2]) {
+				return UnknownQueryType, true, GoDBError{NoSuchTableError, fmt.Sprintf("no index '%s' on table '%s'", name, m[2])}
+			}
+		}
+		if err := c.dropIndexInTransaction(tid, name); err != nil {
+			return UnknownQueryType, true, err
+		}
+		return DropIndexQueryType, true, nil
+	}
+	return UnknownQueryType, false, nil
+}
+
+// sqlparser does not export the key options of a column, e.g., "id int primary
+// key", which are the last words of the formatted column type.
+var columnKeyRe = regexp.MustCompile(`(?i)\s(primary key|unique|unique key)$`)
+
+// Return the PRIMARY KEY and UNIQUE keys declared by the columns and the
+// indexes of a CREATE TABLE statement. Other indexes are ignored.
+func tableSpecKeys(spec *sqlparser.TableSpec) []tableKey {
+	var keys []tableKey
+	for _, col := range spec.Columns {
+		if m := columnKeyRe.FindStringSubmatch(sqlparser.String(&col.Type)); m != nil {
+			keys = append(keys, tableKey{strings.EqualFold(m[1], "primary key"), []string{sqlparser.String(col.Name)}, nil})
+		}
+	}
+	for _, idx := range spec.Indexes {
+		if !idx.Info.Primary && !idx.Info.Unique {
+			continue
+		}
+		k := tableKey{idx.Info.Primary, nil, nil}
+		for _, col := range idx.Columns {
+			k.columns = append(k.columns, sqlparser.String(col.Column))
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Return the literal of the DEFAULT of a column in a CREATE TABLE statement,
+// e.g., "'paris'", "1" or "current_timestamp", or "" if the column has none.
+func defaultLiteral(val *sqlparser.SQLVal) string {
+	if val == nil {
+		return ""
+	}
+	if val.Type == sqlparser.StrVal {
+		return "'" + strings.ReplaceAll(string(val.Val), "'", "''") + "'"
+	}
+	return string(val.Val)
+}
+
+// Remove the FOREIGN KEY constraints from a CREATE TABLE statement, and return
+// the rest of the statement and the foreign keys. The referenced columns are
+// left empty if the constraint does not name them.
+func extractForeignKeys(query string) (string, []foreignKey) {
+	var fks []foreignKey
+	for _, m := range foreignKeyClauseRe.FindAllStringSubmatch(query, -1) {
+		fks = append(fks, foreignKey{splitColumns(m[1]), m[2], splitColumns(m[3]), onDeleteAction(m[4]), nil})
+	}
+	return foreignKeyClauseRe.ReplaceAllString(query, ""), fks
+}
+
+// Process a CREATE TABLE, DROP TABLE or TRUNCATE statement. Tables are created
+// with the specified storage method (see [Catalog.createTable]), or as
+// temporary tables if it is "temporary" (see temp_tables.go), and foreign
+// keys, and are created and dropped on behalf of tid (see
+// [ParseInTransaction]).
+func processDDL(c *Catalog, ddl *sqlparser.DDL, storage string, fks []foreignKey, tid TransactionID) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
+		if ddl.TableSpec == nil {
+			return UnknownQueryType, GoDBError{ParseError, "unsupported create table statement"}
+		}
 		fields := make([]FieldType, len(ddl.TableSpec.Columns))
+		columns := make([]columnInfo, len(ddl.TableSpec.Columns))
 		tabName := sqlparser.String(ddl.NewName.Name)
 		t, _ := c.GetTable(tabName)
 		if t != nil {
 			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already exists", tabName)}
 		}
 		for i, col := range ddl.TableSpec.Columns {
-			var colType DBType
 			colName := sqlparser.String(col.Name)
-			switch col.Type.Type {
-			case "int":
-				colType = IntType
-			case "string":
-				fallthrough
-			case "text":
-				fallthrough
-			case "varchar":
-				colType = StringType
-			default:
-				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
-
+			typ := col.Type.Type
+			if col.Type.Length != nil {
+				typ = fmt.Sprintf("%s(%s)", typ, col.Type.Length.Val)
+			}
+			colInfo, colType, err := parseColumnType(typ)
+			if err != nil {
+				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", typ)}
+			}
+			colInfo.notNull = bool(col.Type.NotNull)
+			if colInfo.defaultValue, err = normalizeDefault(defaultLiteral(col.Type.Default), colType); err != nil {
+				return UnknownQueryType, err
+			}
+			if col.Type.Autoincrement {
+				// the sequence is numbered when the table is created
+				colInfo.seq = newSequence(0, 0, i, nil)
 			}
 			fields[i] = FieldType{colName, "", colType}
+			columns[i] = colInfo
+		}
+		keys := tableSpecKeys(ddl.TableSpec)
+		for _, k := range keys {
+			if !k.primary {
+				continue
+			}
+			for _, col := range k.columns {
+				for i, f := range fields {
+					if f.Fname == col {
+						columns[i].notNull = true
+					}
+				}
+			}
 		}
 
-		_, err := c.addTable(tabName, TupleDesc{fields})
+		var err error
+		if storage == "temporary" {
+			err = c.createTemporaryTable(tabName, TupleDesc{fields}, columns, keys, fks)
+		} else {
+			err = c.createTableInTransaction(tid, tabName, TupleDesc{fields}, columns, keys, fks, storage)
+		}
 		if err != nil {
 			return UnknownQueryType, err
 		}
@@ -1403,17 +2033,88 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 
 	case "drop":
 		tabName := sqlparser.String(ddl.Table.Name)
-		err := c.dropTable(tabName)
+		err := c.dropTableInTransaction(tid, tabName)
 		if err != nil {
 			return UnknownQueryType, err
 		}
 		return DropTableQueryType, nil
+
+	case sqlparser.TruncateStr:
+		tabName := sqlparser.String(ddl.Table.Name)
+		if err := c.TruncateTable(tid, tabName); err != nil {
+			return UnknownQueryType, err
+		}
+		return TruncateQueryType, nil
 	default:
 		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported ddl statement %s", ddl.Action)}
 	}
 }
 
+// Parse a query and return its type and, for queries of IteratorType, the
+// operator that runs it. DDL statements are run by Parse; CREATE TABLE, DROP
+// TABLE and ALTER TABLE statements are committed in a transaction of their own.
+// COPY FROM statements are run too, and return the [BulkLoadResult] of the
+// load, while COPY TO statements return a [CopyToOp].
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
+	return ParseInTransaction(c, query, noTransaction)
+}
+
+// Parse a query that is part of the running transaction tid, e.g., one after
+// BEGIN. Unlike [Parse], CREATE TABLE, DROP TABLE, CREATE INDEX, DROP INDEX,
+// CREATE VIEW, DROP VIEW, ALTER TABLE, TRUNCATE and COPY FROM statements are
+// run on behalf of tid, so that they are undone if tid aborts. VACUUM cannot
+// run inside a transaction.
+func ParseInTransaction(c *Catalog, query string, tid TransactionID) (QueryType, Operator, error) {
+	if qtype, ok, err := processIndexDDL(c, query, tid); ok {
+		return qtype, nil, err
+	}
+	if qtype, ok, err := processAlterTable(c, query, tid); ok {
+		return qtype, nil, err
+	}
+	if qtype, ok, err := processViewDDL(c, query, tid); ok {
+		return qtype, nil, err
+	}
+	if m := copyToRe.FindStringSubmatch(query); m != nil {
+		op, err := parseCopyTo(c, m[1], m[2], strings.ReplaceAll(m[3], "''", "'"), m[4])
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	}
+	if m := copyRe.FindStringSubmatch(query); m != nil {
+		result, err := c.copyFrom(tid, m[1], strings.ReplaceAll(m[2], "''", "'"), m[3])
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return CopyQueryType, result, nil
+	}
+	if m := vacuumRe.FindStringSubmatch(query); m != nil {
+		if _, err := c.VacuumTable(tid, m[1]); err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return VacuumQueryType, nil, nil
+	}
+	storage := "heap"
+	var fks []foreignKey
+	temporary := false
+	if m := temporaryTableRe.FindStringSubmatch(query); m != nil {
+		query, temporary = m[1]+m[2], true
+	}
+	if createTableRe.MatchString(query) {
+		query, fks = extractForeignKeys(query)
+		query = boolColumnRe.ReplaceAllString(query, "${1}bit")
+		query = uniqueKeyRe.ReplaceAllString(query, "${1}unique key unnamed (")
+		query = signedDefaultRe.ReplaceAllString(query, "${1}'${2}'")
+		if m := usingClauseRe.FindStringSubmatch(query); m != nil {
+			query, storage = m[1], strings.ToLower(m[2])
+			if temporary {
+				return UnknownQueryType, nil, GoDBError{ParseError, "temporary tables cannot have a USING clause"}
+			}
+		}
+		if temporary {
+			storage = "temporary"
+		}
+	}
 	stmt, err := sqlparser.Parse(query)
 	if err != nil {
 		return UnknownQueryType, nil, err
@@ -1443,6 +2144,12 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 			return UnknownQueryType, nil, err
 		}
 		return IteratorType, op, nil
+	case *sqlparser.Update:
+		op, err := parseUpdate(c, stmt)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
 	case *sqlparser.Begin:
 		return BeginXactionType, nil, nil
 	case *sqlparser.Commit:
@@ -1450,7 +2157,7 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 	case *sqlparser.Rollback:
 		return AbortXactionType, nil, nil
 	case *sqlparser.DDL:
-		qtype, err := processDDL(c, stmt)
+		qtype, err := processDDL(c, stmt, storage, fks, tid)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		} else {
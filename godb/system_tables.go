@@ -0,0 +1,303 @@
+package godb
+
+/*
+system_tables.go implements the system tables, read-only tables that describe
+the database, so that its schema, statistics and locks can be queried with
+SQL:
+
+	godb_tables   one row per table
+	godb_columns  one row per column of a table
+	godb_indexes  one row per index
+	godb_stats    one row per column of a table with statistics
+	godb_locks    one row per lock that a transaction holds on a page
+
+The rows of a system table are computed from the catalog when it is scanned.
+The system tables are not in the catalog file, and are not listed in the
+system tables themselves.
+*/
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A read-only table whose rows are computed from the catalog.
+type systemTable struct {
+	name    string
+	desc    TupleDesc
+	catalog *Catalog
+	rows    func(c *Catalog) [][]DBValue
+}
+
+type systemPageKey struct {
+	name   string
+	pageNo int
+}
+
+// Return the system tables of a catalog, by name.
+func newSystemTables(c *Catalog) map[string]*systemTable {
+	tables := []*systemTable{
+		{"godb_tables", TupleDesc{[]FieldType{
+			{"table_name", "", StringType},
+			{"file_id", "", IntType},
+			{"storage", "", StringType},
+			{"num_columns", "", IntType},
+			{"pages", "", IntType},
+		}}, c, tablesRows},
+		{"godb_columns", TupleDesc{[]FieldType{
+			{"table_name", "", StringType},
+			{"column_name", "", StringType},
+			{"ordinal_position", "", IntType},
+			{"data_type", "", StringType},
+			{"not_null", "", BoolType},
+		}}, c, columnsRows},
+		{"godb_indexes", TupleDesc{[]FieldType{
+			{"index_name", "", StringType},
+			{"table_name", "", StringType},
+			{"column_name", "", StringType},
+			{"method", "", StringType},
+			{"file_id", "", IntType},
+		}}, c, indexesRows},
+		{"godb_stats", TupleDesc{[]FieldType{
+			{"table_name", "", StringType},
+			{"column_name", "", StringType},
+			{"pages", "", IntType},
+			{"tuples", "", IntType},
+			{"distinct_values", "", IntType},
+			{"null_values", "", IntType},
+			{"hist_min", "", FloatType},
+			{"hist_max", "", FloatType},
+			{"hist_bins", "", IntType},
+		}}, c, statsRows},
+		{"godb_locks", TupleDesc{[]FieldType{
+			{"table_name", "", StringType},
+			{"page_no", "", IntType},
+			{"tid", "", IntType},
+			{"lock_mode", "", StringType},
+		}}, c, locksRows},
+	}
+	m := make(map[string]*systemTable, len(tables))
+	for _, t := range tables {
+		m[t.name] = t
+	}
+	return m
+}
+
+// Return the tables of the catalog, ordered by name.
+func (c *Catalog) sortedTables() []*Table {
+	tables := make([]*Table, 0, len(c.tableMap))
+	for _, t := range c.tableMap {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+	return tables
+}
+
+func tablesRows(c *Catalog) [][]DBValue {
+	var rows [][]DBValue
+	for _, t := range c.sortedTables() {
+		rows = append(rows, []DBValue{
+			StringField{t.name},
+			IntField{int64(t.id)},
+			StringField{t.storage()},
+			IntField{int64(len(t.desc.Fields))},
+			IntField{int64(t.file.NumPages())},
+		})
+	}
+	return rows
+}
+
+func columnsRows(c *Catalog) [][]DBValue {
+	var rows [][]DBValue
+	for _, t := range c.sortedTables() {
+		for i, f := range t.desc.Fields {
+			col := t.columns[i]
+			typ := col.typeName
+			if col.length > 0 {
+				typ = fmt.Sprintf("%s(%d)", col.typeName, col.length)
+			}
+			rows = append(rows, []DBValue{
+				StringField{t.name},
+				StringField{f.Fname},
+				IntField{int64(i + 1)},
+				StringField{typ},
+				BoolField{col.notNull},
+			})
+		}
+	}
+	return rows
+}
+
+func indexesRows(c *Catalog) [][]DBValue {
+	var rows [][]DBValue
+	for _, t := range c.sortedTables() {
+		for _, idx := range c.tableIndexes(t.name) {
+			rows = append(rows, []DBValue{
+				StringField{idx.name},
+				StringField{idx.table},
+				StringField{idx.column},
+				StringField{idx.method},
+				IntField{int64(idx.id)},
+			})
+		}
+	}
+	return rows
+}
+
+// The rows of godb_stats summarize the histogram of each column: the range of
+// values and number of bins of the histograms of numeric columns, or NULL for
+// the sketches of string columns.
+func statsRows(c *Catalog) [][]DBValue {
+	var rows [][]DBValue
+	for _, t := range c.sortedTables() {
+		ts := t.stats
+		if ts == nil {
+			continue
+		}
+		for _, f := range t.desc.Fields {
+			var histMin, histMax, histBins DBValue = NullField{}, NullField{}, NullField{}
+			switch h := ts.histograms[f.Fname].(type) {
+			case *IntHistogram:
+				histMin, histMax, histBins = FloatField{float64(h.min)}, FloatField{float64(h.max)}, IntField{int64(len(h.bins))}
+			case *FloatHistogram:
+				histMin, histMax, histBins = FloatField{h.min}, FloatField{h.max}, IntField{int64(len(h.bins))}
+			}
+			rows = append(rows, []DBValue{
+				StringField{t.name},
+				StringField{f.Fname},
+				IntField{int64(ts.basePages)},
+				IntField{int64(ts.baseTups)},
+				IntField{int64(ts.EstimateDistinct(f.Fname))},
+				IntField{int64(ts.nulls[f.Fname])},
+				histMin,
+				histMax,
+				histBins,
+			})
+		}
+	}
+	return rows
+}
+
+// The rows of godb_locks name the table or index that each locked page
+// belongs to, or are NULL if the page is not a page of a table or index in the
+// catalog. Rows are ordered by name, page and transaction.
+func locksRows(c *Catalog) [][]DBValue {
+	bp := c.bufferPool
+	if bp == nil {
+		return nil
+	}
+	bp.Lock()
+	held := bp.lockTable.heldLocks()
+	bp.Unlock()
+
+	type lockRow struct {
+		name   string
+		pageNo int
+		lock   heldLock
+	}
+	locks := make([]lockRow, len(held))
+	for i, l := range held {
+		name, pageNo := c.lockedPage(l.page)
+		locks[i] = lockRow{name, pageNo, l}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		a, b := locks[i], locks[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.pageNo != b.pageNo {
+			return a.pageNo < b.pageNo
+		}
+		return a.lock.tid < b.lock.tid
+	})
+	var rows [][]DBValue
+	for _, l := range locks {
+		var name DBValue = NullField{}
+		if l.name != "" {
+			name = StringField{l.name}
+		}
+		mode := "read"
+		if l.lock.write {
+			mode = "write"
+		}
+		rows = append(rows, []DBValue{name, IntField{int64(l.pageNo)}, IntField{int64(l.lock.tid)}, StringField{mode}})
+	}
+	return rows
+}
+
+// Return the name of the table or index that the page with the specified page
+// key belongs to, and its page number. The pages of the overflow file of a
+// table belong to the table. The name is empty if no file of the catalog has
+// the page.
+func (c *Catalog) lockedPage(key any) (string, int) {
+	var pageNo int
+	switch k := key.(type) {
+	case heapHash:
+		pageNo = k.PageNo
+	case MemPageKey:
+		pageNo = k.pgNo
+	case droppedPageKey:
+		pageNo = k.pageNo
+	default:
+		return "", 0
+	}
+	for _, t := range c.tableMap {
+		if t.file.pageKey(pageNo) == key {
+			return t.name, pageNo
+		}
+		if hf, ok := t.file.(*HeapFile); ok && hf.overflow.pageKey(pageNo) == key {
+			return t.name, pageNo
+		}
+	}
+	for _, idx := range c.indexMap {
+		if idx.file.pageKey(pageNo) == key {
+			return idx.name, pageNo
+		}
+	}
+	return "", pageNo
+}
+
+func (t *systemTable) insertTuple(tup *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, fmt.Sprintf("system table '%s' is read-only", t.name)}
+}
+
+func (t *systemTable) deleteTuple(tup *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, fmt.Sprintf("system table '%s' is read-only", t.name)}
+}
+
+func (t *systemTable) readPage(pageNo int) (Page, error) {
+	return nil, GoDBError{IllegalOperationError, fmt.Sprintf("system table '%s' has no pages", t.name)}
+}
+
+func (t *systemTable) flushPage(page Page) error {
+	return nil
+}
+
+func (t *systemTable) pageKey(pgNo int) any {
+	return systemPageKey{t.name, pgNo}
+}
+
+func (t *systemTable) NumPages() int {
+	return 0
+}
+
+// Like [HeapFile.Descriptor], returns the descriptor of the tuples of the table
+// rather than a copy, so that the table aliases that the parser sets are those
+// of the tuples.
+func (t *systemTable) Descriptor() *TupleDesc {
+	return &t.desc
+}
+
+// [Operator] iterator method. The rows are computed when the iterator is
+// created, so a scan returns a snapshot of the catalog.
+func (t *systemTable) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	rows := t.rows(t.catalog)
+	i := 0
+	return func() (*Tuple, error) {
+		if i >= len(rows) {
+			return nil, nil
+		}
+		i++
+		return &Tuple{t.desc, rows[i-1], nil}, nil
+	}, nil
+}
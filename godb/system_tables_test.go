@@ -0,0 +1,113 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSystemTables(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (name varchar(20) not null, age int)", noTransaction)
+	runSQLForTest(t, bp, c, "create table pets (owner varchar(20), kind text)", noTransaction)
+	runSQLForTest(t, bp, c, "create index people_age on people(age)", noTransaction)
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 10; i++ {
+		runSQLForTest(t, bp, c, fmt.Sprintf("insert into people values ('sam', %d)", i), tid)
+	}
+	runSQLForTest(t, bp, c, "insert into pets values ('sam', 'kind')", tid)
+	bp.CommitTransaction(tid)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, tc := range []struct {
+		sql  string
+		want [][]DBValue
+	}{
+		{"select table_name, num_columns from godb_tables", [][]DBValue{
+			{StringField{"people"}, IntField{2}},
+			{StringField{"pets"}, IntField{2}},
+		}},
+		{"select column_name, data_type from godb_columns where table_name = 'people'", [][]DBValue{
+			{StringField{"name"}, StringField{"varchar(20)"}},
+			{StringField{"age"}, StringField{"int"}},
+		}},
+		{"select index_name, column_name from godb_indexes", [][]DBValue{
+			{StringField{"people_age"}, StringField{"age"}},
+		}},
+		{"select tuples, distinct_values, hist_min, hist_max from godb_stats where table_name = 'people' and column_name = 'age'", [][]DBValue{
+			{IntField{10}, IntField{10}, FloatField{0}, FloatField{9}},
+		}},
+		{"select hist_bins from godb_stats where column_name = 'kind'", [][]DBValue{
+			{NullField{}},
+		}},
+		// system tables can be joined with each other and with ordinary tables
+		{"select t.table_name, c.column_name from godb_tables t, godb_columns c where t.table_name = c.table_name and c.ordinal_position = 2 and t.storage = 'heap' order by t.table_name", [][]DBValue{
+			{StringField{"people"}, StringField{"age"}},
+			{StringField{"pets"}, StringField{"kind"}},
+		}},
+		{"select kind, data_type from pets, godb_columns where kind = column_name and owner = 'sam'", [][]DBValue{
+			{StringField{"kind"}, StringField{"text"}},
+		}},
+	} {
+		tups := runSQLForTest(t, bp, c, tc.sql, noTransaction)
+		if len(tups) != len(tc.want) {
+			t.Errorf("%s: expected %d rows, got %v", tc.sql, len(tc.want), tups)
+			continue
+		}
+		for i, tup := range tups {
+			for j, v := range tc.want[i] {
+				if tup.Fields[j] != v {
+					t.Errorf("%s: expected %v in row %d, got %v", tc.sql, tc.want[i], i, tup.Fields)
+					break
+				}
+			}
+		}
+	}
+
+	// the rows are computed when the table is scanned
+	runSQLForTest(t, bp, c, "drop table pets", noTransaction)
+	if tups := runSQLForTest(t, bp, c, "select table_name from godb_tables", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the dropped table not to be listed, got %v", tups)
+	}
+
+	if _, _, err := Parse(c, "create table godb_tables (a int)"); err == nil {
+		t.Errorf("expected an error creating a table with the name of a system table")
+	}
+	if _, err := c.addTable("godb_locks", TupleDesc{[]FieldType{{"a", "", IntType}}}); err == nil {
+		t.Errorf("expected an error adding a table with the name of a system table")
+	}
+	if _, err := execSQLForTest(t, bp, c, "insert into godb_tables values ('x', 1, 'heap', 1, 0)", noTransaction); err == nil {
+		t.Errorf("expected an error inserting into a system table")
+	}
+	if _, _, err := Parse(c, "drop table godb_tables"); err == nil {
+		t.Errorf("expected an error dropping a system table")
+	}
+}
+
+func TestSystemTableLocks(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (name text, age int)", noTransaction)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "insert into people values ('sam', 1)", tid)
+
+	tups := runSQLForTest(t, bp, c, "select table_name, page_no, tid, lock_mode from godb_locks", noTransaction)
+	want := []DBValue{StringField{"people"}, IntField{0}, IntField{int64(tid)}, StringField{"write"}}
+	if len(tups) != 1 {
+		t.Fatalf("expected one lock, got %v", tups)
+	}
+	for i, v := range want {
+		if tups[0].Fields[i] != v {
+			t.Errorf("expected lock %v, got %v", want, tups[0].Fields)
+			break
+		}
+	}
+
+	bp.CommitTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select tid from godb_locks", noTransaction); len(tups) != 0 {
+		t.Errorf("expected the locks to be released by the commit, got %v", tups)
+	}
+}
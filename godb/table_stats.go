@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"math"
+
+	"github.com/tylertreat/BoomFilters"
 	//</silentstrip>
 )
 
@@ -28,6 +30,9 @@ type TableStats struct {
 	baseTups   int
 	histograms map[string]any
 	tupleDesc  *TupleDesc
+	distinct   map[string]*boom.HyperLogLog // distinct value counts per field
+	nulls      map[string]int               // number of NULLs per field
+	unique     map[string]bool              // fields whose values a key makes distinct
 	//</strip>
 }
 
@@ -40,13 +45,43 @@ const CostPerPage = 1000
 const NumHistBins = 100
 
 // <silentstrip lab3>
-func tableMinMax(tid TransactionID, dbFile DBFile) ([]int64, []int64, error) {
+// Return the value that represents v in an [IntHistogram] or a
+// [FloatHistogram]: ints and floats are their own values, bools are 0 or 1, and
+// dates and timestamps are their Value field.
+func histValue(v DBValue) (float64, bool) {
+	switch v := v.(type) {
+	case IntField:
+		return float64(v.Value), true
+	case FloatField:
+		return v.Value, true
+	case BoolField:
+		return float64(boolToInt(v.Value)), true
+	case DateField:
+		return float64(v.Value), true
+	case TimestampField:
+		return float64(v.Value), true
+	}
+	return 0, false
+}
+
+// Return the string a string histogram records for a string or blob value.
+func histString(v DBValue) (string, bool) {
+	switch v := v.(type) {
+	case StringField:
+		return v.Value, true
+	case BlobField:
+		return v.Value, true
+	}
+	return "", false
+}
+
+func tableMinMax(tid TransactionID, dbFile DBFile) ([]float64, []float64, error) {
 	td := dbFile.Descriptor()
-	mins := make([]int64, len(td.Fields))
-	maxs := make([]int64, len(td.Fields))
+	mins := make([]float64, len(td.Fields))
+	maxs := make([]float64, len(td.Fields))
 	for i := range mins {
-		mins[i] = math.MaxInt32
-		maxs[i] = math.MinInt32
+		mins[i] = math.Inf(1)
+		maxs[i] = math.Inf(-1)
 	}
 
 	iter, err := dbFile.Iterator(tid)
@@ -58,9 +93,8 @@ func tableMinMax(tid TransactionID, dbFile DBFile) ([]int64, []int64, error) {
 			return nil, nil, err
 		}
 
-		for i, f := range td.Fields {
-			if f.Ftype == IntType {
-				v := tup.Fields[i].(IntField).Value
+		for i := range td.Fields {
+			if v, ok := histValue(tup.Fields[i]); ok {
 				mins[i] = min(mins[i], v)
 				maxs[i] = max(maxs[i], v)
 			}
@@ -82,7 +116,12 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 
 	bp.BeginTransaction(tid)
 	defer bp.CommitTransaction(tid)
+	return computeTableStats(tid, dbFile)
+}
 
+// Compute the statistics of a table on behalf of a running transaction tid,
+// e.g., one that has changed the table. See [ComputeTableStats].
+func computeTableStats(tid TransactionID, dbFile DBFile) (*TableStats, error) {
 	//<strip lab3>
 	td := dbFile.Descriptor()
 
@@ -96,13 +135,19 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 	hists := make(map[string]any, len(td.Fields))
 	for i, f := range td.Fields {
 		switch f.Ftype {
-		case IntType:
-			h, err := NewIntHistogram(NumHistBins, mins[i], maxs[i])
+		case IntType, BoolType, DateType, TimestampType:
+			h, err := NewIntHistogram(NumHistBins, int64(mins[i]), int64(maxs[i]))
 			if err != nil {
 				return nil, err
 			}
 			hists[f.Fname] = h
-		case StringType:
+		case FloatType:
+			h, err := NewFloatHistogram(NumHistBins, mins[i], maxs[i])
+			if err != nil {
+				return nil, err
+			}
+			hists[f.Fname] = h
+		case StringType, BlobType:
 			h, err := NewStringHistogram()
 			if err != nil {
 				return nil, err
@@ -113,11 +158,21 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 		}
 	}
 
+	distinct := make(map[string]*boom.HyperLogLog, len(td.Fields))
+	for _, f := range td.Fields {
+		hll, err := boom.NewDefaultHyperLogLog(0.01)
+		if err != nil {
+			return nil, err
+		}
+		distinct[f.Fname] = hll
+	}
+
 	iter, err := dbFile.Iterator(tid)
 	if err != nil {
 		return nil, err
 	}
 
+	nulls := make(map[string]int, len(td.Fields))
 	baseTups := 0
 	for tup, err := iter(); tup != nil; tup, err = iter() {
 		if err != nil {
@@ -125,21 +180,29 @@ func ComputeTableStats(bp *BufferPool, dbFile DBFile) (*TableStats, error) {
 		}
 
 		for i, f := range td.Fields {
+			if isNull(tup.Fields[i]) {
+				nulls[f.Fname]++
+				continue
+			}
 			switch f.Ftype {
-			case IntType:
-				v := tup.Fields[i].(IntField).Value
-				hists[f.Fname].(*IntHistogram).AddValue(v)
-			case StringType:
-				v := tup.Fields[i].(StringField).Value
+			case IntType, BoolType, DateType, TimestampType:
+				v, _ := histValue(tup.Fields[i])
+				hists[f.Fname].(*IntHistogram).AddValue(int64(v))
+			case FloatType:
+				v, _ := histValue(tup.Fields[i])
+				hists[f.Fname].(*FloatHistogram).AddValue(v)
+			case StringType, BlobType:
+				v, _ := histString(tup.Fields[i])
 				hists[f.Fname].(*StringHistogram).AddValue(v)
 			case UnknownType:
 				return nil, fmt.Errorf("unexpected unknown type")
 			}
+			distinct[f.Fname].Add([]byte(fmt.Sprint(tup.Fields[i])))
 		}
 		baseTups++
 	}
 
-	return &TableStats{dbFile.NumPages(), baseTups, hists, td}, nil
+	return &TableStats{dbFile.NumPages(), baseTups, hists, td, distinct, nulls, nil}, nil
 	//</strip>
 }
 
@@ -157,6 +220,39 @@ func (t *TableStats) EstimateScanCost() float64 {
 	//</strip>
 }
 
+// The number of pages read to descend an index to the first matching entry.
+const IndexLookupPages = 2
+
+// Estimates the cost of reading the tuples that satisfy a predicate with the
+// given selectivity through an unclustered index: descending the index, and
+// then one random page read per matching tuple.
+func (t *TableStats) EstimateIndexScanCost(selectivity float64) float64 {
+	return float64((IndexLookupPages + t.EstimateCardinality(selectivity)) * CostPerPage)
+}
+
+// Estimates the cost of an index nested loops join that probes an index on
+// field once for each of outerCard outer tuples: descending the index, and then
+// one random page read per matching tuple, assuming that the values of field
+// are uniformly distributed.
+func (t *TableStats) EstimateIndexJoinCost(field string, outerCard int) float64 {
+	matches := float64(t.baseTups) / float64(t.EstimateDistinct(field))
+	return float64(outerCard) * (IndexLookupPages + matches) * CostPerPage
+}
+
+// Estimates the number of distinct values of field. Returns 1 if there are no
+// statistics for the field. The non-NULL values of a field that is a key of
+// its table are known to be distinct.
+func (t *TableStats) EstimateDistinct(field string) int {
+	if t.unique[field] {
+		return max(1, t.baseTups-t.nulls[field])
+	}
+	hll, ok := t.distinct[field]
+	if !ok {
+		return 1
+	}
+	return max(1, min(int(hll.Count()), t.baseTups))
+}
+
 // This method returns the number of tuples in the relation, given that a
 // predicate with selectivity is applied.
 func (t *TableStats) EstimateCardinality(selectivity float64) int {
@@ -169,6 +265,20 @@ func (t *TableStats) EstimateCardinality(selectivity float64) int {
 // histogram and estimate the selectivity of the filter.
 func (t *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error) {
 	//<strip lab3>
+	switch {
+	case op == OpIsNull || op == OpIsNotNull:
+		nullSel := 0.0
+		if t.baseTups > 0 {
+			nullSel = float64(t.nulls[field]) / float64(t.baseTups)
+		}
+		if op == OpIsNotNull {
+			return 1.0 - nullSel, nil
+		}
+		return nullSel, nil
+	case isNull(value):
+		// comparisons with NULL are never true
+		return 0.0, nil
+	}
 	hist, ok := t.histograms[field]
 	if !ok {
 		log.Printf("WARNING: no histogram found for field %s", field)
@@ -177,18 +287,25 @@ func (t *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue)
 
 	switch h := hist.(type) {
 	case *IntHistogram:
-		value, ok := value.(IntField)
+		v, ok := histValue(value)
+		if !ok {
+			return 1.0, fmt.Errorf("field '%s' has an int histogram, but value %v is not an int, bool, date or timestamp", field, value)
+		}
+		return h.EstimateSelectivity(op, int64(v)), nil
+
+	case *FloatHistogram:
+		v, ok := histValue(value)
 		if !ok {
-			return 1.0, fmt.Errorf("field '%s' is int, but value %v is not an IntField", field, value)
+			return 1.0, fmt.Errorf("field '%s' is float, but value %v is not a number", field, value)
 		}
-		return h.EstimateSelectivity(op, value.Value), nil
+		return h.EstimateSelectivity(op, v), nil
 
 	case *StringHistogram:
-		value, ok := value.(StringField)
+		v, ok := histString(value)
 		if !ok {
 			return 1.0, fmt.Errorf("field is string, but value is not a StringField")
 		}
-		return h.EstimateSelectivity(op, value.Value), nil
+		return h.EstimateSelectivity(op, v), nil
 	}
 
 	return 1.0, fmt.Errorf("unexpected histogram type")
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"math"
 	"os"
 	"testing"
 )
@@ -43,8 +44,8 @@ func TestTableStatsCard(t *testing.T) {
 func TestTableStatsCost(t *testing.T) {
 	ts := setupTableStatsTest(t)
 	cost := ts.EstimateScanCost()
-	if cost != 4000.0 {
-		t.Errorf("Expected 4000.0, got %f", cost)
+	if cost != 3000.0 {
+		t.Errorf("Expected 3000.0, got %f", cost)
 	}
 }
 
@@ -99,3 +100,28 @@ func TestTableStatsSelectivity(t *testing.T) {
 		t.Errorf("Expected 0.66, got %f", s)
 	}
 }
+
+func TestFloatHistogram(t *testing.T) {
+	h, err := NewFloatHistogram(NumHistBins, 0, 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < 1000; i++ {
+		h.AddValue(float64(i) / 1000)
+	}
+	for _, tc := range []struct {
+		op   BoolOp
+		v    float64
+		want float64
+	}{
+		{OpLt, 0.25, 0.25},
+		{OpGt, 0.9, 0.1},
+		{OpLt, -1, 0},
+		{OpGe, 2, 0},
+		{OpLe, 2, 1},
+	} {
+		if got := h.EstimateSelectivity(tc.op, tc.v); math.Abs(got-tc.want) > 0.02 {
+			t.Errorf("selectivity of %s %v: expected %v, got %v", tc.op, tc.v, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package godb
+
+/*
+temp_tables.go implements temporary tables, which hold intermediate results for
+the session that creates them:
+
+	create temporary table staged (id int, name text not null)
+	insert into staged select id, name from people where city = 'paris'
+
+A temporary table is stored in a [MemFile], and belongs to the catalog that
+created it, which is the session of a client of the database, e.g., the shell
+of main.go. It is not written to the catalog file or the log, so other
+sessions, which open the database with catalogs of their own, do not see it,
+and it is dropped when the session ends (see [Catalog.EndSession]), or by DROP
+TABLE. The changes of its tuples are part of transactions, and are undone if
+their transaction aborts, but CREATE TEMPORARY TABLE and DROP TABLE of a
+temporary table take effect immediately.
+
+Temporary tables can be queried, joined, and changed by INSERT, UPDATE and
+DELETE like other tables, and their columns may be NOT NULL or have DEFAULT
+values, but they cannot have keys, foreign keys, indexes or AUTO_INCREMENT
+columns, cannot be altered, and cannot be used by views, which outlive the
+session.
+*/
+
+import (
+	"fmt"
+)
+
+// Return true if the table is a temporary table.
+func (t *Table) temporary() bool {
+	_, ok := t.file.(*MemFile)
+	return ok
+}
+
+// Add a temporary table whose columns have the specified declared types to the
+// catalog.
+//
+// Returns an error if a table or view with the same name already exists, or
+// the table has keys, foreign keys or an AUTO_INCREMENT column.
+func (c *Catalog) createTemporaryTable(named string, desc TupleDesc, columns []columnInfo, keys []tableKey, fks []foreignKey) error {
+	if _, ok := c.tableMap[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+	}
+	if _, ok := c.systemTables[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("'%s' is the name of a system table", named)}
+	}
+	if _, ok := c.viewMap[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a view named '%s' already exists", named)}
+	}
+	for _, drops := range c.dropped {
+		for _, d := range drops {
+			if d.table.name == named {
+				return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' was dropped by a transaction that has not committed", named)}
+			}
+		}
+	}
+	if len(keys) > 0 || len(fks) > 0 {
+		return GoDBError{ParseError, fmt.Sprintf("temporary table '%s' cannot have keys or foreign keys", named)}
+	}
+	for i, col := range columns {
+		if col.seq != nil {
+			return GoDBError{ParseError, fmt.Sprintf("column '%s' of temporary table '%s' cannot be auto_increment", desc.Fields[i].Fname, named)}
+		}
+	}
+	file := NewMemFile(desc.copy(), columns)
+	c.registerTable(&Table{-1, named, "", desc, columns, nil, nil, nil, file})
+	return nil
+}
+
+// Remove a temporary table from the catalog, and discard its tuples.
+func (c *Catalog) dropTemporaryTable(t *Table) error {
+	c.unregisterTable(t)
+	return nil
+}
+
+// Drop the temporary tables of the session, e.g., when a client disconnects or
+// opens another database. The catalog can be used after the session ends,
+// e.g., by a new session.
+func (c *Catalog) EndSession() {
+	for _, t := range c.tableMap {
+		if t.temporary() {
+			c.dropTemporaryTable(t)
+		}
+	}
+}
+
+// Forget the changes of tid to the temporary tables, which has committed.
+func (c *Catalog) commitTemporaryTables(tid TransactionID) {
+	for _, t := range c.tableMap {
+		if mf, ok := t.file.(*MemFile); ok {
+			mf.commit(tid)
+		}
+	}
+}
+
+// Undo the changes of tid to the temporary tables, which is aborting.
+func (c *Catalog) abortTemporaryTables(tid TransactionID) {
+	for _, t := range c.tableMap {
+		if mf, ok := t.file.(*MemFile); ok {
+			mf.abort(tid)
+		}
+	}
+}
+
+// Return an error if a plan, e.g., the query of a view, uses a temporary
+// table.
+func checkNoTemporaryTables(plan *LogicalPlan) error {
+	for _, t := range plan.tables {
+		if _, ok := (*t.file).(*MemFile); ok {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("views cannot use temporary table '%s'", t.tableName)}
+		}
+	}
+	for _, sub := range plan.subqueries {
+		if err := checkNoTemporaryTables(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
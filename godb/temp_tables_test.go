@@ -0,0 +1,113 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestTemporaryTables(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table people (id int primary key, name text, city text)", noTransaction)
+	for _, sql := range []string{
+		"insert into people values (1, 'ann', 'paris')",
+		"insert into people values (2, 'bob', 'rome')",
+		"insert into people values (3, 'cid', 'paris')",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	runSQLForTest(t, bp, c, "create temporary table staged (id int, name text not null, note text default 'new')", noTransaction)
+	if got := c.String(); got != "people(id int not null, name text, city text) primary key (id)\n"+
+		"staged(id int, name text not null, note text default 'new') temporary\n"+
+		"index people_pkey on people(id) using btree\n" {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+	for _, sql := range []string{
+		"insert into staged (id, name) select id, name from people where city = 'paris'",
+		"update staged set note = 'done' where id = 3",
+		"delete from staged where id = 1",
+		"insert into staged (id, name) values (4, 'dan')",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select s.id, s.note, p.city from staged s join people p on s.name = p.name", noTransaction); len(tups) != 1 ||
+		tups[0].Fields[0] != (IntField{3}) || tups[0].Fields[1] != (StringField{"done"}) || tups[0].Fields[2] != (StringField{"paris"}) {
+		t.Errorf("expected a join of cid, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from staged", noTransaction); len(tups) != 2 {
+		t.Errorf("expected two staged tuples, got %v", tups)
+	}
+
+	// tuples inserted with plain values are read with the fields of the table
+	runSQLForTest(t, bp, c, "create temporary table tt (a int, b text)", noTransaction)
+	for _, sql := range []string{
+		"insert into tt values (1, 'ann')",
+		"insert into tt values (2, 'bob')",
+		"insert into tt values (3, 'zed')",
+		"delete from tt where a = 1",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select a from tt where b = 'bob'", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{2}) {
+		t.Errorf("expected a filter of bob, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select count(*) from tt", noTransaction); tups[0].Fields[0] != (IntField{2}) {
+		t.Errorf("expected the delete to remove a tuple, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select tt.a, p.city from tt join people p on tt.b = p.name", noTransaction); len(tups) != 1 ||
+		tups[0].Fields[0] != (IntField{2}) || tups[0].Fields[1] != (StringField{"rome"}) {
+		t.Errorf("expected a join of bob, got %v", tups)
+	}
+
+	// an abort undoes the changes of the transaction
+	tid := BeginTransactionForTest(t, bp)
+	staged, _ := c.GetTable("staged")
+	for _, tup := range runQueryForTest(t, bp, staged, noTransaction) {
+		if err := staged.deleteTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	runSQLForTest(t, bp, c, "insert into staged values (5, 'eve', 'x')", tid)
+	bp.AbortTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select id from staged order by id", noTransaction); len(tups) != 2 || tups[0].Fields[0] != (IntField{3}) || tups[1].Fields[0] != (IntField{4}) {
+		t.Errorf("expected the abort to restore the staged tuples, got %v", tups)
+	}
+
+	for _, sql := range []string{
+		"insert into staged values (6, null, 'x')",
+		"create temporary table people (a int)",
+		"create table staged (a int)",
+		"create temporary table bad (a int primary key)",
+		"create temporary table bad (a int auto_increment)",
+		"create temporary table bad (a int) using column",
+		"alter table staged add column x int",
+		"create index staged_id on staged(id)",
+		"create view bad as select id from staged",
+		"create materialized view bad as select id from staged",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+
+	// temporary tables are not kept in the catalog file, and are gone in a new
+	// session
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, c2 := openTestDatabase(t, disk, root)
+	if _, err := c2.GetTable("staged"); err == nil {
+		t.Errorf("expected the temporary table not to be visible to another session")
+	}
+	runSQLForTest(t, bp, c, "create temporary table other (a int)", noTransaction)
+	runSQLForTest(t, bp, c, "drop table other", noTransaction)
+	c.EndSession()
+	if _, err := c.GetTable("staged"); err == nil {
+		t.Errorf("expected the temporary table to be dropped when the session ends")
+	}
+}
@@ -8,9 +8,11 @@ import (
 	//<silentstrip lab1>
 	"encoding/binary"
 	//</silentstrip>
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	//<silentstrip lab1>
 	"unsafe"
@@ -21,9 +23,14 @@ import (
 type DBType int
 
 const (
-	IntType     DBType = iota
-	StringType  DBType = iota
-	UnknownType DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	IntType       DBType = iota
+	StringType    DBType = iota
+	FloatType     DBType = iota
+	BoolType      DBType = iota
+	DateType      DBType = iota
+	TimestampType DBType = iota
+	BlobType      DBType = iota
+	UnknownType   DBType = iota //used internally, during parsing, because sometimes the type is unknown
 )
 
 func (t DBType) String() string {
@@ -32,6 +39,16 @@ func (t DBType) String() string {
 		return "int"
 	case StringType:
 		return "string"
+	case FloatType:
+		return "float"
+	case BoolType:
+		return "bool"
+	case DateType:
+		return "date"
+	case TimestampType:
+		return "timestamp"
+	case BlobType:
+		return "blob"
 	}
 	return "unknown"
 }
@@ -68,21 +85,6 @@ func (d1 *TupleDesc) equals(d2 *TupleDesc) bool {
 
 }
 
-// <silentstrip lab1>
-func (desc *TupleDesc) bytesPerTuple() int {
-	size := 0
-	for i := 0; i < len(desc.Fields); i++ {
-		switch desc.Fields[i].Ftype {
-		case IntType:
-			size += (int)(unsafe.Sizeof(int64(0)))
-		case StringType:
-			size += ((int)(unsafe.Sizeof(byte('a')))) * StringLength
-		}
-	}
-	return size
-}
-
-// </silentstrip>
 // Given a FieldType f and a TupleDesc desc, find the best
 // matching field in desc for f.  A match is defined as
 // having the same Ftype and the same name, preferring a match
@@ -158,6 +160,76 @@ type StringField struct {
 	Value string
 }
 
+// Floating point field value
+type FloatField struct {
+	Value float64
+}
+
+// Boolean field value
+type BoolField struct {
+	Value bool
+}
+
+// Date field value, stored as the number of days since 1970-01-01
+type DateField struct {
+	Value int64
+}
+
+// Timestamp field value, stored as the number of microseconds since
+// 1970-01-01 00:00:00 UTC
+type TimestampField struct {
+	Value int64
+}
+
+func (f FloatField) String() string {
+	return strconv.FormatFloat(f.Value, 'g', -1, 64)
+}
+
+func (f BoolField) String() string {
+	return strconv.FormatBool(f.Value)
+}
+
+func (f DateField) String() string {
+	return f.Time().Format(DateFormat)
+}
+
+// Return the date as a time at midnight UTC.
+func (f DateField) Time() time.Time {
+	return time.Unix(f.Value*secondsPerDay, 0).UTC()
+}
+
+func (f TimestampField) String() string {
+	return f.Time().Format(TimestampFormat)
+}
+
+// Return the timestamp as a time in UTC.
+func (f TimestampField) Time() time.Time {
+	return time.UnixMicro(f.Value).UTC()
+}
+
+// Binary field value, e.g., a document or an image; the bytes are held in a
+// string so that the value is comparable
+type BlobField struct {
+	Value string
+}
+
+func (f BlobField) String() string {
+	return `\x` + hex.EncodeToString([]byte(f.Value))
+}
+
+// SQL NULL field value, which may appear in a field of any type
+type NullField struct{}
+
+func (NullField) String() string {
+	return "NULL"
+}
+
+// Return true if v is the SQL NULL value.
+func isNull(v DBValue) bool {
+	_, ok := v.(NullField)
+	return ok
+}
+
 // Tuple represents the contents of a tuple read from a database
 // It includes the tuple descriptor, and the value of the fields
 type Tuple struct {
@@ -169,22 +241,41 @@ type Tuple struct {
 type recordID interface {
 }
 
-// Serialize the contents of the tuple into a byte array Since all tuples are of
-// fixed size, this method should simply write the fields in sequential order
-// into the supplied buffer.
+// Serialize the contents of the tuple into a byte array. This method should
+// write a null bitmap followed by the non-null fields in sequential order into
+// the supplied buffer.
+//
+// The null bitmap has one bit per field, rounded up to a whole number of bytes;
+// bit i%8 of byte i/8 is set if field i is NULL. Fields that are NULL are not
+// written after the bitmap.
 //
 // See the function [binary.Write].  Objects should be serialized in little
 // endian oder.
 //
-// Strings can be converted to byte arrays by casting to []byte. Note that all
-// strings need to be padded to StringLength bytes (set in types.go). For
-// example if StringLength is set to 5, the string 'mit' should be written as
-// 'm', 'i', 't', 0, 0
+// Strings can be converted to byte arrays by casting to []byte. Strings are
+// variable length, so each string is written as its length in bytes (an int32)
+// followed by its bytes. For example, the string 'mit' should be written as
+// 3, 0, 0, 0, 'm', 'i', 't'
+//
+// Blobs are written like strings. A string or blob that a [HeapFile] keeps in
+// overflow pages is written as a reference to the pages (see [overflowRef]).
+//
+// Floats are written as float64s, bools as a single byte, and dates and
+// timestamps as the int64 in their Value field.
 //
 // May return an error if the buffer has insufficient capacity to store the
 // tuple.
 func (t *Tuple) writeTo(b *bytes.Buffer) error {
 	//<strip lab1>
+	nulls := make([]byte, nullBitmapSize(len(t.Fields)))
+	for j, f := range t.Fields {
+		if isNull(f) {
+			nulls[j/8] |= 1 << (j % 8)
+		}
+	}
+	if _, err := b.Write(nulls); err != nil {
+		return err
+	}
 	for j := 0; j < len(t.Fields); j++ {
 		f := t.Fields[j]
 		switch f := f.(type) {
@@ -194,13 +285,44 @@ func (t *Tuple) writeTo(b *bytes.Buffer) error {
 				return err
 			}
 		case StringField:
-			err := binary.Write(b, binary.LittleEndian, []byte(f.Value))
+			err := binary.Write(b, binary.LittleEndian, int32(len(f.Value)))
+			if err != nil {
+				return err
+			}
+			_, err = b.WriteString(f.Value)
+			if err != nil {
+				return err
+			}
+		case BlobField:
+			err := binary.Write(b, binary.LittleEndian, int32(len(f.Value)))
+			if err != nil {
+				return err
+			}
+			_, err = b.WriteString(f.Value)
+			if err != nil {
+				return err
+			}
+		case overflowRef:
+			if err := f.writeTo(b); err != nil {
+				return err
+			}
+		case FloatField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case BoolField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
+			if err != nil {
+				return err
+			}
+		case DateField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
 			if err != nil {
 				return err
 			}
-			rem := StringLength - len(f.Value)
-			//pad to StringLength
-			err = binary.Write(b, binary.LittleEndian, make([]byte, rem))
+		case TimestampField:
+			err := binary.Write(b, binary.LittleEndian, f.Value)
 			if err != nil {
 				return err
 			}
@@ -215,19 +337,24 @@ func (t *Tuple) writeTo(b *bytes.Buffer) error {
 //
 // See [binary.Read]. Objects should be deserialized in little endian oder.
 //
-// All strings are stored as StringLength byte objects.
-//
-// Strings with length < StringLength will be padded with zeros, and these
-// trailing zeros should be removed from the strings.  A []byte can be cast
-// directly to string.
+// All strings are stored as their length followed by their bytes.  A []byte can
+// be cast directly to string. Fields whose bit is set in the null bitmap are
+// NULL and have no bytes of their own.
 //
 // May return an error if the buffer has insufficent data to deserialize the
 // tuple.
 func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 	//<strip lab1>
-	bs := make([]byte, StringLength)
 	fs := make([]DBValue, len(desc.Fields))
+	nulls := b.Next(nullBitmapSize(len(desc.Fields)))
+	if len(nulls) != nullBitmapSize(len(desc.Fields)) {
+		return nil, GoDBError{MalformedDataError, "tuple is missing its null bitmap"}
+	}
 	for i := 0; i < len(desc.Fields); i++ {
+		if nulls[i/8]&(1<<(i%8)) != 0 {
+			fs[i] = NullField{}
+			continue
+		}
 		switch desc.Fields[i].Ftype {
 		case IntType:
 			var intField int64
@@ -236,12 +363,56 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 				return nil, err
 			}
 			fs[i] = IntField{intField}
-		case StringType:
-			err := binary.Read(b, binary.LittleEndian, bs)
+		case StringType, BlobType:
+			var n int32
+			err := binary.Read(b, binary.LittleEndian, &n)
+			if err != nil {
+				return nil, err
+			}
+			if n == overflowMarker {
+				ref, err := readOverflowRef(b)
+				if err != nil {
+					return nil, err
+				}
+				fs[i] = ref
+				continue
+			}
+			if n < 0 || int(n) > b.Len() {
+				return nil, GoDBError{MalformedDataError, fmt.Sprintf("invalid string length %d", n)}
+			}
+			if desc.Fields[i].Ftype == BlobType {
+				fs[i] = BlobField{string(b.Next(int(n)))}
+			} else {
+				fs[i] = StringField{string(b.Next(int(n)))}
+			}
+		case FloatType:
+			var floatField float64
+			err := binary.Read(b, binary.LittleEndian, &floatField)
 			if err != nil {
 				return nil, err
 			}
-			fs[i] = StringField{string(bytes.TrimRight(bs, "\x00"))}
+			fs[i] = FloatField{floatField}
+		case BoolType:
+			var boolField bool
+			err := binary.Read(b, binary.LittleEndian, &boolField)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = BoolField{boolField}
+		case DateType:
+			var days int64
+			err := binary.Read(b, binary.LittleEndian, &days)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = DateField{days}
+		case TimestampType:
+			var micros int64
+			err := binary.Read(b, binary.LittleEndian, &micros)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = TimestampField{micros}
 		}
 	}
 
@@ -249,6 +420,39 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 	//</strip>
 }
 
+// <silentstrip lab1>
+// Return the number of bytes in the null bitmap of a tuple with n fields.
+func nullBitmapSize(n int) int {
+	return (n + 7) / 8
+}
+
+// Return the number of bytes written by [Tuple.writeTo].
+func (t *Tuple) size() int {
+	size := nullBitmapSize(len(t.Fields))
+	for _, f := range t.Fields {
+		switch f := f.(type) {
+		case IntField:
+			size += int(unsafe.Sizeof(f.Value))
+		case StringField:
+			size += int(unsafe.Sizeof(int32(0))) + len(f.Value)
+		case BlobField:
+			size += int(unsafe.Sizeof(int32(0))) + len(f.Value)
+		case overflowRef:
+			size += overflowRefSize
+		case FloatField:
+			size += int(unsafe.Sizeof(f.Value))
+		case BoolField:
+			size += int(unsafe.Sizeof(f.Value))
+		case DateField:
+			size += int(unsafe.Sizeof(f.Value))
+		case TimestampField:
+			size += int(unsafe.Sizeof(f.Value))
+		}
+	}
+	return size
+}
+
+// </silentstrip>
 // Compare two tuples for equality.  Equality means that the TupleDescs are equal
 // and all of the fields are equal.  TupleDescs should be compared with
 // the [TupleDesc.equals] method, but fields can be compared directly with equality
@@ -317,29 +521,25 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 		return order, err
 	}
 
-	switch field.GetExprType().Ftype {
-	case IntType:
-		v1 := v1.(IntField).Value
-		v2 := v2.(IntField).Value
-		if v1 < v2 {
-			return OrderedLessThan, nil
-		} else if v1 == v2 {
-			return OrderedEqual, nil
-		} else {
-			return OrderedGreaterThan, nil
-		}
-	case StringType:
-		v1 := v1.(StringField).Value
-		v2 := v2.(StringField).Value
-		if v1 < v2 {
-			return OrderedLessThan, nil
-		} else if v1 == v2 {
-			return OrderedEqual, nil
-		} else {
-			return OrderedGreaterThan, nil
-		}
+	// NULLs sort after all other values
+	switch {
+	case isNull(v1) && isNull(v2):
+		return OrderedEqual, nil
+	case isNull(v1):
+		return OrderedGreaterThan, nil
+	case isNull(v2):
+		return OrderedLessThan, nil
+	}
+
+	switch {
+	case v1.EvalPred(v2, OpLt):
+		return OrderedLessThan, nil
+	case v1.EvalPred(v2, OpEq):
+		return OrderedEqual, nil
+	case v1.EvalPred(v2, OpGt):
+		return OrderedGreaterThan, nil
 	}
-	return order, GoDBError{IncompatibleTypesError, "unknown type"}
+	return order, GoDBError{IncompatibleTypesError, fmt.Sprintf("cannot compare %v and %v", v1, v2)}
 	//</strip>
 }
 
@@ -423,6 +623,8 @@ func (t *Tuple) PrettyPrintString(aligned bool) string {
 			str = strconv.FormatInt(f.Value, 10)
 		case StringField:
 			str = f.Value
+		case FloatField, BoolField, DateField, TimestampField, BlobField, NullField:
+			str = fmt.Sprint(f)
 		}
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
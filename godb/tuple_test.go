@@ -3,6 +3,7 @@ package godb
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -107,6 +108,141 @@ func TestTupleSerialization(t *testing.T) {
 	}
 }
 
+// Strings are length prefixed, so long strings and strings with trailing
+// zero bytes survive serialization
+func TestTupleSerializationVariableLength(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	long := strings.Repeat("a long product description ", 40)
+	tups := []Tuple{
+		{td, []DBValue{StringField{long}, IntField{1}}, nil},
+		{td, []DBValue{StringField{""}, IntField{2}}, nil},
+		{td, []DBValue{StringField{"ends in zero\x00"}, IntField{3}}, nil},
+	}
+	b := new(bytes.Buffer)
+	for _, tup := range tups {
+		if err := tup.writeTo(b); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if b.Len() != tups[0].size()+tups[1].size()+tups[2].size() {
+		t.Errorf("expected %d bytes, got %d", tups[0].size()+tups[1].size()+tups[2].size(), b.Len())
+	}
+	for _, tup := range tups {
+		t2, err := readTupleFrom(b, &td)
+		if err != nil {
+			t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+		}
+		if !t2.equals(&tup) {
+			t.Errorf("expected %v, got %v", tup, t2)
+		}
+	}
+}
+
+// NULL fields are recorded in the null bitmap and take no other space
+func TestTupleSerializationNulls(t *testing.T) {
+	td, _, _ := makeTupleTestVars()
+	tups := []Tuple{
+		{td, []DBValue{NullField{}, IntField{1}}, nil},
+		{td, []DBValue{StringField{"sam"}, NullField{}}, nil},
+		{td, []DBValue{NullField{}, NullField{}}, nil},
+	}
+	b := new(bytes.Buffer)
+	for _, tup := range tups {
+		if err := tup.writeTo(b); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if tups[2].size() != 1 {
+		t.Errorf("expected an all NULL tuple to use 1 byte, got %d", tups[2].size())
+	}
+	for _, tup := range tups {
+		t2, err := readTupleFrom(b, &td)
+		if err != nil {
+			t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+		}
+		if !t2.equals(&tup) {
+			t.Errorf("expected %v, got %v", tup, t2)
+		}
+	}
+}
+
+func TestTupleSerializationTypes(t *testing.T) {
+	td := TupleDesc{[]FieldType{
+		{"price", "", FloatType},
+		{"paid", "", BoolType},
+		{"day", "", DateType},
+		{"at", "", TimestampType},
+	}}
+	day, _ := parseValue("2024-02-29", DateType)
+	at, _ := parseValue("2024-02-29 13:45:01.25", TimestampType)
+	tup := Tuple{td, []DBValue{FloatField{19.99}, BoolField{true}, day, at}, nil}
+	b := new(bytes.Buffer)
+	if err := tup.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if b.Len() != tup.size() {
+		t.Errorf("expected %d bytes, got %d", tup.size(), b.Len())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf("Error loading tuple from saved buffer: %v", err.Error())
+	}
+	if !t2.equals(&tup) {
+		t.Errorf("expected %v, got %v", tup, t2)
+	}
+	if s := t2.PrettyPrintString(false); s != "19.99,true,2024-02-29,2024-02-29 13:45:01.25" {
+		t.Errorf("unexpected output %s", s)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		t    DBType
+		want DBValue
+	}{
+		{"1.5", FloatType, FloatField{1.5}},
+		{"TRUE", BoolType, BoolField{true}},
+		{"f", BoolType, BoolField{false}},
+		{"1970-01-02", DateType, DateField{1}},
+		{"1969-12-31", DateType, DateField{-1}},
+		{"1970-01-01 00:00:01", TimestampType, TimestampField{1000000}},
+		{"1970-01-01T01:00:00+01:00", TimestampType, TimestampField{0}},
+		{"1970-01-02", TimestampType, TimestampField{86400000000}},
+	} {
+		v, err := parseValue(tc.s, tc.t)
+		if err != nil {
+			t.Errorf("parsing %s: %s", tc.s, err.Error())
+		} else if v != tc.want {
+			t.Errorf("parsing %s: expected %v, got %v", tc.s, tc.want, v)
+		}
+	}
+	for _, s := range []string{"1.5.1", "yes", "2024-13-01"} {
+		for _, typ := range []DBType{FloatType, BoolType, DateType} {
+			if _, err := parseValue(s, typ); err == nil {
+				t.Errorf("expected error parsing %s as %s", s, typ)
+			}
+		}
+	}
+}
+
+func TestEvalPredTypes(t *testing.T) {
+	d1, _ := parseValue("2024-01-01", DateType)
+	d2, _ := parseValue("2024-01-02", DateType)
+	if !d1.EvalPred(d2, OpLt) || d1.EvalPred(d2, OpGe) {
+		t.Errorf("expected %v < %v", d1, d2)
+	}
+	if !(FloatField{1.5}).EvalPred(IntField{1}, OpGt) || !(IntField{2}).EvalPred(FloatField{1.5}, OpGt) {
+		t.Errorf("expected ints and floats to be comparable")
+	}
+	if !(BoolField{false}).EvalPred(BoolField{true}, OpLt) {
+		t.Errorf("expected false < true")
+	}
+	if d1.EvalPred(StringField{"2024-01-01"}, OpEq) {
+		t.Errorf("expected a date not to equal a string")
+	}
+}
+
 // Unit test for Tuple.compareField()
 func TestTupleExpr(t *testing.T) {
 	td, t1, t2 := makeTupleTestVars()
@@ -1,27 +1,33 @@
 package godb
 
 import (
+	"cmp"
+	"encoding/hex"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type GoDBErrorCode int
 
 const (
-	TupleNotFoundError      GoDBErrorCode = iota
-	PageFullError           GoDBErrorCode = iota
-	IncompatibleTypesError  GoDBErrorCode = iota
-	TypeMismatchError       GoDBErrorCode = iota
-	MalformedDataError      GoDBErrorCode = iota
-	BufferPoolFullError     GoDBErrorCode = iota
-	ParseError              GoDBErrorCode = iota
-	DuplicateTableError     GoDBErrorCode = iota
-	NoSuchTableError        GoDBErrorCode = iota
-	AmbiguousNameError      GoDBErrorCode = iota
-	IllegalOperationError   GoDBErrorCode = iota
-	DeadlockError           GoDBErrorCode = iota
-	IllegalTransactionError GoDBErrorCode = iota
+	TupleNotFoundError       GoDBErrorCode = iota
+	PageFullError            GoDBErrorCode = iota
+	IncompatibleTypesError   GoDBErrorCode = iota
+	TypeMismatchError        GoDBErrorCode = iota
+	MalformedDataError       GoDBErrorCode = iota
+	BufferPoolFullError      GoDBErrorCode = iota
+	ParseError               GoDBErrorCode = iota
+	DuplicateTableError      GoDBErrorCode = iota
+	NoSuchTableError         GoDBErrorCode = iota
+	AmbiguousNameError       GoDBErrorCode = iota
+	IllegalOperationError    GoDBErrorCode = iota
+	DeadlockError            GoDBErrorCode = iota
+	IllegalTransactionError  GoDBErrorCode = iota
+	CorruptPageError         GoDBErrorCode = iota
+	ConstraintViolationError GoDBErrorCode = iota
 )
 
 //go:generate stringer -type=GoDBErrorCode
@@ -36,8 +42,7 @@ func (e GoDBError) Error() string {
 }
 
 const (
-	PageSize     int = 4096
-	StringLength int = 32
+	PageSize int = 4096
 )
 
 type Page interface {
@@ -76,6 +81,10 @@ const (
 	OpEq   BoolOp = iota
 	OpNeq  BoolOp = iota
 	OpLike BoolOp = iota
+
+	// IS NULL and IS NOT NULL ignore the value they are compared to
+	OpIsNull    BoolOp = iota
+	OpIsNotNull BoolOp = iota
 )
 
 var BoolOpMap = map[string]BoolOp{
@@ -89,7 +98,24 @@ var BoolOpMap = map[string]BoolOp{
 	"like": OpLike,
 }
 
+// Comparisons follow SQL's three-valued logic: comparing NULL with anything,
+// including another NULL, is unknown rather than true or false. Because GoDB
+// has no NOT, EvalPred reports unknown as false, so that, e.g., a filter
+// drops tuples whose field is NULL for both "x = 1" and "x <> 1".
+func (NullField) EvalPred(v2 DBValue, op BoolOp) bool {
+	return op == OpIsNull
+}
+
 func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
+	switch op {
+	case OpIsNull:
+		return false
+	case OpIsNotNull:
+		return true
+	}
+	if f2, ok := v2.(FloatField); ok {
+		return evalOrdered(float64(i1.Value), f2.Value, op)
+	}
 	i2, ok := v2.(IntField)
 	if !ok {
 		return false
@@ -115,6 +141,12 @@ func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
 }
 
 func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
+	switch op {
+	case OpIsNull:
+		return false
+	case OpIsNotNull:
+		return true
+	}
 	i2, ok := v2.(StringField)
 	if !ok {
 		return false
@@ -151,3 +183,195 @@ func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
 		return false
 	}
 }
+
+// Compare two values of the same ordered type with one of the comparison
+// operators.
+func evalOrdered[T cmp.Ordered](x1 T, x2 T, op BoolOp) bool {
+	switch op {
+	case OpEq:
+		return x1 == x2
+	case OpNeq:
+		return x1 != x2
+	case OpGt:
+		return x1 > x2
+	case OpGe:
+		return x1 >= x2
+	case OpLt:
+		return x1 < x2
+	case OpLe:
+		return x1 <= x2
+	case OpIsNotNull:
+		return true
+	}
+	return false
+}
+
+// Ints and floats can be compared with each other.
+func (f1 FloatField) EvalPred(v2 DBValue, op BoolOp) bool {
+	switch v2 := v2.(type) {
+	case FloatField:
+		return evalOrdered(f1.Value, v2.Value, op)
+	case IntField:
+		return evalOrdered(f1.Value, float64(v2.Value), op)
+	}
+	return op == OpIsNotNull
+}
+
+// False is less than true.
+func (b1 BoolField) EvalPred(v2 DBValue, op BoolOp) bool {
+	b2, ok := v2.(BoolField)
+	if !ok {
+		return op == OpIsNotNull
+	}
+	return evalOrdered(boolToInt(b1.Value), boolToInt(b2.Value), op)
+}
+
+func (d1 DateField) EvalPred(v2 DBValue, op BoolOp) bool {
+	d2, ok := v2.(DateField)
+	if !ok {
+		return op == OpIsNotNull
+	}
+	return evalOrdered(d1.Value, d2.Value, op)
+}
+
+func (t1 TimestampField) EvalPred(v2 DBValue, op BoolOp) bool {
+	t2, ok := v2.(TimestampField)
+	if !ok {
+		return op == OpIsNotNull
+	}
+	return evalOrdered(t1.Value, t2.Value, op)
+}
+
+// Blobs are compared byte by byte.
+func (b1 BlobField) EvalPred(v2 DBValue, op BoolOp) bool {
+	b2, ok := v2.(BlobField)
+	if !ok {
+		return op == OpIsNotNull
+	}
+	return evalOrdered(b1.Value, b2.Value, op)
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Formats of date and timestamp values, as accepted by [time.Parse].
+const (
+	DateFormat      = "2006-01-02"
+	TimestampFormat = "2006-01-02 15:04:05.999999"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// Parse a string into a value of the specified type. Dates are written
+// 2006-01-02; timestamps are written 2006-01-02 15:04:05, with optional
+// fractional seconds, or in RFC 3339 format, and are taken to be in UTC if they
+// have no time zone. Blobs are written in hex with a \x prefix, e.g., \x00ff,
+// or as the bytes of the string otherwise.
+func parseValue(s string, t DBType) (DBValue, error) {
+	switch t {
+	case IntType:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid int %q", s)}
+		}
+		return IntField{i}, nil
+	case StringType:
+		return StringField{s}, nil
+	case FloatType:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid float %q", s)}
+		}
+		return FloatField{f}, nil
+	case BoolType:
+		b, err := strconv.ParseBool(strings.ToLower(s))
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid bool %q", s)}
+		}
+		return BoolField{b}, nil
+	case DateType:
+		d, err := time.Parse(DateFormat, s)
+		if err != nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid date %q", s)}
+		}
+		return DateField{d.Unix() / secondsPerDay}, nil
+	case TimestampType:
+		for _, layout := range []string{TimestampFormat, time.RFC3339Nano, DateFormat} {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return TimestampField{ts.UnixMicro()}, nil
+			}
+		}
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid timestamp %q", s)}
+	case BlobType:
+		if hexStr, ok := strings.CutPrefix(s, `\x`); ok {
+			b, err := hex.DecodeString(hexStr)
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("invalid blob %q", s)}
+			}
+			return BlobField{string(b)}, nil
+		}
+		return BlobField{s}, nil
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot parse a value of type %s", t)}
+}
+
+// Convert v to a value of type t, if v is a string that can be parsed as a
+// value of type t, or an int and t is FloatType. NULL converts to any type.
+// Used to convert constants in queries to the type of the column they are
+// compared with or inserted into.
+func castValue(v DBValue, t DBType) (DBValue, error) {
+	switch v := v.(type) {
+	case NullField:
+		return v, nil
+	case StringField:
+		return parseValue(v.Value, t)
+	case IntField:
+		switch t {
+		case IntType:
+			return v, nil
+		case FloatType:
+			return FloatField{float64(v.Value)}, nil
+		}
+	default:
+		if valueType(v) == t {
+			return v, nil
+		}
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot convert %v to %s", v, t)}
+}
+
+// Return a value as text, e.g., "abc" for a string, "1" for an int, or "NULL".
+func valueText(v DBValue) string {
+	switch v := v.(type) {
+	case StringField:
+		return v.Value
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// Return the type of a value, or UnknownType for NULL.
+func valueType(v DBValue) DBType {
+	switch v.(type) {
+	case IntField:
+		return IntType
+	case StringField:
+		return StringType
+	case FloatField:
+		return FloatType
+	case BoolField:
+		return BoolType
+	case DateField:
+		return DateType
+	case TimestampField:
+		return TimestampType
+	case BlobField:
+		return BlobType
+	}
+	return UnknownType
+}
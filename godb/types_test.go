@@ -0,0 +1,126 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+// Create the table types_test, with a column of each type, and load three rows
+// into it from a CSV file.
+func loadTypesTestTable(t *testing.T, bp *BufferPool, c *Catalog) {
+	t.Helper()
+	runSQLForTest(t, bp, c, "create table types_test (item varchar(10), price float, paid boolean, day date, at timestamp)", noTransaction)
+	ti, _ := c.GetTableInfo("types_test")
+	if ti.String() != "types_test(item varchar(10), price float, paid bool, day date, at timestamp)\n" {
+		t.Errorf("unexpected table: %#v", ti.String())
+	}
+	dir := t.TempDir()
+	writeFile(t, dir+"/types_test.csv", "item,price,paid,day,at\n"+
+		"apple,0.1,true,2024-01-31,2024-01-31 09:00:00\n"+
+		"pear,0.2,false,2024-02-01,2024-02-01 10:30:00.5\n"+
+		"melon,12.5,TRUE,2024-02-29,2024-02-29T23:59:59Z\n")
+	f, err := os.Open(dir + "/types_test.csv")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := ti.file.(*HeapFile).LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestColumnTypesQuery(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	loadTypesTestTable(t, bp, c)
+	for _, tc := range []struct {
+		sql  string
+		want int
+	}{
+		{"select item from types_test where price > 10", 1},
+		{"select item from types_test where price < 0.25", 2},
+		{"select item from types_test where paid = true", 2},
+		{"select item from types_test where day >= '2024-02-01'", 2},
+		{"select item from types_test where day = '2024-02-29'", 1},
+		{"select item from types_test where at < '2024-02-01 10:30:01'", 2},
+	} {
+		if got := len(runSQLForTest(t, bp, c, tc.sql, noTransaction)); got != tc.want {
+			t.Errorf("%s: expected %d results, got %d", tc.sql, tc.want, got)
+		}
+	}
+
+	tups := runSQLForTest(t, bp, c, "select item, day from types_test order by day desc", noTransaction)
+	if len(tups) != 3 || tups[0].Fields[0] != (StringField{"melon"}) || tups[0].Fields[1].(DateField).String() != "2024-02-29" {
+		t.Errorf("unexpected order %v", tups)
+	}
+
+	runSQLForTest(t, bp, c, "insert into types_test values ('kiwi', 1, false, '2024-03-01', '2024-03-01 08:00:00')", noTransaction)
+	tups = runSQLForTest(t, bp, c, "select price, at from types_test where item = 'kiwi'", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (FloatField{1}) || tups[0].Fields[1].(TimestampField).String() != "2024-03-01 08:00:00" {
+		t.Errorf("unexpected inserted tuple %v", tups)
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	loadTypesTestTable(t, bp, c)
+	tups := runSQLForTest(t, bp, c, "select price * 2, price + 1, 10 / price, price - 0.5, -price, 7 / 2 from types_test where item = 'melon'", noTransaction)
+	want := []DBValue{FloatField{25}, FloatField{13.5}, FloatField{0.8}, FloatField{12}, FloatField{-12.5}, IntField{3}}
+	if len(tups) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(tups))
+	}
+	for i, v := range want {
+		if tups[0].Fields[i] != v {
+			t.Errorf("expression %d: expected %v, got %v", i, v, tups[0].Fields[i])
+		}
+	}
+
+	runSQLForTest(t, bp, c, "insert into types_test values ('fig', -1.5, false, '2024-03-01', '2024-03-01 08:00:00')", noTransaction)
+	tups = runSQLForTest(t, bp, c, "select price from types_test where price < -1", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (FloatField{-1.5}) {
+		t.Errorf("expected the negative price to be inserted, got %v", tups)
+	}
+}
+
+func TestFloatAggregates(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t)
+	loadTypesTestTable(t, bp, c)
+	tups := runSQLForTest(t, bp, c, "select sum(price), avg(price), min(day), max(at) from types_test where price < 1", noTransaction)
+	if len(tups) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(tups))
+	}
+	x, y := 0.1, 0.2
+	if got := tups[0].Fields[0].(FloatField).Value; got != x+y {
+		t.Errorf("expected sum %v, got %v", x+y, got)
+	}
+	if got := tups[0].Fields[1].(FloatField).Value; got != (x+y)/2 {
+		t.Errorf("expected avg %v, got %v", (x+y)/2, got)
+	}
+	if s := tups[0].PrettyPrintString(false); s != "0.30000000000000004,0.15000000000000002,2024-01-31,2024-02-01 10:30:00.5" {
+		t.Errorf("unexpected output %s", s)
+	}
+}
+
+// Averages of ints are floats, rather than being truncated, and float sums do
+// not lose small values added to large ones.
+func TestAvgAndSumPrecision(t *testing.T) {
+	td := TupleDesc{[]FieldType{{"i", "", IntType}, {"f", "", FloatType}}}
+	avg := &AvgAggState{}
+	avg.Init("avg", &FieldExpr{td.Fields[0]})
+	sum := &SumAggState{}
+	sum.Init("sum", &FieldExpr{td.Fields[1]})
+	fs := []float64{1e16, 1, 1, 1, 1}
+	for i, f := range fs {
+		tup := Tuple{td, []DBValue{IntField{int64(i % 2)}, FloatField{f}}, nil}
+		avg.AddTuple(&tup)
+		sum.AddTuple(&tup)
+	}
+	if got := avg.Finalize().Fields[0]; got != (FloatField{0.4}) {
+		t.Errorf("expected avg 0.4, got %v", got)
+	}
+	if got := sum.Finalize().Fields[0]; got != (FloatField{1e16 + 4}) {
+		t.Errorf("expected sum %v, got %v", 1e16+4, got)
+	}
+}
@@ -0,0 +1,127 @@
+package godb
+
+import "fmt"
+
+type UpdateOp struct {
+	child      Operator
+	updateFile DBFile
+	fields     []int  // fields of the tuples that are set
+	exprs      []Expr // new value of each field, evaluated on the old tuple
+}
+
+// A DBFile that can replace a tuple with a new version, e.g., in place on its
+// page, rather than deleting the tuple and inserting the new version.
+type updatableFile interface {
+	DBFile
+	// Replace t, which must have its Rid set, with newT, and set the Rid of
+	// newT.
+	updateTuple(t *Tuple, newT *Tuple, tid TransactionID) error
+}
+
+// Construct an update operator. The update operator replaces each record in the
+// child Operator, which must be a record of the specified DBFile, with a copy in
+// which each of the named fields is set to the value of the corresponding
+// expression, evaluated on the record. Returns an error if a field is not a
+// field of the DBFile.
+func NewUpdateOp(updateFile DBFile, child Operator, fields []string, exprs []Expr) (*UpdateOp, error) {
+	if len(fields) != len(exprs) {
+		return nil, GoDBError{ParseError, "update must have one expression per field"}
+	}
+	fieldNos := make([]int, len(fields))
+	for i, name := range fields {
+		fieldNo, err := findFieldInTd(FieldType{name, "", UnknownType}, updateFile.Descriptor())
+		if err != nil {
+			return nil, err
+		}
+		fieldNos[i] = fieldNo
+	}
+	return &UpdateOp{child, updateFile, fieldNos, exprs}, nil
+}
+
+// The update TupleDesc is a one column descriptor with an integer field named
+// "count".
+func (uop *UpdateOp) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{{"count", "", IntType}}}
+}
+
+// Return the new version of t, with the fields of the update set. All of the
+// expressions are evaluated on t, so that, e.g., SET a = b, b = a swaps a and b.
+func (uop *UpdateOp) newTuple(t *Tuple) (*Tuple, error) {
+	td := uop.updateFile.Descriptor()
+	fields := append([]DBValue{}, t.Fields...)
+	for i, fieldNo := range uop.fields {
+		v, err := uop.exprs[i].EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		ftype := td.Fields[fieldNo].Ftype
+		if !isNull(v) && valueType(v) != ftype {
+			// constants such as '2024-01-01' or 1 may be converted to the
+			// type of the column, e.g., a date or float
+			cast, err := castValue(v, ftype)
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot set %s field %s to %v", ftype, td.Fields[fieldNo].Fname, v)}
+			}
+			v = cast
+		}
+		fields[fieldNo] = v
+	}
+	return &Tuple{*td, fields, nil}, nil
+}
+
+// Replace t with newT in the DBFile, in place if the file supports it.
+func (uop *UpdateOp) update(t *Tuple, newT *Tuple, tid TransactionID) error {
+	if f, ok := uop.updateFile.(updatableFile); ok {
+		return f.updateTuple(t, newT, tid)
+	}
+	if err := uop.updateFile.deleteTuple(t, tid); err != nil {
+		return err
+	}
+	return uop.updateFile.insertTuple(newT, tid)
+}
+
+// Return an iterator that updates all of the tuples from the child iterator in
+// the DBFile passed to the constructor and then returns a one-field tuple with
+// a "count" field indicating the number of tuples that were updated.
+//
+// An updated tuple may move, e.g., to a page that the child has yet to scan, or
+// to a later key of an index that the child scans, and be returned by the child
+// again (the Halloween problem). The record ids of the updated tuples are kept,
+// so that each tuple is only updated once.
+func (uop *UpdateOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := uop.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	didIterate := false
+	return func() (*Tuple, error) {
+		if didIterate {
+			return nil, nil
+		}
+		updated := make(map[recordID]bool)
+		cnt := 0
+		for {
+			t, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+			if updated[t.Rid] {
+				continue
+			}
+			newT, err := uop.newTuple(t)
+			if err != nil {
+				return nil, err
+			}
+			if err := uop.update(t, newT, tid); err != nil {
+				return nil, err
+			}
+			updated[newT.Rid] = true
+			cnt++
+		}
+		didIterate = true
+		return &Tuple{*uop.Descriptor(), []DBValue{IntField{int64(cnt)}}, nil}, nil
+	}, nil
+}
@@ -0,0 +1,164 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpdateOp(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, overflowTestTable)
+	hf := heapFileForTest(t, c, "docs")
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < 10; i++ {
+		tup := Tuple{*hf.Descriptor(), []DBValue{IntField{int64(i)}, StringField{"a"}, BlobField{"b"}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	bp.CommitTransaction(tid)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	before := runQueryForTest(t, bp, hf, noTransaction)
+
+	tups := runSQLForTest(t, bp, c, "update docs set id = id + 100 where id >= 5", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{5}) {
+		t.Fatalf("expected a count of 5, got %v", tups)
+	}
+	after := runQueryForTest(t, bp, hf, noTransaction)
+	if len(after) != 10 {
+		t.Fatalf("expected 10 tuples, got %d", len(after))
+	}
+	for i, tup := range after {
+		want := int64(i)
+		if i >= 5 {
+			want += 100
+		}
+		if tup.Fields[0] != (IntField{want}) {
+			t.Errorf("expected id %d, got %v", want, tup.Fields[0])
+		}
+		// tuples that still fit are updated in place
+		if tup.Rid != before[i].Rid {
+			t.Errorf("expected tuple %d to keep its record id", i)
+		}
+	}
+
+	// every expression is evaluated on the old tuple
+	runSQLForTest(t, bp, c, "create table pairs (a int, b int)", noTransaction)
+	pairs, _ := c.GetTable("pairs")
+	tid = BeginTransactionForTest(t, bp)
+	pair := Tuple{*pairs.Descriptor(), []DBValue{IntField{1}, IntField{2}}, nil}
+	insertTupleForTest(t, pairs, &pair, tid)
+	bp.CommitTransaction(tid)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runSQLForTest(t, bp, c, "update pairs set a = b, b = a", noTransaction)
+	tups = runSQLForTest(t, bp, c, "select a, b from pairs", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{2}) || tups[0].Fields[1] != (IntField{1}) {
+		t.Errorf("expected a and b to be swapped, got %v", tups)
+	}
+
+	if _, _, err := Parse(c, "update docs set missing = 1"); err == nil {
+		t.Errorf("expected an error updating a field that does not exist")
+	}
+	_, op, err := Parse(c, "update docs set id = 'abc'")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := execQueryForTest(t, bp, op, noTransaction); err == nil {
+		t.Errorf("expected an error setting an int field to a string")
+	}
+}
+
+// Tuples that no longer fit on their page are moved, possibly to a page that
+// the scan has yet to reach, but are only updated once.
+func TestUpdateMovesTuples(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, overflowTestTable)
+	hf := heapFileForTest(t, c, "docs")
+	n := 200
+	tid := BeginTransactionForTest(t, bp)
+	for i := 0; i < n; i++ {
+		tup := Tuple{*hf.Descriptor(), []DBValue{IntField{int64(i)}, StringField{"x"}, NullField{}}, nil}
+		insertTupleForTest(t, hf, &tup, tid)
+	}
+	bp.CommitTransaction(tid)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	pages := hf.NumPages()
+
+	body := strings.Repeat("y", 200)
+	tups := runSQLForTest(t, bp, c, "update docs set body = '"+body+"', id = id + 1", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{int64(n)}) {
+		t.Fatalf("expected a count of %d, got %v", n, tups)
+	}
+	if hf.NumPages() <= pages {
+		t.Errorf("expected the updated tuples to need more pages")
+	}
+	seen := make(map[int64]bool)
+	for _, tup := range runQueryForTest(t, bp, hf, noTransaction) {
+		id := tup.Fields[0].(IntField).Value
+		if seen[id] || id < 1 || id > int64(n) {
+			t.Errorf("unexpected id %d", id)
+		}
+		seen[id] = true
+		if tup.Fields[1] != (StringField{body}) {
+			t.Errorf("expected tuple %d to be updated", id)
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("expected %d tuples, got %d", n, len(seen))
+	}
+
+	// large values are moved to and from overflow pages
+	big := makeOverflowTestTuple(hf, 1)
+	_, op, err := Parse(c, "update docs set body = 'z' where id = 1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	updateOp := op.(*UpdateOp)
+	updateOp.exprs[0] = &ConstExpr{big.Fields[1], StringType}
+	runQueryForTest(t, bp, updateOp, noTransaction)
+	if hf.overflow.NumPages() == 0 {
+		t.Errorf("expected the large value to be stored in overflow pages")
+	}
+	tups = runSQLForTest(t, bp, c, "select body from docs where id = 1", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != big.Fields[1] {
+		t.Errorf("large value was not read back intact")
+	}
+	runSQLForTest(t, bp, c, "update docs set body = 'z' where id = 1", noTransaction)
+	if len(hf.overflow.free) != hf.overflow.NumPages() {
+		t.Errorf("expected the overflow pages of the old value to be freed")
+	}
+}
+
+func TestUpdateIndex(t *testing.T) {
+	bp, c, _, _ := newTestDatabase(t, indexTestTable...)
+	runSQLForTest(t, bp, c, "create index idx_test_age on idx_test(age)", noTransaction)
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tups := runSQLForTest(t, bp, c, "update idx_test set age = age + 5000 where age < 100", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (IntField{100}) {
+		t.Fatalf("expected a count of 100, got %v", tups)
+	}
+	for _, tc := range []struct {
+		sql  string
+		want int
+	}{
+		{"select name from idx_test where age = 50", 0},
+		{"select name from idx_test where age = 5050", 1},
+		{"select name from idx_test where age >= 5000", 100},
+		{"select name from idx_test where age = 150", 1},
+	} {
+		_, op, err := Parse(c, tc.sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if findIndexScan(op) == nil {
+			t.Errorf("%s: expected an index scan", tc.sql)
+		}
+		if got := len(runQueryForTest(t, bp, op, noTransaction)); got != tc.want {
+			t.Errorf("%s: expected %d results, got %d", tc.sql, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package godb
+
+import (
+	"fmt"
+)
+
+/*
+VACUUM and TRUNCATE reclaim the space of a [HeapFile]. Deleting tuples leaves
+empty slots and empty pages behind, which iterators still have to read, and the
+backing file never shrinks. VACUUM moves tuples from the end of the file into
+the free space of earlier pages and removes the pages that become empty;
+TRUNCATE deletes every tuple and removes all pages.
+
+VACUUM runs in a transaction of its own, and cannot be run inside a
+transaction that the user began, since the moved tuples and the removed pages
+cannot be restored if that transaction aborts. TRUNCATE outside a transaction
+runs in its own transaction too. Either transaction first takes a write lock on
+every page of the file, so that no other transaction can read or modify the table while
+its tuples are moved. The tuples are moved and deleted like any other update,
+so the changes are written to the log when the transaction commits, and the
+pages at the end of the file are only removed from the buffer pool and the
+backing file once the commit is durable. If another transaction appends a page
+to the file in the meantime, the emptied pages before it are kept.
+
+TRUNCATE inside a transaction deletes the tuples on behalf of that transaction,
+like a DELETE without a WHERE clause, so that they are restored if it aborts.
+The emptied pages are kept, and are reclaimed by the next VACUUM.
+
+Moved tuples keep their values in the same overflow pages. The overflow pages
+of deleted tuples are freed, and reused by later inserts, but the overflow file
+does not shrink.
+*/
+
+// Take a write lock on every page of the HeapFile on behalf of tid, which
+// locks the whole table: other transactions cannot read or modify its tuples
+// until tid commits or aborts. Pages appended to the file while the locks are
+// being taken are locked too. Returns the number of pages that were locked.
+func (f *HeapFile) lockAllPages(tid TransactionID) (int, error) {
+	locked := 0
+	for {
+		numPages := f.NumPages()
+		if locked == numPages {
+			return numPages, nil
+		}
+		for ; locked < numPages; locked++ {
+			if _, err := f.bufPool.GetPage(f, locked, tid, WritePerm); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// Run rewrite in a new transaction that holds write locks on every page of the
+// HeapFile, and then remove the pages of the file past the page count that
+// rewrite returns, all of which rewrite must have emptied. Returns the number
+// of pages that were removed.
+func (f *HeapFile) reclaimPages(rewrite func(tid TransactionID, numPages int) (int, error)) (int, error) {
+	bp := f.bufPool
+	tid := NewTID()
+	if err := bp.BeginTransaction(tid); err != nil {
+		return 0, err
+	}
+	numPages, err := f.lockAllPages(tid)
+	if err != nil {
+		bp.AbortTransaction(tid)
+		return 0, err
+	}
+	newPages, err := rewrite(tid, numPages)
+	if err != nil {
+		bp.AbortTransaction(tid)
+		return 0, err
+	}
+
+	// hide the empty pages before releasing the locks, so that inserts do not
+	// pick them and iterators do not read them
+	f.Lock()
+	if f.numPages == numPages {
+		f.numPages = newPages
+	}
+	f.Unlock()
+	bp.CommitTransaction(tid)
+
+	if err := f.removePagesPastEnd(); err != nil {
+		return 0, err
+	}
+	return numPages - f.NumPages(), nil
+}
+
+// Remove the pages past the end of the HeapFile from the buffer pool, the
+// backing file and the free-space map, e.g., after they were emptied and
+// hidden by [HeapFile.reclaimPages].
+func (f *HeapFile) removePagesPastEnd() error {
+	f.Lock()
+	defer f.Unlock()
+	f.bufPool.discardPagesFrom(f, f.numPages)
+	if err := f.bufPool.DiskManager().Truncate(f.backingFile, int64(f.numPages*PageSize)); err != nil {
+		return err
+	}
+	return f.fsm.truncate(f.numPages)
+}
+
+// Return the specified page of the HeapFile, write locked on behalf of tid.
+func (f *HeapFile) getWritePage(pageNo int, tid TransactionID) (*heapPage, error) {
+	pg, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
+	if err != nil {
+		return nil, err
+	}
+	return pg.(*heapPage), nil
+}
+
+// Move the tuples of the last pages of the first numPages pages of the HeapFile
+// into free space on earlier pages, until no more tuples fit. The index entries
+// of moved tuples are updated, since their record ids change. Returns the
+// number of pages up to and including the last page that still has tuples.
+func (f *HeapFile) compact(tid TransactionID, numPages int) (int, error) {
+	dst := 0
+outer:
+	for src := numPages - 1; src > dst; src-- {
+		srcPage, err := f.getWritePage(src, tid)
+		if err != nil {
+			return 0, err
+		}
+		// deleting tuples shrinks the slot directory of the page, so iterate
+		// over a copy
+		tuples := append([]*Tuple{}, srcPage.tuples...)
+		for slot, t := range tuples {
+			if t == nil {
+				continue
+			}
+			// getting a page may evict the pages that were got before, so
+			// each page is modified right after it is got
+			moved := &Tuple{*f.td, t.Fields, nil}
+			for ; dst < src; dst++ {
+				dstPage, err := f.getWritePage(dst, tid)
+				if err != nil {
+					return 0, err
+				}
+				_, err = dstPage.insertTuple(moved)
+				if err == nil {
+					dstPage.setDirty(tid, true)
+					break
+				}
+				if err != ErrPageFull {
+					return 0, err
+				}
+			}
+			if dst == src {
+				break outer
+			}
+			if srcPage, err = f.getWritePage(src, tid); err != nil {
+				return 0, err
+			}
+			rid := heapFileRid{src, slot}
+			if err := srcPage.deleteTuple(rid); err != nil {
+				return 0, err
+			}
+			srcPage.setDirty(tid, true)
+			full, err := f.loadOverflowValues(t, tid)
+			if err != nil {
+				return 0, err
+			}
+			if err := f.deleteIndexEntries(full, rid, tid); err != nil {
+				return 0, err
+			}
+			if err := f.insertIndexEntries(&Tuple{*f.td, full.Fields, moved.Rid}, tid); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for numPages > 0 {
+		pg, err := f.getWritePage(numPages-1, tid)
+		if err != nil {
+			return 0, err
+		}
+		if pg.numUsed > 0 {
+			break
+		}
+		numPages--
+	}
+	return numPages, nil
+}
+
+// Delete every tuple on the first numPages pages of the HeapFile, along with
+// their index entries and overflow pages. Returns 0, the number of pages that
+// still have tuples.
+func (f *HeapFile) clear(tid TransactionID, numPages int) (int, error) {
+	for p := 0; p < numPages; p++ {
+		pg, err := f.getWritePage(p, tid)
+		if err != nil {
+			return 0, err
+		}
+		tuples := append([]*Tuple{}, pg.tuples...)
+		for slot, t := range tuples {
+			if t == nil {
+				continue
+			}
+			// updating the indexes may have evicted the page
+			if pg, err = f.getWritePage(p, tid); err != nil {
+				return 0, err
+			}
+			rid := heapFileRid{p, slot}
+			if err := pg.deleteTuple(rid); err != nil {
+				return 0, err
+			}
+			pg.setDirty(tid, true)
+			full, err := f.loadOverflowValues(t, tid)
+			if err != nil {
+				return 0, err
+			}
+			if err := f.freeOverflowValues(t, tid); err != nil {
+				return 0, err
+			}
+			if err := f.deleteIndexEntries(full, rid, tid); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+// Compact the tuples of the HeapFile into as few pages as possible and shrink
+// the backing file. Returns the number of pages that were removed.
+func (f *HeapFile) vacuum() (int, error) {
+	return f.reclaimPages(f.compact)
+}
+
+// Delete every tuple of the HeapFile on behalf of tid. Without a transaction,
+// the tuples are deleted in a transaction of their own, and the backing file is
+// shrunk to zero pages; otherwise the empty pages are kept, since the tuples are
+// restored if tid aborts.
+func (f *HeapFile) truncate(tid TransactionID) error {
+	if tid == noTransaction {
+		_, err := f.reclaimPages(f.clear)
+		return err
+	}
+	numPages, err := f.lockAllPages(tid)
+	if err != nil {
+		return err
+	}
+	_, err = f.clear(tid, numPages)
+	return err
+}
+
+// Return the heap file of the specified table, or an error if the table does
+// not exist or is not stored in a heap file.
+func (c *Catalog) heapFileForCommand(named string, command string) (*HeapFile, *Table, error) {
+	t, err := c.GetTableInfo(named)
+	if err != nil {
+		return nil, nil, err
+	}
+	hf, ok := t.file.(*HeapFile)
+	if !ok {
+		return nil, nil, GoDBError{IllegalOperationError, fmt.Sprintf("cannot %s table '%s'", command, named)}
+	}
+	return hf, t, nil
+}
+
+// Reclaim the space of the deleted tuples of a table (see [HeapFile.vacuum]),
+// and recompute its statistics. Returns the number of pages that were removed.
+// A table cannot be vacuumed inside a running transaction tid.
+func (c *Catalog) VacuumTable(tid TransactionID, named string) (int, error) {
+	if tid != noTransaction {
+		return 0, GoDBError{IllegalTransactionError, "VACUUM cannot run inside a transaction"}
+	}
+	hf, t, err := c.heapFileForCommand(named, "vacuum")
+	if err != nil {
+		return 0, err
+	}
+	removed, err := hf.vacuum()
+	if err != nil {
+		return 0, err
+	}
+	t.stats, err = ComputeTableStats(c.bufferPool, hf)
+	return removed, err
+}
+
+// Delete all tuples of a table on behalf of tid (see [HeapFile.truncate]), and
+// recompute its statistics. A table that foreign keys of other tables reference
+// cannot be truncated.
+func (c *Catalog) TruncateTable(tid TransactionID, named string) error {
+	hf, t, err := c.heapFileForCommand(named, "truncate")
+	if err != nil {
+		return err
+	}
+	if err := c.checkUnreferenced(named, "truncate"); err != nil {
+		return err
+	}
+	if err := c.checkNotMaterialized(named); err != nil {
+		return err
+	}
+	if err := hf.truncate(tid); err != nil {
+		return err
+	}
+	if tid == noTransaction {
+		t.stats, err = ComputeTableStats(c.bufferPool, hf)
+	} else {
+		t.stats, err = computeTableStats(tid, hf)
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const vacuumTestRows = 600
+
+// Statements that create a heap table with an index on its id column and
+// vacuumTestRows rows, enough to fill several pages.
+var vacuumTestTable = []string{
+	"create table vac_test (id int, pad text)",
+	"create index vac_idx on vac_test (id)",
+	insertRowsForTest("vac_test", vacuumTestRows, func(i int) string {
+		return fmt.Sprintf("%d, '%d%s'", i, i, strings.Repeat("x", 100))
+	}),
+}
+
+func checkFileSize(t *testing.T, disk DiskManager, fileName string, want int64) {
+	t.Helper()
+	size, err := disk.Size(fileName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if size != want {
+		t.Errorf("expected %s to have %d bytes, got %d", fileName, want, size)
+	}
+}
+
+func TestVacuumCompactsHeapFile(t *testing.T) {
+	bp, c, disk, _ := newTestDatabase(t, vacuumTestTable...)
+	hf := heapFileForTest(t, c, "vac_test")
+	before := hf.NumPages()
+	runSQLForTest(t, bp, c, "delete from vac_test where id < 500", noTransaction)
+	if hf.NumPages() != before {
+		t.Fatalf("expected delete to keep all %d pages, got %d", before, hf.NumPages())
+	}
+
+	runSQLForTest(t, bp, c, "vacuum vac_test", noTransaction)
+	after := hf.NumPages()
+	if after >= before/2 {
+		t.Fatalf("expected vacuum to remove most of %d pages, %d remain", before, after)
+	}
+	checkFileSize(t, disk, hf.BackingFile(), int64(after*PageSize))
+	checkFileSize(t, disk, fsmFileName(hf.BackingFile()), int64(after))
+
+	tups := runSQLForTest(t, bp, c, "select count(*), min(id), max(id) from vac_test", noTransaction)
+	if tups[0].Fields[0] != (IntField{100}) || tups[0].Fields[1] != (IntField{500}) || tups[0].Fields[2] != (IntField{vacuumTestRows - 1}) {
+		t.Errorf("unexpected contents after vacuum: %v", tups[0])
+	}
+
+	// moved tuples can still be found through the index
+	_, plan, err := Parse(c, "select pad from vac_test where id = 550")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if findIndexScan(plan) == nil {
+		t.Fatalf("expected the query to use the index")
+	}
+	tups = runQueryForTest(t, bp, plan, noTransaction)
+	if len(tups) != 1 || !strings.HasPrefix(tups[0].Fields[0].(StringField).Value, "550x") {
+		t.Errorf("unexpected index lookup result %v", tups)
+	}
+
+	// the compacted pages are durable
+	bp.FlushAllPages()
+	bp2, hf2 := reopenHeapFileForTest(t, hf)
+	if hf2.NumPages() != after {
+		t.Errorf("expected %d pages after reopening, got %d", after, hf2.NumPages())
+	}
+	if n := len(runQueryForTest(t, bp2, hf2, noTransaction)); n != 100 {
+		t.Errorf("expected 100 tuples after reopening, got %d", n)
+	}
+}
+
+func TestTruncateHeapFile(t *testing.T) {
+	bp, c, disk, _ := newTestDatabase(t, vacuumTestTable...)
+	hf := heapFileForTest(t, c, "vac_test")
+	runSQLForTest(t, bp, c, "truncate table vac_test", noTransaction)
+	if hf.NumPages() != 0 {
+		t.Errorf("expected no pages after truncate, got %d", hf.NumPages())
+	}
+	checkFileSize(t, disk, hf.BackingFile(), 0)
+	for key, pg := range bp.pages {
+		if pg.getFile() == hf {
+			t.Errorf("page %v of the truncated table is still in the buffer pool", key)
+		}
+	}
+	if card := c.GetTableStats("vac_test").EstimateCardinality(1.0); card != 0 {
+		t.Errorf("expected statistics to be recomputed, got cardinality %d", card)
+	}
+
+	runSQLForTest(t, bp, c, "insert into vac_test values (7, 'seven')", noTransaction)
+	tups := runSQLForTest(t, bp, c, "select pad from vac_test where id = 7", noTransaction)
+	if len(tups) != 1 || tups[0].Fields[0] != (StringField{"seven"}) {
+		t.Errorf("unexpected contents after truncate and insert: %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from vac_test where id = 500", noTransaction); len(tups) != 0 {
+		t.Errorf("expected truncate to remove index entries, got %v", tups)
+	}
+
+	if _, _, err := Parse(c, "vacuum no_such_table"); err == nil {
+		t.Errorf("expected vacuum of a missing table to fail")
+	}
+}
+
+func TestTruncateInTransaction(t *testing.T) {
+	bp, c, disk, _ := newTestDatabase(t, vacuumTestTable...)
+	hf := heapFileForTest(t, c, "vac_test")
+	before := hf.NumPages()
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "truncate table vac_test", tid)
+	if _, _, err := ParseInTransaction(c, "vacuum vac_test", tid); err == nil {
+		t.Errorf("expected vacuum inside a transaction to fail")
+	}
+	bp.AbortTransaction(tid)
+	if hf.NumPages() != before {
+		t.Errorf("expected the aborted truncate to keep all %d pages, got %d", before, hf.NumPages())
+	}
+	tups := runSQLForTest(t, bp, c, "select count(*) from vac_test", noTransaction)
+	if tups[0].Fields[0] != (IntField{vacuumTestRows}) {
+		t.Errorf("expected the aborted truncate to restore %d tuples, got %v", vacuumTestRows, tups[0])
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from vac_test where id = 500", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the aborted truncate to restore index entries, got %v", tups)
+	}
+
+	// a committed truncate leaves empty pages, which vacuum removes
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "truncate table vac_test", tid)
+	bp.CommitTransaction(tid)
+	if tups := runSQLForTest(t, bp, c, "select count(*) from vac_test", noTransaction); tups[0].Fields[0] != (IntField{0}) {
+		t.Errorf("expected no tuples after the truncate committed, got %v", tups[0])
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from vac_test where id = 500", noTransaction); len(tups) != 0 {
+		t.Errorf("expected truncate to remove index entries, got %v", tups)
+	}
+	runSQLForTest(t, bp, c, "vacuum vac_test", noTransaction)
+	if hf.NumPages() != 0 {
+		t.Errorf("expected vacuum to remove the pages emptied by truncate, %d remain", hf.NumPages())
+	}
+	checkFileSize(t, disk, hf.BackingFile(), 0)
+}
@@ -0,0 +1,273 @@
+package godb
+
+/*
+views.go implements views, which are named queries that can be used in the
+FROM clause of a query like a table:
+
+	create view big_orders as select o.id, c.name from orders o join customers c on o.cust = c.id where o.total > 100
+	select name from big_orders where id < 10
+	drop view big_orders
+
+The catalog keeps the text of the query of a view, which [parseFrom] parses
+again each time a query uses the view, and plans as a subquery whose alias is
+the name of the view, unless the query gives it an alias of its own. A view
+may use other views, and the tables and views that it uses must exist when it
+is created. A table that a view uses cannot be dropped; if a view that another
+view uses is dropped, queries that use the other view fail.
+
+CREATE VIEW and DROP VIEW are part of the transaction they are run in: they
+write a record with the definition of the view to the log (see ddl.go), so that
+they are undone if the transaction aborts, and recovered after a crash. The
+views are kept in a file next to the catalog file, whose name is that of the
+catalog file with a ".views" suffix, e.g., "catalog.txt.views", with one view
+per line in the form "name as select ...", or "materialized name as select
+..." for a materialized view (see materialized_views.go).
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// A view of the catalog.
+type view struct {
+	name  string
+	query string // the SELECT statement of the view
+
+	// whether the result of the query is stored in a table with the name of
+	// the view (see materialized_views.go)
+	materialized bool
+}
+
+func (v *view) String() string {
+	if v.materialized {
+		return fmt.Sprintf("materialized view %s as %s", v.name, v.query)
+	}
+	return fmt.Sprintf("view %s as %s", v.name, v.query)
+}
+
+// Return the statement of the query of the view.
+func (v *view) parse() (*sqlparser.Select, error) {
+	stmt, err := sqlparser.Parse(v.query)
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid query of view '%s': %s", v.name, err.Error())}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("the query of view '%s' is not a select statement", v.name)}
+	}
+	return sel, nil
+}
+
+// Return the logical plan of the query of the view.
+func (v *view) plan(c *Catalog) (*LogicalPlan, error) {
+	sel, err := v.parse()
+	if err != nil {
+		return nil, err
+	}
+	return parseStatement(c, sel)
+}
+
+// Return the names of the tables and views in the FROM clauses of the query of
+// the view and of its subqueries.
+func (v *view) uses() (map[string]bool, error) {
+	sel, err := v.parse()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if tableEx, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if _, ok := tableEx.Expr.(sqlparser.TableName); ok {
+				names[strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())] = true
+			}
+		}
+		return true, nil
+	}, sel)
+	return names, err
+}
+
+// Add a view with the specified SELECT statement to the catalog on behalf of
+// tid, and log its creation, so that it is removed if tid aborts.
+//
+// Returns an error if a table, index or view with the same name already exists,
+// or the query is not a valid SELECT statement of the tables and views of the
+// catalog.
+func (c *Catalog) createView(tid TransactionID, named string, query string) error {
+	if err := c.checkViewName(named); err != nil {
+		return err
+	}
+	v := &view{named, strings.TrimSpace(query), false}
+	// the query is planned, but not run, to check that it is valid
+	plan, err := v.plan(c)
+	if err != nil {
+		return err
+	}
+	if err := checkNoTemporaryTables(plan); err != nil {
+		return err
+	}
+	if _, err := makePhysicalPlan(c, plan); err != nil {
+		return err
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		return c.addView(tid, v)
+	})
+}
+
+// Add a view to the catalog on behalf of tid, and log its creation, unless
+// there is no transaction.
+func (c *Catalog) addView(tid TransactionID, v *view) error {
+	if tid != noTransaction {
+		if err := c.bufferPool.logFile.logView(CreateViewRecord, tid, v); err != nil {
+			return err
+		}
+		c.viewChanges[tid] = append(c.viewChanges[tid], viewChange{v, false})
+	}
+	c.viewMap[v.name] = v
+	return nil
+}
+
+// Remove a view from the catalog on behalf of tid, and log the drop, unless
+// there is no transaction.
+func (c *Catalog) removeView(tid TransactionID, v *view) error {
+	if tid != noTransaction {
+		if err := c.bufferPool.logFile.logView(DropViewRecord, tid, v); err != nil {
+			return err
+		}
+		c.viewChanges[tid] = append(c.viewChanges[tid], viewChange{v, true})
+	}
+	delete(c.viewMap, v.name)
+	return nil
+}
+
+// Return an error if a view uses the specified table, which cannot be dropped.
+// Views whose query no longer parses are ignored.
+func (c *Catalog) checkNoViewUses(tableName string) error {
+	for _, v := range c.views() {
+		if uses, err := v.uses(); err == nil && uses[tableName] {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop table '%s', which view '%s' uses", tableName, v.name)}
+		}
+	}
+	return nil
+}
+
+// Return an error if a table, index or view with the specified name exists, or
+// a transaction that has not committed dropped a view with the name, which an
+// abort would add back.
+func (c *Catalog) checkViewName(named string) error {
+	if _, ok := c.viewMap[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a view named '%s' already exists", named)}
+	}
+	for _, changes := range c.viewChanges {
+		for _, ch := range changes {
+			if ch.dropped && ch.v.name == named {
+				return GoDBError{DuplicateTableError, fmt.Sprintf("view '%s' was dropped by a transaction that has not committed", named)}
+			}
+		}
+	}
+	if _, ok := c.tableMap[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+	}
+	if _, ok := c.systemTables[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("'%s' is the name of a system table", named)}
+	}
+	if _, ok := c.indexMap[named]; ok {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("an index named '%s' already exists", named)}
+	}
+	return nil
+}
+
+// Remove a view from the catalog on behalf of tid, and log the drop, so that
+// the view is added back if tid aborts. Views that use it are kept, but queries
+// that use them fail.
+func (c *Catalog) dropView(tid TransactionID, named string) error {
+	v, ok := c.viewMap[named]
+	if !ok {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no view named '%s'", named)}
+	}
+	if v.materialized {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("'%s' is a materialized view, and is dropped with DROP MATERIALIZED VIEW", named)}
+	}
+	return c.runDDL(tid, func(tid TransactionID) error {
+		return c.removeView(tid, v)
+	})
+}
+
+// Return the view with the specified name, or nil if there is none.
+func (c *Catalog) getView(named string) *view {
+	return c.viewMap[named]
+}
+
+// Return the views of the catalog, ordered by name.
+func (c *Catalog) views() []*view {
+	views := make([]*view, 0, len(c.viewMap))
+	for _, v := range c.viewMap {
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].name < views[j].name })
+	return views
+}
+
+// Return the name of the file that keeps the views of a catalog file.
+func viewsFile(catalogFile string) string {
+	return catalogFile + ".views"
+}
+
+// Write the views of the catalog to the views file of the catalog file in
+// rootPath, or remove the views file if there are no views.
+func (c *Catalog) saveViews(catalogFile string, rootPath string) error {
+	path := rootPath + "/" + viewsFile(catalogFile)
+	if len(c.viewMap) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	var buf strings.Builder
+	for _, v := range c.views() {
+		if v.materialized {
+			buf.WriteString("materialized ")
+		}
+		fmt.Fprintf(&buf, "%s as %s\n", v.name, v.query)
+	}
+	return os.WriteFile(path, []byte(buf.String()), 0644)
+}
+
+// A line of the views file.
+var viewEntryRe = regexp.MustCompile(`(?is)^\s*(materialized\s+)?(\w+)\s+as\s+(.*\S)\s*$`)
+
+// Read the views of the catalog from the views file of the catalog file, if it
+// has one. The queries of the views are not checked, as the views may use
+// each other, and neither are the tables of the materialized views, which
+// recovery may add to the catalog later.
+func (c *Catalog) loadViews() error {
+	f, err := os.Open(c.rootPath + "/" + viewsFile(c.filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		m := viewEntryRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			return GoDBError{ParseError, fmt.Sprintf("malformed view entry (line %s)", scanner.Text())}
+		}
+		name := strings.ToLower(m[2])
+		c.viewMap[name] = &view{name, m[3], m[1] != ""}
+	}
+	return scanner.Err()
+}
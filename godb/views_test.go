@@ -0,0 +1,173 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestViews(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table customers (id int primary key, name text)", noTransaction)
+	runSQLForTest(t, bp, c, "create table orders (id int primary key, cust int, total int)", noTransaction)
+	for _, sql := range []string{
+		"insert into customers values (1, 'ann')",
+		"insert into customers values (2, 'bob')",
+		"insert into orders values (10, 1, 50)",
+		"insert into orders values (11, 1, 200)",
+		"insert into orders values (12, 2, 300)",
+	} {
+		if _, err := execSQLForTest(t, bp, c, sql, noTransaction); err != nil {
+			t.Fatalf("%s: %s", sql, err.Error())
+		}
+	}
+
+	for _, sql := range []string{
+		"create view big_orders as select o.id as id, c.name as name, o.total as total from orders o join customers c on o.cust = c.id where o.total > 100",
+		"create view ann_orders as select id from big_orders where name = 'ann'",
+	} {
+		if qtype, _, err := Parse(c, sql); err != nil || qtype != CreateViewQueryType {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select name, total from big_orders where id > 11", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (StringField{"bob"}) || tups[0].Fields[1] != (IntField{300}) {
+		t.Errorf("expected the order of bob, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select * from big_orders", noTransaction); len(tups) != 2 || len(tups[0].Fields) != 3 {
+		t.Errorf("expected two orders with three fields, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select b.id from big_orders b join customers c on b.name = c.name where c.id = 2", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{12}) {
+		t.Errorf("expected a join with the view, got %v", tups)
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from ann_orders", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (IntField{11}) {
+		t.Errorf("expected a view of a view, got %v", tups)
+	}
+	// views see the current contents of their tables
+	if _, err := execSQLForTest(t, bp, c, "insert into orders values (13, 1, 400)", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from ann_orders", noTransaction); len(tups) != 2 {
+		t.Errorf("expected the new order in the view, got %v", tups)
+	}
+
+	for _, sql := range []string{
+		"create view big_orders as select id from orders",
+		"create view orders as select id from customers",
+		"create view bad as select id from missing",
+		"create view bad as select missing from orders",
+		"create table big_orders (a int)",
+		"drop view missing",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+	if c.getView("bad") != nil {
+		t.Errorf("expected the invalid views not to be created")
+	}
+	want := "customers(id int not null, name text) primary key (id)\n" +
+		"orders(id int not null, cust int, total int) primary key (id)\n" +
+		"index customers_pkey on customers(id) using btree\n" +
+		"index orders_pkey on orders(id) using btree\n" +
+		"view ann_orders as select id from big_orders where name = 'ann'\n" +
+		"view big_orders as select o.id as id, c.name as name, o.total as total from orders o join customers c on o.cust = c.id where o.total > 100\n"
+	if got := c.String(); got != want {
+		t.Errorf("unexpected catalog:\n%s", got)
+	}
+
+	// the views are kept next to the catalog file
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp2, c2 := openTestDatabase(t, disk, root)
+	if got := c2.String(); got != want {
+		t.Errorf("unexpected catalog after a restart:\n%s", got)
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select id from ann_orders", noTransaction); len(tups) != 2 {
+		t.Errorf("expected the view after a restart, got %v", tups)
+	}
+
+	// a view that uses a dropped view fails
+	if qtype, _, err := Parse(c2, "drop view big_orders"); err != nil || qtype != DropViewQueryType {
+		t.Fatalf("drop view: %v", err)
+	}
+	if _, _, err := Parse(c2, "select id from ann_orders"); err == nil {
+		t.Errorf("expected a query of a view of a dropped view to fail")
+	}
+	runSQLForTest(t, bp2, c2, "drop view ann_orders", noTransaction)
+	if err := c2.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, c3 := openTestDatabase(t, disk, root)
+	if len(c3.views()) != 0 {
+		t.Errorf("expected the dropped views to be gone after a restart, got %v", c3.views())
+	}
+}
+
+func TestViewsInTransaction(t *testing.T) {
+	bp, c, disk, root := newTestDatabase(t)
+	runSQLForTest(t, bp, c, "create table p (id int, name text)", noTransaction)
+	if _, err := execSQLForTest(t, bp, c, "insert into p values (1, 'ann')", noTransaction); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runSQLForTest(t, bp, c, "create view vp as select id from p", noTransaction)
+	if err := c.SaveToFile("catalog.txt", root); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid := BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create table z (a int)", tid)
+	runSQLForTest(t, bp, c, "create view vz as select a from z", tid)
+	runSQLForTest(t, bp, c, "create materialized view mp as select name from p", tid)
+	runSQLForTest(t, bp, c, "drop view vp", tid)
+	if _, _, err := Parse(c, "create view vp as select name from p"); err == nil {
+		t.Errorf("expected an error creating a view whose drop has not committed")
+	}
+	bp.AbortTransaction(tid)
+	for name, want := range map[string]bool{"vp": true, "vz": false, "mp": false} {
+		if got := c.getView(name) != nil; got != want {
+			t.Errorf("view %s: expected it to exist after the abort to be %v", name, want)
+		}
+	}
+	for _, name := range []string{"z", "mp"} {
+		if _, err := c.GetTable(name); err == nil {
+			t.Errorf("expected table %s to be removed by the abort", name)
+		}
+	}
+	if tups := runSQLForTest(t, bp, c, "select id from vp", noTransaction); len(tups) != 1 {
+		t.Errorf("expected the dropped view to be restored by the abort, got %v", tups)
+	}
+
+	// a table that a view uses cannot be dropped
+	if _, _, err := Parse(c, "drop table p"); err == nil {
+		t.Errorf("expected an error dropping a table that a view uses")
+	}
+	runSQLForTest(t, bp, c, "create materialized view mp as select name from p", noTransaction)
+	runSQLForTest(t, bp, c, "create view vmp as select name from mp", noTransaction)
+	if _, _, err := Parse(c, "drop materialized view mp"); err == nil || c.getView("mp") == nil {
+		t.Errorf("expected an error dropping a materialized view that a view uses, and the view to be kept")
+	}
+	runSQLForTest(t, bp, c, "drop view vmp", noTransaction)
+	runSQLForTest(t, bp, c, "drop materialized view mp", noTransaction)
+	if _, _, err := Parse(c, "drop table p"); err == nil {
+		t.Errorf("expected an error dropping a table that a view uses")
+	}
+
+	// views committed after the views file was saved are recovered, and those
+	// of a transaction that did not commit are not
+	runSQLForTest(t, bp, c, "create view vn as select name from p where id = 1", noTransaction)
+	runSQLForTest(t, bp, c, "drop view vp", noTransaction)
+	tid = BeginTransactionForTest(t, bp)
+	runSQLForTest(t, bp, c, "create view vu as select name from p", tid)
+	runSQLForTest(t, bp, c, "drop view vn", tid)
+
+	bp2, c2 := openTestDatabase(t, disk, root)
+	for name, want := range map[string]bool{"vp": false, "vn": true, "vu": false, "mp": false} {
+		if got := c2.getView(name) != nil; got != want {
+			t.Errorf("view %s: expected it to exist after recovery to be %v", name, want)
+		}
+	}
+	if tups := runSQLForTest(t, bp2, c2, "select name from vn", noTransaction); len(tups) != 1 || tups[0].Fields[0] != (StringField{"ann"}) {
+		t.Errorf("expected the recovered view to return ann, got %v", tups)
+	}
+	runSQLForTest(t, bp2, c2, "drop view vn", noTransaction)
+	runSQLForTest(t, bp2, c2, "drop table p", noTransaction)
+}
@@ -19,23 +19,75 @@ var helpText = `Enter a SQL query terminated by a ; to process it.  Commands pre
 Available shell commands:
 	\h : This help
 	\c path/to/catalog : Change the current database to a specified catalog file
-	\d : List tables and fields in the current database
+	\d : List tables, fields, indexes and views in the current database
 	\f : List available functions for use in queries
 	\a : Toggle aligned vs csv output
     \o : Toggle query optimization
-	\l table path/to/file [sep] [hasHeader]: Append csv file to end of table.  Default to sep = ',', hasHeader = 'true'
-	\z : Compute statistics for the database`
+	\l table path/to/file [sep] [hasHeader]: Append csv file to end of table, reporting rejected rows.  Default to sep = ',', hasHeader = 'true'
+	\j table path/to/file.jsonl : Append JSON Lines file to end of table, reporting rejected rows.  Creates the table, inferring its columns from the first lines of the file, if it does not exist
+	\e path/to/file csv|jsonl|tsv query : Write the results of a query to a file, with a header for csv and tsv
+	\z : Compute statistics for the database
+	\verify : Verify the page checksums of every table and report damaged pages`
 
 func printCatalog(c *godb.Catalog) {
 	s := c.CatalogString()
 	fmt.Printf("\033[34m%s\n\033[0m", s)
 }
 
+// Number of lines of a JSON Lines file that the columns of the table that \j
+// creates for it are inferred from.
+const jsonlSampleRows = 100
+
+func printRejectedRows(result *godb.BulkLoadResult) {
+	for _, row := range result.Rejected {
+		fmt.Printf("\033[31;1mrejected %s\033[0m\n", row.String())
+	}
+}
+
+// Write the results of a query to a file, like COPY (query) TO 'path', on
+// behalf of tid, or of a transaction of its own if autocommit is true. Returns
+// the number of tuples that were written.
+func exportQuery(c *godb.Catalog, bp *godb.BufferPool, tid godb.TransactionID, autocommit bool, path string, format string, query string) (int64, error) {
+	header := ", header"
+	if strings.EqualFold(format, "jsonl") {
+		header = ""
+	}
+	copySQL := fmt.Sprintf("copy (%s) to '%s' with (format %s%s)", query, strings.ReplaceAll(path, "'", "''"), format, header)
+	queryType, plan, err := godb.ParseInTransaction(c, copySQL, tid)
+	if err != nil {
+		return 0, err
+	}
+	if queryType != godb.IteratorType {
+		return 0, fmt.Errorf("not a query: %s", query)
+	}
+	if autocommit {
+		tid = godb.NewTID()
+		if err := bp.BeginTransaction(tid); err != nil {
+			return 0, err
+		}
+	}
+	iter, err := plan.Iterator(tid)
+	var tup *godb.Tuple
+	if err == nil {
+		tup, err = iter()
+	}
+	if err != nil {
+		if autocommit {
+			bp.AbortTransaction(tid)
+		}
+		return 0, err
+	}
+	if autocommit {
+		bp.CommitTransaction(tid)
+	}
+	return tup.Fields[0].(godb.IntField).Value, nil
+}
+
 func main() {
 	alarm := make(chan int, 1)
 
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 
 		signal.Notify(c, os.Interrupt, syscall.SIGINT)
 		go func() {
@@ -110,6 +162,8 @@ func main() {
 				pathAr := strings.Split(rest, "/")
 				catName = pathAr[len(pathAr)-1]
 				catPath = strings.Join(pathAr[0:len(pathAr)-1], "/")
+				// the temporary tables of the current database are dropped
+				c.EndSession()
 				c, err = godb.NewCatalogFromFile(catName, bp, catPath)
 				if err != nil {
 					fmt.Printf("failed load catalog, %s\n", err.Error())
@@ -130,17 +184,44 @@ func main() {
 			case 'o':
 				godb.EnableJoinOptimization = !godb.EnableJoinOptimization
 				if godb.EnableJoinOptimization {
-					fmt.Println("\033[32;1mOptimization enabled\033[0m\n\n")
+					fmt.Print("\033[32;1mOptimization enabled\033[0m\n\n\n")
 				} else {
-					fmt.Println("\033[32;1mOptimization disabled\033[0m\n\n")
+					fmt.Print("\033[32;1mOptimization disabled\033[0m\n\n\n")
 				}
 			case 'z':
 				c.ComputeTableStats()
 				fmt.Printf("\033[32;1mAnalysis Complete\033[0m\n\n")
+			case 'v':
+				bad, err := c.VerifyTables()
+				if err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					continue
+				}
+				for _, p := range bad {
+					fmt.Printf("\033[31;1m%s\033[0m\n", p.String())
+				}
+				if len(bad) == 0 {
+					fmt.Printf("\033[32;1mNo damaged pages found\033[0m\n\n")
+				} else {
+					fmt.Printf("\033[31;1m%d damaged pages found\033[0m\n\n", len(bad))
+				}
 			case '?':
 				fallthrough
 			case 'h':
 				fmt.Println(helpText)
+			case 'e':
+				splits := strings.SplitN(text, " ", 4)
+				if len(splits) < 4 {
+					fmt.Printf("\033[31;1mExpected a file, a format and a query after \\e\033[0m\n")
+					continue
+				}
+				query := strings.TrimSuffix(strings.TrimSpace(splits[3]), ";")
+				n, err := exportQuery(c, bp, tid, autocommit, splits[1], splits[2], query)
+				if err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					continue
+				}
+				fmt.Printf("\033[32;1mEXPORT %d\033[0m\n\n", n)
 			case 'l':
 				splits := strings.Split(text, " ")
 				table := splits[1]
@@ -154,25 +235,51 @@ func main() {
 					hasHeader = splits[4] != "false"
 				}
 
-				//todo -- following code assumes data is in heap files
-				hf, err := c.GetTable(table)
+				f, err := os.Open(path)
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
 				}
-				heapFile := hf.(*godb.HeapFile)
-				f, err := os.Open(path)
+				result, err := c.LoadCSV(table, f, sep, hasHeader)
+				f.Close()
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
 				}
-				err = heapFile.LoadFromCSV(f, hasHeader, sep, false)
+				printRejectedRows(result)
+				fmt.Printf("\033[32;1mLOAD %d\033[0m\n\n", result.Loaded)
+			case 'j':
+				splits := strings.Split(text, " ")
+				if len(splits) < 3 {
+					fmt.Printf("\033[31;1mExpected a table and a file after \\j\033[0m\n")
+					continue
+				}
+				table := splits[1]
+				f, err := os.Open(splits[2])
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
 				}
-				bp.FlushAllPages() //gross, if in a transaction, but oh well!
-				fmt.Printf("\033[32;1mLOAD\033[0m\n\n")
+				var result *godb.BulkLoadResult
+				_, err = c.GetTable(table)
+				created := err != nil
+				if created {
+					result, err = c.ImportJSONL(table, f, jsonlSampleRows)
+				} else {
+					result, err = c.LoadJSONL(table, f)
+				}
+				f.Close()
+				if err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					continue
+				}
+				if created {
+					if err := c.SaveToFile(catName, catPath); err != nil {
+						fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					}
+				}
+				printRejectedRows(result)
+				fmt.Printf("\033[32;1mLOAD %d\033[0m\n\n", result.Loaded)
 			}
 
 			query = ""
@@ -191,7 +298,14 @@ func main() {
 			explain = true
 		}
 
-		queryType, plan, err := godb.Parse(c, query)
+		var queryType godb.QueryType
+		var plan godb.Operator
+		if autocommit {
+			queryType, plan, err = godb.Parse(c, query)
+		} else {
+			// CREATE TABLE and DROP TABLE are undone if the transaction aborts
+			queryType, plan, err = godb.ParseInTransaction(c, query, tid)
+		}
 		query = ""
 		nresults := 0
 
@@ -296,6 +410,10 @@ func main() {
 			bp.AbortTransaction(tid)
 			autocommit = true
 			fmt.Printf("\033[32;1mABORT\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		case godb.CommitXactionType:
 			if autocommit {
 				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot commit transaction unless in transaction")
@@ -304,6 +422,10 @@ func main() {
 			bp.CommitTransaction(tid)
 			autocommit = true
 			fmt.Printf("\033[32;1mCOMMIT\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		case godb.CreateTableQueryType:
 			fmt.Printf("\033[32;1mCREATE\033[0m\n\n")
 			err := c.SaveToFile(catName, catPath)
@@ -316,6 +438,47 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.CreateIndexQueryType:
+			fmt.Printf("\033[32;1mCREATE INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropIndexQueryType:
+			fmt.Printf("\033[32;1mDROP INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.AlterTableQueryType:
+			fmt.Printf("\033[32;1mALTER\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.CreateViewQueryType:
+			fmt.Printf("\033[32;1mCREATE VIEW\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropViewQueryType:
+			fmt.Printf("\033[32;1mDROP VIEW\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.RefreshViewQueryType:
+			fmt.Printf("\033[32;1mREFRESH\033[0m\n\n")
+		case godb.CopyQueryType:
+			result := plan.(*godb.BulkLoadResult)
+			printRejectedRows(result)
+			fmt.Printf("\033[32;1mCOPY %d\033[0m\n\n", result.Loaded)
+		case godb.VacuumQueryType:
+			fmt.Printf("\033[32;1mVACUUM\033[0m\n\n")
+		case godb.TruncateQueryType:
+			fmt.Printf("\033[32;1mTRUNCATE\033[0m\n\n")
 		}
 	}
+	c.EndSession()
 }